@@ -0,0 +1,90 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// an array of strings; converts:
+// ["ab", "c"]
+// =>
+// la $t0, strings3
+// with the strings, followed by the table of their addresses, in
+// the data section:
+// string1: .asciiz "ab"
+// string2: .asciiz "c"
+// strings3: .word string1, string2
+// the table comes after the strings, so that their labels are
+// defined by the time it refers to them (see 'layout_data'); the
+// strings stay writable, since indexing can pass them anywhere
+func (backend *MIPSBackend) string_array(node *StringArray) {
+    var labels []string
+    for _, value := range node.values {
+        var label string = backend.__string_label()
+        backend.__emit_string(label, value, false)
+        labels = append(labels, label)
+    }
+    var table string = fmt.Sprintf("strings%d", backend.data_temp_name)
+    backend.data_temp_name++
+    backend.__emit_data(DataItem{fmt.Sprintf("%s: .word %s", table, strings.Join(labels, ", ")), ""})
+    var register string = backend.__temp_register()
+    backend.stack.push(register)
+    backend.__emit_address(register, table)
+}
+
+// an element of a string array; converts:
+// a[i]
+// =>
+// <code for a>
+// <code for i>
+// sll $t1, $t1, 2
+// addu $t1, $t0, $t1
+// lw $t1, 0($t1)
+// such that $t0 is a's register, and $t1 is i's; small integer
+// indices become the offset of the load instead:
+// a[3]
+// =>
+// <code for a>
+// lw $t0, 12($t0)
+// there are no bounds checks
+func (backend *MIPSBackend) index_table(node *Index) {
+    if index, ok := backend.__fold_size(node.index).(Integer); ok {
+        value, err := strconv.ParseInt(index.value, 0, 64)
+        if err == nil && value >= -(max_offset+1)/4 && value <= max_offset/4 {
+            backend.codegen(node.value)
+            var register string = backend.__peek()
+            backend.__emit_main("lw", register, fmt.Sprintf("%d(%s)", 4*value, register), "")
+            return
+        }
+    }
+    backend.codegen(node.value)
+    backend.codegen(node.index)
+    var registers []string = backend.__pop_n(2)
+    backend.__emit_main("sll", registers[1], registers[1], "2")
+    backend.__emit_main("addu", registers[1], registers[0], registers[1])
+    backend.__emit_main("lw", registers[1], fmt.Sprintf("0(%s)", registers[1]), "")
+    backend.__free(registers[0])
+    backend.stack.push(registers[1])
+}
+
+// returns the labels a line of a data section refers to (the
+// items of its '.word's that aren't numbers); converts:
+// strings3: .word string1, string2
+// =>
+// string1, string2
+func data_references(line string) (ret []string) {
+    if _, rest, ok := strings.Cut(strings.TrimSpace(strip_comment(line)), ":"); ok {
+        line = rest
+    }
+    rest, ok := strings.CutPrefix(strings.TrimSpace(line), ".word")
+    if !ok {
+        return nil
+    }
+    for _, item := range strings.Split(rest, ",") {
+        if _, ok := parse_immediate(strings.TrimSpace(item)); !ok {
+            ret = append(ret, strings.TrimSpace(item))
+        }
+    }
+    return
+}
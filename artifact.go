@@ -0,0 +1,147 @@
+package main
+
+import (
+    "encoding/json"
+    "sort"
+    "strings"
+)
+
+// a label of the generated code; the offset is from the start of
+// its section, since the assembler decides where sections go
+type Symbol struct {
+    name string
+    // "text", "rodata", "data", or "bss" (offsets are from the
+    // start of each)
+    section string
+    // "procedure" (its entry point), "label" (e.g. a branch
+    // target), or "data"
+    kind   string
+    offset uint32
+}
+
+// where a variable lives in the frame of a procedure
+type StackSlot struct {
+    procedure string
+    name      string
+    // e.g. "-8($sp)"
+    location string
+}
+
+// everything a compilation produced, for tools that want more than
+// the assembly (e.g. 'serve', or '-artifact'); the assembly is empty
+// if the program has errors
+type Artifact struct {
+    assembly    string
+    symbols     []Symbol
+    stack_slots []StackSlot
+    stats       Stats
+    diagnostics []Diagnostic
+}
+
+// records the slot a variable of the current procedure just got
+func (backend *MIPSBackend) __record_slot(name string) {
+    var procedure string = backend.current_function
+    if procedure == "" {
+        procedure = "main"
+    }
+    backend.stack_slots = append(backend.stack_slots, StackSlot{procedure, name, backend.access_loc[name]})
+}
+
+// returns the labels of the text and data sections, in order
+func (backend *MIPSBackend) symbols() []Symbol {
+    var (
+        symbols []Symbol
+        offset  uint32
+        unknown = func(string) uint32 { return 0 }
+    )
+    for _, procedure := range backend.text_procedures(true) {
+        for i, instruction := range procedure.instructions() {
+            if !strings.HasSuffix(instruction.opcode, ":") {
+                offset += uint32(4 * len(expand(instruction, unknown)))
+                continue
+            }
+            var kind string = "label"
+            if i == 0 {
+                kind = "procedure"
+            }
+            symbols = append(symbols, Symbol{strings.TrimSuffix(instruction.opcode, ":"), "text", kind, offset})
+        }
+    }
+    for _, section := range []string{"rodata", "data", "bss"} {
+        var (
+            labels map[string]uint32 = map[string]uint32{}
+            data   []Symbol
+        )
+        layout_data(map[string]string{"rodata": backend.rodata_section, "data": backend.data_section,
+            "bss": backend.bss_section}[section],
+            0, labels, backend.byte_order())
+        for label, offset := range labels {
+            data = append(data, Symbol{label, section, "data", offset})
+        }
+        // the same order as the section
+        sort.Slice(data, func(i, j int) bool {
+            return data[i].offset < data[j].offset || data[i].offset == data[j].offset && data[i].name < data[j].name
+        })
+        symbols = append(symbols, data...)
+    }
+    return symbols
+}
+
+// returns the artifact of a backend that finished generating
+// (see 'generate')
+func (backend *MIPSBackend) artifact() Artifact {
+    return Artifact{backend.assemble(), backend.symbols(), backend.stack_slots, backend.stats(), backend.diagnostics.reported}
+}
+
+// the JSON of an artifact; e.g.:
+// {"assembly": "...", "ok": true, "diagnostics": ["Warning: ..."],
+//  "symbols": [{"name": "main", "section": "text", "kind": "procedure", "offset": 0}, ...],
+//  "stack_slots": [{"procedure": "main", "name": "a", "location": "-4($sp)"}, ...],
+//  "stats": {"instructions": 12, "opcodes": {"li": 2, ...}, ...}}
+// the diagnostics are written like 'Diagnostic.String'
+func (artifact Artifact) MarshalJSON() ([]byte, error) {
+    var (
+        diagnostics []string                 = []string{}
+        symbols     []map[string]interface{} = []map[string]interface{}{}
+        stack_slots []map[string]interface{} = []map[string]interface{}{}
+        stats       map[string]interface{}
+    )
+    for _, diagnostic := range artifact.diagnostics {
+        diagnostics = append(diagnostics, diagnostic.String())
+    }
+    for _, symbol := range artifact.symbols {
+        symbols = append(symbols, map[string]interface{}{
+            "name": symbol.name, "section": symbol.section, "kind": symbol.kind, "offset": symbol.offset})
+    }
+    for _, slot := range artifact.stack_slots {
+        stack_slots = append(stack_slots, map[string]interface{}{
+            "procedure": slot.procedure, "name": slot.name, "location": slot.location})
+    }
+    if artifact.assembly != "" {
+        var total int
+        for _, count := range artifact.stats.opcodes {
+            total += count
+        }
+        stats = map[string]interface{}{
+            "instructions":      total,
+            "opcodes":           artifact.stats.opcodes,
+            "loads":             artifact.stats.loads,
+            "stores":            artifact.stats.stores,
+            "data_bytes":        artifact.stats.data_bytes,
+            "cycles":            artifact.stats.cycles,
+            "register_pressure": artifact.stats.pressure,
+            "taken_branches":    artifact.stats.taken_branches,
+        }
+        if artifact.stats.taken_before_layout != -1 {
+            stats["taken_before_layout"] = artifact.stats.taken_before_layout
+        }
+    }
+    return json.Marshal(map[string]interface{}{
+        "assembly":    artifact.assembly,
+        "ok":          artifact.assembly != "",
+        "diagnostics": diagnostics,
+        "symbols":     symbols,
+        "stack_slots": stack_slots,
+        "stats":       stats,
+    })
+}
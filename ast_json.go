@@ -0,0 +1,435 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// what 'AstDecoder' panics with when the JSON doesn't match
+// the shape of an ast; 'decode_ast' returns it as an error
+type DecodeError struct {
+    path    string
+    message string
+}
+
+func (err DecodeError) Error() string {
+    return fmt.Sprintf("%s: %s", err.path, err.message)
+}
+
+// the state of decoding an ast from JSON
+type AstDecoder struct {
+    // stops decoding once it's done (see 'Cancelled')
+    context context.Context
+}
+
+// panics with a 'DecodeError' at 'path'
+func (decoder *AstDecoder) fail(path string, format string, args ...interface{}) {
+    panic(DecodeError{path, fmt.Sprintf(format, args...)})
+}
+
+// returns the fields of a JSON object
+func (decoder *AstDecoder) object(value interface{}, path string) map[string]interface{} {
+    object, ok := value.(map[string]interface{})
+    if !ok {
+        decoder.fail(path, "expected an object, got %s", json_type(value))
+    }
+    return object
+}
+
+// returns a JSON string; a missing field is an empty
+// string, which 'validate' reports if it matters
+func (decoder *AstDecoder) string(value interface{}, path string) string {
+    switch value := value.(type) {
+    case nil:
+        return ""
+    case string:
+        return value
+    }
+    decoder.fail(path, "expected a string, got %s", json_type(value))
+    return ""
+}
+
+// returns a number, written as a JSON number or a string (e.g.
+// "0x10"); floating-point literals are read the same way
+func (decoder *AstDecoder) integer(value interface{}, path string) string {
+    if number, ok := value.(json.Number); ok {
+        return number.String()
+    }
+    return decoder.string(value, path)
+}
+
+// returns a JSON array of strings (or of integers, when
+// 'read' is 'integer')
+func (decoder *AstDecoder) strings(value interface{}, path string,
+    read func(decoder *AstDecoder, value interface{}, path string) string) (ret []string) {
+    for i, item := range decoder.array(value, path) {
+        ret = append(ret, read(decoder, item, fmt.Sprintf("%s[%d]", path, i)))
+    }
+    return
+}
+
+// returns a JSON boolean (false if it's missing)
+func (decoder *AstDecoder) boolean(value interface{}, path string) bool {
+    if value == nil {
+        return false
+    }
+    boolean, ok := value.(bool)
+    if !ok {
+        decoder.fail(path, "expected a boolean, got %s", json_type(value))
+    }
+    return boolean
+}
+
+// returns the items of a JSON array (nil if it's missing)
+func (decoder *AstDecoder) array(value interface{}, path string) []interface{} {
+    if value == nil {
+        return nil
+    }
+    array, ok := value.([]interface{})
+    if !ok {
+        decoder.fail(path, "expected an array, got %s", json_type(value))
+    }
+    return array
+}
+
+// returns the nodes of a JSON array
+func (decoder *AstDecoder) nodes(value interface{}, path string) (ret []interface{}) {
+    for i, item := range decoder.array(value, path) {
+        ret = append(ret, decoder.node(item, fmt.Sprintf("%s[%d]", path, i)))
+    }
+    return
+}
+
+// returns the parts of an interpolated string (see 'parse_interp')
+func (decoder *AstDecoder) interp(text string, path string) Interp {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            message, ok := recovered.(string)
+            if !ok {
+                panic(recovered)
+            }
+            decoder.fail(path, "%s", message)
+        }
+    }()
+    return parse_interp(text)
+}
+
+// returns the node a JSON object describes; null is nil (e.g.
+// the value of a 'return' without one)
+func (decoder *AstDecoder) node(value interface{}, path string) interface{} {
+    if value == nil {
+        return nil
+    }
+    check_cancelled(decoder.context)
+    var (
+        fields map[string]interface{} = decoder.object(value, path)
+        kind   string                 = decoder.string(fields["node"], path+".node")
+        field                         = func(name string) (interface{}, string) {
+            return fields[name], path + "." + name
+        }
+    )
+    switch kind {
+    case "Program":
+        return Program{decoder.nodes(field("nodes"))}
+    case "Ident":
+        return Ident{decoder.string(field("name"))}
+    case "Integer":
+        return Integer{decoder.integer(field("value"))}
+    case "String":
+        return String{decoder.string(field("value"))}
+    case "Float":
+        return Float{decoder.integer(field("value")), decoder.boolean(field("double"))}
+    case "StringArray":
+        return StringArray{decoder.strings(fields["values"], path+".values", (*AstDecoder).string)}
+    case "ArithmeticOp":
+        return ArithmeticOp{decoder.node(field("left")), decoder.string(field("op")), decoder.node(field("right"))}
+    case "Assignment":
+        return Assignment{decoder.string(field("name")), decoder.node(field("value"))}
+    case "Let":
+        return Let{decoder.string(field("name")), decoder.node(field("value"))}
+    case "Var":
+        return Var{decoder.string(field("name")), decoder.node(field("value"))}
+    case "ExprStmt":
+        return ExprStmt{decoder.node(field("value"))}
+    case "Call":
+        return Call{decoder.string(field("name")), decoder.nodes(field("args"))}
+    case "Function":
+        return Function{decoder.string(field("name")), decoder.strings(fields["params"], path+".params", (*AstDecoder).string),
+            decoder.nodes(field("body")), decoder.boolean(field("variadic"))}
+    case "VarArg":
+        return VarArg{decoder.node(field("index"))}
+    case "Return":
+        return Return{decoder.node(field("value"))}
+    case "If":
+        return If{decoder.node(field("cond")), decoder.nodes(field("then")), decoder.nodes(field("otherwise"))}
+    case "Hint":
+        return Hint{decoder.node(field("cond")), decoder.boolean(field("likely"))}
+    case "Cast":
+        return Cast{decoder.node(field("value")), decoder.string(field("to"))}
+    case "Index":
+        return Index{decoder.node(field("value")), decoder.node(field("index"))}
+    case "Slice":
+        return Slice{decoder.node(field("value")), decoder.node(field("low")), decoder.node(field("high"))}
+    case "Interp":
+        if _, ok := fields["text"]; ok {
+            // written out, e.g. "x = {x}"
+            return decoder.interp(decoder.string(field("text")), path+".text")
+        }
+        return Interp{decoder.nodes(field("parts"))}
+    case "Static":
+        return Static{decoder.string(field("name")), decoder.string(field("kind")), decoder.integer(field("value"))}
+    case "ExceptionHandler":
+        return ExceptionHandler{decoder.nodes(field("nodes"))}
+    case "Section":
+        return Section{decoder.string(field("name")), decoder.integer(field("address")),
+            decoder.strings(fields["functions"], path+".functions", (*AstDecoder).string)}
+    case "Raw":
+        return Raw{decoder.string(field("placement")), decoder.strings(fields["lines"], path+".lines", (*AstDecoder).string)}
+    case "Enum":
+        return Enum{decoder.string(field("name")), decoder.strings(fields["members"], path+".members", (*AstDecoder).string),
+            decoder.strings(fields["values"], path+".values", (*AstDecoder).integer)}
+    }
+    decoder.fail(path+".node", "unknown node type '%s'", kind)
+    return nil
+}
+
+// returns the name of a JSON value's type, for errors
+func json_type(value interface{}) string {
+    switch value.(type) {
+    case nil:
+        return "null"
+    case map[string]interface{}:
+        return "an object"
+    case []interface{}:
+        return "an array"
+    case string:
+        return "a string"
+    case json.Number:
+        return "a number"
+    case bool:
+        return "a boolean"
+    }
+    return fmt.Sprintf("%T", value)
+}
+
+// reads an ast from JSON, where each node is an object with its
+// type and its fields (named like the struct's); converts:
+// {"node": "Assignment", "name": "a", "value": {"node": "Integer", "value": 5}}
+// =>
+// Assignment{"a", Integer{"5"}}
+// missing fields are left empty; the result still has to pass
+// 'validate' (which 'lower' does)
+func decode_ast(data []byte) (interface{}, error) {
+    return decode_ast_with(context.Background(), data)
+}
+
+// 'decode_ast' that gives up (returning the 'Cancelled') once
+// the context is done
+func decode_ast_with(ctx context.Context, data []byte) (ast interface{}, err error) {
+    var (
+        decoder *json.Decoder = json.NewDecoder(bytes.NewReader(data))
+        value   interface{}
+    )
+    // keeps integers exactly as they're written
+    decoder.UseNumber()
+    if err := decoder.Decode(&value); err != nil {
+        return nil, err
+    }
+    var ast_decoder AstDecoder = AstDecoder{ctx}
+    return ast_decoder.decode(value, "$")
+}
+
+// returns the node a JSON value (as 'encoding/json' decodes it)
+// describes, or the 'DecodeError' (or 'Cancelled') it failed with
+func (decoder *AstDecoder) decode(value interface{}, path string) (ast interface{}, err error) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            switch recovered := recovered.(type) {
+            case DecodeError:
+                ast, err = nil, recovered
+            case Cancelled:
+                ast, err = nil, recovered
+            default:
+                panic(recovered)
+            }
+        }
+    }()
+    return decoder.node(value, path), nil
+}
+
+// returns a string as JSON, without escaping HTML characters
+// (which is all 'json.Marshal' would do differently)
+func json_string(value string) string {
+    var buffer bytes.Buffer
+    var encoder *json.Encoder = json.NewEncoder(&buffer)
+    encoder.SetEscapeHTML(false)
+    encoder.Encode(value)
+    return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// returns an integer literal as JSON; decimal ones are numbers,
+// and the rest (e.g. "0x10") stay strings
+func json_integer(value string) string {
+    if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && fmt.Sprint(parsed) == value {
+        return value
+    }
+    return json_string(value)
+}
+
+// returns a floating-point literal as JSON; the ones that are
+// valid JSON numbers are numbers, and the rest (e.g. ".5") stay
+// strings
+func json_float(value string) string {
+    if _, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+        return value
+    }
+    return json_string(value)
+}
+
+// returns a list of strings as JSON, on one line
+func json_strings(values []string, encode func(value string) string) string {
+    var items []string
+    for _, value := range values {
+        items = append(items, encode(value))
+    }
+    return "[" + strings.Join(items, ", ") + "]"
+}
+
+// returns a node as JSON (see 'encode_ast'); 'indent' is the
+// indentation of the line it starts on
+func encode_node(__node interface{}, indent string) string {
+    var fields []string = []string{fmt.Sprintf(`"node": "%s"`, node_type(__node))}
+    // adds a field, unless it's empty (which decodes the same)
+    var field = func(name string, value string) {
+        if value != "" && value != `""` && value != "[]" {
+            fields = append(fields, fmt.Sprintf(`"%s": %s`, name, value))
+        }
+    }
+    // returns expressions on one line
+    var inline = func(nodes []interface{}) string {
+        var items []string
+        for _, node := range nodes {
+            items = append(items, encode_node(node, indent))
+        }
+        return "[" + strings.Join(items, ", ") + "]"
+    }
+    // returns statements on a line each
+    var block = func(nodes []interface{}) string {
+        if len(nodes) == 0 {
+            return ""
+        }
+        var items []string
+        for _, node := range nodes {
+            items = append(items, indent+"    "+encode_node(node, indent+"    "))
+        }
+        return "[\n" + strings.Join(items, ",\n") + "\n" + indent + "]"
+    }
+    var boolean = func(value bool) string {
+        if value {
+            return "true"
+        }
+        return ""
+    }
+    switch node := __node.(type) {
+    case nil:
+        return "null"
+    case Program:
+        field("nodes", block(node.nodes))
+    case Ident:
+        field("name", json_string(node.name))
+    case Integer:
+        field("value", json_integer(node.value))
+    case String:
+        field("value", json_string(node.value))
+    case StringArray:
+        field("values", json_strings(node.values, json_string))
+    case Float:
+        field("value", json_float(node.value))
+        field("double", boolean(node.double))
+    case ArithmeticOp:
+        field("left", encode_node(node.left, indent))
+        field("op", json_string(node.op))
+        field("right", encode_node(node.right, indent))
+    case Assignment:
+        field("name", json_string(node.name))
+        field("value", encode_node(node.value, indent))
+    case Let:
+        field("name", json_string(node.name))
+        field("value", encode_node(node.value, indent))
+    case Var:
+        field("name", json_string(node.name))
+        field("value", encode_node(node.value, indent))
+    case ExprStmt:
+        field("value", encode_node(node.value, indent))
+    case Call:
+        field("name", json_string(node.name))
+        field("args", inline(node.args))
+    case Function:
+        field("name", json_string(node.name))
+        field("params", json_strings(node.params, json_string))
+        field("body", block(node.body))
+        field("variadic", boolean(node.variadic))
+    case VarArg:
+        field("index", encode_node(node.index, indent))
+    case Return:
+        if node.value != nil {
+            field("value", encode_node(node.value, indent))
+        }
+    case If:
+        field("cond", encode_node(node.cond, indent))
+        field("then", block(node.then))
+        field("otherwise", block(node.otherwise))
+    case Hint:
+        field("cond", encode_node(node.cond, indent))
+        field("likely", boolean(node.likely))
+    case Cast:
+        field("value", encode_node(node.value, indent))
+        field("to", json_string(node.to))
+    case Index:
+        field("value", encode_node(node.value, indent))
+        field("index", encode_node(node.index, indent))
+    case Slice:
+        field("value", encode_node(node.value, indent))
+        field("low", encode_node(node.low, indent))
+        field("high", encode_node(node.high, indent))
+    case Interp:
+        field("parts", inline(node.parts))
+    case Static:
+        field("name", json_string(node.name))
+        field("kind", json_string(node.kind))
+        field("value", json_integer(node.value))
+    case ExceptionHandler:
+        field("nodes", block(node.nodes))
+    case Section:
+        field("name", json_string(node.name))
+        field("address", json_integer(node.address))
+        field("functions", json_strings(node.functions, json_string))
+    case Raw:
+        field("placement", json_string(node.placement))
+        field("lines", json_strings(node.lines, json_string))
+    case Enum:
+        field("name", json_string(node.name))
+        field("members", json_strings(node.members, json_string))
+        field("values", json_strings(node.values, json_integer))
+    default:
+        panic(fmt.Sprintf("can't encode a %s as JSON", node_type(__node)))
+    }
+    return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// returns an ast as JSON that 'decode_ast' reads back; the fields
+// are in the order of the struct's, empty ones are left out, and
+// statements get a line each while expressions stay on the line of
+// their statement; converts:
+// Program{[]interface{}{Assignment{"a", Integer{"5"}}}}
+// =>
+// {"node": "Program", "nodes": [
+//     {"node": "Assignment", "name": "a", "value": {"node": "Integer", "value": 5}}
+// ]}
+func encode_ast(ast interface{}) string {
+    return encode_node(ast, "") + "\n"
+}
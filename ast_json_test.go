@@ -0,0 +1,107 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// a program with every kind of node, where every list that
+// isn't empty is non-nil (decoding leaves missing ones nil)
+var every_node Program = Program{[]interface{}{
+    Static{"limit", "int16", "-3"},
+    Static{"flags", "uint16", "0xffff"},
+    Enum{"Colour", []string{"red", "green", "blue"}, []string{"", "0x10", ""}},
+    Section{".text.fast", "0x1000", []string{"f"}},
+    Raw{"data", []string{"padding: .space 4 # <raw>"}},
+    Function{"f", []string{"x", "y"}, []interface{}{
+        Let{"z", ArithmeticOp{Ident{"x"}, "mul", Ident{"y"}}},
+        If{Hint{ArithmeticOp{Ident{"z"}, "slt", Integer{"0"}}, false}, []interface{}{Return{Integer{"0"}}}, nil},
+        Return{Ident{"z"}},
+    }, false},
+    Function{"count", []string{"n"}, []interface{}{Return{VarArg{Ident{"n"}}}}, true},
+    Function{"nothing", nil, []interface{}{Return{nil}}, false},
+    Var{"names", StringArray{[]string{"a \"quoted\" name", "<html> & tabs\t"}}},
+    Assignment{"h", Float{"0.5", false}},
+    Assignment{"d", Float{".25", true}},
+    Assignment{"c", Cast{Call{"f", []interface{}{Integer{"-7"}, Ident{"limit"}}}, "uint8"}},
+    Assignment{"s", Index{Ident{"names"}, Integer{"1"}}},
+    Assignment{"t", Slice{Ident{"s"}, Integer{"1"}, Ident{"c"}}},
+    If{Ident{"c"}, []interface{}{ExprStmt{Call{"count", []interface{}{Integer{"1"}, Integer{"2"}}}}},
+        []interface{}{Assignment{"c", Ident{"green"}}}},
+    ExceptionHandler{[]interface{}{Assignment{"e", Call{"exception_cause", nil}}}},
+    Call{"Printf", []interface{}{Interp{[]interface{}{String{"c = "}, Ident{"c"}, String{"\\n"}}}}},
+}}
+
+// encoding an ast and decoding it gives back the same ast, which
+// still passes 'validate'; an invalid one keeps its violations
+func Test_ast_round_trip(t *testing.T) {
+    var invalid Program = Program{[]interface{}{
+        Assignment{"a", ArithmeticOp{nil, "pow", Integer{"x"}}},
+        Static{"", "word", "99999999999"},
+        Call{"", []interface{}{Cast{nil, "int24"}}},
+    }}
+    for _, program := range []Program{every_node, invalid} {
+        var (
+            data     string      = encode_ast(program)
+            expected []Violation = validate(program)
+        )
+        ast, err := decode_ast([]byte(data))
+        if err != nil {
+            t.Fatalf("%s\ndidn't decode: %v", data, err)
+        }
+        if !reflect.DeepEqual(ast, program) {
+            t.Errorf("%s\ndecoded to %#v", data, ast)
+        }
+        if violations := validate(ast); !reflect.DeepEqual(violations, expected) {
+            t.Errorf("%s\nhas the violations %v, expected %v", data, violations, expected)
+        }
+        if again := encode_ast(ast); again != data {
+            t.Errorf("encoding it again gave\n%s\ninstead of\n%s", again, data)
+        }
+    }
+    if violations := validate(every_node); len(violations) != 0 {
+        t.Errorf("the program with every node has the violations %v", violations)
+    }
+}
+
+// missing fields decode as empty ones, integers keep how they're
+// written, and whatever doesn't match the shape of an ast fails
+// with the path to it
+func Test_decode_ast(t *testing.T) {
+    ast, err := decode_ast([]byte(`{"node": "Program", "nodes": [
+        {"node": "Assignment", "name": "a", "value": {"node": "Integer", "value": "0x10"}},
+        {"node": "Assignment", "name": "b", "value": {"node": "Integer", "value": 12345678901234567890}},
+        {"node": "Return", "value": null},
+        {"node": "Function", "name": "f"}
+    ]}`))
+    var expected Program = Program{[]interface{}{
+        Assignment{"a", Integer{"0x10"}},
+        Assignment{"b", Integer{"12345678901234567890"}},
+        Return{nil},
+        Function{"f", nil, nil, false},
+    }}
+    if err != nil || !reflect.DeepEqual(ast, expected) {
+        t.Errorf("decoded to %#v (%v)", ast, err)
+    }
+    var cases = map[string]string{
+        `[]`:                                                                             "$: expected an object, got an array",
+        `{"name": "a"}`:                                                                  "$.node: unknown node type ''",
+        `{"node": 5}`:                                                                    "$.node: expected a string, got a number",
+        `{"node": "Loop"}`:                                                               "$.node: unknown node type 'Loop'",
+        `{"node": "Program", "nodes": {}}`:                                               "$.nodes: expected an array, got an object",
+        `{"node": "Program", "nodes": ["a"]}`:                                            "$.nodes[0]: expected an object, got a string",
+        `{"node": "Call", "name": "f", "args": [null, {"node": "Ident", "name": true}]}`: "$.args[1].name: expected a string, got a boolean",
+        `{"node": "Function", "params": ["x", 1]}`:                                       "$.params[1]: expected a string, got a number",
+        `{"node": "Float", "double": "yes"}`:                                             "$.double: expected a boolean, got a string",
+        `{"node": "Enum", "values": [1, null, [2]]}`:                                     "$.values[2]: expected a string, got an array",
+    }
+    for data, expected := range cases {
+        if ast, err := decode_ast([]byte(data)); err == nil || err.Error() != expected {
+            t.Errorf("%s decoded to %v (%v), expected the error %q", data, ast, err, expected)
+        }
+    }
+    if _, err := decode_ast([]byte(`{"node": "Program"`)); err == nil || !strings.Contains(err.Error(), "EOF") {
+        t.Errorf("truncated JSON failed with %v", err)
+    }
+}
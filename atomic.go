@@ -0,0 +1,92 @@
+package main
+
+import (
+    "fmt"
+)
+
+// AtomicAdd(x, delta) => int
+// CompareAndSwap(x, expected, new) => int
+// where 'x' must be a variable; converts:
+// AtomicAdd(x, 1)
+// =>
+// li $t0, 1
+// atomic1:
+// ll $t1, -4($sp)
+// addu $t2, $t1, $t0
+// sc $t2, -4($sp)
+// beq $t2, $0, atomic1
+// such that -4 is x's offset from the stack pointer; the result
+// is the old value ($t1). 'CompareAndSwap' stores 'new' only if
+// x holds 'expected', and returns 1 if it did (0 otherwise):
+// CompareAndSwap(x, 1, 2)
+// =>
+// li $t0, 1
+// li $t1, 2
+// atomic1:
+// ll $t2, -4($sp)
+// bne $t2, $t0, atomic2
+// move $t3, $t1
+// sc $t3, -4($sp)
+// beq $t3, $0, atomic1
+// j atomic3
+// atomic2:
+// li $t3, 0
+// atomic3:
+func (backend *MIPSBackend) atomic(node *Call) {
+    var arity int = 2
+    if node.name == "CompareAndSwap" {
+        arity = 3
+    }
+    if len(node.args) != arity {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d", node.name, arity, len(node.args)))
+    }
+    backend.__require_capability("ll_sc", node.name)
+    target, ok := node.args[0].(Ident)
+    if !ok {
+        panic(fmt.Sprintf("the first argument of '%s' must be a variable", node.name))
+    }
+    if _, ok := backend.statics[target.name]; ok {
+        panic(fmt.Sprintf("'%s' can't be used on static '%s'", node.name, target.name))
+    }
+    location, ok := backend.access_loc[target.name]
+    if !ok {
+        panic(fmt.Sprintf("undefined variable '%s'", target.name))
+    }
+    for i := range node.args {
+        backend.__expect_type(node, i, "int")
+    }
+    for _, arg := range node.args[1:] {
+        backend.codegen(arg)
+    }
+    var (
+        registers    []string = backend.__pop_n(arity - 1)
+        old_register string   = backend.__temp_register()
+        new_register string   = backend.__temp_register()
+        retry        string   = backend.__new_label("atomic")
+    )
+    backend.__emit_label(retry)
+    backend.__emit_main("ll", old_register, location, "")
+    if node.name == "AtomicAdd" {
+        backend.__emit_main("addu", new_register, old_register, registers[0])
+        backend.__emit_main("sc", new_register, location, "")
+        // sc leaves 0 in the register if another write got in first
+        backend.__emit_main("beq", new_register, "$0", retry)
+        backend.__free(append(registers, new_register)...)
+        backend.stack.push(old_register)
+        return
+    }
+    var (
+        fail string = backend.__new_label("atomic")
+        done string = backend.__new_label("atomic")
+    )
+    backend.__emit_main("bne", old_register, registers[0], fail)
+    backend.__emit_main("move", new_register, registers[1], "")
+    backend.__emit_main("sc", new_register, location, "")
+    backend.__emit_main("beq", new_register, "$0", retry)
+    backend.__emit_main("j", done, "", "")
+    backend.__emit_label(fail)
+    backend.__emit_main("li", new_register, "0", "")
+    backend.__emit_label(done)
+    backend.__free(append(registers, old_register)...)
+    backend.stack.push(new_register)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+    "fmt"
+)
+
+// the label bare-metal programs spin at once main is done
+const bare_metal_halt string = "__scg_halt"
+
+// returns the scaffold for a target without an operating system
+// (see the "bare_metal" capability), which the program is the
+// first thing in memory for, e.g. as a flat binary (see
+// 'assemble_binary') loaded by a minimal emulator; main starts
+// with the entry point, which sets up $sp and zeroes the bss (a
+// flat binary doesn't have its bytes), and ends by spinning, since
+// it has nothing to return to. converts:
+// main:
+// <body>
+// =>
+// main:
+// .globl _start
+// _start:
+// li $sp, 0x7ffffff0
+// la $t0, __bss_start
+// la $t1, __bss_end
+// beq $t0, $t1, __scg_bss_zeroed
+// __scg_zero_bss:
+// sw $0, 0($t0)
+// addiu $t0, $t0, 4
+// bne $t0, $t1, __scg_zero_bss
+// __scg_bss_zeroed:
+// <body>
+// __scg_halt:
+// j __scg_halt
+// the scaffold's own startup code runs after the bss is zeroed, and
+// its exit code is replaced (the default one returns to $ra)
+func bare_metal_scaffold(scaffold Scaffold, stack_top uint32) Scaffold {
+    if stack_top%8 != 0 {
+        panic(fmt.Sprintf("the stack has to start at a multiple of 8, not 0x%x", stack_top))
+    }
+    var startup []Instruction = []Instruction{
+        {".globl", []string{"_start", "", ""}, ""},
+        {"_start:", []string{}, ""},
+        {"li", []string{"$sp", fmt.Sprintf("0x%x", stack_top), ""}, ""},
+        // the bss is a whole number of words (see 'linker_script');
+        // nothing is live yet, and main's own code hasn't started, so
+        // $t0/$t1 don't have to be allocated or saved
+        {"la", []string{"$t0", "__bss_start", ""}, ""},
+        {"la", []string{"$t1", "__bss_end", ""}, ""},
+        {"beq", []string{"$t0", "$t1", "__scg_bss_zeroed"}, ""},
+        {"__scg_zero_bss:", []string{}, ""},
+        {"sw", []string{"$0", "0($t0)", ""}, ""},
+        {"addiu", []string{"$t0", "$t0", "4"}, ""},
+        {"bne", []string{"$t0", "$t1", "__scg_zero_bss"}, ""},
+        {"__scg_bss_zeroed:", []string{}, ""},
+    }
+    return Scaffold{
+        scaffold.code,
+        append(startup, scaffold.startup...),
+        []Instruction{
+            {bare_metal_halt + ":", []string{}, ""},
+            {"j", []string{bare_metal_halt, "", ""}, ""},
+        },
+    }
+}
+
+// the BFD names of ld's output formats, by byte order
+var ld_output_formats = map[string]string{
+    "EB": "elf32-tradbigmips",
+    "EL": "elf32-tradlittlemips",
+}
+
+// the template of 'linker_script', formatted with the target,
+// the output format, the base address, the sections that go in the
+// text section, and the sections at their own addresses
+const linker_script_template string = `/* generated by scg for target '%s' */
+OUTPUT_FORMAT("%s")
+OUTPUT_ARCH(mips)
+ENTRY(_start)
+
+SECTIONS
+{
+    . = 0x%08x;
+    .text : { *(.text)%s }
+    .rodata : ALIGN(4) { *(.rdata) *(.rodata*) }
+    .data : ALIGN(4) { *(.data) }
+    .bss : ALIGN(4)
+    {
+        __bss_start = .;
+        *(.bss) *(COMMON)
+        . = ALIGN(4);
+        __bss_end = .;
+    }
+%s    /DISCARD/ : { *(.reginfo) *(.MIPS.abiflags) *(.pdr) *(.gnu.attributes) *(.comment) }
+}
+`
+
+// returns a GNU ld linker script that lays the program out like
+// 'assemble_binary' does: the text section at the 'binary_base'
+// option (starting with '_start'), and the read-only data and the
+// data section right after it, followed by the bss; the sections GNU as adds for
+// MIPS objects are dropped, so that 'objcopy -O binary' gives just
+// the program. the sections of 'Section' nodes go at the end of the
+// text section, unless they have an address of their own, e.g.:
+// .boot 0xbfc00000 : { *(.boot) }
+// an error is returned for targets that have an operating system,
+// whose own linker script is the one to use
+func (backend *MIPSBackend) linker_script() (string, error) {
+    if !backend.target.capabilities["bare_metal"] {
+        return "", fmt.Errorf("linker scripts are only for bare-metal targets (e.g. 'bare'), not '%s'",
+            backend.options.target)
+    }
+    var text, placed string
+    for _, section := range backend.sections {
+        if section.address == "" {
+            text += fmt.Sprintf(" *(%s)", section.name)
+        } else {
+            placed += fmt.Sprintf("    %s %s : { *(%s) }\n", section.name, section.address, section.name)
+        }
+    }
+    return fmt.Sprintf(linker_script_template, backend.options.target,
+        ld_output_formats[backend.byte_order_name()], backend.options.binary_base, text, placed), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+    "testing"
+)
+
+// the entry point zeroes the words between '__bss_start' and
+// '__bss_end', which a flat binary places right after the data
+func Test_bss_is_zeroed(t *testing.T) {
+    var options BackendOptions = default_backend_options()
+    options.target = "bare"
+    var program Program = Program{[]interface{}{
+        Static{"total", "int", ""},
+        Static{"count", "int16", ""},
+        Assignment{"total", ArithmeticOp{Ident{"total"}, "add", Ident{"count"}}},
+    }}
+    var (
+        backend MIPSBackend = new_mips_backend_with(program, options)
+        image   Image       = backend.link_image(options.binary_base)
+        start   uint32      = image.labels["__bss_start"]
+        end     uint32      = image.labels["__bss_end"]
+    )
+    if start != (image.data_address+uint32(len(image.data))+3)&^3 || end-start != 8 {
+        t.Errorf("the bss is 0x%x-0x%x, after data at 0x%x (%d bytes)", start, end, image.data_address, len(image.data))
+    }
+    var zeroes, loops bool
+    for _, encoded := range image.text {
+        switch encoded.source.opcode {
+        case "sw":
+            zeroes = zeroes || encoded.source.args[0] == "$0"
+        case "bne":
+            loops = loops || encoded.source.args[2] == "__scg_zero_bss"
+        }
+    }
+    if !zeroes || !loops {
+        t.Errorf("the entry point doesn't zero the bss")
+    }
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "testing"
+)
+
+// a program of 'statements' statements, as machine-generated
+// inputs look: long runs of assignments over a few variables, with
+// some conditions and output
+func large_program(statements int) Program {
+    var (
+        nodes    []interface{} = []interface{}{Assignment{"v0", Integer{"1"}}}
+        variable               = func(i int) string { return fmt.Sprintf("v%d", i%8) }
+    )
+    for i := 1; i < statements; i++ {
+        var value interface{} = ArithmeticOp{Ident{variable(i - 1)}, "addu",
+            ArithmeticOp{Integer{fmt.Sprint(i)}, "mul", Ident{variable(i / 8)}}}
+        switch {
+        case i < 8:
+            nodes = append(nodes, Assignment{variable(i), Integer{fmt.Sprint(i)}})
+        case i%50 == 0:
+            nodes = append(nodes, If{Ident{variable(i)}, []interface{}{Assignment{variable(i + 1), value}}, nil})
+        case i%100 == 1:
+            nodes = append(nodes, Call{"Printf", []interface{}{String{"%d\\n"}, Ident{variable(i)}}})
+        default:
+            nodes = append(nodes, Assignment{variable(i), value})
+        }
+    }
+    return Program{nodes}
+}
+
+// the sizes the benchmarks run at, in statements
+var benchmark_sizes = []int{1000, 10000}
+
+// decoding a large ast from JSON (see 'decode_ast')
+func Benchmark_decode(b *testing.B) {
+    for _, size := range benchmark_sizes {
+        var data []byte = []byte(encode_ast(large_program(size)))
+        b.Run(fmt.Sprint(size), func(b *testing.B) {
+            b.SetBytes(int64(len(data)))
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                if _, err := decode_ast(data); err != nil {
+                    b.Fatal(err)
+                }
+            }
+        })
+    }
+}
+
+// generating and assembling a large ast that's already decoded
+func Benchmark_generate(b *testing.B) {
+    for _, size := range benchmark_sizes {
+        var program Program = large_program(size)
+        b.Run(fmt.Sprint(size), func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                var backend MIPSBackend = new_mips_backend_with(program, default_backend_options())
+                backend.assemble()
+            }
+        })
+    }
+}
+
+// decoding and generating a large ast statement by statement (see
+// 'Stream'), which doesn't hold the whole tree, against doing both
+// for the whole tree
+func Benchmark_stream(b *testing.B) {
+    for _, size := range benchmark_sizes {
+        var data []byte = []byte(encode_ast(large_program(size)))
+        b.Run(fmt.Sprintf("%d/stream", size), func(b *testing.B) {
+            b.SetBytes(int64(len(data)))
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                var stream *Stream = new_stream(default_backend_options())
+                if err := decode_stream(bytes.NewReader(data), stream); err != nil {
+                    b.Fatal(err)
+                }
+                stream.finish()
+            }
+        })
+        b.Run(fmt.Sprintf("%d/tree", size), func(b *testing.B) {
+            b.SetBytes(int64(len(data)))
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                ast, err := decode_ast(data)
+                if err != nil {
+                    b.Fatal(err)
+                }
+                var backend MIPSBackend = new_mips_backend_with(ast, default_backend_options())
+                backend.assemble()
+            }
+        })
+    }
+}
+
+// the large programs compile, and print what the interpreter does
+func Test_large_program(t *testing.T) {
+    if err := check_with_emulator(large_program(1000), default_backend_options()); err != nil {
+        t.Error(err)
+    }
+}
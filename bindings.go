@@ -0,0 +1,472 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+)
+
+// a variable being checked
+type Binding struct {
+    // the name it's generated under, which differs from the one
+    // it's declared with if an earlier block of the function
+    // declared that one too (see 'declare')
+    name      string
+    immutable bool
+    // set once anything reads the variable
+    read bool
+    // where it's declared (or first assigned)
+    node interface{}
+}
+
+// the state of declaration checking
+type Binder struct {
+    // the variables of the function being checked and of every
+    // function enclosing it, and those of the blocks (e.g. the
+    // branches of an 'if') around the node being checked
+    // (innermost last)
+    scopes []map[string]*Binding
+    // the values of the immutable variables bound to integers
+    constants map[string]string
+    // true while checking a function (rather than main)
+    in_function bool
+    // the type of every static, which can be used anywhere
+    // (see 'Static')
+    statics     map[string]string
+    diagnostics *Diagnostics
+    // the variables of the function being checked that are assigned
+    // on every path to the node being checked (see 'If'), and the
+    // index of its first scope (the ones before it are captured)
+    assigned map[*Binding]bool
+    base     int
+    // the names declared anywhere in the function being checked,
+    // and how many variables were renamed (see 'declare')
+    declared map[string]bool
+    renamed  int
+}
+
+// 'Binder' constructor
+func new_binder(diagnostics *Diagnostics) Binder {
+    return Binder{
+        []map[string]*Binding{{}}, map[string]string{}, false, map[string]string{}, diagnostics, map[*Binding]bool{}, 0,
+        map[string]bool{}, 0}
+}
+
+// returns a copy of the variables assigned on every path
+func (binder *Binder) copy_assigned() map[*Binding]bool {
+    var ret map[*Binding]bool = map[*Binding]bool{}
+    for binding := range binder.assigned {
+        ret[binding] = true
+    }
+    return ret
+}
+
+// returns the variable 'name' refers to (in this function, or the
+// closest one enclosing it), or nil if there isn't one
+func (binder *Binder) lookup(name string) *Binding {
+    binding, _ := binder.lookup_scope(name)
+    return binding
+}
+
+// 'lookup', which also returns the index of the scope the variable
+// is in (-1 if there isn't one)
+func (binder *Binder) lookup_scope(name string) (*Binding, int) {
+    for i := len(binder.scopes) - 1; i >= 0; i-- {
+        if binding, ok := binder.scopes[i][name]; ok {
+            return binding, i
+        }
+    }
+    return nil, -1
+}
+
+// returns true if 'name' is a static
+func (binder *Binder) is_static(name string) bool {
+    _, ok := binder.statics[name]
+    return ok
+}
+
+// returns true if 'name' is an immutable variable
+func (binder *Binder) immutable(name string) bool {
+    var binding *Binding = binder.lookup(name)
+    return binding != nil && binding.immutable
+}
+
+// records a declaration in the innermost scope, returning the name
+// it's generated under; it's an error if the name is already a
+// variable (of this block, one around it, or a function enclosing
+// it). a name declared again after the block of its first
+// declaration ended (e.g. in both branches of an 'if') is a new
+// variable, which is renamed so that the two never share a slot
+// or a type; converts:
+// if c { let x = 1 } else { let x = "a" }
+// =>
+// if c { x = 1 } else { __block1_x = "a" }
+func (binder *Binder) declare(name string, immutable bool, node interface{}) string {
+    if binder.lookup(name) != nil {
+        binder.diagnostics.error(node, "'%s' is already declared", name)
+        return name
+    }
+    return binder.add(len(binder.scopes)-1, name, immutable, node).name
+}
+
+// adds a variable to the i-th scope (see 'declare')
+func (binder *Binder) add(i int, name string, immutable bool, node interface{}) *Binding {
+    var binding *Binding = &Binding{name, immutable, false, node}
+    if binder.declared[name] {
+        binder.renamed++
+        binding.name = fmt.Sprintf("__block%d_%s", binder.renamed, name)
+    }
+    binder.declared[name] = true
+    binder.scopes[i][name] = binding
+    binder.assigned[binding] = true
+    return binding
+}
+
+// returns the name a variable is generated under (see 'declare')
+func (binder *Binder) generated_name(name string) string {
+    if binding := binder.lookup(name); binding != nil {
+        return binding.name
+    }
+    return name
+}
+
+// records an assignment, returning the name it's generated under;
+// it's an error if 'name' is immutable, and assigning to a new name
+// declares it (as a mutable variable) in the function rather than
+// the block, so that branches can assign the same variable
+func (binder *Binder) assign(name string, node interface{}) string {
+    if binder.immutable(name) {
+        binder.diagnostics.error(node, "can't assign to '%s', which is declared with 'let'", name)
+    }
+    if len(binder.scopes) != 0 && !binder.is_static(name) && binder.lookup(name) == nil {
+        binder.add(binder.base, name, false, node)
+    }
+    if binding := binder.lookup(name); binding != nil {
+        binder.assigned[binding] = true
+        return binding.name
+    }
+    return name
+}
+
+// binds the nodes of a block, whose declarations are only visible
+// in it
+func (binder *Binder) bind_block(nodes []interface{}) []interface{} {
+    var scope map[string]*Binding = map[string]*Binding{}
+    binder.scopes = append(binder.scopes, scope)
+    var ret []interface{} = binder.bind_all(nodes, false)
+    binder.scopes = binder.scopes[:len(binder.scopes)-1]
+    binder.report_unused(scope)
+    return ret
+}
+
+// returns true if 'name' is a variable of this function
+// or one enclosing it
+func (binder *Binder) visible(name string) bool {
+    return binder.lookup(name) != nil
+}
+
+// warns about storing a value that may not fit in a static
+// without an explicit cast; integers, casts, and bytes (see
+// 'Index') are fine if they fit
+func (binder *Binder) convert_static(name string, value interface{}, node interface{}) {
+    kind, ok := binder.statics[name]
+    cast_type, known := cast_types[kind]
+    if !ok || !known || cast_type.bits >= 32 {
+        return
+    }
+    // returns true if every value of a type fits in the static
+    var fits = func(from CastType) bool {
+        return from.bits < cast_type.bits && (cast_type.signed || !from.signed) ||
+            from.bits == cast_type.bits && from.signed == cast_type.signed
+    }
+    switch value := value.(type) {
+    case Integer:
+        parsed, err := strconv.ParseInt(value.value, 0, 64)
+        if err == nil && int64(convert(int32(parsed), kind)) != parsed {
+            binder.diagnostics.warn("implicit-conversion", node,
+                "%s doesn't fit in '%s' (%s), which gets %d", value.value, name, kind, convert(int32(parsed), kind))
+        }
+    case Cast:
+        if !fits(cast_types[value.to]) {
+            binder.diagnostics.warn("implicit-conversion", node,
+                "assigning %s to '%s' implicitly converts it to %s", value.to, name, kind)
+        }
+    case Index:
+        if !fits(cast_types["uint8"]) {
+            binder.diagnostics.warn("implicit-conversion", node,
+                "assigning uint8 to '%s' implicitly converts it to %s", name, kind)
+        }
+    default:
+        binder.diagnostics.warn("implicit-conversion", node,
+            "assigning int to '%s' implicitly converts it to %s", name, kind)
+    }
+}
+
+// warns about every variable of a scope that is never read
+func (binder *Binder) report_unused(scope map[string]*Binding) {
+    var names []string
+    for name := range scope {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        if !scope[name].read {
+            binder.diagnostics.warn("unused-variable", scope[name].node, "'%s' is never used", name)
+        }
+    }
+}
+
+// copies a node, turning declarations into assignments and
+// replacing the immutable variables bound to integers with
+// their values
+func (binder *Binder) bind(__node interface{}) interface{} {
+    switch node := __node.(type) {
+    case Ident:
+        if binding, i := binder.lookup_scope(node.name); binding != nil {
+            binding.read = true
+            // the generated code would read whatever its slot held
+            if i >= binder.base && !binder.assigned[binding] {
+                binder.diagnostics.error(node, "'%s' may be used before it's assigned", node.name)
+            }
+        } else if !binder.is_static(node.name) {
+            binder.diagnostics.error(node, "'%s' is used before it's declared", node.name)
+        }
+        if value, ok := binder.constants[node.name]; ok {
+            return Integer{value}
+        }
+        return Ident{binder.generated_name(node.name)}
+    case ArithmeticOp:
+        return ArithmeticOp{binder.bind(node.left), node.op, binder.bind(node.right)}
+    case Assignment:
+        var value interface{} = binder.bind(node.value)
+        var name string = binder.assign(node.name, node)
+        binder.convert_static(node.name, value, node)
+        return Assignment{name, value}
+    case Let:
+        var value interface{} = binder.bind(node.value)
+        return Assignment{binder.declare(node.name, true, node), value}
+    case Var:
+        var value interface{} = binder.bind(node.value)
+        return Assignment{binder.declare(node.name, false, node), value}
+    case ExprStmt:
+        return ExprStmt{binder.bind(node.value)}
+    case Call:
+        // the target of an atomic has to be declared already
+        var args []interface{} = binder.bind_all(node.args, false)
+        if node.name == "AtomicAdd" || node.name == "CompareAndSwap" {
+            if target, ok := node.args[0].(Ident); ok {
+                binder.assign(target.name, node)
+            }
+        }
+        return Call{node.name, args}
+    case Return:
+        if node.value == nil {
+            return node
+        }
+        return Return{binder.bind(node.value)}
+    case If:
+        // a variable is assigned after the 'if' if both branches
+        // assign it (or one of them returns)
+        var (
+            cond   interface{}       = binder.bind(node.cond)
+            before map[*Binding]bool = binder.copy_assigned()
+            then   []interface{}     = binder.bind_block(node.then)
+            after  map[*Binding]bool = binder.assigned
+        )
+        binder.assigned = before
+        var otherwise []interface{} = binder.bind_block(node.otherwise)
+        switch {
+        case returns(node.then):
+        case returns(node.otherwise):
+            binder.assigned = after
+        default:
+            for binding := range binder.assigned {
+                if !after[binding] {
+                    delete(binder.assigned, binding)
+                }
+            }
+        }
+        return If{cond, then, otherwise}
+    case Hint:
+        return Hint{binder.bind(node.cond), node.likely}
+    case VarArg:
+        return VarArg{binder.bind(node.index)}
+    case Cast:
+        return Cast{binder.bind(node.value), node.to}
+    case Index:
+        return Index{binder.bind(node.value), binder.bind(node.index)}
+    case Slice:
+        return Slice{binder.bind(node.value), binder.bind(node.low), binder.bind(node.high)}
+    case Interp:
+        return Interp{binder.bind_all(node.parts, false)}
+    case Function:
+        var (
+            scopes      []map[string]*Binding = binder.scopes
+            constants   map[string]string     = binder.constants
+            in_function bool                  = binder.in_function
+            assigned    map[*Binding]bool     = binder.assigned
+            base        int                   = binder.base
+            declared    map[string]bool       = binder.declared
+            params      map[string]*Binding   = map[string]*Binding{}
+        )
+        if !in_function {
+            // top-level functions can't see main's variables
+            binder.scopes, binder.constants, binder.in_function = nil, map[string]string{}, true
+        }
+        binder.constants = copy_without(binder.constants, node.params)
+        for _, param := range node.params {
+            if binder.visible(param) {
+                binder.diagnostics.warn("shadowing", node,
+                    "parameter '%s' of '%s' shadows a variable of an enclosing function", param, node.name)
+            } else if binder.is_static(param) {
+                binder.diagnostics.warn("shadowing", node, "parameter '%s' of '%s' shadows a static", param, node.name)
+            }
+            // unused parameters aren't reported
+            params[param] = &Binding{param, false, true, node}
+        }
+        binder.scopes = append(append([]map[string]*Binding{}, binder.scopes...), params)
+        binder.assigned, binder.base = map[*Binding]bool{}, len(binder.scopes)-1
+        binder.declared = map[string]bool{}
+        for _, param := range node.params {
+            binder.declared[param] = true
+        }
+        for _, binding := range params {
+            binder.assigned[binding] = true
+        }
+        var body []interface{} = binder.bind_all(node.body, true)
+        binder.report_unused(params)
+        binder.scopes, binder.constants, binder.in_function = scopes, constants, in_function
+        binder.assigned, binder.base, binder.declared = assigned, base, declared
+        return Function{node.name, node.params, body, node.variadic}
+    case ExceptionHandler:
+        // which may never run, so what it assigns doesn't count
+        var assigned map[*Binding]bool = binder.copy_assigned()
+        var nodes []interface{} = binder.bind_all(node.nodes, false)
+        binder.assigned = assigned
+        return ExceptionHandler{nodes}
+    }
+    return __node
+}
+
+// copies a list of nodes through 'bind'; when the list is the body
+// of a function (or main), immutable variables bound to integers
+// are folded into every use after their declaration, and their
+// assignment is dropped if nothing else uses them
+func (binder *Binder) bind_all(nodes []interface{}, body bool) (ret []interface{}) {
+    var (
+        constants map[string]string = binder.constants
+        folded    map[int]string    = map[int]string{}
+    )
+    if body {
+        binder.constants = copy_without(constants, nil)
+    }
+    for _, node := range nodes {
+        var bound interface{} = binder.bind(node)
+        if let, ok := node.(Let); ok && body {
+            if integer, ok := bound.(Assignment).value.(Integer); ok {
+                binder.constants[let.name] = integer.value
+                folded[len(ret)] = bound.(Assignment).name
+            }
+        }
+        ret = append(ret, bound)
+    }
+    binder.constants = constants
+    if len(folded) == 0 {
+        return
+    }
+    var kept []interface{}
+    for i, node := range ret {
+        // the assignment itself is one use
+        if name, ok := folded[i]; ok && !used_elsewhere(ret, i, name) {
+            continue
+        }
+        kept = append(kept, node)
+    }
+    return kept
+}
+
+// returns true if a list of statements always returns, so that
+// nothing after it runs
+func returns(nodes []interface{}) bool {
+    if len(nodes) == 0 {
+        return false
+    }
+    switch node := nodes[len(nodes)-1].(type) {
+    case Return:
+        return true
+    case If:
+        return returns(node.then) && returns(node.otherwise)
+    }
+    return false
+}
+
+// returns true if any of 'nodes' other than the i-th one
+// (including the bodies of nested functions) uses 'name'
+func used_elsewhere(nodes []interface{}, i int, name string) bool {
+    for j, node := range nodes {
+        var names map[string]string = map[string]string{}
+        collect_names(node, "", names)
+        collect_nested_names(node, names)
+        if _, ok := names[name]; ok && j != i {
+            return true
+        }
+    }
+    return false
+}
+
+// adds the names used in the nested functions (and the
+// exception handler) in 'node' to 'names'
+func collect_nested_names(node interface{}, names map[string]string) {
+    var pinned map[string]bool = map[string]bool{}
+    pin_names(node, pinned)
+    for name := range pinned {
+        names[name] = name
+    }
+}
+
+// returns a copy of a map without the given keys
+func copy_without(values map[string]string, keys []string) map[string]string {
+    var ret map[string]string = map[string]string{}
+    for key, value := range values {
+        ret[key] = value
+    }
+    for _, key := range keys {
+        delete(ret, key)
+    }
+    return ret
+}
+
+// checks the declarations of a program, turning them into
+// assignments; converts:
+// let a = 5
+// var b = a + 1
+// =>
+// b = 5 + 1
+// it's an error to assign to a variable declared with 'let', to
+// declare a name twice (variables of enclosing functions can't be
+// shadowed either), to use a variable before it's declared
+// (with 'let', 'var', or its first assignment), or before it's
+// assigned on every path to the use (e.g. only in one branch of
+// an 'if'), like the interpreter; functions and
+// statics can still be used before their definitions (see
+// '__declare_functions'). unused variables, parameters that shadow
+// other variables, and values that may not fit the statics they're
+// assigned to are warnings
+func bind_declarations(ast interface{}, diagnostics *Diagnostics) interface{} {
+    var binder Binder = new_binder(diagnostics)
+    program, ok := ast.(Program)
+    if !ok {
+        return binder.bind(ast)
+    }
+    for _, node := range program.nodes {
+        if static, ok := node.(Static); ok {
+            binder.statics[static.name] = static.kind
+            if static.value != "" {
+                binder.convert_static(static.name, Integer{static.value}, static)
+            }
+        }
+    }
+    var nodes []interface{} = binder.bind_all(program.nodes, true)
+    binder.report_unused(binder.scopes[0])
+    return Program{nodes}
+}
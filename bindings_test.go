@@ -0,0 +1,157 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// a variable has to be assigned on every path to a read, which the
+// interpreter needs too (it has no value otherwise, while the
+// generated code would read whatever its slot held); the programs
+// that pass print the same on the emulator
+func Test_definite_assignment(t *testing.T) {
+    var (
+        c       Ident = Ident{"c"}
+        set           = func(name string, value string) Assignment { return Assignment{name, Integer{value}} }
+        printed       = func(name string) Call {
+            return Call{"Printf", []interface{}{String{"%d\\n"}, Ident{name}}}
+        }
+        function = func(body ...interface{}) []interface{} {
+            return []interface{}{
+                Function{"f", []string{"c"}, body, false},
+                Call{"Printf", []interface{}{String{"%d %d\\n"},
+                    Call{"f", []interface{}{Integer{"0"}}}, Call{"f", []interface{}{Integer{"1"}}}}},
+            }
+        }
+    )
+    var cases = map[string]struct {
+        nodes []interface{}
+        // the error, if it isn't assigned
+        expected string
+    }{
+        "one branch": {[]interface{}{
+            set("a", "41"), printed("a"), set("c", "0"),
+            If{c, []interface{}{set("x", "2")}, nil},
+            printed("x"),
+        }, "'x' may be used before it's assigned"},
+        "both branches": {[]interface{}{
+            set("c", "0"),
+            If{c, []interface{}{set("x", "2")}, []interface{}{set("x", "3")}},
+            printed("x"),
+        }, ""},
+        "nested branches": {[]interface{}{
+            set("c", "1"),
+            If{c, []interface{}{
+                If{Hint{c, false}, []interface{}{set("x", "1")}, []interface{}{set("x", "2")}},
+            }, []interface{}{set("x", "3")}},
+            printed("x"),
+        }, ""},
+        "one nested branch": {[]interface{}{
+            set("c", "1"),
+            If{c, []interface{}{If{c, []interface{}{set("x", "1")}, nil}}, []interface{}{set("x", "3")}},
+            printed("x"),
+        }, "'x' may be used before it's assigned"},
+        "the other branch returns": {function(
+            If{c, []interface{}{Return{Integer{"-1"}}}, []interface{}{set("x", "5")}},
+            Return{Ident{"x"}},
+        ), ""},
+        "the branch doesn't return": {function(
+            If{c, []interface{}{set("x", "5")}, nil},
+            Return{Ident{"x"}},
+        ), "'x' may be used before it's assigned"},
+        "the handler may not run": {[]interface{}{
+            ExceptionHandler{[]interface{}{set("x", "1")}},
+            printed("x"),
+        }, "'x' may be used before it's assigned"},
+        // captured variables are assigned before the call that uses
+        // them can happen
+        "captured": {function(
+            set("x", "6"),
+            Function{"g", nil, []interface{}{Return{ArithmeticOp{Ident{"x"}, "addu", c}}}, false},
+            Return{Call{"g", nil}},
+        ), ""},
+    }
+    for name, test := range cases {
+        var program Program = Program{test.nodes}
+        if test.expected == "" {
+            if err := check_with_emulator(program, default_backend_options()); err != nil {
+                t.Errorf("%s: %v", name, err)
+            }
+            continue
+        }
+        _, interpreted := interpret_safely(program)
+        if interpreted == nil || !strings.Contains(interpreted.Error(), test.expected) {
+            t.Errorf("%s: the interpreter failed with %v, expected %q", name, interpreted, test.expected)
+        }
+        if _, diagnostics, ok := try_generate(program, default_backend_options()); ok ||
+            !strings.Contains(strings.Join(diagnostics, "\n"), "Error: "+test.expected) {
+            t.Errorf("%s: generating it reported %q, expected %q", name, diagnostics, test.expected)
+        }
+    }
+}
+
+// 'let' and 'var' in a branch of an 'if' are only visible in it, so
+// sibling branches (and the code after them) can declare the same
+// name, even as another type; the program prints the same on the
+// emulator
+func Test_block_scopes(t *testing.T) {
+    var (
+        c       Ident = Ident{"c"}
+        printed       = func(format string, value interface{}) Call {
+            return Call{"Printf", []interface{}{String{format}, value}}
+        }
+    )
+    var sibling = func(c string) []interface{} {
+        return []interface{}{
+            Assignment{"c", Integer{c}},
+            If{Ident{"c"}, []interface{}{
+                Let{"x", String{"then"}}, printed("%s\\n", Ident{"x"}),
+            }, []interface{}{
+                Var{"x", Integer{"7"}}, Assignment{"x", ArithmeticOp{Ident{"x"}, "mul", Integer{"6"}}},
+                printed("%d\\n", Ident{"x"}),
+            }},
+            // a new variable, declared after both branches
+            Let{"x", Integer{"3"}}, printed("%d\\n", Ident{"x"}),
+        }
+    }
+    var valid = map[string][]interface{}{
+        "then": sibling("1"),
+        "else": sibling("0"),
+        "nested": {
+            Assignment{"c", Integer{"1"}},
+            If{c, []interface{}{
+                Var{"y", Integer{"1"}},
+                If{c, []interface{}{Let{"z", ArithmeticOp{Ident{"y"}, "addu", Integer{"1"}}}, printed("%d\\n", Ident{"z"})}, nil},
+                If{c, []interface{}{Let{"z", String{"again"}}, printed("%s\\n", Ident{"z"})}, nil},
+            }, nil},
+        },
+        "function": {
+            Function{"f", []string{"c"}, []interface{}{
+                If{c, []interface{}{Let{"x", Integer{"10"}}, Return{Ident{"x"}}}, nil},
+                Var{"x", Integer{"20"}},
+                Return{Ident{"x"}},
+            }, false},
+            printed("%d\\n", Call{"f", []interface{}{Integer{"1"}}}),
+            printed("%d\\n", Call{"f", []interface{}{Integer{"0"}}}),
+        },
+    }
+    for name, nodes := range valid {
+        if err := check_with_emulator(Program{nodes}, default_backend_options()); err != nil {
+            t.Errorf("%s: %v", name, err)
+        }
+    }
+    // what a branch declares isn't visible after it
+    var program Program = Program{[]interface{}{
+        Assignment{"c", Integer{"1"}},
+        If{c, []interface{}{Let{"x", Integer{"1"}}, printed("%d\\n", Ident{"x"})}, nil},
+        printed("%d\\n", Ident{"x"}),
+    }}
+    var expected string = "'x' is used before it's declared"
+    if _, err := interpret_safely(program); err == nil || !strings.Contains(err.Error(), expected) {
+        t.Errorf("the interpreter failed with %v, expected %q", err, expected)
+    }
+    if _, diagnostics, ok := try_generate(program, default_backend_options()); ok ||
+        !strings.Contains(strings.Join(diagnostics, "\n"), "Error: "+expected) {
+        t.Errorf("generating it reported %q, expected %q", diagnostics, expected)
+    }
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// a basic block of an instrumented program
+type BasicBlock struct {
+    // the label the block starts with, or the procedure's
+    // label and the block's index in it (e.g. "f+2")
+    name string
+    // the cycles it takes to run the block once (see 'OpcodeInfo.latency')
+    cycles int
+}
+
+// returns the cycles it takes to run an instruction
+func instruction_cycles(instruction Instruction) (cycles int) {
+    for _, real := range expand(instruction, func(string) uint32 { return 0 }) {
+        cycles += 1 + opcode_table[real.opcode].latency
+    }
+    return
+}
+
+// returns an instruction that takes a label as its memory operand
+func label_instruction(opcode string, register string, label string, offset int) Instruction {
+    return Instruction{opcode, []string{register, fmt.Sprintf("%s+%d", label, offset), ""}, ""}
+}
+
+// returns the code that counts one run of the i-th block:
+// sw $v1, __block_save
+// lw $v1, __block_counts+8
+// addiu $v1, $v1, 1
+// sw $v1, __block_counts+8
+// lw $v1, __block_save
+// $v1 is saved around it since it can hold the static link, and
+// the assembler needs $at for the addresses
+func block_counter(i int) []Instruction {
+    return []Instruction{
+        {"sw", []string{"$v1", "__block_save", ""}, ""},
+        label_instruction("lw", "$v1", "__block_counts", 4*i),
+        {"addiu", []string{"$v1", "$v1", "1"}, ""},
+        label_instruction("sw", "$v1", "__block_counts", 4*i),
+        {"lw", []string{"$v1", "__block_save", ""}, ""},
+    }
+}
+
+// inserts a counter at the start of every basic block of main and
+// the user functions (the runtime library and exception handlers
+// aren't instrumented), returning the blocks; the counts are kept
+// in '__block_counts', one word per block
+func (backend *MIPSBackend) instrument_blocks() []BasicBlock {
+    if backend.options.pic || backend.target.reserve_at {
+        panic("instrumented code needs absolute addresses and $at")
+    }
+    var blocks []BasicBlock
+    var instrument = func(procedure *Procedure) {
+        var (
+            pending bool = true
+            index   int
+            name    string
+        )
+        // instruments one part of the procedure, continuing
+        // the blocks of the previous part
+        var part = func(instructions []Instruction) (ret []Instruction) {
+            for _, instruction := range instructions {
+                if strings.HasSuffix(instruction.opcode, ":") {
+                    if !pending {
+                        pending, name = true, ""
+                    }
+                    if name == "" {
+                        name = strings.TrimSuffix(instruction.opcode, ":")
+                    }
+                    ret = append(ret, instruction)
+                    continue
+                }
+                if strings.HasPrefix(instruction.opcode, ".") {
+                    ret = append(ret, instruction)
+                    continue
+                }
+                if pending {
+                    if name == "" {
+                        name = fmt.Sprintf("%s+%d", procedure.label, index)
+                    }
+                    ret = append(ret, block_counter(len(blocks))...)
+                    blocks = append(blocks, BasicBlock{name, 0})
+                    pending, name = false, ""
+                    index++
+                }
+                blocks[len(blocks)-1].cycles += instruction_cycles(instruction)
+                ret = append(ret, instruction)
+                pending = opcode_table[instruction.opcode].ends_block
+            }
+            return
+        }
+        name = procedure.label
+        procedure.prologue = part(procedure.prologue)
+        procedure.body = part(procedure.body)
+        procedure.epilogue = part(procedure.epilogue)
+    }
+    instrument(&backend.main_procedure)
+    for i := range backend.procedures {
+        instrument(&backend.procedures[i])
+    }
+    if len(blocks) != 0 {
+        backend.__emit_bss("__block_counts", uint(4*len(blocks)))
+        backend.__emit_bss("__block_save", 4)
+    }
+    return blocks
+}
+
+// adds a report to the end of main; 'report' generates it,
+// and can use every register but $sp and $ra
+func (backend *MIPSBackend) __add_report(report func()) {
+    var main_section []Instruction = backend.main_section
+    backend.main_section = []Instruction{}
+    report()
+    backend.main_procedure.epilogue = append(backend.main_section, backend.main_procedure.epilogue...)
+    backend.main_section = main_section
+}
+
+// returns a function that emits:
+// la $a0, string1
+// li $v0, 4
+// syscall
+// to print a string literal; each literal only gets
+// one entry in the data section
+func (backend *MIPSBackend) __literal_printer() func(text string) {
+    var labels map[string]string = map[string]string{}
+    return func(text string) {
+        label, ok := labels[text]
+        if !ok {
+            label = backend.__string_label()
+            backend.__emit_string(label, text, true)
+            labels[text] = label
+        }
+        backend.__emit_address("$a0", label)
+        backend.__emit_syscall("print_string")
+    }
+}
+
+// emits the code that prints how often every block ran and
+// the cycles it took (estimated with 'OpcodeInfo.latency'):
+// main: 1 run(s), 12 cycles
+// fib: 177 run(s), 1239 cycles
+// ...
+// total: 4321 cycles
+func (backend *MIPSBackend) profile_report(blocks []BasicBlock, print_literal func(string)) {
+    // the total, which the syscalls leave alone
+    backend.__emit_main("li", "$a1", "0", "")
+    for i, block := range blocks {
+        print_literal(block.name + ": ")
+        backend.main_section = append(backend.main_section, label_instruction("lw", "$a0", "__block_counts", 4*i))
+        backend.__emit_syscall("print_int")
+        print_literal(" run(s), ")
+        backend.main_section = append(backend.main_section, label_instruction("lw", "$a0", "__block_counts", 4*i))
+        backend.__emit_main("li", "$v1", fmt.Sprint(block.cycles), "")
+        backend.__emit_main("mul", "$a0", "$a0", "$v1")
+        backend.__emit_main("addu", "$a1", "$a1", "$a0")
+        backend.__emit_syscall("print_int")
+        print_literal(" cycles\\n")
+    }
+    print_literal("total: ")
+    backend.__emit_main("move", "$a0", "$a1", "")
+    backend.__emit_syscall("print_int")
+    print_literal(" cycles\\n")
+}
+
+// emits the code that prints how often every block ran, marking
+// the ones that never did with '!', and how many did:
+// main: 1
+// else1: 0 !
+// ...
+// covered: 6 of 7 blocks
+func (backend *MIPSBackend) coverage_report(blocks []BasicBlock, print_literal func(string)) {
+    // the number of blocks that ran
+    backend.__emit_main("li", "$a1", "0", "")
+    for i, block := range blocks {
+        var covered string = backend.__new_label("covered")
+        print_literal(block.name + ": ")
+        backend.main_section = append(backend.main_section, label_instruction("lw", "$a0", "__block_counts", 4*i))
+        backend.__emit_main("sltu", "$v1", "$0", "$a0")
+        backend.__emit_main("addu", "$a1", "$a1", "$v1")
+        backend.__emit_syscall("print_int")
+        backend.main_section = append(backend.main_section, label_instruction("lw", "$a0", "__block_counts", 4*i))
+        backend.__emit_main("bne", "$a0", "$0", covered)
+        print_literal(" !")
+        backend.__emit_label(covered)
+        print_literal("\\n")
+    }
+    print_literal("covered: ")
+    backend.__emit_main("move", "$a0", "$a1", "")
+    backend.__emit_syscall("print_int")
+    print_literal(fmt.Sprintf(" of %d blocks\\n", len(blocks)))
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// the type of the value each builtin leaves on the stack
+// (intrinsics always leave an int)
+var builtin_types = map[string]string{
+    "Printf":          "void",
+    "close":           "void",
+    "set_pixel":       "void",
+    "open":            "fd",
+    "stdin":           "fd",
+    "stdout":          "fd",
+    "stderr":          "fd",
+    "read":            "int",
+    "write":           "int",
+    "random":          "int",
+    "random_range":    "int",
+    "time":            "int",
+    "key_ready":       "int",
+    "read_key":        "int",
+    "exception_cause": "int",
+    "AtomicAdd":       "int",
+    "CompareAndSwap":  "int",
+    "memcpy":          "void",
+    "memset":          "void",
+    "rune_at":         "int",
+    "next_rune":       "int",
+    "sizeof":          "int",
+    "alignof":         "int",
+}
+
+// returns true if 'name' is a builtin or an intrinsic
+func is_builtin(name string) bool {
+    _, builtin := builtin_types[name]
+    _, intrinsic := intrinsics[name]
+    return builtin || intrinsic
+}
+
+// returns the type of the value a builtin leaves on the stack
+func builtin_type(name string) string {
+    if _, ok := intrinsics[name]; ok {
+        return "int"
+    }
+    if builtin_type, ok := builtin_types[name]; ok {
+        return builtin_type
+    }
+    panic(fmt.Sprintf("unknown function '%s'", name))
+}
+
+// a call; builtins are expanded inline, while
+// calls to user functions jump to them
+func (backend *MIPSBackend) call(node *Call) {
+    if intrinsic, ok := intrinsics[node.name]; ok {
+        backend.intrinsic(node, intrinsic)
+        return
+    }
+    if label, ok := backend.__resolve_function(node.name); ok {
+        var function Function = backend.functions[label]
+        backend.user_call(node, label, &function)
+        return
+    }
+    switch node.name {
+    case "Printf":
+        backend.printf(node)
+    case "open", "read", "write", "close":
+        backend.file_io(node)
+    case "stdin", "stdout", "stderr":
+        backend.std_fd(node)
+    case "random", "random_range", "time":
+        backend.random_time(node)
+    case "set_pixel", "key_ready", "read_key":
+        backend.mmio(node)
+    case "exception_cause":
+        backend.exception_cause(node)
+    case "AtomicAdd", "CompareAndSwap":
+        backend.atomic(node)
+    case "memcpy", "memset":
+        backend.memory_op(node)
+    case "sizeof", "alignof":
+        backend.size_query(node)
+    case "rune_at", "next_rune":
+        backend.rune_op(node)
+    default:
+        if function, ok := backend.__c_function(node.name); ok {
+            backend.c_call(node, function)
+            return
+        }
+        panic(fmt.Sprintf("unknown function '%s'", node.name))
+    }
+}
+
+// emits:
+// li $v0, 4
+// syscall
+// such that 4 is the target's number for the syscall; the
+// arguments are expected to already be in $a0-$a3
+func (backend *MIPSBackend) __emit_syscall(name string) {
+    number, ok := backend.target.syscalls[name]
+    if !ok {
+        panic(fmt.Sprintf("syscall '%s' is not available on target '%s'", name, backend.options.target))
+    }
+    backend.__emit_main("li", "$v0", fmt.Sprint(number), "")
+    backend.__emit_main("syscall", "", "", "")
+}
+
+// panics unless the target supports 'capability'
+func (backend *MIPSBackend) __require_capability(capability string, user string) {
+    if !backend.target.capabilities[capability] {
+        panic(fmt.Sprintf("'%s' needs '%s', which target '%s' doesn't support",
+            user, capability, backend.options.target))
+    }
+}
+
+// panics unless the argument at 'index' has one of the given types
+func (backend *MIPSBackend) __expect_type(node *Call, index int, types ...string) {
+    var actual string = backend.type_of(node.args[index])
+    for _, t := range types {
+        if actual == t {
+            return
+        }
+    }
+    panic(fmt.Sprintf("argument %d of '%s' expects %s, got %s",
+        index+1, node.name, strings.Join(types, " or "), actual))
+}
+
+// pushes a new temporary register holding the value
+// a syscall left in 'register' (usually $v0)
+func (backend *MIPSBackend) __push_result(register string) {
+    var temp_register string = backend.__temp_register()
+    backend.stack.push(temp_register)
+    backend.__emit_main("move", temp_register, register, "")
+}
+
+// generates code for an expression and moves its
+// value into 'register'
+func (backend *MIPSBackend) __load_arg(register string, arg interface{}) {
+    backend.codegen(arg)
+    var value_register string = backend.__pop()
+    backend.__emit_main("move", register, value_register, "")
+    backend.__free(value_register)
+}
+
+// generates code for every argument first, then moves them
+// into $a0-$a3; evaluating them all up front keeps nested
+// calls from clobbering the argument registers
+func (backend *MIPSBackend) __load_args(args []interface{}) {
+    if len(args) > 4 {
+        panic("too many arguments to fit in $a0-$a3")
+    }
+    for _, arg := range args {
+        backend.codegen(arg)
+    }
+    for n, value_register := range backend.__pop_n(len(args)) {
+        backend.__emit_main("move", fmt.Sprintf("$a%d", n), value_register, "")
+        backend.__free(value_register)
+    }
+}
+
+// Printf(format, args...); the format is split at compile time:
+// Printf("x = %d\n", x)
+// =>
+// string1: .asciiz "x = "
+// string2: .asciiz "\n"
+// in the data section, and:
+// la $a0, string1
+// li $v0, 4
+// syscall
+// <code for x>
+// move $a0, $t0
+// li $v0, 1
+// syscall
+// la $a0, string2
+// li $v0, 4
+// syscall
+// supports %d (int), %c (int), %s (string), %f (a float or double
+// literal, or a float value, on targets that can print them; see
+// '__load_float' and 'cast_to_float'), and %%. targets without
+// MARS's printing syscalls print with 'write' instead (see
+// '__print')
+func (backend *MIPSBackend) printf(node *Call) {
+    if len(node.args) == 0 {
+        panic("'Printf' expects a format string")
+    }
+    format, ok := node.args[0].(String)
+    if !ok {
+        panic("the format passed to 'Printf' must be a string literal")
+    }
+    var (
+        args    []interface{} = node.args[1:]
+        literal string
+    )
+    // print the literal text collected so far (if any)
+    var flush = func() {
+        if literal == "" {
+            return
+        }
+        var label string = backend.__string_label()
+        backend.__emit_string(label, literal, true)
+        backend.__emit_address("$a0", label)
+        backend.__print("print_string")
+        literal = ""
+    }
+    for i := 0; i < len(format.value); i++ {
+        if format.value[i] != '%' {
+            literal += format.value[i : i+1]
+            continue
+        }
+        if i+1 == len(format.value) {
+            panic("'Printf' format ends with a lone '%'")
+        }
+        i++
+        var verb byte = format.value[i]
+        if verb == '%' {
+            literal += "%"
+            continue
+        }
+        var expected string
+        var syscall string
+        switch verb {
+        case 'd':
+            expected, syscall = "int", "print_int"
+        case 'c':
+            expected, syscall = "int", "print_char"
+        case 's':
+            expected, syscall = "string", "print_string"
+        case 'f':
+            expected, syscall = "float", "print_float"
+        default:
+            panic(fmt.Sprintf("unsupported 'Printf' verb '%%%c'", verb))
+        }
+        if len(args) == 0 {
+            panic(fmt.Sprintf("missing argument for '%%%c' in 'Printf'", verb))
+        }
+        var actual string = backend.type_of(args[0])
+        if verb == 'f' && actual == "double" {
+            expected, syscall = "double", "print_double"
+        }
+        if actual != expected {
+            panic(fmt.Sprintf("'%%%c' in 'Printf' expects %s, got %s", verb, expected, actual))
+        }
+        flush()
+        if _, ok := args[0].(Float); !ok && verb == 'f' {
+            // a float value (see 'cast_to_float'), in an integer register
+            backend.codegen(args[0])
+            var register string = backend.__pop()
+            backend.__emit_main("mtc1", register, "$f12", "")
+            backend.__free(register)
+        } else if verb == 'f' {
+            backend.__load_float("$f12", args[0])
+        } else {
+            backend.__load_arg("$a0", args[0])
+        }
+        backend.__print(syscall)
+        args = args[1:]
+    }
+    if len(args) != 0 {
+        panic(fmt.Sprintf("%d extra argument(s) passed to 'Printf'", len(args)))
+    }
+    flush()
+}
+
+// prints what's in $a0 (or $f12) with one of MARS's printing
+// syscalls, or on targets that only have 'write', with the runtime
+// library routine that writes it to stdout instead; emits:
+// addiu $sp, $sp, -8
+// jal __scg_print_int
+// addiu $sp, $sp, 8
+// such that 8 is the size of the frame so far, which the routine's
+// buffer goes below; it only uses the argument and result registers
+// (see 'runtime_library'), so nothing needs to be spilled
+func (backend *MIPSBackend) __print(syscall string) {
+    if _, ok := backend.target.syscalls[syscall]; ok {
+        backend.__emit_syscall(syscall)
+        return
+    }
+    var library string = "__scg_" + syscall
+    _, routine := runtime_library[library]
+    if _, write := backend.target.syscalls["write"]; !routine || !write {
+        panic(fmt.Sprintf("'Printf' needs the '%s' or 'write' syscall, which target '%s' doesn't have",
+            syscall, backend.options.target))
+    }
+    // 'jal' overwrites $ra, which the caller needs to return
+    backend.__save_ra()
+    var frame_size uint = backend.name_offset - backend.target.word_size
+    if alignment := backend.options.stack_alignment; alignment != 0 {
+        frame_size = (frame_size + alignment - 1) / alignment * alignment
+    }
+    backend.__check_frame_size(frame_size)
+    backend.__emit_main("addiu", "$sp", "$sp", fmt.Sprintf("-%d", frame_size))
+    backend.__emit_local_call(library)
+    backend.__emit_main("addiu", "$sp", "$sp", fmt.Sprint(frame_size))
+    backend.runtime_used[library] = true
+}
+
+// open(path, flags, mode) => fd
+// read(fd, buffer, length) => int
+// write(fd, buffer, length) => int
+// close(fd)
+// converts:
+// read(f, buffer, 16)
+// =>
+// <code for f>
+// <code for buffer>
+// li $t2, 16
+// move $a0, $t0
+// move $a1, $t1
+// move $a2, $t2
+// li $v0, 14
+// syscall
+// move $t3, $v0
+// file descriptors are typed ("fd"), so they can only come from
+// 'open' (or 'stdin', 'stdout', and 'stderr') and can't be used
+// in arithmetic; a variable passed to 'close' can't be used again
+func (backend *MIPSBackend) file_io(node *Call) {
+    var arity int = 3
+    if node.name == "close" {
+        arity = 1
+    }
+    if len(node.args) != arity {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d", node.name, arity, len(node.args)))
+    }
+    if node.name == "open" {
+        backend.__expect_type(node, 0, "string")
+        backend.__expect_type(node, 1, "int")
+        backend.__expect_type(node, 2, "int")
+    } else {
+        backend.__expect_type(node, 0, "fd")
+    }
+    if node.name == "read" || node.name == "write" {
+        backend.__expect_type(node, 1, "string", "int")
+        backend.__expect_type(node, 2, "int")
+    }
+    backend.__load_args(node.args)
+    backend.__emit_syscall(node.name)
+    if node.name == "close" {
+        if fd, ok := node.args[0].(Ident); ok {
+            backend.name_types[fd.name] = "closed fd"
+        }
+        return
+    }
+    backend.__push_result("$v0")
+}
+
+// stdin(), stdout(), stderr() => fd
+// emits:
+// li $t0, 1
+// for 'stdout', such that $t0 is the first temporary register
+// it could get
+func (backend *MIPSBackend) std_fd(node *Call) {
+    if len(node.args) != 0 {
+        panic(fmt.Sprintf("'%s' takes no arguments", node.name))
+    }
+    var temp_register string = backend.__temp_register()
+    backend.stack.push(temp_register)
+    var fd string = map[string]string{"stdin": "0", "stdout": "1", "stderr": "2"}[node.name]
+    backend.__emit_main("li", temp_register, fd, "")
+}
+
+// random() => int
+// random_range(bound) => int
+// time() => int
+// converts:
+// random_range(10)
+// =>
+// li $t0, 10
+// li $a0, 0
+// move $a1, $t0
+// li $v0, 42
+// syscall
+// move $t1, $a0
+// such that 0 is the id of MARS's default random generator;
+// 'random_range' returns a value in [0, bound), and 'time'
+// returns the low 32 bits of the system time in milliseconds
+func (backend *MIPSBackend) random_time(node *Call) {
+    var arity int = 0
+    if node.name == "random_range" {
+        arity = 1
+    }
+    if len(node.args) != arity {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d", node.name, arity, len(node.args)))
+    }
+    switch node.name {
+    case "random":
+        backend.__emit_main("li", "$a0", "0", "")
+        backend.__emit_syscall("random_int")
+    case "random_range":
+        backend.__expect_type(node, 0, "int")
+        backend.__load_arg("$a1", node.args[0])
+        backend.__emit_main("li", "$a0", "0", "")
+        backend.__emit_syscall("random_range")
+    case "time":
+        backend.__emit_syscall("time")
+    }
+    // all three leave their result in $a0 rather than $v0
+    backend.__push_result("$a0")
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+    "context"
+    "fmt"
+)
+
+// what compilation panics with once its context (see
+// 'BackendOptions.context') is cancelled or past its deadline;
+// like 'ErrorLimit', it isn't recovered by 'statement'
+type Cancelled struct {
+    err error
+}
+
+func (cancelled Cancelled) Error() string {
+    return fmt.Sprintf("compilation stopped: %v", cancelled.err)
+}
+
+// panics with a 'Cancelled' if the context is done
+func check_cancelled(ctx context.Context) {
+    if err := ctx.Err(); err != nil {
+        panic(Cancelled{err})
+    }
+}
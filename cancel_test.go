@@ -0,0 +1,26 @@
+package main
+
+import (
+    "context"
+    "strings"
+    "testing"
+)
+
+// a build that runs out of time (-timeout) fails with one error
+// saying so, rather than panicking
+func Test_cancelled_build(t *testing.T) {
+    var options BackendOptions = default_backend_options()
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    options.context = ctx
+    _, diagnostics, ok := try_generate(Program{[]interface{}{Assignment{"a", Integer{"1"}}}}, options)
+    var errors []string
+    for _, diagnostic := range diagnostics {
+        if strings.HasPrefix(diagnostic, "Error: ") {
+            errors = append(errors, diagnostic)
+        }
+    }
+    if ok || len(errors) != 1 || errors[0] != "Error: compilation stopped: context canceled" {
+        t.Errorf("reported %q (ok: %v)", diagnostics, ok)
+    }
+}
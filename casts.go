@@ -0,0 +1,160 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+)
+
+// the width of a type a value can be cast to
+type CastType struct {
+    bits uint
+    // true if the value is sign-extended back to a
+    // word, and false if it is zero-extended
+    signed bool
+}
+
+// every type a value can be cast to, by name
+var cast_types = map[string]CastType{
+    "int8":   {8, true},
+    "uint8":  {8, false},
+    "int16":  {16, true},
+    "uint16": {16, false},
+    "int":    {32, true},
+}
+
+// returns a value converted to a type (see 'Cast')
+func convert(value int32, to string) int32 {
+    var shift uint = 32 - cast_types[to].bits
+    if cast_types[to].signed {
+        return value << shift >> shift
+    }
+    return int32(uint32(value) << shift >> shift)
+}
+
+// returns a float rounded toward zero, as 'trunc.w.s' does; NaN
+// and values out of range give the largest int, as MIPS does when
+// the invalid operation exception is off
+func truncate_float(value float32) int32 {
+    if value != value || value >= math.MaxInt32 || value < math.MinInt32 {
+        return math.MaxInt32
+    }
+    return int32(value)
+}
+
+// a conversion; converts:
+// int8(a)
+// =>
+// <code for a>
+// seb $t0, $t0
+// such that $t0 is a's register; targets without 'seb' (and 'seh')
+// shift the value up and back down instead:
+// sll $t0, $t0, 24
+// sra $t0, $t0, 24
+// the unsigned types just mask the value:
+// uint8(a)
+// =>
+// <code for a>
+// andi $t0, $t0, 255
+// and integers are converted at compile time. floats are truncated
+// toward zero first:
+// int8(f)
+// =>
+// <code for f>
+// mtc1 $t0, $f0
+// trunc.w.s $f0, $f0
+// mfc1 $t0, $f0
+// seb $t0, $t0
+// (see 'cast_to_float' for the other way)
+func (backend *MIPSBackend) cast(node *Cast) {
+    if node.to == "float" {
+        backend.cast_to_float(node)
+        return
+    }
+    cast_type, ok := cast_types[node.to]
+    if !ok {
+        panic(fmt.Sprintf("unknown type '%s' in cast", node.to))
+    }
+    var from string = backend.type_of(node.value)
+    if from != "int" && from != "float" {
+        panic(fmt.Sprintf("can't cast %s to %s", from, node.to))
+    }
+    if integer, ok := node.value.(Integer); ok {
+        if value, err := strconv.ParseInt(integer.value, 0, 64); err == nil {
+            backend._integer(&Integer{fmt.Sprint(convert(int32(value), node.to))})
+            return
+        }
+    }
+    if literal, ok := node.value.(Float); ok {
+        var value int32 = truncate_float(float32(must_parse_float(literal.value, 32)))
+        backend._integer(&Integer{fmt.Sprint(convert(value, node.to))})
+        return
+    }
+    backend.codegen(node.value)
+    var register string = backend.__peek()
+    if from == "float" {
+        backend.__convert_float(register, "trunc.w.s")
+    }
+    switch {
+    case cast_type.bits == 32:
+    case !cast_type.signed:
+        backend.__emit_main("andi", register, register, fmt.Sprint(1<<cast_type.bits-1))
+    case backend.target.capabilities["seb"]:
+        var opcode string = map[uint]string{8: "seb", 16: "seh"}[cast_type.bits]
+        backend.__emit_main(opcode, register, register, "")
+    default:
+        var shift string = fmt.Sprint(32 - cast_type.bits)
+        backend.__emit_main("sll", register, register, shift)
+        backend.__emit_main("sra", register, register, shift)
+    }
+}
+
+// a conversion to a float, whose bits are kept in an integer
+// register like every other value; converts:
+// float(a)
+// =>
+// <code for a>
+// mtc1 $t0, $f0
+// cvt.s.w $f0, $f0
+// mfc1 $t0, $f0
+// such that $t0 is a's register; integers are converted at compile
+// time:
+// float(3)
+// =>
+// li $t0, 0x40400000
+func (backend *MIPSBackend) cast_to_float(node *Cast) {
+    var from string = backend.type_of(node.value)
+    switch {
+    case from == "float":
+        backend.codegen(node.value)
+        return
+    case from != "int":
+        panic(fmt.Sprintf("can't cast %s to float", from))
+    }
+    if integer, ok := node.value.(Integer); ok {
+        if value, err := strconv.ParseInt(integer.value, 0, 64); err == nil {
+            var bits uint32 = math.Float32bits(float32(int32(value)))
+            backend._integer(&Integer{fmt.Sprintf("0x%08x", bits)})
+            backend.__comment_last(fmt.Sprintf("float(%s)", integer.value))
+            return
+        }
+    }
+    backend.codegen(node.value)
+    backend.__convert_float(backend.__peek(), "cvt.s.w")
+}
+
+// converts the value in a register with the floating-point unit;
+// emits:
+// mtc1 $t0, $f0
+// cvt.s.w $f0, $f0
+// mfc1 $t0, $f0
+// such that $t0 is the register and 'cvt.s.w' the conversion
+func (backend *MIPSBackend) __convert_float(register string, opcode string) {
+    if backend.in_handler {
+        // see '__load_float'
+        panic("exception handlers can't use the floating-point unit")
+    }
+    backend.__emit_main("mtc1", register, "$f0", "")
+    backend.__emit_main(opcode, "$f0", "$f0", "")
+    backend.__emit_main("mfc1", register, "$f0", "")
+}
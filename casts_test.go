@@ -0,0 +1,58 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// ints become floats and floats become ints (truncated, see
+// 'truncate_float') the same way in the interpreter and on the
+// emulator, whether they're converted at run time or at compile
+// time; floats can only be printed and converted back
+func Test_float_casts(t *testing.T) {
+    var (
+        to_float = func(value interface{}) Cast { return Cast{value, "float"} }
+        to_int   = func(value interface{}, to string) Cast { return Cast{value, to} }
+        i        Ident = Ident{"i"}
+    )
+    var program Program = Program{[]interface{}{
+        Assignment{"i", Integer{"-7"}},
+        Assignment{"f", to_float(i)},
+        Call{"Printf", []interface{}{String{"%f %d %d\\n"}, Ident{"f"}, to_int(Ident{"f"}, "int"), to_int(Ident{"f"}, "uint8")}},
+        // 2^24 + 1 rounds to 2^24, and 2^31 - 1 to 2^31, which is out
+        // of range
+        Assignment{"i", Integer{"16777217"}},
+        Call{"Printf", []interface{}{String{"%d\\n"}, to_int(to_float(i), "int")}},
+        Assignment{"i", Integer{"2147483647"}},
+        Call{"Printf", []interface{}{String{"%d %f\\n"}, to_int(to_float(i), "int"), to_float(to_float(Integer{"3"}))}},
+        Call{"Printf", []interface{}{String{"%d %d %d\\n"},
+            to_int(Float{"-2.7", false}, "int"), to_int(Float{"300.5", false}, "uint8"), to_int(Float{"1e10", false}, "int")}},
+    }}
+    const expected string = "-7.0 -7 249\n16777216\n2147483647 3.0\n-2 44 2147483647\n"
+    if output, err := interpret_safely(program); err != nil || output != expected {
+        t.Errorf("the interpreter printed %q (%v), expected %q", output, err, expected)
+    }
+    if err := check_with_emulator(program, default_backend_options()); err != nil {
+        t.Error(err)
+    }
+    var (
+        backend MIPSBackend = new_mips_backend(program)
+        code    string      = backend.assemble()
+    )
+    for _, expected := range []string{"cvt.s.w $f0,$f0", "trunc.w.s $f0,$f0", "mtc1 $t0,$f12", "li $t0,0x40400000"} {
+        if !strings.Contains(code, expected) {
+            t.Errorf("no %q in\n%s", expected, code)
+        }
+    }
+    for expected, value := range map[string]interface{}{
+        "floats can't be used in arithmetic (cast them to int first)": ArithmeticOp{to_float(Integer{"1"}), "addu", Integer{"1"}},
+        "can't cast string to float":                                  to_float(String{"1"}),
+        "can't cast double to int8":                                   to_int(Float{"1.5", true}, "int8"),
+    } {
+        var program Program = Program{[]interface{}{Assignment{"x", value}}}
+        if _, diagnostics, ok := try_generate(program, default_backend_options()); ok ||
+            !strings.Contains(strings.Join(diagnostics, "\n"), expected) {
+            t.Errorf("generating %s reported %q, expected %q", encode_ast(value), diagnostics, expected)
+        }
+    }
+}
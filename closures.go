@@ -0,0 +1,180 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// returns how deeply the code being generated is nested; main
+// is 0, top-level functions are 1, functions nested in them are 2
+func (backend *MIPSBackend) __depth() int {
+    if backend.current_function == "" {
+        return 0
+    }
+    return backend.function_depths[backend.current_function]
+}
+
+// returns the label of the function a call to 'name' refers to;
+// nested functions are searched from the innermost scope out,
+// then the module's own functions, then the ones it imports
+func (backend *MIPSBackend) __resolve_function(name string) (string, bool) {
+    var path []string
+    if backend.current_function != "" {
+        path = strings.Split(backend.current_function, "__")
+    }
+    for i := len(path); i > 0; i-- {
+        var label string = strings.Join(append(append([]string{}, path[:i]...), name), "__")
+        if _, ok := backend.functions[label]; ok {
+            return label, true
+        }
+    }
+    var label string = mangle(backend.options.module, name)
+    if _, ok := backend.functions[label]; ok {
+        return label, true
+    }
+    if extern, ok := backend.options.externs[name]; ok {
+        return extern.label, true
+    }
+    return "", false
+}
+
+// returns how many static links have to be followed to reach the
+// frame that 'name' lives in; 0 means the current frame
+func (backend *MIPSBackend) __hops(name string) (int, bool) {
+    if _, ok := backend.access_loc[name]; ok {
+        return 0, true
+    }
+    for i := len(backend.enclosing) - 1; i >= 0; i-- {
+        if _, ok := backend.enclosing[i][name]; ok {
+            return len(backend.enclosing) - i, true
+        }
+    }
+    return 0, false
+}
+
+// returns true if 'name' is a variable of an enclosing function
+func (backend *MIPSBackend) __captured(name string) bool {
+    hops, ok := backend.__hops(name)
+    return ok && hops != 0
+}
+
+// returns the type of a variable, looking through the
+// enclosing functions as well
+func (backend *MIPSBackend) __variable_type(name string) string {
+    if _, ok := backend.statics[name]; ok {
+        return "int"
+    }
+    hops, ok := backend.__hops(name)
+    if !ok || hops == 0 {
+        return backend.name_types[name]
+    }
+    return backend.enclosing_types[len(backend.enclosing)-hops][name]
+}
+
+// returns the location of a variable; for variables of the
+// current frame that's just its slot, otherwise it emits:
+// lw $t0, -4($sp)
+// lw $t0, -4($t0)
+// to follow the static links (one load per hop) into 'register',
+// and returns the variable's slot relative to 'register'
+func (backend *MIPSBackend) __variable_location(name string, register string) string {
+    hops, ok := backend.__hops(name)
+    if !ok || hops == 0 {
+        return backend.access_loc[name]
+    }
+    var link int = int(backend.target.word_size)
+    backend.__emit_main("lw", register, fmt.Sprintf("-%d($sp)", link), "")
+    for i := 1; i < hops; i++ {
+        backend.__emit_main("lw", register, fmt.Sprintf("-%d(%s)", link, register), "")
+    }
+    var location string = backend.enclosing[len(backend.enclosing)-hops][name]
+    return strings.Replace(location, "($sp)", fmt.Sprintf("(%s)", register), 1)
+}
+
+// passes the static link to a nested function whose enclosing
+// function is at depth 'parent_depth'; emits:
+// addiu $v1, $sp, 12
+// when the caller is the enclosing function (such that 12 undoes
+// the caller's '$sp' adjustment), or:
+// lw $v1, 8($sp)
+// lw $v1, -4($v1)
+// to follow the caller's own static links up to it
+func (backend *MIPSBackend) __static_link(parent_depth int, frame_size uint) {
+    var hops int = backend.__depth() - parent_depth
+    if hops == 0 {
+        backend.__emit_main("addiu", "$v1", "$sp", fmt.Sprint(frame_size))
+        return
+    }
+    // the caller's link slot is the first one below its own $sp
+    var link int = int(backend.target.word_size)
+    backend.__emit_main("lw", "$v1", fmt.Sprintf("%d($sp)", int(frame_size)-link), "")
+    for i := 1; i < hops; i++ {
+        backend.__emit_main("lw", "$v1", fmt.Sprintf("-%d($v1)", link), "")
+    }
+}
+
+// escape analysis for nested functions; returns the names of the
+// functions defined directly in 'body' that are used as values
+// (anything other than being called), since a closure that outlives
+// its enclosing call would need its captured variables moved to the
+// heap. calls are the only thing that can be done with a nested
+// function, so none of them escape and captured variables stay in
+// the enclosing frame, reached through the static link
+func escaping_functions(body []interface{}) (ret []string) {
+    var nested map[string]bool = map[string]bool{}
+    for _, node := range body {
+        if function, ok := node.(Function); ok {
+            nested[function.name] = true
+        }
+    }
+    var visit func(__node interface{})
+    visit = func(__node interface{}) {
+        switch node := __node.(type) {
+        case Ident:
+            if nested[node.name] {
+                ret = append(ret, node.name)
+            }
+        case ArithmeticOp:
+            visit(node.left)
+            visit(node.right)
+        case Assignment:
+            visit(node.value)
+        case Let:
+            visit(node.value)
+        case Var:
+            visit(node.value)
+        case ExprStmt:
+            visit(node.value)
+        case Call:
+            for _, arg := range node.args {
+                visit(arg)
+            }
+        case Return:
+            visit(node.value)
+        case If:
+            visit(node.cond)
+            for _, item := range append(append([]interface{}{}, node.then...), node.otherwise...) {
+                visit(item)
+            }
+        case Hint:
+            visit(node.cond)
+        case Cast:
+            visit(node.value)
+        case Index:
+            visit(node.value)
+            visit(node.index)
+        case Slice:
+            visit(node.value)
+            visit(node.low)
+            visit(node.high)
+        case Interp:
+            for _, part := range node.parts {
+                visit(part)
+            }
+        }
+    }
+    for _, node := range body {
+        visit(node)
+    }
+    return
+}
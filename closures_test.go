@@ -0,0 +1,20 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func Test_escaping_functions(t *testing.T) {
+    var body []interface{} = []interface{}{
+        Function{"g", nil, []interface{}{Return{Integer{"1"}}}, false},
+        Function{"h", nil, []interface{}{Return{Integer{"2"}}}, false},
+        Function{"k", nil, []interface{}{Return{Integer{"3"}}}, false},
+        Assignment{"a", Call{"g", nil}},
+        Var{"b", Ident{"h"}},
+        Let{"c", Ident{"k"}},
+    }
+    if escaping := escaping_functions(body); !reflect.DeepEqual(escaping, []string{"h", "k"}) {
+        t.Errorf("escaping functions are %v, expected [h k]", escaping)
+    }
+}
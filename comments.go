@@ -0,0 +1,69 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// gives an instruction a comment, which 'assemble' writes after it;
+// passes use it to say what they changed, e.g. converts:
+// bne $t0,$t1,L2
+// =>
+// beq $t0,$t1,L3                 # inverted from bne
+// an instruction has at most one comment (the last one given), and
+// it stays with the instruction wherever later passes move it
+func (backend *MIPSBackend) comment(instruction *Instruction, text string) {
+    instruction.comment = text
+}
+
+// gives the instruction emitted last a comment (see 'comment')
+func (backend *MIPSBackend) __comment_last(text string) {
+    backend.comment(&backend.main_section[len(backend.main_section)-1], text)
+}
+
+// an entry of a data section (a label and its data, or a directive
+// like '.align'), with an optional comment, as for instructions
+type DataItem struct {
+    text    string
+    comment string
+}
+
+// returns the line a data item takes in its section (see
+// 'with_comment')
+func (item DataItem) render() string {
+    if item.comment == "" {
+        return item.text
+    }
+    return with_comment(item.text, item.comment)
+}
+
+// returns a line of code followed by a comment, lined up with the
+// comments of the lines around it; converts:
+// "lwc1 $f12,0($t1)", "2.50"
+// =>
+// lwc1 $f12,0($t1)               # 2.50
+// the data sections are kept as text, so their items are emitted
+// with it (see 'strip_comment')
+func with_comment(line string, comment string) string {
+    return fmt.Sprintf("%-30s # %s", line, comment)
+}
+
+// returns a line of a data section without its comment (see
+// 'with_comment'); a '#' in a string literal doesn't start one
+func strip_comment(line string) string {
+    var quoted bool
+    for i := 0; i < len(line); i++ {
+        switch line[i] {
+        case '\\':
+            // skips the escaped character
+            i++
+        case '"':
+            quoted = !quoted
+        case '#':
+            if !quoted {
+                return strings.TrimRight(line[:i], " \t")
+            }
+        }
+    }
+    return line
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// returns the lines of each procedure of a program (without their
+// indentation), and the labels of the procedures in order
+func procedure_lines(backend *MIPSBackend) (map[string][]string, []string) {
+    var (
+        lines  map[string][]string = map[string][]string{}
+        labels []string
+    )
+    for _, procedure := range backend.text_procedures(true) {
+        lines[procedure.label] = code_lines(render_instructions(procedure.instructions()))
+        labels = append(labels, procedure.label)
+    }
+    return lines, labels
+}
+
+// returns the number of instructions in some lines of code
+// (everything but labels)
+func count_instructions(lines []string) (count int) {
+    for _, line := range lines {
+        if !strings.HasSuffix(line, ":") {
+            count++
+        }
+    }
+    return
+}
+
+// returns the code of two compilations of a program side by side
+// (see 'side_by_side'), procedure by procedure, each with how many
+// instructions it gained or lost; e.g.:
+// main: 9 -> 7 (-2)
+//     main:                    main:
+//     li $t0,321             | li $t0,321
+//     ...
+// total: 9 -> 7 (-2)
+// the data section is compared too, if it changed
+func compare_backends(before *MIPSBackend, after *MIPSBackend) string {
+    var (
+        ret                         strings.Builder
+        before_lines, before_labels          = procedure_lines(before)
+        after_lines, after_labels            = procedure_lines(after)
+        labels                      []string = before_labels
+        before_total, after_total   int
+    )
+    // procedures only the second program has go last
+    for _, label := range after_labels {
+        if _, ok := before_lines[label]; !ok {
+            labels = append(labels, label)
+        }
+    }
+    for _, label := range labels {
+        var old, new int = count_instructions(before_lines[label]), count_instructions(after_lines[label])
+        before_total, after_total = before_total+old, after_total+new
+        fmt.Fprintf(&ret, "%s: %d -> %d (%+d)\n", label, old, new, new-old)
+        for _, row := range side_by_side(before_lines[label], after_lines[label]) {
+            fmt.Fprintf(&ret, "    %s\n", row)
+        }
+    }
+    var before_data, after_data []string = code_lines(before.data_section + before.rodata_section + before.bss_section),
+        code_lines(after.data_section + after.rodata_section + after.bss_section)
+    if strings.Join(before_data, "\n") != strings.Join(after_data, "\n") {
+        fmt.Fprintf(&ret, "data:\n")
+        for _, row := range side_by_side(before_data, after_data) {
+            fmt.Fprintf(&ret, "    %s\n", row)
+        }
+    }
+    fmt.Fprintf(&ret, "total: %d -> %d (%+d)\n", before_total, after_total, after_total-before_total)
+    return ret.String()
+}
+
+// scg diff [flags] -against flags ast.json
+// compiles a program with two sets of options (e.g. -against -O2
+// to see what optimizing does) and prints the code of both side
+// by side (see 'compare_backends'); exits with 1 if either
+// compilation fails
+func diff_options(args []string) {
+    var (
+        flags   *flag.FlagSet  = flag.NewFlagSet("diff", flag.ExitOnError)
+        options BackendOptions = default_backend_options()
+        against *string        = flags.String("against", "", "the flags of the second compilation (e.g. \"-O2 -whole-program\")")
+    )
+    backend_flags(flags, &options)
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        fmt.Fprintln(os.Stderr, "usage: scg diff [flags] -against flags ast.json")
+        os.Exit(2)
+    }
+    // the second compilation starts from the defaults too, rather
+    // than from the first one's flags
+    var (
+        against_flags   *flag.FlagSet  = flag.NewFlagSet("against", flag.ContinueOnError)
+        against_options BackendOptions = default_backend_options()
+    )
+    backend_flags(against_flags, &against_options)
+    if err := against_flags.Parse(strings.Fields(*against)); err != nil {
+        os.Exit(2)
+    }
+    data, err := os.ReadFile(flags.Arg(0))
+    var ast interface{}
+    if err == nil {
+        ast, err = decode_ast(data)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(0), err)
+        os.Exit(1)
+    }
+    var backends [2]MIPSBackend
+    for i, options := range []BackendOptions{options, against_options} {
+        backend, diagnostics, ok := try_generate(ast, options)
+        for _, diagnostic := range diagnostics {
+            fmt.Fprintln(os.Stderr, diagnostic)
+        }
+        if !ok {
+            os.Exit(1)
+        }
+        backends[i] = backend
+    }
+    fmt.Print(compare_backends(&backends[0], &backends[1]))
+}
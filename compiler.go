@@ -0,0 +1,50 @@
+package main
+
+import "context"
+
+// a configured compiler, which any number of goroutines can share
+// (e.g. the requests to 'serve'); it never changes once it's made,
+// and everything a compilation changes lives in a backend of its
+// own (see 'backend_pool')
+type Compiler struct {
+    options BackendOptions
+}
+
+// 'Compiler' constructor; copies what the caller could still change
+// in the options, and leaves out the 'TimeReport' (which only one
+// compilation at a time can add to). the emission hooks (see
+// 'before_emit') are shared, so they have to be safe to call
+// from several goroutines
+func new_compiler(options BackendOptions) *Compiler {
+    var externs map[string]Extern = map[string]Extern{}
+    for name, extern := range options.externs {
+        externs[name] = extern
+    }
+    options.externs = externs
+    options.warnings = copy_without(options.warnings, nil)
+    options.reserved_registers = append([]string{}, options.reserved_registers...)
+    options.scaffold.startup = append([]Instruction{}, options.scaffold.startup...)
+    options.scaffold.exit = append([]Instruction{}, options.scaffold.exit...)
+    options.before_emit = append([]func(*Instruction){}, options.before_emit...)
+    options.after_emit = append([]func(*Instruction){}, options.after_emit...)
+    options.time_report = nil
+    return &Compiler{options}
+}
+
+// compiles an ast (see 'decode_ast'); the artifact only has the
+// diagnostics if there were errors, or if the context ran out
+func (compiler *Compiler) compile(ctx context.Context, data []byte) Artifact {
+    var options BackendOptions = compiler.options
+    options.context = ctx
+    ast, err := decode_ast_with(ctx, data)
+    if err != nil {
+        return Artifact{"", nil, nil, Stats{}, []Diagnostic{{0, "Error", err.Error(), Instruction{}, nil}}}
+    }
+    var backend *MIPSBackend = backend_pool.Get().(*MIPSBackend)
+    defer backend_pool.Put(backend)
+    diagnostics, ok := backend.try_generate(ast, options)
+    if !ok {
+        return Artifact{"", nil, nil, Stats{}, diagnostics}
+    }
+    return backend.artifact()
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// the keys of a project file (see 'parse_config') that set
+// flags, and the flags they set
+var config_flags = map[string]string{
+    "target":           "target",
+    "abi":              "abi",
+    "stack_align":      "stack-align",
+    "libc":             "libc",
+    "stack_top":        "stack-top",
+    "base":             "base",
+    "byte_order":       "byte-order",
+    "pic":              "fpic",
+    "string_labels":    "string-labels",
+    "output":           "o",
+    "watch":            "watch",
+    "split":            "split",
+    "format":           "format",
+    "whole_program":    "whole-program",
+    "branchless":       "fbranchless",
+    "branch_likely":    "fbranch-likely",
+    "inline_threshold": "finline-threshold",
+    "unroll_loops":     "funroll-loops",
+    "werror":           "Werror",
+    "max_errors":       "fmax-errors",
+    "check_discipline": "check-discipline",
+    "go_package":       "go-package",
+    "go_const":         "go-const",
+    "profile":          "profile",
+    "coverage":         "coverage",
+    "stats":            "stats",
+    "size_report":      "size-report",
+    "artifact":         "artifact",
+    "source_map":       "source-map",
+    "listing":          "listing",
+    "ld_script":        "ld-script",
+    "debug_info":       "g",
+    "symbolic":         "symbolic",
+    "stream":           "stream",
+    "time_report":      "time-report",
+    "trace":            "trace",
+    "timeout":          "timeout",
+}
+
+// parses a value of a project file, returning what's left of
+// the line after it; values are strings (with double quotes),
+// integers, booleans, or arrays of strings
+func parse_config_value(text string) (interface{}, string, error) {
+    text = strings.TrimLeft(text, " \t")
+    switch {
+    case strings.HasPrefix(text, `"`):
+        quoted, err := strconv.QuotedPrefix(text)
+        if err != nil {
+            return nil, "", fmt.Errorf("unterminated string")
+        }
+        value, err := strconv.Unquote(quoted)
+        if err != nil {
+            return nil, "", err
+        }
+        return value, text[len(quoted):], nil
+    case strings.HasPrefix(text, "["):
+        var items []string = []string{}
+        text = strings.TrimLeft(text[1:], " \t")
+        for !strings.HasPrefix(text, "]") {
+            item, rest, err := parse_config_value(text)
+            if err != nil {
+                return nil, "", err
+            }
+            if _, ok := item.(string); !ok {
+                return nil, "", fmt.Errorf("arrays can only have strings")
+            }
+            items = append(items, item.(string))
+            text = strings.TrimLeft(rest, " \t")
+            if strings.HasPrefix(text, ",") {
+                text = strings.TrimLeft(text[1:], " \t")
+            } else if !strings.HasPrefix(text, "]") {
+                return nil, "", fmt.Errorf("expected ',' or ']' in an array")
+            }
+        }
+        return items, text[1:], nil
+    }
+    var (
+        end   int    = strings.IndexAny(text+" ", " \t#,]")
+        token string = text[:end]
+    )
+    if token == "true" || token == "false" {
+        return token == "true", text[end:], nil
+    }
+    if value, err := strconv.ParseInt(token, 0, 64); err == nil {
+        return value, text[end:], nil
+    }
+    return nil, "", fmt.Errorf("invalid value '%s' (strings need double quotes)", token)
+}
+
+// parses a project file, which is a small part of TOML (tables,
+// and keys with the values 'parse_config_value' knows about);
+// converts:
+// target = "linux"
+// [warnings]
+// unused-variable = "ignore"
+// =>
+// {"target": "linux", "warnings.unused-variable": "ignore"}
+func parse_config(text string) (map[string]interface{}, error) {
+    var (
+        values map[string]interface{} = map[string]interface{}{}
+        table  string
+    )
+    for i, line := range strings.Split(text, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        if strings.HasPrefix(line, "[") {
+            end := strings.Index(line, "]")
+            if end == -1 || strings.TrimSpace(line[1:end]) == "" {
+                return nil, fmt.Errorf("line %d: invalid table", i+1)
+            }
+            if rest := strings.TrimSpace(line[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+                return nil, fmt.Errorf("line %d: unexpected '%s' after the table", i+1, rest)
+            }
+            table = strings.TrimSpace(line[1:end]) + "."
+            continue
+        }
+        key, text, ok := strings.Cut(line, "=")
+        if key = table + strings.TrimSpace(key); !ok || strings.TrimSpace(key) == table {
+            return nil, fmt.Errorf("line %d: expected <key> = <value>", i+1)
+        }
+        value, rest, err := parse_config_value(text)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %v", i+1, err)
+        }
+        if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+            return nil, fmt.Errorf("line %d: unexpected '%s' after the value", i+1, rest)
+        }
+        if _, ok := values[key]; ok {
+            return nil, fmt.Errorf("line %d: '%s' is set twice", i+1, key)
+        }
+        values[key] = value
+    }
+    return values, nil
+}
+
+// applies a project file to the flags that weren't given on the
+// command line (so that flags always win), returning its inputs;
+// e.g. a project of two modules, compiled into one program (see
+// 'link_modules'):
+// inputs = ["main.json", "lib.json"]
+// target = "linux"
+// optimize = 2
+// output = "program.s"
+// reserved_registers = ["$t8", "$t9"]
+// [warnings]
+// shadowing = "error"
+func apply_config(path string, flags *flag.FlagSet, warnings map[string]string) ([]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    values, err := parse_config(string(data))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", path, err)
+    }
+    var (
+        given  map[string]bool = given_flags(flags)
+        inputs []string
+        keys   []string
+    )
+    // sets a flag the command line didn't; false leaves the flags
+    // that can only be switched on (e.g. -trace) alone
+    var set = func(name string, value interface{}) error {
+        if given[name] || value == false && switch_flag(flags.Lookup(name)) {
+            return nil
+        }
+        return flags.Set(name, fmt.Sprint(value))
+    }
+    for key := range values {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        var value interface{} = values[key]
+        switch name, warning := config_flags[key], strings.TrimPrefix(key, "warnings."); {
+        case key == "inputs":
+            inputs, err = config_strings(value)
+        case key == "optimize":
+            if level, ok := value.(int64); !ok || level < 0 || level > 2 {
+                err = fmt.Errorf("expected 0, 1, or 2")
+            } else if level == 2 {
+                err = set("O2", true)
+            }
+        case key == "reserved_registers":
+            var registers []string
+            if registers, err = config_strings(value); err == nil && len(registers) != 0 {
+                err = set("freserve", strings.Join(registers, ","))
+            }
+        case key == "share_slots":
+            if share, ok := value.(bool); !ok {
+                err = fmt.Errorf("expected a boolean")
+            } else if !share {
+                err = set("no-slot-sharing", true)
+            }
+        case warning != key:
+            if _, ok := warnings[warning]; !ok {
+                err = parse_severity(fmt.Sprintf("%s=%v", warning, value), warnings)
+            }
+        case name != "":
+            if _, ok := value.([]string); ok {
+                err = fmt.Errorf("expected a single value")
+            } else {
+                err = set(name, value)
+            }
+        default:
+            err = fmt.Errorf("unknown key")
+        }
+        if err != nil {
+            return nil, fmt.Errorf("%s: '%s': %v", path, key, err)
+        }
+    }
+    return inputs, nil
+}
+
+// returns the names of the flags given on the command line
+func given_flags(flags *flag.FlagSet) map[string]bool {
+    var given map[string]bool = map[string]bool{}
+    flags.Visit(func(flag *flag.Flag) {
+        given[flag.Name] = true
+    })
+    return given
+}
+
+// returns true if a flag can only be switched on, like the ones
+// 'flag.BoolFunc' defines, for which "-name=false" does the same
+// as "-name"
+func switch_flag(flag *flag.Flag) bool {
+    if flag == nil {
+        return false
+    }
+    value, ok := flag.Value.(interface{ IsBoolFlag() bool })
+    return ok && value.IsBoolFlag() && flag.DefValue == ""
+}
+
+// returns a value of a project file that has to be an array
+// of strings
+func config_strings(value interface{}) ([]string, error) {
+    strings, ok := value.([]string)
+    if !ok {
+        return nil, fmt.Errorf("expected an array of strings")
+    }
+    return strings, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+    "flag"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// every form of value, with tables and comments around them
+func Test_parse_config(t *testing.T) {
+    var cases = []struct {
+        text     string
+        expected map[string]interface{}
+    }{
+        {"", map[string]interface{}{}},
+        {"# only a comment\n\n   \n", map[string]interface{}{}},
+        {`target = "linux"`, map[string]interface{}{"target": "linux"}},
+        {`output = "a \"b\"\tc.s"`, map[string]interface{}{"output": "a \"b\"\tc.s"}},
+        {`output = "#not a comment" # a comment`, map[string]interface{}{"output": "#not a comment"}},
+        {"max_errors = 5\nstack_top = 0x7ff0\ntimeout = -1",
+            map[string]interface{}{"max_errors": int64(5), "stack_top": int64(0x7ff0), "timeout": int64(-1)}},
+        {"werror = true\nstats = false#off", map[string]interface{}{"werror": true, "stats": false}},
+        {`inputs = ["a.json", "b.json"]`, map[string]interface{}{"inputs": []string{"a.json", "b.json"}}},
+        {`inputs = [ "a.json" , ]`, map[string]interface{}{"inputs": []string{"a.json"}}},
+        {`inputs = []`, map[string]interface{}{"inputs": []string{}}},
+        {"  target = \"bare\"  \n[warnings]\nshadowing = \"error\"\n[ more ] # a table\nx = 1",
+            map[string]interface{}{"target": "bare", "warnings.shadowing": "error", "more.x": int64(1)}},
+    }
+    for _, test := range cases {
+        values, err := parse_config(test.text)
+        if err != nil {
+            t.Errorf("%q: %v", test.text, err)
+        } else if !reflect.DeepEqual(values, test.expected) {
+            t.Errorf("%q parsed to %#v, expected %#v", test.text, values, test.expected)
+        }
+    }
+}
+
+// errors point at the line they're on
+func Test_parse_config_errors(t *testing.T) {
+    var cases = []struct {
+        text     string
+        expected string
+    }{
+        {"[", "line 1: invalid table"},
+        {"# fine\n[ ]", "line 2: invalid table"},
+        {"[warnings] shadowing = \"error\"", "line 1: unexpected 'shadowing = \"error\"' after the table"},
+        {"target\n", "line 1: expected <key> = <value>"},
+        {"\n\n = 1", "line 3: expected <key> = <value>"},
+        {"[warnings]\n= \"error\"", "line 2: expected <key> = <value>"},
+        {"target = linux", "line 1: invalid value 'linux' (strings need double quotes)"},
+        {"target =", "line 1: invalid value '' (strings need double quotes)"},
+        {"x = 1\ntarget = \"linux", "line 2: unterminated string"},
+        {`inputs = [1, 2]`, "line 1: arrays can only have strings"},
+        {`inputs = ["a" "b"]`, "line 1: expected ',' or ']' in an array"},
+        {`inputs = ["a"`, "line 1: expected ',' or ']' in an array"},
+        {`inputs = [["a"]]`, "line 1: arrays can only have strings"},
+        {"werror = true false", "line 1: unexpected 'false' after the value"},
+        {"target = \"a\"\n\ntarget = \"b\"", "line 3: 'target' is set twice"},
+        {"[warnings]\nshadowing = \"error\"\n[warnings]\nshadowing = \"ignore\"", "line 4: 'warnings.shadowing' is set twice"},
+    }
+    for _, test := range cases {
+        values, err := parse_config(test.text)
+        if err == nil {
+            t.Errorf("%q parsed to %v, expected the error %q", test.text, values, test.expected)
+        } else if err.Error() != test.expected {
+            t.Errorf("%q failed with %q, expected %q", test.text, err, test.expected)
+        }
+    }
+}
+
+// flags on the command line win over the project file, which
+// sets the rest
+func Test_apply_config(t *testing.T) {
+    var path string = filepath.Join(t.TempDir(), "scg.toml")
+    // returns the options after applying a project file over
+    // the given flags
+    var apply = func(text string, args ...string) (BackendOptions, []string, error) {
+        var (
+            flags   *flag.FlagSet  = flag.NewFlagSet("scg", flag.ContinueOnError)
+            options BackendOptions = default_backend_options()
+        )
+        backend_flags(flags, &options)
+        if err := flags.Parse(args); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        inputs, err := apply_config(path, flags, options.warnings)
+        return options, inputs, err
+    }
+    var project string = `inputs = ["main.json", "lib.json"]
+target = "linux"
+optimize = 2
+share_slots = false
+max_errors = 3
+branchless = true
+inline_threshold = 8
+reserved_registers = ["$t8", "$t9"]
+[warnings]
+shadowing = "error"
+unused-variable = "ignore"
+`
+    options, inputs, err := apply(project, "-target", "bare", "-W", "unused-variable=error")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(inputs, []string{"main.json", "lib.json"}) {
+        t.Errorf("the inputs are %v", inputs)
+    }
+    if options.target != "bare" || options.optimize != 2 || options.share_slots || options.max_errors != 3 ||
+        !options.branchless || options.inline_threshold != 8 {
+        t.Errorf("got -target %s, optimize %d, share_slots %t, -fmax-errors %d, -fbranchless %t and -finline-threshold=%d",
+            options.target, options.optimize, options.share_slots, options.max_errors, options.branchless, options.inline_threshold)
+    }
+    if !reflect.DeepEqual(options.reserved_registers, []string{"$t8", "$t9"}) {
+        t.Errorf("the reserved registers are %v", options.reserved_registers)
+    }
+    var expected = map[string]string{"shadowing": "error", "unused-variable": "error"}
+    if !reflect.DeepEqual(options.warnings, expected) {
+        t.Errorf("the warnings are %v, expected %v", options.warnings, expected)
+    }
+    // the file's name and the key come first
+    var cases = map[string]string{
+        "optimize = 3":                     "'optimize': expected 0, 1, or 2",
+        `optimize = "2"`:                   "'optimize': expected 0, 1, or 2",
+        "share_slots = 1":                  "'share_slots': expected a boolean",
+        `inputs = "main.json"`:             "'inputs': expected an array of strings",
+        `reserved_registers = "$t8"`:       "'reserved_registers': expected an array of strings",
+        `target = ["linux"]`:               "'target': expected a single value",
+        "max_errors = true":                "'max_errors': parse error",
+        "colour = true":                    "'colour': unknown key",
+        "[warnings]\nloud = \"on\"":        "'warnings.loud': unknown warning 'loud'",
+        "[warnings]\nshadowing = \"loud\"": "'warnings.shadowing': unknown severity 'loud' (expected error, warning, or ignore)",
+        "target = linux":                   "line 1: invalid value 'linux' (strings need double quotes)",
+    }
+    for text, expected := range cases {
+        if _, _, err := apply(text); err == nil {
+            t.Errorf("%q was applied, expected the error %q", text, expected)
+        } else if err.Error() != path+": "+expected {
+            t.Errorf("%q failed with %q, expected %q", text, err, path+": "+expected)
+        }
+    }
+}
+
+// every code generation flag can be set by a project file, through
+// a key of 'config_flags' or one that sets it its own way
+func Test_config_covers_flags(t *testing.T) {
+    var (
+        flags   *flag.FlagSet   = flag.NewFlagSet("scg", flag.ContinueOnError)
+        options BackendOptions  = default_backend_options()
+        keys    map[string]bool = map[string]bool{}
+        // the keys 'apply_config' handles itself
+        special = map[string]string{
+            "O2":              "optimize",
+            "no-slot-sharing": "share_slots",
+            "freserve":        "reserved_registers",
+            "W":               "[warnings]",
+        }
+    )
+    backend_flags(flags, &options)
+    for key, name := range config_flags {
+        keys[name] = true
+        if key != strings.ReplaceAll(key, "-", "_") {
+            t.Errorf("the key '%s' has a '-'", key)
+        }
+    }
+    flags.VisitAll(func(flag *flag.Flag) {
+        if !keys[flag.Name] && special[flag.Name] == "" {
+            t.Errorf("-%s has no key in 'config_flags'", flag.Name)
+        }
+    })
+    // switches that can only be turned on stay off for false
+    var path string = filepath.Join(t.TempDir(), "scg.toml")
+    for text, expected := range map[string]bool{"trace = false": false, "trace = true": true} {
+        var (
+            switches *flag.FlagSet = flag.NewFlagSet("scg", flag.ContinueOnError)
+            traced   bool
+        )
+        switches.BoolFunc("trace", "", func(string) error {
+            traced = true
+            return nil
+        })
+        if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := apply_config(path, switches, map[string]string{}); err != nil || traced != expected {
+            t.Errorf("%q traced: %t (%v)", text, traced, err)
+        }
+    }
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+    "strconv"
+)
+
+// returns true if 'node' assigns to 'name' anywhere, including
+// through the builtins that update a variable in place
+func assigns_to(__node interface{}, name string) bool {
+    switch node := __node.(type) {
+    case Assignment:
+        return node.name == name || assigns_to(node.value, name)
+    case ExprStmt:
+        return assigns_to(node.value, name)
+    case ArithmeticOp:
+        return assigns_to(node.left, name) || assigns_to(node.right, name)
+    case Call:
+        if node.name == "AtomicAdd" || node.name == "CompareAndSwap" {
+            if target, ok := node.args[0].(Ident); ok && target.name == name {
+                return true
+            }
+        }
+        return assigns_to_any(node.args, name)
+    case Return:
+        return assigns_to(node.value, name)
+    case If:
+        return assigns_to(node.cond, name) || assigns_to_any(node.then, name) ||
+            assigns_to_any(node.otherwise, name)
+    case Hint:
+        return assigns_to(node.cond, name)
+    case Cast:
+        return assigns_to(node.value, name)
+    case Index:
+        return assigns_to(node.value, name) || assigns_to(node.index, name)
+    case Slice:
+        return assigns_to(node.value, name) || assigns_to(node.low, name) || assigns_to(node.high, name)
+    case Interp:
+        return assigns_to_any(node.parts, name)
+    case VarArg:
+        return assigns_to(node.index, name)
+    case Function:
+        return assigns_to_any(node.body, name)
+    case ExceptionHandler:
+        return assigns_to_any(node.nodes, name)
+    }
+    return false
+}
+
+// returns true if any of 'nodes' assigns to 'name' (see 'assigns_to')
+func assigns_to_any(nodes []interface{}, name string) bool {
+    for _, node := range nodes {
+        if assigns_to(node, name) {
+            return true
+        }
+    }
+    return false
+}
+
+// fills 'calls' with every call in 'node' by the name of the function,
+// and 'nested' with the names of the nested functions
+func collect_calls(__node interface{}, calls map[string][]Call, nested map[string]bool, top bool) {
+    var all = func(nodes []interface{}) {
+        for _, item := range nodes {
+            collect_calls(item, calls, nested, false)
+        }
+    }
+    switch node := __node.(type) {
+    case Assignment:
+        collect_calls(node.value, calls, nested, false)
+    case ExprStmt:
+        collect_calls(node.value, calls, nested, false)
+    case ArithmeticOp:
+        collect_calls(node.left, calls, nested, false)
+        collect_calls(node.right, calls, nested, false)
+    case Call:
+        calls[node.name] = append(calls[node.name], node)
+        all(node.args)
+    case Return:
+        collect_calls(node.value, calls, nested, false)
+    case If:
+        collect_calls(node.cond, calls, nested, false)
+        all(node.then)
+        all(node.otherwise)
+    case Hint:
+        collect_calls(node.cond, calls, nested, false)
+    case Cast:
+        collect_calls(node.value, calls, nested, false)
+    case Index:
+        collect_calls(node.value, calls, nested, false)
+        collect_calls(node.index, calls, nested, false)
+    case Slice:
+        collect_calls(node.value, calls, nested, false)
+        collect_calls(node.low, calls, nested, false)
+        collect_calls(node.high, calls, nested, false)
+    case Interp:
+        all(node.parts)
+    case VarArg:
+        collect_calls(node.index, calls, nested, false)
+    case Function:
+        if !top {
+            nested[node.name] = true
+        }
+        all(node.body)
+    case ExceptionHandler:
+        all(node.nodes)
+    }
+}
+
+// returns the value every call passes for each parameter of 'function'
+// that only ever gets the same integer literal, by the parameter's
+// index; parameters the function assigns to are left alone
+func constant_params(function Function, calls []Call) map[int]string {
+    var constants map[int]string = map[int]string{}
+    if function.variadic || len(calls) == 0 {
+        return constants
+    }
+    for i, param := range function.params {
+        var (
+            value    string
+            first    int64
+            constant bool = !assigns_to_any(function.body, param)
+        )
+        for _, call := range calls {
+            if !constant || len(call.args) != len(function.params) {
+                constant = false
+                break
+            }
+            literal, ok := call.args[i].(Integer)
+            if !ok {
+                constant = false
+                break
+            }
+            parsed, err := strconv.ParseInt(literal.value, 0, 64)
+            if err != nil || (value != "" && parsed != first) {
+                constant = false
+                break
+            }
+            if value == "" {
+                value, first = literal.value, parsed
+            }
+        }
+        if constant {
+            constants[i] = value
+        }
+    }
+    return constants
+}
+
+// the state of constant propagation
+type Propagator struct {
+    // the constant parameters of each function (see 'constant_params')
+    constants map[string]map[int]string
+}
+
+// copies a node, replacing the parameters in 'values' with their
+// constants and dropping them from every function and call
+func (propagator *Propagator) propagate(__node interface{}, values map[string]string) interface{} {
+    switch node := __node.(type) {
+    case Ident:
+        if value, ok := values[node.name]; ok {
+            return Integer{value}
+        }
+    case ArithmeticOp:
+        return ArithmeticOp{propagator.propagate(node.left, values), node.op, propagator.propagate(node.right, values)}
+    case Assignment:
+        return Assignment{node.name, propagator.propagate(node.value, values)}
+    case ExprStmt:
+        return ExprStmt{propagator.propagate(node.value, values)}
+    case Call:
+        var args []interface{}
+        for i, arg := range node.args {
+            if _, ok := propagator.constants[node.name][i]; !ok {
+                args = append(args, propagator.propagate(arg, values))
+            }
+        }
+        return Call{node.name, args}
+    case Return:
+        if node.value == nil {
+            return node
+        }
+        return Return{propagator.propagate(node.value, values)}
+    case If:
+        return If{propagator.propagate(node.cond, values),
+            propagator.propagate_all(node.then, values), propagator.propagate_all(node.otherwise, values)}
+    case Hint:
+        return Hint{propagator.propagate(node.cond, values), node.likely}
+    case Cast:
+        return Cast{propagator.propagate(node.value, values), node.to}
+    case Index:
+        return Index{propagator.propagate(node.value, values), propagator.propagate(node.index, values)}
+    case Slice:
+        return Slice{propagator.propagate(node.value, values), propagator.propagate(node.low, values),
+            propagator.propagate(node.high, values)}
+    case Interp:
+        return Interp{propagator.propagate_all(node.parts, values)}
+    case VarArg:
+        return VarArg{propagator.propagate(node.index, values)}
+    case Function:
+        var (
+            inner  map[string]string = map[string]string{}
+            params []string
+        )
+        for name, value := range values {
+            inner[name] = value
+        }
+        for i, param := range node.params {
+            // parameters shadow the enclosing function's
+            delete(inner, param)
+            if value, ok := propagator.constants[node.name][i]; ok {
+                inner[param] = value
+                continue
+            }
+            params = append(params, param)
+        }
+        return Function{node.name, params, propagator.propagate_all(node.body, inner), node.variadic}
+    case ExceptionHandler:
+        return ExceptionHandler{propagator.propagate_all(node.nodes, values)}
+    }
+    return __node
+}
+
+// copies a list of nodes through 'propagate'
+func (propagator *Propagator) propagate_all(nodes []interface{}, values map[string]string) (ret []interface{}) {
+    for _, node := range nodes {
+        ret = append(ret, propagator.propagate(node, values))
+    }
+    return
+}
+
+// interprocedural constant propagation; when every call to a function
+// passes the same integer literal for a parameter, converts:
+// func f(a, b) { return a + b }
+// x = f(1, y)
+// z = f(1, 2)
+// =>
+// func f(b) { return 1 + b }
+// x = f(y)
+// z = f(2)
+// this needs every call to be known (see the 'whole_program' option),
+// and only top-level functions are changed, since nested functions
+// with the same name would make calls ambiguous
+func propagate_constants(ast interface{}) interface{} {
+    program, ok := ast.(Program)
+    if !ok {
+        return ast
+    }
+    var (
+        calls      map[string][]Call = map[string][]Call{}
+        nested     map[string]bool   = map[string]bool{}
+        propagator Propagator        = Propagator{map[string]map[int]string{}}
+    )
+    for _, node := range program.nodes {
+        collect_calls(node, calls, nested, true)
+    }
+    for _, node := range program.nodes {
+        if function, ok := node.(Function); ok && !nested[function.name] {
+            if constants := constant_params(function, calls[function.name]); len(constants) != 0 {
+                propagator.constants[function.name] = constants
+            }
+        }
+    }
+    return Program{propagator.propagate_all(program.nodes, map[string]string{})}
+}
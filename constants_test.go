@@ -0,0 +1,99 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+// propagating constant parameters (see 'propagate_constants') keeps
+// what a program prints; only parameters that are never assigned to
+// (even by a nested function capturing them) become constants, and
+// nested functions' own parameters shadow them
+func Test_constant_propagation(t *testing.T) {
+    var (
+        a, b, c, n, q Ident = Ident{"a"}, Ident{"b"}, Ident{"c"}, Ident{"n"}, Ident{"q"}
+        call                = func(name string, args ...interface{}) Call { return Call{name, args} }
+        printed             = func(value interface{}) Call {
+            return call("Printf", String{"%d\\n"}, value)
+        }
+    )
+    var program Program = Program{[]interface{}{
+        // 'a' is always 3 and 'g' captures it, 'b' isn't constant
+        Function{"f", []string{"a", "b"}, []interface{}{
+            Function{"g", []string{"c"}, []interface{}{
+                Return{ArithmeticOp{ArithmeticOp{a, "mul", c}, "addu", b}},
+            }, false},
+            Return{ArithmeticOp{call("g", Integer{"2"}), "subu", call("g", b)}},
+        }, false},
+        // 'q' is always 1, but it's reassigned
+        Function{"h", []string{"p", "q"}, []interface{}{
+            Assignment{"q", ArithmeticOp{q, "addu", Ident{"p"}}},
+            Return{ArithmeticOp{q, "mul", Integer{"10"}}},
+        }, false},
+        // 'n' is always 4, but a nested function reassigns it
+        Function{"k", []string{"n"}, []interface{}{
+            Function{"bump", nil, []interface{}{
+                Assignment{"n", ArithmeticOp{n, "addu", Integer{"100"}}},
+            }, false},
+            ExprStmt{call("bump")},
+            Return{n},
+        }, false},
+        // 'a' is always 10, but 'inner' has an 'a' of its own
+        Function{"shadow", []string{"a"}, []interface{}{
+            Function{"inner", []string{"a"}, []interface{}{Return{ArithmeticOp{a, "addu", Integer{"1"}}}}, false},
+            Return{ArithmeticOp{call("inner", Integer{"5"}), "mul", a}},
+        }, false},
+        // always 7 at the top level, but a nested function has the
+        // same name (and other arguments)
+        Function{"twice", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "addu", Ident{"x"}}}}, false},
+        Function{"outer", []string{"y"}, []interface{}{
+            Function{"twice", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "mul", Integer{"-1"}}}}, false},
+            Return{call("twice", Ident{"y"})},
+        }, false},
+        printed(call("f", Integer{"3"}, Integer{"-4"})),
+        printed(call("f", Integer{"3"}, Integer{"9"})),
+        printed(call("h", Integer{"2"}, Integer{"1"})),
+        printed(call("h", Integer{"-6"}, Integer{"1"})),
+        printed(call("k", Integer{"4"})),
+        printed(call("k", Integer{"4"})),
+        printed(call("shadow", Integer{"10"})),
+        printed(call("twice", Integer{"7"})),
+        printed(call("outer", Integer{"8"})),
+        printed(call("outer", Integer{"8"})),
+    }}
+    // 'h', 'k' and both 'twice' stay as they are
+    var expected []interface{} = []interface{}{
+        Function{"f", []string{"b"}, []interface{}{
+            Function{"g", []string{"c"}, []interface{}{
+                Return{ArithmeticOp{ArithmeticOp{Integer{"3"}, "mul", c}, "addu", b}},
+            }, false},
+            Return{ArithmeticOp{call("g", Integer{"2"}), "subu", call("g", b)}},
+        }, false},
+        program.nodes[1],
+        program.nodes[2],
+        Function{"shadow", nil, []interface{}{
+            program.nodes[3].(Function).body[0],
+            Return{ArithmeticOp{call("inner", Integer{"5"}), "mul", Integer{"10"}}},
+        }, false},
+        program.nodes[4],
+        Function{"outer", nil, []interface{}{
+            program.nodes[5].(Function).body[0],
+            Return{call("twice", Integer{"8"})},
+        }, false},
+    }
+    var propagated []interface{} = propagate_constants(program).(Program).nodes
+    for i, function := range expected {
+        if !reflect.DeepEqual(propagated[i], function) {
+            t.Errorf("propagated\n%s\ninstead of\n%s", encode_ast(propagated[i]), encode_ast(function))
+        }
+    }
+    for _, target := range []string{"mars", "linux-n32"} {
+        for _, inline_threshold := range []int{0, 8} {
+            var options BackendOptions = default_backend_options()
+            options.target, options.optimize, options.whole_program, options.inline_threshold = target, 2, true, inline_threshold
+            if err := check_on_target(program, options); err != nil {
+                t.Errorf("%s -finline-threshold=%d: %v", target, inline_threshold, err)
+            }
+        }
+    }
+}
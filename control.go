@@ -0,0 +1,164 @@
+package main
+
+import (
+    "fmt"
+)
+
+// returns the assignment if 'nodes' is a single assignment
+func single_assignment(nodes []interface{}) (Assignment, bool) {
+    if len(nodes) != 1 {
+        return Assignment{}, false
+    }
+    assignment, ok := nodes[0].(Assignment)
+    return assignment, ok
+}
+
+// a conditional; converts:
+// if cond { a } else { b }
+// =>
+// <code for cond>
+// beq $t0, $0, else1
+// <code for a>
+// j endif2
+// else1:
+// <code for b>
+// endif2:
+// such that $t0 is cond's register; if cond has a 'Hint', the
+// unlikely branch is moved out of line instead (see '__emit_cold'),
+// e.g. for a likely cond:
+// <code for cond>
+// beq $t0, $0, else1
+// <code for a>
+// endif2:
+// ...
+// else1:
+// <code for b>
+// j endif2
+// or, with the 'branch_likely' option, the code for an unlikely
+// cond stays in place and is skipped with 'beql'
+func (backend *MIPSBackend) if_statement(node *If) {
+    if backend.type_of(node.cond) != "int" {
+        panic("the condition of an 'if' must be an int")
+    }
+    if backend.options.branchless && backend.select_assignment(node) {
+        return
+    }
+    backend.codegen(node.cond)
+    var (
+        cond_register string = backend.__pop_n(1)[0]
+        branch        string = "beq"
+    )
+    if hint, ok := node.cond.(Hint); ok {
+        var (
+            hot, cold []interface{} = node.then, node.otherwise
+            skip      string        = "beq"
+            prefix    string        = "else"
+        )
+        if !hint.likely {
+            hot, cold, skip, prefix = node.otherwise, node.then, "bne", "then"
+        }
+        if !hint.likely && backend.options.branch_likely && backend.target.capabilities["branch_likely"] {
+            // the branch over 'then' is the one that's usually taken
+            branch = "beql"
+        } else if len(cold) != 0 {
+            var (
+                cold_label string = backend.__new_label(prefix)
+                end_label  string = backend.__new_label("endif")
+            )
+            backend.__emit_main(skip, cond_register, "$0", cold_label)
+            backend.__free(cond_register)
+            for _, item := range hot {
+                backend.statement(item)
+            }
+            backend.__emit_label(end_label)
+            backend.__emit_cold(cold_label, cold, end_label)
+            return
+        }
+    }
+    var (
+        else_label string = backend.__new_label("else")
+        end_label  string = backend.__new_label("endif")
+    )
+    backend.__emit_main(branch, cond_register, "$0", else_label)
+    backend.__free(cond_register)
+    for _, item := range node.then {
+        backend.statement(item)
+    }
+    if len(node.otherwise) == 0 {
+        // no need to jump over an empty 'else'
+        backend.__emit_label(else_label)
+        return
+    }
+    backend.__emit_main("j", end_label, "", "")
+    backend.__emit_label(else_label)
+    for _, item := range node.otherwise {
+        backend.statement(item)
+    }
+    backend.__emit_label(end_label)
+}
+
+// generates code that rarely runs out of line; emits:
+// then1:
+// <code for nodes>
+// j endif2
+// into the cold section, which comes after the epilogue of the
+// procedure, so that the code around the branch to it stays
+// together (and the branch usually isn't taken)
+func (backend *MIPSBackend) __emit_cold(label string, nodes []interface{}, resume string) {
+    var main_section []Instruction = backend.main_section
+    backend.main_section = []Instruction{}
+    backend.__emit_label(label)
+    for _, item := range nodes {
+        backend.statement(item)
+    }
+    backend.__emit_main("j", resume, "", "")
+    backend.cold_section = append(backend.cold_section, backend.main_section...)
+    backend.main_section = main_section
+}
+
+// a conditional assignment without branches; converts:
+// if cond { x = a } else { x = b }
+// =>
+// <code for cond>
+// <code for a>
+// <code for b>
+// movn $t2, $t1, $t0
+// sw $t2, -4($sp)
+// such that $t0 is cond's register, $t1 is a's, $t2 is b's,
+// and -4 is x's offset from the stack pointer; without an 'else',
+// x's current value is used for b. returns false (generating
+// nothing) if 'node' isn't a simple conditional assignment
+func (backend *MIPSBackend) select_assignment(node *If) bool {
+    then, ok := single_assignment(node.then)
+    if !ok || !backend.target.capabilities["movn"] {
+        return false
+    }
+    var otherwise interface{}
+    if len(node.otherwise) == 0 {
+        if _, ok := backend.access_loc[then.name]; !ok && !backend.__captured(then.name) {
+            return false
+        }
+        otherwise = Ident{then.name}
+    } else {
+        assignment, ok := single_assignment(node.otherwise)
+        if !ok || assignment.name != then.name {
+            return false
+        }
+        otherwise = assignment.value
+    }
+    if backend.type_of(then.value) != backend.type_of(otherwise) {
+        panic(fmt.Sprintf("both branches must assign the same type to '%s'", then.name))
+    }
+    backend.codegen(node.cond)
+    backend.codegen(then.value)
+    backend.codegen(otherwise)
+    var registers []string = backend.__pop_n(3)
+    // the 'else' value is replaced when the condition isn't 0
+    backend.__emit_main("movn", registers[2], registers[1], registers[0])
+    if !backend.__captured(then.name) {
+        backend.name_types[then.name] = backend.type_of(then.value)
+    }
+    backend.__store_variable(then.name, registers[2])
+    backend.__free(registers...)
+    return true
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+)
+
+// the state of 'scg debug': a program running on a 'Machine', whose
+// source is the debug listing of its statements (see 'DebugInfo')
+type Debugger struct {
+    backend MIPSBackend
+    machine *Machine
+    // the listing line of each instruction, by address, and the
+    // addresses where a line starts (where breakpoints stop)
+    lines  map[uint32]int
+    starts map[uint32]bool
+    // the procedures by address, in order (see 'procedure'), and
+    // the address of every label
+    procedures []string
+    addresses  []uint32
+    labels     map[string]uint32
+    // the lines to stop at
+    breakpoints map[int]bool
+    // how much of the program's output has been shown
+    shown int
+}
+
+// 'Debugger' constructor; the program is built with line info
+// (see 'debug_info'), and stops before its first instruction
+func new_debugger(ast interface{}, options BackendOptions) *Debugger {
+    options.debug_info = true
+    var (
+        backend  MIPSBackend = new_mips_backend_with(ast, options)
+        image    Image       = backend.link_image(backend.options.binary_base)
+        debugger *Debugger   = &Debugger{backend, backend.emulated_machine(image), map[uint32]int{},
+            map[uint32]bool{}, nil, nil, image.labels, map[int]bool{}, 0}
+        last int
+    )
+    for _, encoded := range image.text {
+        var line int
+        if len(encoded.source.args) != 0 {
+            line = backend.debug.lines[&encoded.source.args[0]]
+        }
+        for i := range encoded.words {
+            var address uint32 = encoded.address + uint32(4*i)
+            debugger.lines[address] = line
+            debugger.starts[address] = line != 0 && line != last
+            last = line
+        }
+    }
+    for _, procedure := range backend.text_procedures(true) {
+        debugger.procedures = append(debugger.procedures, procedure.label)
+    }
+    sort.Slice(debugger.procedures, func(i, j int) bool {
+        return image.labels[debugger.procedures[i]] < image.labels[debugger.procedures[j]]
+    })
+    for _, label := range debugger.procedures {
+        debugger.addresses = append(debugger.addresses, image.labels[label])
+    }
+    return debugger
+}
+
+// returns the procedure the machine is in
+func (debugger *Debugger) procedure() string {
+    var i int = sort.Search(len(debugger.addresses), func(i int) bool {
+        return debugger.addresses[i] > debugger.machine.pc
+    })
+    if i == 0 {
+        return ""
+    }
+    return debugger.procedures[i-1]
+}
+
+// returns a line of the listing, with its number
+func (debugger *Debugger) line_text(line int) string {
+    return fmt.Sprintf("%d: %s", line, strings.TrimSpace(debugger.backend.debug.listing[line-1]))
+}
+
+// runs the machine until 'stop' returns true after an instruction,
+// or the program ends; faults are returned as errors
+func (debugger *Debugger) run_until(stop func() bool) (err error) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            message, ok := recovered.(string)
+            if !ok {
+                panic(recovered)
+            }
+            debugger.machine.halted = true
+            err = errors.New(message)
+        }
+    }()
+    var machine *Machine = debugger.machine
+    for !machine.halted && machine.pc != machine_halt {
+        if machine.steps == max_emulated_steps {
+            return fmt.Errorf("still running after %d instructions", max_emulated_steps)
+        }
+        machine.step()
+        if stop() {
+            return nil
+        }
+    }
+    machine.halted = true
+    return nil
+}
+
+// returns the value of a variable of the procedure the machine is
+// in, from its stack slot (see 'StackSlot'), or of a static
+func (debugger *Debugger) variable(name string) (int32, error) {
+    var (
+        procedure string = debugger.procedure()
+        location  string
+    )
+    if procedure == "" {
+        return 0, fmt.Errorf("the program isn't running")
+    }
+    for _, slot := range debugger.backend.stack_slots {
+        // the last slot it got is the one it's in
+        if slot.procedure == procedure && slot.name == name {
+            location = slot.location
+        }
+    }
+    if location == "" {
+        if static, ok := debugger.backend.statics[name]; ok {
+            var (
+                label string = debugger.backend.__static_label(name)
+                size  uint32 = uint32(cast_types[static.kind].bits / 8)
+            )
+            return convert(int32(debugger.machine.load(debugger.labels[label], size)), static.kind), nil
+        }
+        return 0, fmt.Errorf("'%s' has no variable '%s'", procedure, name)
+    }
+    offset, base, _ := split_memory(location)
+    value, _ := parse_immediate(offset)
+    return int32(debugger.machine.load(debugger.machine.registers[register_numbers[base]]+uint32(value), 4)), nil
+}
+
+// runs a command, printing what it shows; the commands are:
+// break <line> (or b): stop when the line is about to run
+// continue (or c): run until a breakpoint, or the end
+// step (or s): run until the next line
+// stepi (or si): run one instruction
+// registers (or r): show the registers
+// print <name> (or p): show a variable
+// where (or w): show the line about to run
+// returns false once the program has ended
+func (debugger *Debugger) command(text string, out io.Writer) bool {
+    var (
+        fields  []string = strings.Fields(text)
+        machine *Machine = debugger.machine
+        err     error
+    )
+    if len(fields) == 0 {
+        return true
+    }
+    switch fields[0] {
+    case "break", "b":
+        var line int
+        if _, err = fmt.Sscan(strings.Join(fields[1:], " "), &line); err != nil || len(fields) != 2 {
+            err = fmt.Errorf("usage: break <line>")
+            break
+        }
+        err = fmt.Errorf("line %d has no code", line)
+        for address, start := range debugger.starts {
+            if start && debugger.lines[address] == line {
+                debugger.breakpoints[line], err = true, nil
+            }
+        }
+        if err == nil {
+            fmt.Fprintf(out, "breakpoint at %s\n", debugger.line_text(line))
+        }
+        return debugger.__report(err, out, false)
+    case "continue", "c":
+        err = debugger.run_until(func() bool {
+            return debugger.starts[machine.pc] && debugger.breakpoints[debugger.lines[machine.pc]]
+        })
+    case "step", "s":
+        err = debugger.run_until(func() bool { return debugger.starts[machine.pc] })
+    case "stepi", "si":
+        err = debugger.run_until(func() bool { return true })
+    case "registers", "r":
+        var names [32]string
+        for name, number := range register_numbers {
+            names[number] = name
+        }
+        for number, name := range names {
+            fmt.Fprintf(out, "%-6s0x%08x\n", name, machine.registers[number])
+        }
+        fmt.Fprintf(out, "%-6s0x%08x\n%-6s0x%08x\n%-6s0x%08x\n", "hi", machine.hi, "lo", machine.lo, "pc", machine.pc)
+        return true
+    case "print", "p":
+        if len(fields) != 2 {
+            return debugger.__report(fmt.Errorf("usage: print <name>"), out, false)
+        }
+        value, err := debugger.variable(fields[1])
+        if err == nil {
+            fmt.Fprintf(out, "%s = %d\n", fields[1], value)
+        }
+        return debugger.__report(err, out, false)
+    case "where", "w":
+    default:
+        return debugger.__report(fmt.Errorf("unknown command '%s'", fields[0]), out, false)
+    }
+    return debugger.__report(err, out, true)
+}
+
+// prints what the program printed since the last command, then the
+// error (if any), and where the program is if 'where' is set (or
+// how it exited); returns false once the program has ended
+func (debugger *Debugger) __report(err error, out io.Writer, where bool) bool {
+    var (
+        machine *Machine = debugger.machine
+        output  string   = machine.output.String()
+    )
+    fmt.Fprint(out, output[debugger.shown:])
+    debugger.shown = len(output)
+    if err != nil {
+        fmt.Fprintf(out, "Error: %v\n", err)
+    }
+    if machine.halted || machine.pc == machine_halt {
+        if err == nil {
+            fmt.Fprintf(out, "exited with status %d\n", machine.exit_code)
+        }
+        return false
+    }
+    if !where {
+        return true
+    }
+    if line := debugger.lines[machine.pc]; line != 0 {
+        fmt.Fprintf(out, "%s\n", debugger.line_text(line))
+    } else {
+        fmt.Fprintf(out, "0x%08x in %s\n", machine.pc, debugger.procedure())
+    }
+    return true
+}
+
+// scg debug [flags] ast.json
+// runs the program on the emulator (see 'Machine'), reading
+// commands (see 'command') from stdin; the lines are those of the
+// listing of its statements (see 'DebugInfo'), which it prints first
+func debug(args []string) {
+    var (
+        flags   *flag.FlagSet  = flag.NewFlagSet("debug", flag.ExitOnError)
+        options BackendOptions = default_backend_options()
+    )
+    backend_flags(flags, &options)
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        fmt.Fprintln(os.Stderr, "usage: scg debug [flags] ast.json")
+        os.Exit(2)
+    }
+    data, err := os.ReadFile(flags.Arg(0))
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    ast, err := decode_ast(data)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(0), err)
+        os.Exit(1)
+    }
+    var debugger *Debugger
+    if !run_build(func() { debugger = new_debugger(ast, options) }, nil) {
+        os.Exit(1)
+    }
+    for i, text := range debugger.backend.debug.listing {
+        fmt.Printf("%d: %s\n", i+1, text)
+    }
+    var scanner *bufio.Scanner = bufio.NewScanner(os.Stdin)
+    for fmt.Fprint(os.Stderr, "(scg) "); scanner.Scan(); fmt.Fprint(os.Stderr, "(scg) ") {
+        if text := strings.TrimSpace(scanner.Text()); text == "quit" || text == "q" ||
+            !debugger.command(text, os.Stdout) {
+            break
+        }
+    }
+    fmt.Fprintln(os.Stderr)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// the debugger stops at breakpoints and steps by the lines of the
+// debug listing, and shows the variables of the procedure it's in
+// (from their stack slots) and statics; its output follows the
+// program's
+func Test_debugger(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Static{"total", "int16", "-3"},
+        Function{"square", []string{"x"}, []interface{}{
+            Assignment{"y", ArithmeticOp{Ident{"x"}, "mul", Ident{"x"}}},
+            Return{Ident{"y"}},
+        }, false},
+        Assignment{"a", Integer{"5"}},
+        Assignment{"b", Call{"square", []interface{}{Ident{"a"}}}},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"b"}}},
+        Assignment{"total", ArithmeticOp{Ident{"total"}, "add", Ident{"b"}}},
+    }}
+    // the listing is the statements in order, with the function's
+    // body as lines 3 and 4
+    var debugger *Debugger = new_debugger(program, default_backend_options())
+    var session = []struct {
+        command  string
+        expected []string
+    }{
+        {"s", []string{`5: {"node": "Assignment", "name": "a"`}},
+        {"p c", []string{"Error: 'main' has no variable 'c'"}},
+        {"s", []string{`6: {"node": "Assignment", "name": "b"`}},
+        {"p a", []string{"a = 5"}},
+        {"b 4", []string{`breakpoint at 4: {"node": "Return"`}},
+        {"b 99", []string{"Error: line 99 has no code"}},
+        {"c", []string{`4: {"node": "Return"`}},
+        {"p x", []string{"x = 5"}},
+        {"p y", []string{"y = 25"}},
+        {"p a", []string{"Error: 'square' has no variable 'a'"}},
+        {"r", []string{"$t1   0x00000019", "$a0   0x00000005", "pc    0x004"}},
+        {"b 8", []string{`breakpoint at 8: {"node": "Assignment", "name": "total"`}},
+        {"c", []string{"25\n8: "}},
+        {"p total", []string{"total = -3"}},
+        {"si", []string{"8: "}},
+        {"frobnicate", []string{"Error: unknown command 'frobnicate'"}},
+        {"c", []string{"exited with status 0"}},
+    }
+    for _, step := range session {
+        var out strings.Builder
+        debugger.command(step.command, &out)
+        for _, expected := range step.expected {
+            if !strings.Contains(out.String(), expected) {
+                t.Fatalf("'%s' showed:\n%s\nexpected %q", step.command, out.String(), expected)
+            }
+        }
+    }
+    if running := debugger.command("s", &strings.Builder{}); running {
+        t.Errorf("the program is still running after it exited")
+    }
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// the line information of '-g'; the input has no positions of its
+// own, so the lines are those of a listing of the statements codegen
+// generated (after 'lower'), one per line and indented by nesting;
+// e.g.:
+// {"node": "Assignment", "name": "a", "value": {"node": "Integer", "value": 5}}
+// {"node": "If", "cond": {"node": "Ident", "name": "a"}}
+//     {"node": "Assignment", "name": "b", "value": {"node": "Integer", "value": 1}}
+type DebugInfo struct {
+    listing []string
+    // the line of the statement being generated (0 outside of
+    // any), and how deeply it's nested
+    line  int
+    depth int
+    // the listing line of each instruction, keyed by its first
+    // operand (like 'origins')
+    lines map[*string]int
+}
+
+// returns a statement as a line of the debug listing; statements
+// with blocks leave them out, since their statements get lines of
+// their own
+func debug_text(__node interface{}) string {
+    switch node := __node.(type) {
+    case If:
+        return encode_node(If{node.cond, nil, nil}, "")
+    case Function:
+        return encode_node(Function{node.name, node.params, nil, node.variadic}, "")
+    case ExceptionHandler:
+        return encode_node(ExceptionHandler{nil}, "")
+    }
+    return encode_node(__node, "")
+}
+
+// adds a statement to the debug listing, returning a function that
+// goes back to the enclosing statement once it's generated
+func (backend *MIPSBackend) __debug_statement(node interface{}) func() {
+    var line, depth int = backend.debug.line, backend.debug.depth
+    backend.debug.listing = append(backend.debug.listing, strings.Repeat("    ", depth)+debug_text(node))
+    backend.debug.line, backend.debug.depth = len(backend.debug.listing), depth+1
+    return func() {
+        backend.debug.line, backend.debug.depth = line, depth
+    }
+}
+
+// returns the debug listing, which '.file' in 'assemble_debug'
+// names
+func (backend *MIPSBackend) debug_listing() string {
+    return strings.Join(backend.debug.listing, "\n") + "\n"
+}
+
+// returns the assembly with '.file' and '.loc' directives (which
+// GNU as turns into DWARF line info), so that gdb can step through
+// the debug listing (see 'DebugInfo') saved as 'listing_name'
+func (backend *MIPSBackend) assemble_debug(listing_name string) string {
+    if !backend.target.capabilities["gas"] {
+        panic(fmt.Sprintf("debug info is only for GNU as (e.g. the 'linux' target), not '%s'", backend.options.target))
+    }
+    var (
+        code, lines          = backend.assemble_mapped()
+        ret         []string = []string{fmt.Sprintf("    .file 1 %s", json_string(listing_name))}
+        last        int
+    )
+    for i, text := range strings.Split(code, "\n") {
+        if instruction, ok := lines[i+1]; ok && len(instruction.args) != 0 {
+            if line := backend.debug.lines[&instruction.args[0]]; line != 0 && line != last {
+                ret = append(ret, fmt.Sprintf("        .loc 1 %d", line))
+                last = line
+            }
+        }
+        ret = append(ret, text)
+    }
+    return strings.Join(ret, "\n")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+)
+
+// the warnings the checks can report, and their severities
+// unless the options say otherwise (see 'BackendOptions')
+var warning_severities = map[string]string{
+    // a variable that is assigned but never read
+    "unused-variable": "warning",
+    // a parameter with the same name as a variable
+    // of an enclosing function (or a static)
+    "shadowing": "warning",
+    // a value that doesn't fit a static being stored in it
+    "implicit-conversion": "warning",
+}
+
+// a message about the program; either from the checks that run
+// before codegen (see 'Diagnostics'), or from the assembler,
+// mapped back to the instruction and node it is about
+type Diagnostic struct {
+    // 0 for the checks, which don't know about lines
+    line        int
+    severity    string
+    message     string
+    instruction Instruction
+    // nil if the instruction isn't generated for any node
+    // (e.g. prologues and library routines)
+    node interface{}
+}
+
+func (diagnostic Diagnostic) String() string {
+    if diagnostic.line == 0 {
+        return fmt.Sprintf("%s: %s", diagnostic.severity, diagnostic.message)
+    }
+    if diagnostic.node == nil {
+        return fmt.Sprintf("line %d: %s: %s", diagnostic.line, diagnostic.severity, diagnostic.message)
+    }
+    return fmt.Sprintf("line %d: %s: %s (in '%s', generated for %+v)", diagnostic.line,
+        diagnostic.severity, diagnostic.message, render_instruction(diagnostic.instruction), diagnostic.node)
+}
+
+// what 'Diagnostics' panics with once there are too many errors;
+// unlike the errors themselves (see 'statement'), it isn't recovered
+type ErrorLimit string
+
+// what codegen panics with when it needs the type of a variable
+// whose value came from a statement that failed; 'statement' drops
+// the statement that used it without another error, which would
+// only repeat the first one (e.g. "expects int, got ")
+type Cascaded struct{}
+
+// collects the diagnostics of a run; an error doesn't stop the
+// checks (or codegen), so that all of them are reported at once,
+// but nothing is generated if there were any (see 'check')
+type Diagnostics struct {
+    // the severity of each warning ("error", "warning", or
+    // "ignore") that doesn't have its default one
+    severities map[string]string
+    // report every warning as an error (-Werror)
+    warnings_as_errors bool
+    // give up after this many errors (0 for no limit)
+    max_errors int
+    reported   []Diagnostic
+}
+
+// 'Diagnostics' constructor
+func new_diagnostics(options BackendOptions) Diagnostics {
+    return Diagnostics{options.warnings, options.warnings_as_errors, options.max_errors, []Diagnostic{}}
+}
+
+// reports an error
+func (diagnostics *Diagnostics) error(node interface{}, format string, args ...interface{}) {
+    diagnostics.__report(Diagnostic{0, "Error", fmt.Sprintf(format, args...), Instruction{}, node})
+}
+
+// reports a warning with its severity, which makes it an error
+// (or drops it) if the options say so; converts:
+// warn("unused-variable", node, "'%s' is never used", "a")
+// =>
+// Warning: 'a' is never used [-Wunused-variable]
+func (diagnostics *Diagnostics) warn(name string, node interface{}, format string, args ...interface{}) {
+    severity, ok := diagnostics.severities[name]
+    if !ok {
+        severity, ok = warning_severities[name]
+    }
+    if !ok {
+        panic(fmt.Sprintf("unknown warning '%s'", name))
+    }
+    var message string = fmt.Sprintf(format, args...) + fmt.Sprintf(" [-W%s]", name)
+    switch {
+    case severity == "ignore":
+    case severity == "error" || diagnostics.warnings_as_errors:
+        diagnostics.__report(Diagnostic{0, "Error", message, Instruction{}, node})
+    default:
+        diagnostics.__report(Diagnostic{0, "Warning", message, Instruction{}, node})
+    }
+}
+
+// adds a diagnostic, panicking with every error so far (as an
+// 'ErrorLimit') if it's one error too many
+func (diagnostics *Diagnostics) __report(diagnostic Diagnostic) {
+    diagnostics.reported = append(diagnostics.reported, diagnostic)
+    var errors []Diagnostic = diagnostics.with_severity("Error")
+    if diagnostic.severity == "Error" && diagnostics.max_errors != 0 && len(errors) >= diagnostics.max_errors {
+        panic(ErrorLimit(summarize(errors) + "\ntoo many errors, stopping"))
+    }
+}
+
+// returns the diagnostics with a severity ("Error" or "Warning")
+func (diagnostics *Diagnostics) with_severity(severity string) (ret []Diagnostic) {
+    for _, diagnostic := range diagnostics.reported {
+        if diagnostic.severity == severity {
+            ret = append(ret, diagnostic)
+        }
+    }
+    return
+}
+
+// panics if any errors were reported, with every one of them (see
+// 'summarize')
+func (diagnostics *Diagnostics) check() {
+    if errors := diagnostics.with_severity("Error"); len(errors) != 0 {
+        panic(summarize(errors))
+    }
+}
+
+// returns the messages of a list of errors; converts:
+// 'a' is used before it's declared
+// 'b' is already declared
+// =>
+// 2 errors:
+// 'a' is used before it's declared
+// 'b' is already declared
+// a single error is just its message
+func summarize(errors []Diagnostic) string {
+    if len(errors) == 1 {
+        return errors[0].message
+    }
+    var messages []string
+    for _, diagnostic := range errors {
+        messages = append(messages, diagnostic.message)
+    }
+    return fmt.Sprintf("%d errors:\n%s", len(errors), strings.Join(messages, "\n"))
+}
+
+// generates a program like 'new_mips_backend_with', but returns
+// its diagnostics (as text) and whether it succeeded instead of
+// panicking, for tools that keep running after bad programs
+// (e.g. 'serve' and 'repl')
+func try_generate(ast interface{}, options BackendOptions) (backend MIPSBackend, diagnostics []string, ok bool) {
+    reported, ok := backend.try_generate(ast, options)
+    for _, diagnostic := range reported {
+        diagnostics = append(diagnostics, diagnostic.String())
+    }
+    return
+}
+
+// 'try_generate' into a backend that may have generated another
+// program before (see 'reset'), returning the diagnostics as they are
+func (backend *MIPSBackend) try_generate(ast interface{}, options BackendOptions) (diagnostics []Diagnostic, ok bool) {
+    defer func() {
+        var recovered interface{} = recover()
+        diagnostics, ok = final_diagnostics(backend.diagnostics.reported, recovered), recovered == nil
+    }()
+    backend.reset(options)
+    backend.generate(ast)
+    return
+}
+
+// returns the diagnostics of a run, given the ones it reported and
+// what it panicked with (nil if it didn't); the panic is added as
+// an error of its own unless it's just the errors reported already
+// (see 'check'), so that errors the checks didn't report (e.g. an
+// unknown target, or a bug in the generator) aren't lost
+func final_diagnostics(reported []Diagnostic, recovered interface{}) []Diagnostic {
+    var (
+        ret    []Diagnostic = append([]Diagnostic{}, reported...)
+        errors int
+    )
+    for _, diagnostic := range reported {
+        if diagnostic.severity == "Error" {
+            errors++
+        }
+    }
+    switch recovered.(type) {
+    case nil:
+    case ErrorLimit:
+        // its message repeats the errors
+        ret = append(ret, Diagnostic{0, "Error", "too many errors, stopping", Instruction{}, nil})
+    case Cascaded:
+        // the error it follows from is reported already
+    case string:
+        if errors == 0 {
+            ret = append(ret, Diagnostic{0, "Error", fmt.Sprint(recovered), Instruction{}, nil})
+        }
+    default:
+        // a build that was cancelled (see 'Cancelled', which says
+        // so), or a bug in the generator (e.g. an 'InternalError')
+        ret = append(ret, Diagnostic{0, "Error", fmt.Sprint(recovered), Instruction{}, nil})
+    }
+    return ret
+}
+
+// runs a build for the command line, printing its diagnostics
+// (warnings included, see 'final_diagnostics') to stderr instead
+// of panicking; 'diagnostics' has the ones reported along the way,
+// or is nil if the build only panics with them. returns false if
+// the build failed
+func run_build(build func(), diagnostics *Diagnostics) (ok bool) {
+    defer func() {
+        var (
+            recovered interface{} = recover()
+            reported  []Diagnostic
+        )
+        if diagnostics != nil {
+            reported = diagnostics.reported
+        }
+        for _, diagnostic := range final_diagnostics(reported, recovered) {
+            fmt.Fprintln(os.Stderr, diagnostic)
+        }
+        ok = recovered == nil
+    }()
+    build()
+    return
+}
+
+// sets the severity of a warning from an option; converts:
+// unused-variable=ignore
+// =>
+// severities["unused-variable"] = "ignore"
+func parse_severity(option string, severities map[string]string) error {
+    name, severity, ok := strings.Cut(option, "=")
+    if !ok {
+        return fmt.Errorf("expected <warning>=<severity>, got '%s'", option)
+    }
+    if _, ok := warning_severities[name]; !ok {
+        return fmt.Errorf("unknown warning '%s'", name)
+    }
+    if severity != "error" && severity != "warning" && severity != "ignore" {
+        return fmt.Errorf("unknown severity '%s' (expected error, warning, or ignore)", severity)
+    }
+    severities[name] = severity
+    return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+// a failed build reports its warnings along with its errors
+func Test_failed_build_diagnostics(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Assignment{"a", Ident{"b"}},
+        Assignment{"c", Integer{"1"}},
+    }}
+    _, diagnostics, ok := try_generate(program, default_backend_options())
+    var expected []string = []string{
+        "Error: 'b' is used before it's declared",
+        "Warning: 'a' is never used [-Wunused-variable]",
+        "Warning: 'c' is never used [-Wunused-variable]",
+    }
+    if ok || !reflect.DeepEqual(diagnostics, expected) {
+        t.Errorf("reported %q (ok: %v)", diagnostics, ok)
+    }
+}
+
+// what a build panicked with is only added if it isn't just the
+// errors it reported
+func Test_final_diagnostics(t *testing.T) {
+    var (
+        failure  Diagnostic   = Diagnostic{0, "Error", "'b' is used before it's declared", Instruction{}, nil}
+        warning  Diagnostic   = Diagnostic{0, "Warning", "'a' is never used [-Wunused-variable]", Instruction{}, nil}
+        reported []Diagnostic = []Diagnostic{failure, warning}
+    )
+    if diagnostics := final_diagnostics(reported, summarize([]Diagnostic{failure})); len(diagnostics) != 2 {
+        t.Errorf("the summary of the errors was added again: %v", diagnostics)
+    }
+    if diagnostics := final_diagnostics([]Diagnostic{warning}, "unknown target 'x'"); len(diagnostics) != 2 ||
+        diagnostics[1].message != "unknown target 'x'" {
+        t.Errorf("an error that wasn't reported was lost: %v", diagnostics)
+    }
+    if diagnostics := final_diagnostics(reported, InternalError("popping 1 value(s) off a stack of 0")); len(diagnostics) != 3 ||
+        diagnostics[2].message != "internal error: popping 1 value(s) off a stack of 0" {
+        t.Errorf("a bug in the generator was lost: %v", diagnostics)
+    }
+}
+
+// an error about a variable whose assignment failed only repeats
+// the error the assignment had
+func Test_cascaded_errors(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Function{"f", []string{"a", "b"}, []interface{}{Return{Ident{"a"}}}, false},
+        Assignment{"x", Call{"stdout", []interface{}{Integer{"1"}}}},
+        Assignment{"y", Call{"f", []interface{}{Integer{"1"}, Ident{"x"}}}},
+        Call{"Printf", []interface{}{String{"%d"}, Ident{"y"}}},
+        Call{"Printf", []interface{}{String{"%d"}, String{"z"}}},
+    }}
+    _, diagnostics, ok := try_generate(program, default_backend_options())
+    var expected []string = []string{
+        "Error: 'stdout' takes no arguments",
+        "Error: '%d' in 'Printf' expects int, got string",
+    }
+    if ok || !reflect.DeepEqual(diagnostics, expected) {
+        t.Errorf("reported %q (ok: %v)", diagnostics, ok)
+    }
+}
+
+// a build that stops at '-fmax-errors' says so once, after the
+// errors it found
+func Test_error_limit(t *testing.T) {
+    var (
+        program Program        = Program{[]interface{}{Ident{"a"}, Ident{"b"}, Ident{"c"}}}
+        options BackendOptions = default_backend_options()
+    )
+    options.max_errors = 2
+    _, diagnostics, ok := try_generate(program, options)
+    var expected []string = []string{
+        "Error: 'a' is used before it's declared",
+        "Error: 'b' is used before it's declared",
+        "Error: too many errors, stopping",
+    }
+    if ok || !reflect.DeepEqual(diagnostics, expected) {
+        t.Errorf("reported %q (ok: %v)", diagnostics, ok)
+    }
+}
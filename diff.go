@@ -0,0 +1,117 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// a line of the edit script between two lists of lines (see
+// 'edit_lines'); the kind is ' ' for a line both have, '-' for a
+// removed one, and '+' for an added one
+type Edit struct {
+    kind byte
+    line string
+}
+
+// returns the edits that turn 'before' into 'after', line by line,
+// with the removals of each change before its additions (a longest
+// common subsequence, which is fine for the few thousand lines a
+// program has)
+func edit_lines(before []string, after []string) (ret []Edit) {
+    // common[i][j] is the length of the longest common
+    // subsequence of before[i:] and after[j:]
+    var common [][]int = make([][]int, len(before)+1)
+    for i := range common {
+        common[i] = make([]int, len(after)+1)
+    }
+    for i := len(before) - 1; i >= 0; i-- {
+        for j := len(after) - 1; j >= 0; j-- {
+            if before[i] == after[j] {
+                common[i][j] = common[i+1][j+1] + 1
+            } else {
+                common[i][j] = max(common[i+1][j], common[i][j+1])
+            }
+        }
+    }
+    var i, j int
+    for i < len(before) || j < len(after) {
+        switch {
+        case i < len(before) && j < len(after) && before[i] == after[j]:
+            ret = append(ret, Edit{' ', before[i]})
+            i, j = i+1, j+1
+        case i < len(before) && (j == len(after) || common[i+1][j] >= common[i][j+1]):
+            ret = append(ret, Edit{'-', before[i]})
+            i++
+        default:
+            ret = append(ret, Edit{'+', after[j]})
+            j++
+        }
+    }
+    return
+}
+
+// returns the changes that turn 'before' into 'after', line by
+// line; removed lines start with "- ", added ones with "+ ", and
+// the lines both have are left out. converts:
+// a, b, c
+// a, c, d
+// =>
+// - b
+// + d
+func diff_lines(before []string, after []string) (ret []string) {
+    for _, edit := range edit_lines(before, after) {
+        if edit.kind != ' ' {
+            ret = append(ret, fmt.Sprintf("%c %s", edit.kind, edit.line))
+        }
+    }
+    return
+}
+
+// returns 'before' and 'after' side by side, lining up the lines
+// they have in common; a changed line is marked with "|", a removed
+// one with "<", and an added one with ">"; converts:
+// a, b, c
+// a, d, c, e
+// =>
+// a   a
+// b | d
+// c   c
+//   > e
+func side_by_side(before []string, after []string) (ret []string) {
+    var (
+        edits []Edit = edit_lines(before, after)
+        width int
+    )
+    for _, line := range before {
+        width = max(width, len(line))
+    }
+    var row = func(left string, mark string, right string) {
+        ret = append(ret, strings.TrimRight(fmt.Sprintf("%-*s %s %s", width, left, mark, right), " "))
+    }
+    for i := 0; i < len(edits); {
+        if edits[i].kind == ' ' {
+            row(edits[i].line, " ", edits[i].line)
+            i++
+            continue
+        }
+        // a change: its removals, then its additions
+        var removed, added []string
+        for ; i < len(edits) && edits[i].kind == '-'; i++ {
+            removed = append(removed, edits[i].line)
+        }
+        for ; i < len(edits) && edits[i].kind == '+'; i++ {
+            added = append(added, edits[i].line)
+        }
+        for j := 0; j < max(len(removed), len(added)); j++ {
+            switch {
+            case j < len(removed) && j < len(added):
+                row(removed[j], "|", added[j])
+            case j < len(removed):
+                row(removed[j], "<", "")
+            default:
+                row("", ">", added[j])
+            }
+        }
+    }
+    return
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "encoding/binary"
+    "flag"
+    "fmt"
+    "os"
+)
+
+// returns the name of every register, by number
+func register_names() (names [32]string) {
+    for name, number := range register_numbers {
+        names[number] = name
+    }
+    return
+}
+
+// returns the key of a map that has 'value', if there is one
+func find_by_value(table map[string]uint32, value uint32) (string, bool) {
+    for key, v := range table {
+        if v == value {
+            return key, true
+        }
+    }
+    return "", false
+}
+
+// decodes a word at 'pc' into an instruction (as 'expand'
+// produces them); branch and jump targets become absolute
+// addresses. the second result is false for words that
+// 'encode' never produces
+func disassemble(word uint32, pc uint32) (Instruction, bool) {
+    var (
+        names  [32]string = register_names()
+        op     uint32     = word >> 26
+        rs     string     = names[(word>>21)&0x1f]
+        rt     string     = names[(word>>16)&0x1f]
+        rd     string     = names[(word>>11)&0x1f]
+        shamt  uint32     = (word >> 6) & 0x1f
+        funct  uint32     = word & 0x3f
+        signed int16      = int16(word & 0xffff)
+        branch string     = fmt.Sprintf("0x%08x", pc+4+uint32(int32(signed)<<2))
+    )
+    switch {
+    case word == 0x42000018:
+        return make_instruction("eret"), true
+    case op == 0x10 && (rs == "$zero" || rs == "$a0") && word&0x7ff == 0:
+        var opcode string = map[string]string{"$zero": "mfc0", "$a0": "mtc0"}[rs]
+        return make_instruction(opcode, rt, fmt.Sprintf("$%d", (word>>11)&0x1f)), true
+    case op == 0x11 && (rs == "$zero" || rs == "$a0") && word&0x7ff == 0:
+        var opcode string = map[string]string{"$zero": "mfc1", "$a0": "mtc1"}[rs]
+        return make_instruction(opcode, rt, fmt.Sprintf("$f%d", (word>>11)&0x1f)), true
+    case word&0xffff003f == 0x46800020 || word&0xffff003f == 0x4600000d:
+        var opcode string = map[uint32]string{0x20: "cvt.s.w", 0x0d: "trunc.w.s"}[funct]
+        return make_instruction(opcode, fmt.Sprintf("$f%d", shamt), fmt.Sprintf("$f%d", (word>>11)&0x1f)), true
+    case op == 0x1c && funct == 0x02 && shamt == 0:
+        return make_instruction("mul", rd, rs, rt), true
+    case op == 0x1c && funct == 0x20 && shamt == 0 && rt == rd:
+        return make_instruction("clz", rd, rs), true
+    case op == 0x1f && funct == 0x20 && (shamt == 0x10 || shamt == 0x18) && rs == "$zero":
+        var opcode string = map[uint32]string{0x10: "seb", 0x18: "seh"}[shamt]
+        return make_instruction(opcode, rd, rt), true
+    case op == 0x01 && (word>>16)&0x1f <= 1:
+        var opcode string = []string{"bltz", "bgez"}[(word>>16)&0x1f]
+        return make_instruction(opcode, rs, branch), true
+    case op == 0x02 || op == 0x03:
+        var target uint32 = (pc+4)&0xf0000000 | (word&0x3ffffff)<<2
+        var opcode string = map[uint32]string{0x02: "j", 0x03: "jal"}[op]
+        return make_instruction(opcode, fmt.Sprintf("0x%08x", target)), true
+    case op != 0:
+        opcode, ok := find_by_value(opcodes, op)
+        if !ok {
+            return Instruction{}, false
+        }
+        switch opcode {
+        case "beq", "bne", "beql", "bnel":
+            return make_instruction(opcode, rs, rt, branch), true
+        case "blez", "bgtz":
+            return make_instruction(opcode, rs, branch), true
+        case "lui":
+            return make_instruction(opcode, rt, fmt.Sprint(word&0xffff)), true
+        case "andi", "ori", "xori":
+            return make_instruction(opcode, rt, rs, fmt.Sprint(word&0xffff)), true
+        case "addi", "addiu", "slti", "sltiu":
+            return make_instruction(opcode, rt, rs, fmt.Sprint(signed)), true
+        case "lwc1", "ldc1":
+            return make_instruction(opcode, fmt.Sprintf("$f%d", (word>>16)&0x1f), fmt.Sprintf("%d(%s)", signed, rs)), true
+        }
+        // loads and stores
+        return make_instruction(opcode, rt, fmt.Sprintf("%d(%s)", signed, rs)), true
+    }
+    opcode, ok := find_by_value(r_functs, funct)
+    if !ok {
+        return Instruction{}, false
+    }
+    switch opcode {
+    case "syscall":
+        return make_instruction(opcode), true
+    case "sll", "srl", "sra":
+        return make_instruction(opcode, rd, rt, fmt.Sprint(shamt)), true
+    case "sllv", "srlv", "srav":
+        return make_instruction(opcode, rd, rt, rs), true
+    case "jr", "jalr":
+        return make_instruction(opcode, rs), true
+    case "mfhi", "mflo":
+        return make_instruction(opcode, rd), true
+    case "mult", "multu", "div", "divu":
+        return make_instruction(opcode, rs, rt), true
+    }
+    return make_instruction(opcode, rd, rs, rt), true
+}
+
+// returns the disassembly of a flat binary (in the given byte
+// order) loaded at 'base', one word per line; words that don't
+// decode are shown as '.word'
+func disassemble_binary(image []byte, base uint32, order binary.ByteOrder) (ret string) {
+    for offset := 0; offset+4 <= len(image); offset += 4 {
+        var (
+            address uint32 = base + uint32(offset)
+            word    uint32 = order.Uint32(image[offset:])
+            text    string = fmt.Sprintf(".word 0x%08x", word)
+        )
+        if instruction, ok := disassemble(word, address); word == 0 {
+            text = "nop"
+        } else if ok {
+            text = render_instruction(instruction)
+        }
+        ret += fmt.Sprintf("%08x:  %08x  %s\n", address, word, text)
+    }
+    return
+}
+
+// decodes every word of the text section and encodes it again,
+// panicking if the encoder and disassembler disagree
+func (backend *MIPSBackend) check_round_trip() {
+    var (
+        image   Image = backend.link_image(backend.options.binary_base)
+        address       = func(target string) uint32 {
+            value, _ := parse_immediate(target)
+            return uint32(value)
+        }
+    )
+    for _, encoded := range image.text {
+        for i, word := range encoded.words {
+            var pc uint32 = encoded.address + uint32(4*i)
+            decoded, ok := disassemble(word, pc)
+            if !ok {
+                panic(fmt.Sprintf("can't decode %08x ('%s')", word, render_instruction(encoded.expansion[i])))
+            }
+            if decoded.opcode != encoded.expansion[i].opcode || encode(decoded, pc, address) != word {
+                panic(fmt.Sprintf("'%s' decodes to '%s'",
+                    render_instruction(encoded.expansion[i]), render_instruction(decoded)))
+            }
+        }
+    }
+}
+
+// scg disassemble [-base address] [-byte-order EB|EL] image.bin...
+// prints the disassembly of flat binaries (as 'assemble_binary'
+// writes them); exits with 1 if any of them couldn't be read
+func disassemble_files(args []string) {
+    var (
+        flags  *flag.FlagSet = flag.NewFlagSet("disassemble", flag.ExitOnError)
+        base   uint32        = default_backend_options().binary_base
+        order  *string       = flags.String("byte-order", targets["mars"].byte_order, "the byte order of the images (EB or EL)")
+        failed bool
+    )
+    flags.Func("base", "the address the images are loaded at (default 0x00400000)", func(value string) error {
+        address, ok := parse_immediate(value)
+        if !ok || address < 0 || address > 0xffffffff || address%4 != 0 {
+            return fmt.Errorf("'%s' isn't a word address", value)
+        }
+        base = uint32(address)
+        return nil
+    })
+    flags.Parse(args)
+    if _, ok := byte_orders[*order]; !ok {
+        fmt.Fprintf(os.Stderr, "unknown byte order '%s' (EB or EL)\n", *order)
+        os.Exit(2)
+    }
+    for _, path := range flags.Args() {
+        image, err := os.ReadFile(path)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            failed = true
+            continue
+        }
+        fmt.Print(disassemble_binary(image, base, byte_orders[*order]))
+    }
+    if failed {
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+    "encoding/binary"
+    "strings"
+    "testing"
+)
+
+// an instruction of every kind 'encode' knows, written as
+// 'disassemble' writes it (branch targets are absolute, from 0x00400000)
+var encodable_instructions = []Instruction{
+    make_instruction("sll", "$t0", "$t1", "3"),
+    make_instruction("srl", "$t0", "$t1", "31"),
+    make_instruction("sra", "$t0", "$t1", "1"),
+    make_instruction("sllv", "$t0", "$t1", "$t2"),
+    make_instruction("srlv", "$t0", "$t1", "$t2"),
+    make_instruction("srav", "$t0", "$t1", "$t2"),
+    make_instruction("jr", "$ra"),
+    make_instruction("jalr", "$t9"),
+    make_instruction("movz", "$t0", "$t1", "$t2"),
+    make_instruction("movn", "$t0", "$t1", "$t2"),
+    make_instruction("syscall"),
+    make_instruction("mfhi", "$t3"),
+    make_instruction("mflo", "$t3"),
+    make_instruction("mult", "$t0", "$t1"),
+    make_instruction("multu", "$t0", "$t1"),
+    make_instruction("div", "$t0", "$t1"),
+    make_instruction("divu", "$t0", "$t1"),
+    make_instruction("add", "$t0", "$t1", "$t2"),
+    make_instruction("addu", "$v0", "$a0", "$a1"),
+    make_instruction("sub", "$t0", "$t1", "$t2"),
+    make_instruction("subu", "$t0", "$t1", "$t2"),
+    make_instruction("and", "$t0", "$t1", "$t2"),
+    make_instruction("or", "$t0", "$t1", "$t2"),
+    make_instruction("xor", "$t0", "$t1", "$t2"),
+    make_instruction("nor", "$t0", "$t1", "$t2"),
+    make_instruction("slt", "$t0", "$t1", "$t2"),
+    make_instruction("sltu", "$t0", "$t1", "$t2"),
+    make_instruction("j", "0x00400100"),
+    make_instruction("jal", "0x00400100"),
+    make_instruction("beq", "$t0", "$zero", "0x00400010"),
+    make_instruction("bne", "$t0", "$t1", "0x003ffff0"),
+    make_instruction("blez", "$t0", "0x00400008"),
+    make_instruction("bgtz", "$t0", "0x00400008"),
+    make_instruction("bltz", "$t0", "0x00400008"),
+    make_instruction("bgez", "$t0", "0x00400008"),
+    make_instruction("beql", "$t0", "$t1", "0x00400008"),
+    make_instruction("bnel", "$t0", "$t1", "0x00400008"),
+    make_instruction("addi", "$t0", "$t1", "-1"),
+    make_instruction("addiu", "$sp", "$sp", "-32"),
+    make_instruction("slti", "$t0", "$t1", "-5"),
+    make_instruction("sltiu", "$t0", "$t1", "5"),
+    make_instruction("andi", "$t0", "$t1", "65535"),
+    make_instruction("ori", "$t0", "$t1", "32768"),
+    make_instruction("xori", "$t0", "$t1", "1"),
+    make_instruction("lui", "$at", "4097"),
+    make_instruction("lb", "$t0", "-1($t1)"),
+    make_instruction("lh", "$t0", "2($t1)"),
+    make_instruction("lw", "$ra", "-4($sp)"),
+    make_instruction("lbu", "$t0", "0($t1)"),
+    make_instruction("lhu", "$t0", "0($t1)"),
+    make_instruction("sb", "$t0", "0($t1)"),
+    make_instruction("sh", "$t0", "0($t1)"),
+    make_instruction("sw", "$ra", "32764($sp)"),
+    make_instruction("ll", "$t0", "0($t1)"),
+    make_instruction("sc", "$t0", "0($t1)"),
+    make_instruction("lwc1", "$f2", "8($sp)"),
+    make_instruction("ldc1", "$f4", "-8($sp)"),
+    make_instruction("mfc1", "$t0", "$f2"),
+    make_instruction("mtc1", "$a1", "$f12"),
+    make_instruction("cvt.s.w", "$f0", "$f6"),
+    make_instruction("trunc.w.s", "$f4", "$f0"),
+    make_instruction("eret"),
+    make_instruction("mfc0", "$k0", "$13"),
+    make_instruction("mtc0", "$k0", "$14"),
+    make_instruction("mul", "$t0", "$t1", "$t2"),
+    make_instruction("clz", "$t0", "$t1"),
+    make_instruction("seb", "$t0", "$t1"),
+    make_instruction("seh", "$t0", "$t1"),
+}
+
+// every instruction decodes to itself, and encodes to the same word
+func Test_instruction_round_trip(t *testing.T) {
+    const pc uint32 = 0x00400000
+    var address = func(target string) uint32 {
+        value, _ := parse_immediate(target)
+        return uint32(value)
+    }
+    for _, instruction := range encodable_instructions {
+        var word uint32 = encode(instruction, pc, address)
+        decoded, ok := disassemble(word, pc)
+        if !ok {
+            t.Errorf("'%s' (%08x) doesn't decode", render_instruction(instruction), word)
+            continue
+        }
+        if render_instruction(decoded) != render_instruction(instruction) {
+            t.Errorf("'%s' decodes to '%s'", render_instruction(instruction), render_instruction(decoded))
+        }
+        if again := encode(decoded, pc, address); again != word {
+            t.Errorf("'%s' encodes to %08x, then %08x", render_instruction(instruction), word, again)
+        }
+    }
+}
+
+// whole programs round-trip too (see 'check_round_trip')
+func Test_program_round_trip(t *testing.T) {
+    var programs map[string]Program = map[string]Program{}
+    for name, program := range register_programs {
+        programs[name] = program
+    }
+    for name, test := range recursive_programs {
+        programs[name] = test.program
+    }
+    for name, program := range programs {
+        backend, diagnostics, ok := try_generate(program, default_backend_options())
+        if !ok {
+            t.Errorf("%s: %s", name, strings.Join(diagnostics, "\n"))
+            continue
+        }
+        if recovered := recovered_from(backend.check_round_trip); recovered != nil {
+            t.Errorf("%s: %v", name, recovered)
+        }
+    }
+}
+
+// a flat binary disassembles a word per line, text and data alike
+func Test_disassemble_binary(t *testing.T) {
+    var (
+        backend MIPSBackend = new_mips_backend(recursive_programs["factorial"].program)
+        image   []byte      = backend.assemble_binary()
+        lines   []string    = strings.Split(strings.TrimSuffix(
+            disassemble_binary(image, backend.options.binary_base, binary.LittleEndian), "\n"), "\n")
+    )
+    if len(lines) != len(image)/4 {
+        t.Fatalf("%d bytes disassembled to %d lines", len(image), len(lines))
+    }
+    // main starts by saving $ra
+    if expected := "00400000:  afbffffc  sw $ra,-4($sp)"; lines[0] != expected {
+        t.Errorf("the first line is %q, expected %q", lines[0], expected)
+    }
+}
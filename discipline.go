@@ -0,0 +1,70 @@
+package main
+
+import (
+    "fmt"
+)
+
+// whether 'default_backend_options' checks the stack discipline;
+// the tests turn it on (see 'TestMain'), so every program they
+// generate is checked
+var check_discipline_by_default bool = false
+
+// what the stack discipline checker panics with (see
+// 'check_discipline'); it isn't a string, so 'statement' treats
+// it as a bug in the generator rather than an error in the program
+type DisciplineError struct {
+    node    string
+    message string
+}
+
+func (err DisciplineError) Error() string {
+    return fmt.Sprintf("%s broke the stack discipline: %s", err.node, err.message)
+}
+
+// returns true if a statement leaves nothing on the expression
+// stack; the other nodes are expressions used as statements, whose
+// values 'statement' drops
+func leaves_no_value(node interface{}) bool {
+    switch node.(type) {
+    case Program, Assignment, ExprStmt, If, Static, Function, Return, ExceptionHandler:
+        return true
+    }
+    return false
+}
+
+// checks what a statement did to the expression stack and the
+// registers, panicking with a 'DisciplineError' if it popped the
+// values (or freed the registers) of the statement around it, which
+// are 'below' and 'mark' from before it was generated, if it left
+// a value on the stack without being an expression, or if a value
+// it left is in a register it freed; 'statement' frees whatever
+// else it allocated afterwards
+func (backend *MIPSBackend) __check_discipline(node interface{}, below []string, mark map[string]bool) {
+    var (
+        live []string = backend.stack.live()
+        fail          = func(format string, args ...interface{}) {
+            panic(DisciplineError{describe_node(node), fmt.Sprintf(format, args...)})
+        }
+    )
+    if len(live) < len(below) {
+        fail("it popped %d value(s) it didn't push", len(below)-len(live))
+    }
+    for i, register := range below {
+        if live[i] != register {
+            fail("it replaced the value in '%s' with '%s'", register, live[i])
+        }
+    }
+    if leaves_no_value(node) && len(live) != len(below) {
+        fail("it left %d value(s) on the stack", len(live)-len(below))
+    }
+    for _, register := range backend.registers.registers {
+        if mark[register] && !backend.registers.in_use[register] {
+            fail("it freed '%s', which it didn't allocate", register)
+        }
+    }
+    for _, register := range live {
+        if !spilled(register) && !backend.registers.in_use[register] {
+            fail("'%s' is on the stack, but was freed", register)
+        }
+    }
+}
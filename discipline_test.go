@@ -0,0 +1,61 @@
+package main
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+// every program the tests generate has its stack discipline checked
+func TestMain(m *testing.M) {
+    if os.Getenv("SCG_MAIN") != "" {
+        // the command 'run_scg' started
+        main()
+        os.Exit(0)
+    }
+    check_discipline_by_default = true
+    os.Exit(m.Run())
+}
+
+func Test_discipline_is_checked(t *testing.T) {
+    if !default_backend_options().check_discipline {
+        t.Errorf("the tests don't check the stack discipline")
+    }
+}
+
+// a statement that pops a value of the statement around it, or
+// leaves a value behind (unless it's an expression), breaks the
+// discipline
+func Test_discipline_errors(t *testing.T) {
+    var cases = map[string]struct {
+        node      interface{}
+        statement func(backend *MIPSBackend)
+    }{
+        "it popped 1 value(s) it didn't push": {Assignment{"a", Integer{"1"}}, func(backend *MIPSBackend) {
+            backend.stack.pop()
+        }},
+        "it left 1 value(s) on the stack": {Assignment{"a", Integer{"1"}}, func(backend *MIPSBackend) {
+            backend.stack.push(backend.__temp_register())
+        }},
+        "is on the stack, but was freed": {Call{"f", nil}, func(backend *MIPSBackend) {
+            var register string = backend.__temp_register()
+            backend.stack.push(register)
+            backend.__free(register)
+        }},
+    }
+    for expected, test := range cases {
+        var backend MIPSBackend = blank_mips_backend(default_backend_options())
+        backend.stack.push(backend.__temp_register())
+        var (
+            below []string        = backend.stack.live()
+            mark  map[string]bool = backend.registers.mark()
+        )
+        var recovered interface{} = recovered_from(func() {
+            test.statement(&backend)
+            backend.__check_discipline(test.node, below, mark)
+        })
+        if err, ok := recovered.(DisciplineError); !ok || !strings.Contains(err.Error(), expected) {
+            t.Errorf("expected '%s', got %#v", expected, recovered)
+        }
+    }
+}
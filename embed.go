@@ -0,0 +1,31 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// returns a Go source file with the assembly as a string constant,
+// for '-go-package' (e.g. from a go:generate directive); converts:
+// main:
+//     li $t0,5
+// =>
+// // Code generated by scg from prog.json; DO NOT EDIT.
+//
+// package emu
+//
+// const program = `main:
+//     li $t0,5
+// `
+// the assembly is a raw string unless it has a backquote in it
+// (which only strings in the data section can), and nothing in the
+// file depends on when (or where) it's generated
+func go_source(package_name string, const_name string, input string, assembly string) string {
+    var literal string = "`" + assembly + "`"
+    if strings.Contains(assembly, "`") || strings.Contains(assembly, "\r") {
+        literal = strconv.Quote(assembly)
+    }
+    return fmt.Sprintf("// Code generated by scg from %s; DO NOT EDIT.\n\npackage %s\n\nconst %s = %s\n",
+        input, package_name, const_name, literal)
+}
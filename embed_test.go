@@ -0,0 +1,53 @@
+package main
+
+import (
+    "go/ast"
+    "go/parser"
+    "go/token"
+    "strconv"
+    "testing"
+)
+
+// returns the value of a string constant in Go source
+func go_constant(t *testing.T, source string, name string) string {
+    file, err := parser.ParseFile(token.NewFileSet(), "program.go", source, 0)
+    if err != nil {
+        t.Fatalf("%v in:\n%s", err, source)
+    }
+    var object *ast.Object = file.Scope.Lookup(name)
+    if object == nil || object.Kind != ast.Con {
+        t.Fatalf("no constant %s in:\n%s", name, source)
+    }
+    value, err := strconv.Unquote(object.Decl.(*ast.ValueSpec).Values[0].(*ast.BasicLit).Value)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return value
+}
+
+// the constant is the assembly exactly, whatever's in it
+func Test_go_source(t *testing.T) {
+    for _, assembly := range []string{
+        "main:\n    li $t0,5\n",
+        "string1: .asciiz \"`quoted`\"\n",
+        "string1: .asciiz \"a\r\nb\"\n",
+        "",
+    } {
+        if value := go_constant(t, go_source("emu", "program", "prog.json", assembly), "program"); value != assembly {
+            t.Errorf("embedded %q as %q", assembly, value)
+        }
+    }
+    var program Program = Program{[]interface{}{Call{"Printf", []interface{}{String{"`%d`\\n"}, Integer{"5"}}}}}
+    var (
+        assembly string = string(run_scg(t, map[string]interface{}{"prog.json": program}, "prog.json"))
+        embedded string = string(run_scg(t, map[string]interface{}{"prog.json": program},
+            "-go-package", "emu", "-go-const", "hello", "prog.json"))
+    )
+    if value := go_constant(t, embedded, "hello"); value != assembly {
+        t.Errorf("-go-package embedded\n%s\ninstead of\n%s", value, assembly)
+    }
+    if again := string(run_scg(t, map[string]interface{}{"prog.json": program},
+        "-go-package", "emu", "-go-const", "hello", "prog.json")); again != embedded {
+        t.Errorf("generating it again gave\n%s\ninstead of\n%s", again, embedded)
+    }
+}
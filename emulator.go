@@ -0,0 +1,547 @@
+package main
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+)
+
+// where $sp and $gp start on MARS (in its default memory
+// configuration)
+const (
+    mars_stack_pointer  uint32 = 0x7fffeffc
+    mars_global_pointer uint32 = 0x10008000
+)
+
+// the address main returns to when the machine starts it; reaching
+// it halts the machine
+const machine_halt uint32 = 0xfffffff0
+
+// the most instructions 'run_with_emulator' runs a program for
+const max_emulated_steps int = 10000000
+
+// the size of the pages the machine's memory is made of
+const page_size uint32 = 4096
+
+// a MIPS32 processor and its memory, running a flat image (see
+// 'link_image') with the syscalls of MARS (or a few of linux's, see
+// 'linux_syscall'); it runs the encoded words themselves, delay
+// slots included, so it checks what the generated code does rather
+// than what it looks like
+type Machine struct {
+    registers [32]uint32
+    // the floating-point registers, which only ever hold singles
+    // (see 'coprocessor1')
+    float_registers [32]uint32
+    hi        uint32
+    lo        uint32
+    pc        uint32
+    // the address of the instruction after the one at 'pc', which
+    // a branch changes (after its delay slot)
+    next_pc uint32
+    pages   map[uint32]*[page_size]byte
+    order   binary.ByteOrder
+    // the lowest address the program can use (the image's base)
+    floor uint32
+    // the end of the heap, which 'sbrk' (syscall 9) moves
+    brk       uint32
+    output    strings.Builder
+    halted    bool
+    exit_code int
+    steps     int
+    // the names of the syscalls of the linux target the image was
+    // built for, by number; nil for MARS's (see 'syscall')
+    linux_syscalls map[uint32]string
+    // the start and end of the read-only data, which stores fault in
+    read_only [2]uint32
+}
+
+// returns a machine with an image loaded, about to start main (or
+// '_start', which is the same address on bare-metal targets) with
+// $sp and $gp set up as MARS does; the heap starts after the bss
+func new_machine(image Image, order binary.ByteOrder) *Machine {
+    var (
+        entry   uint32   = image.labels["main"]
+        machine *Machine = &Machine{[32]uint32{}, [32]uint32{}, 0, 0, entry, entry + 4, map[uint32]*[page_size]byte{},
+            order, image.base, (image.labels["__bss_end"] + 7) &^ 7, strings.Builder{}, false, 0, 0, nil, [2]uint32{}}
+    )
+    for _, encoded := range image.text {
+        for i, word := range encoded.words {
+            machine.store(encoded.address+uint32(4*i), 4, word)
+        }
+    }
+    for i, value := range image.data {
+        machine.store(image.data_address+uint32(i), 1, uint32(value))
+    }
+    machine.read_only = [2]uint32{image.data_address, image.labels["__rodata_end"]}
+    machine.registers[register_numbers["$sp"]] = mars_stack_pointer
+    machine.registers[register_numbers["$gp"]] = mars_global_pointer
+    machine.registers[register_numbers["$ra"]] = machine_halt
+    return machine
+}
+
+// returns the page an address is in, panicking for
+// addresses below the image (e.g. null pointers)
+func (machine *Machine) __page(address uint32) *[page_size]byte {
+    if address < machine.floor {
+        panic(fmt.Sprintf("0x%08x is outside the program's memory (at 0x%08x)", address, machine.pc))
+    }
+    var page *[page_size]byte = machine.pages[address/page_size]
+    if page == nil {
+        page = &[page_size]byte{}
+        machine.pages[address/page_size] = page
+    }
+    return page
+}
+
+// returns the 'size' bytes (1, 2 or 4) at an address, which has to
+// be a multiple of 'size'
+func (machine *Machine) load(address uint32, size uint32) uint32 {
+    if address%size != 0 {
+        panic(fmt.Sprintf("unaligned %d-byte load from 0x%08x (at 0x%08x)", size, address, machine.pc))
+    }
+    var bytes [4]byte
+    for i := uint32(0); i < size; i++ {
+        bytes[i] = machine.__page(address + i)[(address+i)%page_size]
+    }
+    switch size {
+    case 1:
+        return uint32(bytes[0])
+    case 2:
+        return uint32(machine.order.Uint16(bytes[:]))
+    }
+    return machine.order.Uint32(bytes[:])
+}
+
+// writes the low 'size' bytes (1, 2 or 4) of a value at an address,
+// which has to be a multiple of 'size'
+func (machine *Machine) store(address uint32, size uint32, value uint32) {
+    if address%size != 0 {
+        panic(fmt.Sprintf("unaligned %d-byte store to 0x%08x (at 0x%08x)", size, address, machine.pc))
+    }
+    if address >= machine.read_only[0] && address < machine.read_only[1] {
+        panic(fmt.Sprintf("%d-byte store to read-only data at 0x%08x (at 0x%08x)", size, address, machine.pc))
+    }
+    var bytes [4]byte
+    switch size {
+    case 1:
+        bytes[0] = byte(value)
+    case 2:
+        machine.order.PutUint16(bytes[:], uint16(value))
+    default:
+        machine.order.PutUint32(bytes[:], value)
+    }
+    for i := uint32(0); i < size; i++ {
+        machine.__page(address + i)[(address+i)%page_size] = bytes[i]
+    }
+}
+
+// runs the instruction at 'pc'
+func (machine *Machine) step() {
+    var (
+        pc   uint32 = machine.pc
+        word uint32 = machine.load(pc, 4)
+    )
+    machine.pc, machine.next_pc = machine.next_pc, machine.next_pc+4
+    machine.execute(word, pc)
+    machine.registers[0] = 0
+    machine.steps++
+}
+
+// panics if an arithmetic operation overflowed (as 'add', 'addi'
+// and 'sub' trap), given its operands (with the second negated
+// for 'sub') and its result
+func (machine *Machine) __check_overflow(a uint32, b uint32, result uint32, pc uint32) uint32 {
+    if (a^result)&(b^result)&0x80000000 != 0 {
+        panic(fmt.Sprintf("arithmetic overflow at 0x%08x", pc))
+    }
+    return result
+}
+
+// runs an instruction (a word 'encode' produces) that was at 'pc'
+func (machine *Machine) execute(word uint32, pc uint32) {
+    var (
+        r      *[32]uint32 = &machine.registers
+        op     uint32      = word >> 26
+        rs     uint32      = (word >> 21) & 0x1f
+        rt     uint32      = (word >> 16) & 0x1f
+        rd     uint32      = (word >> 11) & 0x1f
+        shamt  uint32      = (word >> 6) & 0x1f
+        funct  uint32      = word & 0x3f
+        signed uint32      = uint32(int32(int16(word & 0xffff)))
+        branch             = func(taken bool) {
+            if taken {
+                machine.next_pc = pc + 4 + signed<<2
+            }
+        }
+        likely = func(taken bool) {
+            // a likely branch that isn't taken skips its delay slot
+            if taken {
+                machine.next_pc = pc + 4 + signed<<2
+            } else {
+                machine.pc, machine.next_pc = pc+8, pc+12
+            }
+        }
+    )
+    switch op {
+    case 0x00:
+        switch funct {
+        case 0x00:
+            r[rd] = r[rt] << shamt
+        case 0x02:
+            r[rd] = r[rt] >> shamt
+        case 0x03:
+            r[rd] = uint32(int32(r[rt]) >> shamt)
+        case 0x04:
+            r[rd] = r[rt] << (r[rs] & 0x1f)
+        case 0x06:
+            r[rd] = r[rt] >> (r[rs] & 0x1f)
+        case 0x07:
+            r[rd] = uint32(int32(r[rt]) >> (r[rs] & 0x1f))
+        case 0x08:
+            machine.next_pc = r[rs]
+        case 0x09:
+            machine.next_pc = r[rs]
+            r[rd] = pc + 8
+        case 0x0a:
+            if r[rt] == 0 {
+                r[rd] = r[rs]
+            }
+        case 0x0b:
+            if r[rt] != 0 {
+                r[rd] = r[rs]
+            }
+        case 0x0c:
+            machine.syscall()
+        case 0x10:
+            r[rd] = machine.hi
+        case 0x12:
+            r[rd] = machine.lo
+        case 0x18:
+            var product int64 = int64(int32(r[rs])) * int64(int32(r[rt]))
+            machine.hi, machine.lo = uint32(product>>32), uint32(product)
+        case 0x19:
+            var product uint64 = uint64(r[rs]) * uint64(r[rt])
+            machine.hi, machine.lo = uint32(product>>32), uint32(product)
+        case 0x1a:
+            // dividing by zero leaves HI and LO as they were
+            if r[rt] != 0 {
+                machine.lo, machine.hi = uint32(int32(r[rs])/int32(r[rt])), uint32(int32(r[rs])%int32(r[rt]))
+            }
+        case 0x1b:
+            if r[rt] != 0 {
+                machine.lo, machine.hi = r[rs]/r[rt], r[rs]%r[rt]
+            }
+        case 0x20:
+            r[rd] = machine.__check_overflow(r[rs], r[rt], r[rs]+r[rt], pc)
+        case 0x21:
+            r[rd] = r[rs] + r[rt]
+        case 0x22:
+            r[rd] = machine.__check_overflow(r[rs], ^r[rt], r[rs]-r[rt], pc)
+        case 0x23:
+            r[rd] = r[rs] - r[rt]
+        case 0x24:
+            r[rd] = r[rs] & r[rt]
+        case 0x25:
+            r[rd] = r[rs] | r[rt]
+        case 0x26:
+            r[rd] = r[rs] ^ r[rt]
+        case 0x27:
+            r[rd] = ^(r[rs] | r[rt])
+        case 0x2a:
+            r[rd] = bool_word(int32(r[rs]) < int32(r[rt]))
+        case 0x2b:
+            r[rd] = bool_word(r[rs] < r[rt])
+        default:
+            machine.__unknown(word, pc)
+        }
+    case 0x01:
+        switch rt {
+        case 0x00:
+            branch(int32(r[rs]) < 0)
+        case 0x01:
+            branch(int32(r[rs]) >= 0)
+        default:
+            machine.__unknown(word, pc)
+        }
+    case 0x02, 0x03:
+        var target uint32 = (pc+4)&0xf0000000 | (word&0x3ffffff)<<2
+        if op == 0x03 {
+            r[31] = pc + 8
+        } else if target == pc {
+            // spinning (e.g. at '__scg_halt'), which is how
+            // bare-metal programs end
+            machine.halted = true
+        }
+        machine.next_pc = target
+    case 0x04:
+        branch(r[rs] == r[rt])
+    case 0x05:
+        branch(r[rs] != r[rt])
+    case 0x06:
+        branch(int32(r[rs]) <= 0)
+    case 0x07:
+        branch(int32(r[rs]) > 0)
+    case 0x14:
+        likely(r[rs] == r[rt])
+    case 0x15:
+        likely(r[rs] != r[rt])
+    case 0x08:
+        r[rt] = machine.__check_overflow(r[rs], signed, r[rs]+signed, pc)
+    case 0x09:
+        r[rt] = r[rs] + signed
+    case 0x0a:
+        r[rt] = bool_word(int32(r[rs]) < int32(signed))
+    case 0x0b:
+        r[rt] = bool_word(r[rs] < signed)
+    case 0x0c:
+        r[rt] = r[rs] & (word & 0xffff)
+    case 0x0d:
+        r[rt] = r[rs] | (word & 0xffff)
+    case 0x0e:
+        r[rt] = r[rs] ^ (word & 0xffff)
+    case 0x0f:
+        r[rt] = word << 16
+    case 0x1c:
+        switch funct {
+        case 0x02:
+            r[rd] = uint32(int32(r[rs]) * int32(r[rt]))
+        case 0x20:
+            var count uint32
+            for count < 32 && r[rs]&(0x80000000>>count) == 0 {
+                count++
+            }
+            r[rd] = count
+        default:
+            machine.__unknown(word, pc)
+        }
+    case 0x1f:
+        switch {
+        case funct == 0x20 && shamt == 0x10:
+            r[rd] = uint32(int32(int8(r[rt])))
+        case funct == 0x20 && shamt == 0x18:
+            r[rd] = uint32(int32(int16(r[rt])))
+        default:
+            machine.__unknown(word, pc)
+        }
+    case 0x20:
+        r[rt] = uint32(int32(int8(machine.load(r[rs]+signed, 1))))
+    case 0x21:
+        r[rt] = uint32(int32(int16(machine.load(r[rs]+signed, 2))))
+    case 0x23, 0x30:
+        // 'll' is a 'lw' on a machine with one processor
+        r[rt] = machine.load(r[rs]+signed, 4)
+    case 0x24:
+        r[rt] = machine.load(r[rs]+signed, 1)
+    case 0x25:
+        r[rt] = machine.load(r[rs]+signed, 2)
+    case 0x28:
+        machine.store(r[rs]+signed, 1, r[rt])
+    case 0x29:
+        machine.store(r[rs]+signed, 2, r[rt])
+    case 0x2b:
+        machine.store(r[rs]+signed, 4, r[rt])
+    case 0x38:
+        // and so every 'sc' succeeds
+        machine.store(r[rs]+signed, 4, r[rt])
+        r[rt] = 1
+    case 0x10:
+        panic(fmt.Sprintf("coprocessor 0 isn't emulated (at 0x%08x)", pc))
+    case 0x11:
+        machine.coprocessor1(word, pc)
+    case 0x31:
+        machine.float_registers[rt] = machine.load(r[rs]+signed, 4)
+    case 0x35:
+        panic(fmt.Sprintf("doubles aren't emulated (at 0x%08x)", pc))
+    default:
+        machine.__unknown(word, pc)
+    }
+}
+
+// runs an instruction of the floating-point unit; only the moves
+// from and to the integer registers, and the conversions between
+// words and singles (see 'cast'), are emulated
+func (machine *Machine) coprocessor1(word uint32, pc uint32) {
+    var (
+        rt uint32 = (word >> 16) & 0x1f
+        fs uint32 = (word >> 11) & 0x1f
+        fd uint32 = (word >> 6) & 0x1f
+        f         = &machine.float_registers
+    )
+    switch {
+    case word&0xffe007ff == 0x44000000:
+        machine.registers[rt] = f[fs]
+    case word&0xffe007ff == 0x44800000:
+        f[fs] = machine.registers[rt]
+    case word&0xffff003f == 0x46800020:
+        f[fd] = math.Float32bits(float32(int32(f[fs])))
+    case word&0xffff003f == 0x4600000d:
+        f[fd] = uint32(truncate_float(math.Float32frombits(f[fs])))
+    default:
+        panic(fmt.Sprintf("floating point isn't emulated (at 0x%08x)", pc))
+    }
+}
+
+// returns 1 for true and 0 for false, as 'slt' does
+func bool_word(value bool) uint32 {
+    if value {
+        return 1
+    }
+    return 0
+}
+
+// panics for a word the machine can't run
+func (machine *Machine) __unknown(word uint32, pc uint32) {
+    panic(fmt.Sprintf("can't execute %08x (at 0x%08x)", word, pc))
+}
+
+// runs the syscall in $v0, as MARS does; the ones that need
+// input or a file system aren't emulated
+func (machine *Machine) syscall() {
+    var a0 uint32 = machine.registers[register_numbers["$a0"]]
+    if machine.linux_syscalls != nil {
+        machine.linux_syscall(a0)
+        return
+    }
+    switch code := machine.registers[register_numbers["$v0"]]; code {
+    case 1:
+        fmt.Fprint(&machine.output, int32(a0))
+    case 2:
+        var value float32 = math.Float32frombits(machine.float_registers[12])
+        machine.output.WriteString(mars_float_string(float64(value), 32))
+    case 4:
+        for address := a0; machine.load(address, 1) != 0; address++ {
+            machine.output.WriteByte(byte(machine.load(address, 1)))
+        }
+    case 9:
+        machine.registers[register_numbers["$v0"]] = machine.brk
+        machine.brk += (a0 + 7) &^ 7
+    case 10:
+        machine.halted = true
+    case 11:
+        machine.output.WriteByte(byte(a0))
+    case 17:
+        machine.halted = true
+        machine.exit_code = int(int32(a0))
+    default:
+        panic(fmt.Sprintf("syscall %d isn't emulated (at 0x%08x)", code, machine.pc-4))
+    }
+}
+
+// runs the syscall in $v0 as linux does, returning its result in
+// $v0 and 0 in $a3 (no error); only writing to stdout or stderr
+// (which both go to the output) and exiting are emulated
+func (machine *Machine) linux_syscall(a0 uint32) {
+    var (
+        code uint32 = machine.registers[register_numbers["$v0"]]
+        a1   uint32 = machine.registers[register_numbers["$a1"]]
+        a2   uint32 = machine.registers[register_numbers["$a2"]]
+    )
+    switch machine.linux_syscalls[code] {
+    case "write":
+        if a0 != 1 && a0 != 2 {
+            panic(fmt.Sprintf("writing to file descriptor %d isn't emulated (at 0x%08x)", a0, machine.pc-4))
+        }
+        for address := a1; address != a1+a2; address++ {
+            machine.output.WriteByte(byte(machine.load(address, 1)))
+        }
+        machine.registers[register_numbers["$v0"]] = a2
+    case "exit":
+        machine.halted = true
+        machine.exit_code = int(int32(a0))
+    default:
+        panic(fmt.Sprintf("syscall %d isn't emulated (at 0x%08x)", code, machine.pc-4))
+    }
+    machine.registers[register_numbers["$a3"]] = 0
+}
+
+// runs the machine until main returns, the program exits, or it
+// has run 'max_steps' instructions; faults (e.g. an unaligned
+// load) are returned as errors
+func (machine *Machine) run(max_steps int) (err error) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            message, ok := recovered.(string)
+            if !ok {
+                panic(recovered)
+            }
+            err = errors.New(message)
+        }
+    }()
+    for !machine.halted && machine.pc != machine_halt {
+        if machine.steps == max_steps {
+            return fmt.Errorf("still running after %d instructions", max_steps)
+        }
+        machine.step()
+    }
+    machine.halted = true
+    return nil
+}
+
+// builds a program for MARS and runs it on a 'Machine', returning
+// what it printed and its exit status; unlike 'run_with_qemu', it
+// needs nothing installed, but programs can't use doubles (floats
+// only get printed and converted, see 'coprocessor1') or exception
+// handlers
+func run_with_emulator(ast interface{}, options BackendOptions) (stdout string, status int, err error) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            message, ok := recovered.(string)
+            if !ok {
+                panic(recovered)
+            }
+            err = errors.New(message)
+        }
+    }()
+    options.target = "mars"
+    var backend MIPSBackend = new_mips_backend_with(ast, options)
+    return backend.run_emulated()
+}
+
+// runs the generated program on a 'Machine' (see 'run_with_emulator')
+func (backend *MIPSBackend) run_emulated() (stdout string, status int, err error) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            message, ok := recovered.(string)
+            if !ok {
+                panic(recovered)
+            }
+            err = errors.New(message)
+        }
+    }()
+    var machine *Machine = backend.emulated_machine(backend.link_image(backend.options.binary_base))
+    err = machine.run(max_emulated_steps)
+    return machine.output.String(), machine.exit_code, err
+}
+
+// returns a 'Machine' with the program's image loaded, which
+// makes the syscalls of the program's target
+func (backend *MIPSBackend) emulated_machine(image Image) *Machine {
+    var machine *Machine = new_machine(image, backend.byte_order())
+    if backend.options.target == "linux" || backend.options.target == "linux-n32" {
+        machine.linux_syscalls = map[uint32]string{}
+        for name, number := range backend.target.syscalls {
+            machine.linux_syscalls[uint32(number)] = name
+        }
+    }
+    return machine
+}
+
+// runs a program on a 'Machine' and compares its output with the
+// interpreter's (generated programs always exit with 0)
+func check_with_emulator(ast interface{}, options BackendOptions) error {
+    var expected string = interpret(ast)
+    stdout, status, err := run_with_emulator(ast, options)
+    if err != nil {
+        return err
+    }
+    if stdout != expected {
+        return fmt.Errorf("the emulator printed %q, but the interpreter printed %q", stdout, expected)
+    }
+    if status != 0 {
+        return fmt.Errorf("exited with %d", status)
+    }
+    return nil
+}
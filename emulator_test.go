@@ -0,0 +1,270 @@
+package main
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// returns n <op> f(n <step>), for recursive functions
+func recurse(function string, op string, step string) interface{} {
+    return ArithmeticOp{Ident{"n"}, op, Call{function, []interface{}{ArithmeticOp{Ident{"n"}, "sub", Integer{step}}}}}
+}
+
+// 'check_with_emulator' on the target the options choose (one
+// the emulator runs, see 'emulated_machine')
+func check_on_target(ast interface{}, options BackendOptions) error {
+    backend, diagnostics, ok := try_generate(ast, options)
+    if !ok {
+        return errors.New(strings.Join(diagnostics, "\n"))
+    }
+    var expected string = interpret(ast)
+    stdout, status, err := backend.run_emulated()
+    if err != nil {
+        return err
+    }
+    if stdout != expected {
+        return fmt.Errorf("the emulator printed %q, but the interpreter printed %q", stdout, expected)
+    }
+    if status != 0 {
+        return fmt.Errorf("exited with %d", status)
+    }
+    return nil
+}
+
+// recursive programs, which need $ra (and the values computed
+// before a call) to survive it, and what they print
+var recursive_programs = map[string]struct {
+    program  Program
+    expected string
+}{
+    "factorial": {Program{[]interface{}{
+        Function{"fact", []string{"n"}, []interface{}{
+            If{Ident{"n"}, []interface{}{Return{recurse("fact", "mul", "1")}}, []interface{}{Return{Integer{"1"}}}},
+        }, false},
+        Call{"Printf", []interface{}{String{"%d %d\\n"}, Call{"fact", []interface{}{Integer{"5"}}}, Call{"fact", []interface{}{Integer{"10"}}}}},
+    }}, "120 3628800\n"},
+    "fibonacci": {Program{[]interface{}{
+        Function{"fib", []string{"n"}, []interface{}{
+            If{ArithmeticOp{Ident{"n"}, "slt", Integer{"2"}}, []interface{}{Return{Ident{"n"}}}, nil},
+            Return{ArithmeticOp{
+                Call{"fib", []interface{}{ArithmeticOp{Ident{"n"}, "sub", Integer{"1"}}}}, "add",
+                Call{"fib", []interface{}{ArithmeticOp{Ident{"n"}, "sub", Integer{"2"}}}},
+            }},
+        }, false},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Call{"fib", []interface{}{Integer{"15"}}}}},
+    }}, "610\n"},
+    "mutual recursion": {Program{[]interface{}{
+        Function{"is_even", []string{"n"}, []interface{}{
+            If{Ident{"n"}, []interface{}{Return{Call{"is_odd", []interface{}{ArithmeticOp{Ident{"n"}, "sub", Integer{"1"}}}}}}, nil},
+            Return{Integer{"1"}},
+        }, false},
+        Function{"is_odd", []string{"n"}, []interface{}{
+            If{Ident{"n"}, []interface{}{Return{Call{"is_even", []interface{}{ArithmeticOp{Ident{"n"}, "sub", Integer{"1"}}}}}}, nil},
+            Return{Integer{"0"}},
+        }, false},
+        Call{"Printf", []interface{}{String{"%d %d\\n"}, Call{"is_even", []interface{}{Integer{"10"}}}, Call{"is_odd", []interface{}{Integer{"7"}}}}},
+    }}, "1 1\n"},
+    // arguments past the fourth go on the stack
+    "stack arguments": {Program{[]interface{}{
+        Function{"sum", []string{"n", "a", "b", "c", "d", "e"}, []interface{}{
+            If{Ident{"n"}, []interface{}{Return{ArithmeticOp{Ident{"e"}, "add", Call{"sum", []interface{}{
+                ArithmeticOp{Ident{"n"}, "sub", Integer{"1"}}, Ident{"e"}, Ident{"a"}, Ident{"b"}, Ident{"c"}, Ident{"d"},
+            }}}}}, nil},
+            Return{Integer{"0"}},
+        }, false},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Call{"sum", []interface{}{Integer{"7"}, Integer{"1"}, Integer{"2"}, Integer{"3"}, Integer{"4"}, Integer{"5"}}}}},
+    }}, "24\n"},
+}
+
+func Test_recursion(t *testing.T) {
+    for name, test := range recursive_programs {
+        stdout, status, err := run_with_emulator(test.program, default_backend_options())
+        if err != nil || status != 0 || stdout != test.expected {
+            t.Errorf("%s printed %q and exited with %d (%v), expected %q", name, stdout, status, err, test.expected)
+        }
+        if err := check_with_emulator(test.program, default_backend_options()); err != nil {
+            t.Errorf("%s: %v", name, err)
+        }
+    }
+}
+
+// the machine faults like MARS does, rather than carrying on
+func Test_machine_faults(t *testing.T) {
+    var overflow Program = Program{[]interface{}{
+        Assignment{"a", Integer{"2147483647"}},
+        Assignment{"b", ArithmeticOp{Ident{"a"}, "add", Integer{"1"}}},
+    }}
+    if _, _, err := run_with_emulator(overflow, default_backend_options()); err == nil ||
+        !strings.Contains(err.Error(), "arithmetic overflow") {
+        t.Errorf("adding 1 to the largest integer gave %v", err)
+    }
+    var machine *Machine = new_machine(Image{0x00400000, nil, nil, 0x00400000, map[string]uint32{"main": 0x00400000}},
+        binary.LittleEndian)
+    for address, expected := range map[uint32]string{0: "outside the program's memory", 0x10010002: "unaligned"} {
+        if recovered, _ := recovered_from(func() { machine.load(address, 4) }).(string); !strings.Contains(recovered, expected) {
+            t.Errorf("loading from 0x%08x panicked with %q", address, recovered)
+        }
+    }
+}
+
+// the left operand of an operation is the one below the right on
+// the stack (see 'arithmetic_op'), whichever side is generated
+// first, and both are popped
+func Test_operand_order(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Assignment{"a", Integer{"100"}},
+        Assignment{"b", Integer{"7"}},
+        Assignment{"c", Integer{"3"}},
+        Call{"Printf", []interface{}{String{"%d %d %d\\n"},
+            ArithmeticOp{Ident{"a"}, "sub", Ident{"b"}},
+            ArithmeticOp{Ident{"a"}, "div", ArithmeticOp{Ident{"b"}, "sub", Ident{"c"}}},
+            ArithmeticOp{ArithmeticOp{Ident{"a"}, "sub", Ident{"b"}}, "sub", ArithmeticOp{Ident{"c"}, "sub", ArithmeticOp{Ident{"b"}, "mul", Ident{"c"}}}},
+        }},
+        Assignment{"d", ArithmeticOp{Ident{"c"}, "slt", ArithmeticOp{Ident{"a"}, "sub", Ident{"b"}}}},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"d"}}},
+    }}
+    if err := check_with_emulator(program, default_backend_options()); err != nil {
+        t.Error(err)
+    }
+    if stdout, _, _ := run_with_emulator(program, default_backend_options()); stdout != "93 25 111\n1\n" {
+        t.Errorf("printed %q", stdout)
+    }
+}
+
+// 'Printf' prints the same on every target that can print: with
+// MARS's syscalls, or with 'write' on linux (with or without libc);
+// the bare-metal target has neither, which is an error
+func Test_printf_targets(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Assignment{"a", Integer{"-42"}},
+        Assignment{"b", Integer{"-2147483648"}},
+        Call{"Printf", []interface{}{String{"a = %d, %c%s %d %d%%\\n"},
+            Ident{"a"}, Integer{"120"}, String{"yz"}, Integer{"0"}, Ident{"b"}}},
+    }}
+    const expected string = "a = -42, xyz 0 -2147483648%\n"
+    for _, target := range []string{"mars", "linux", "linux-n32"} {
+        for _, libc := range []bool{false, true} {
+            if libc && target == "mars" {
+                continue
+            }
+            var options BackendOptions = default_backend_options()
+            options.target, options.libc = target, libc
+            backend, diagnostics, ok := try_generate(program, options)
+            if !ok {
+                t.Errorf("%s (libc: %t): %s", target, libc, strings.Join(diagnostics, "\n"))
+                continue
+            }
+            if stdout, _, err := backend.run_emulated(); err != nil || stdout != expected {
+                t.Errorf("%s (libc: %t) printed %q (%v), expected %q", target, libc, stdout, err, expected)
+            }
+        }
+    }
+    var options BackendOptions = default_backend_options()
+    options.target = "bare"
+    if _, diagnostics, ok := try_generate(program, options); ok ||
+        !strings.Contains(strings.Join(diagnostics, "\n"), "'Printf' needs the 'print_string' or 'write' syscall, which target 'bare' doesn't have") {
+        t.Errorf("printing on the bare-metal target gave %q", diagnostics)
+    }
+}
+
+// an interpolated string written out (see 'parse_interp') prints
+// its variables, and doubled braces as single ones
+func Test_interp_text(t *testing.T) {
+    ast, err := decode_ast([]byte(`{"node": "Program", "nodes": [
+        {"node": "Assignment", "name": "x", "value": {"node": "Integer", "value": -7}},
+        {"node": "Assignment", "name": "s", "value": {"node": "String", "value": "ab"}},
+        {"node": "Interp", "text": "x = {x}, {{s}} = { s }}}{{\\n"}
+    ]}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    const expected string = "x = -7, {s} = ab}{\n"
+    if stdout, _, err := run_with_emulator(ast, default_backend_options()); err != nil || stdout != expected {
+        t.Errorf("printed %q (%v), expected %q", stdout, err, expected)
+    }
+    if err := check_with_emulator(ast, default_backend_options()); err != nil {
+        t.Error(err)
+    }
+    for text, expected := range map[string]string{
+        "{x":     `$.nodes[0].text: unmatched '{' in "{x"`,
+        "x}":     `$.nodes[0].text: unmatched '}' in "x}"`,
+        "a {} b": `$.nodes[0].text: empty '{}' in "a {} b"`,
+    } {
+        var data string = fmt.Sprintf(`{"node": "Program", "nodes": [{"node": "Interp", "text": %q}]}`, text)
+        if _, err := decode_ast([]byte(data)); err == nil || err.Error() != expected {
+            t.Errorf("%q: %v, expected %s", text, err, expected)
+        }
+    }
+}
+
+// the string literals builtins write to stay writable (storing to
+// the read-only data faults, see 'Machine'), and only the ones
+// builtins just read go there (see 'read_only_literal')
+func Test_writable_literals(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Call{"memcpy", []interface{}{String{"....."}, String{"hey"}, Integer{"3"}}},
+        Call{"memset", []interface{}{String{"ab"}, Integer{"33"}, Integer{"1"}}},
+        Call{"Printf", []interface{}{String{"%c\\n"}, Call{"rune_at", []interface{}{String{"xyz"}, Integer{"1"}}}}},
+    }}
+    backend, diagnostics, ok := try_generate(program, default_backend_options())
+    if !ok {
+        t.Fatal(strings.Join(diagnostics, "\n"))
+    }
+    if stdout, _, err := backend.run_emulated(); err != nil || stdout != "y\n" {
+        t.Errorf("printed %q (%v)", stdout, err)
+    }
+    for text, rodata := range map[string]bool{`"....."`: false, `"ab"`: false, `"hey"`: true, `"xyz"`: true} {
+        if strings.Contains(backend.rodata_section, text) != rodata || strings.Contains(backend.data_section, text) == rodata {
+            t.Errorf("%s is in the wrong section:\n.rdata\n%s.data\n%s", text, backend.rodata_section, backend.data_section)
+        }
+    }
+    var machine *Machine = new_machine(backend.link_image(backend.options.binary_base), backend.byte_order())
+    if recovered, ok := recovered_from(func() { machine.store(machine.read_only[0], 1, 0) }).(string); !ok ||
+        !strings.Contains(recovered, "store to read-only data") {
+        t.Errorf("storing to the read-only data panicked with %#v", recovered)
+    }
+}
+
+// substrings are copied to the heap (see 'slice'), so they keep
+// their text after the next one is made, and they're NUL
+// terminated; targets without 'sbrk' can't make them
+func Test_substrings(t *testing.T) {
+    var (
+        s      Ident = Ident{"s"}
+        slice        = func(value interface{}, low string, high string) Slice {
+            return Slice{value, Integer{low}, Integer{high}}
+        }
+    )
+    var program Program = Program{[]interface{}{
+        Assignment{"s", String{"hello, world"}},
+        Assignment{"n", Integer{"5"}},
+        Assignment{"first", Slice{s, Integer{"0"}, Ident{"n"}}},
+        Assignment{"second", slice(s, "7", "12")},
+        Call{"Printf", []interface{}{String{"%s|%s|%s|%s\\n"},
+            Ident{"first"}, Ident{"second"}, slice(s, "3", "3"), slice(slice(s, "7", "12"), "1", "3")}},
+        // the temporaries around a substring survive the routine
+        Call{"Printf", []interface{}{String{"%d %s %d %c\\n"}, ArithmeticOp{Ident{"n"}, "mul", Integer{"3"}},
+            Slice{s, ArithmeticOp{Ident{"n"}, "subu", Integer{"1"}}, ArithmeticOp{Ident{"n"}, "addu", Integer{"1"}}},
+            Ident{"n"}, Index{Ident{"first"}, Integer{"1"}}}},
+    }}
+    backend, diagnostics, ok := try_generate(program, default_backend_options())
+    if !ok {
+        t.Fatal(strings.Join(diagnostics, "\n"))
+    }
+    const expected string = "hello|world||or\n15 o, 5 e\n"
+    if stdout, _, err := backend.run_emulated(); err != nil || stdout != expected {
+        t.Errorf("printed %q (%v), expected %q", stdout, err, expected)
+    }
+    if err := check_with_emulator(program, default_backend_options()); err != nil {
+        t.Error(err)
+    }
+    var options BackendOptions = default_backend_options()
+    options.target = "linux"
+    if _, diagnostics, ok := try_generate(program, options); ok ||
+        !strings.Contains(strings.Join(diagnostics, "\n"), "'a[i:j]' needs the 'sbrk' syscall, which target 'linux' doesn't have") {
+        t.Errorf("slicing on linux gave %q", diagnostics)
+    }
+}
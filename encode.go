@@ -0,0 +1,505 @@
+package main
+
+import (
+    "encoding/binary"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// the number of every register, by name
+var register_numbers = map[string]uint32{
+    "$zero": 0, "$at": 1, "$v0": 2, "$v1": 3,
+    "$a0": 4, "$a1": 5, "$a2": 6, "$a3": 7,
+    "$t0": 8, "$t1": 9, "$t2": 10, "$t3": 11,
+    "$t4": 12, "$t5": 13, "$t6": 14, "$t7": 15,
+    "$s0": 16, "$s1": 17, "$s2": 18, "$s3": 19,
+    "$s4": 20, "$s5": 21, "$s6": 22, "$s7": 23,
+    "$t8": 24, "$t9": 25, "$k0": 26, "$k1": 27,
+    "$gp": 28, "$sp": 29, "$fp": 30, "$ra": 31,
+}
+
+// the function field of the R-type instructions ('SPECIAL' opcode)
+var r_functs = map[string]uint32{
+    "sll": 0x00, "srl": 0x02, "sra": 0x03, "sllv": 0x04, "srlv": 0x06, "srav": 0x07,
+    "jr": 0x08, "jalr": 0x09, "movz": 0x0a, "movn": 0x0b, "syscall": 0x0c,
+    "mfhi": 0x10, "mflo": 0x12, "mult": 0x18, "multu": 0x19, "div": 0x1a, "divu": 0x1b,
+    "add": 0x20, "addu": 0x21, "sub": 0x22, "subu": 0x23,
+    "and": 0x24, "or": 0x25, "xor": 0x26, "nor": 0x27, "slt": 0x2a, "sltu": 0x2b,
+}
+
+// the opcodes of the I-type and J-type instructions
+var opcodes = map[string]uint32{
+    "j": 0x02, "jal": 0x03, "beq": 0x04, "bne": 0x05, "blez": 0x06, "bgtz": 0x07,
+    "beql": 0x14, "bnel": 0x15,
+    "addi": 0x08, "addiu": 0x09, "slti": 0x0a, "sltiu": 0x0b,
+    "andi": 0x0c, "ori": 0x0d, "xori": 0x0e, "lui": 0x0f,
+    "lb": 0x20, "lh": 0x21, "lw": 0x23, "lbu": 0x24, "lhu": 0x25,
+    "sb": 0x28, "sh": 0x29, "sw": 0x2b, "ll": 0x30, "sc": 0x38,
+    "lwc1": 0x31, "ldc1": 0x35,
+}
+
+// every byte order, by the name GNU tools use for it
+var byte_orders = map[string]binary.ByteOrder{
+    "EB": binary.BigEndian,
+    "EL": binary.LittleEndian,
+}
+
+// returns the name of the byte order binary output uses
+func (backend *MIPSBackend) byte_order_name() string {
+    if backend.options.byte_order != "" {
+        return backend.options.byte_order
+    }
+    return backend.target.byte_order
+}
+
+// returns the byte order binary output uses
+func (backend *MIPSBackend) byte_order() binary.ByteOrder {
+    return byte_orders[backend.byte_order_name()]
+}
+
+// an instruction placed in memory; pseudo-instructions
+// can take up several words
+type Encoded struct {
+    address uint32
+    source  Instruction
+    // the real instructions 'source' expands to
+    expansion []Instruction
+    words     []uint32
+}
+
+// a program laid out in memory; the data section
+// directly follows the text section
+type Image struct {
+    base         uint32
+    text         []Encoded
+    data         []byte
+    data_address uint32
+    labels       map[string]uint32
+}
+
+// returns the operands of an instruction
+func operands(instruction Instruction) []string {
+    return filter_out_blank(instruction.args)
+}
+
+// returns the number of a register, panicking for names
+// that aren't real registers (e.g. '$t10')
+func register_number(name string) uint32 {
+    if number, ok := register_numbers[name]; ok {
+        return number
+    }
+    if number, err := strconv.ParseUint(strings.TrimPrefix(name, "$"), 10, 5); err == nil && strings.HasPrefix(name, "$") {
+        return uint32(number)
+    }
+    panic(fmt.Sprintf("'%s' isn't a register", name))
+}
+
+// parses an integer literal (decimal, hex, or a character)
+func parse_immediate(literal string) (int64, bool) {
+    if len(literal) == 3 && literal[0] == '\'' && literal[2] == '\'' {
+        return int64(literal[1]), true
+    }
+    value, err := strconv.ParseInt(literal, 0, 64)
+    if err != nil {
+        // e.g. 0xffff0000, which doesn't fit an int64 only when negative
+        unsigned, err := strconv.ParseUint(literal, 0, 32)
+        if err != nil {
+            return 0, false
+        }
+        return int64(unsigned), true
+    }
+    return value, true
+}
+
+// splits a memory operand of the form "offset(base)"
+func split_memory(operand string) (string, string, bool) {
+    var open int = strings.Index(operand, "(")
+    if open == -1 || !strings.HasSuffix(operand, ")") {
+        return "", "", false
+    }
+    var offset string = operand[:open]
+    if offset == "" {
+        offset = "0"
+    }
+    return offset, operand[open+1 : len(operand)-1], true
+}
+
+// splits a label operand of the form "label+offset"
+func split_label(operand string) (string, int64) {
+    if i := strings.LastIndexAny(operand, "+-"); i > 0 {
+        if offset, ok := parse_immediate(operand[i:]); ok {
+            return operand[:i], offset
+        }
+    }
+    return operand, 0
+}
+
+// returns an instruction with the given operands
+func make_instruction(opcode string, args ...string) Instruction {
+    for len(args) < 3 {
+        args = append(args, "")
+    }
+    return Instruction{opcode, args, ""}
+}
+
+// expands a pseudo-instruction into real instructions; the
+// expansion's size never depends on label addresses, so it can be
+// done before they are known ('address' resolves labels, or
+// returns 0 during layout). branches and jumps get a 'nop' in
+// their delay slot
+func expand(instruction Instruction, address func(string) uint32) (ret []Instruction) {
+    var args []string = operands(instruction)
+    if opcode_table[instruction.opcode].memory != "" {
+        if _, _, ok := split_memory(args[1]); !ok {
+            // a label, which needs its upper half in $at first
+            label, offset := split_label(args[1])
+            var value uint32 = address(label) + uint32(offset)
+            // the lower half is sign extended, so round the upper half
+            return []Instruction{
+                make_instruction("lui", "$at", fmt.Sprint(((value+0x8000)>>16)&0xffff)),
+                make_instruction(instruction.opcode, args[0],
+                    fmt.Sprintf("%d($at)", int16(value&0xffff))),
+            }
+        }
+    }
+    switch instruction.opcode {
+    case ".set", ".globl", ".text":
+        return nil
+    case "move":
+        return []Instruction{make_instruction("addu", args[0], args[1], "$zero")}
+    case "nop":
+        return []Instruction{make_instruction("sll", "$zero", "$zero", "0")}
+    case "li":
+        value, ok := parse_immediate(args[1])
+        if !ok {
+            panic(fmt.Sprintf("bad immediate '%s'", args[1]))
+        }
+        if value >= -0x8000 && value < 0x8000 {
+            return []Instruction{make_instruction("addiu", args[0], "$zero", fmt.Sprint(value))}
+        }
+        if value >= 0 && value <= 0xffff {
+            return []Instruction{make_instruction("ori", args[0], "$zero", fmt.Sprint(value))}
+        }
+        return []Instruction{
+            make_instruction("lui", args[0], fmt.Sprint((uint32(value)>>16)&0xffff)),
+            make_instruction("ori", args[0], args[0], fmt.Sprint(uint32(value)&0xffff)),
+        }
+    case "la":
+        label, offset := split_label(args[1])
+        var value uint32 = address(label) + uint32(offset)
+        return []Instruction{
+            make_instruction("lui", args[0], fmt.Sprint(value>>16)),
+            make_instruction("ori", args[0], args[0], fmt.Sprint(value&0xffff)),
+        }
+    case "div", "divu":
+        if len(args) == 3 {
+            return []Instruction{
+                make_instruction(instruction.opcode, args[1], args[2]),
+                make_instruction("mflo", args[0]),
+            }
+        }
+    case "j":
+        if strings.HasPrefix(args[0], "$") {
+            // 'j $31' is accepted as 'jr $31'
+            return []Instruction{make_instruction("jr", args[0]), make_instruction("sll", "$zero", "$zero", "0")}
+        }
+    }
+    ret = []Instruction{instruction}
+    if opcode_table[instruction.opcode].delay_slot {
+        ret = append(ret, make_instruction("sll", "$zero", "$zero", "0"))
+    }
+    return
+}
+
+// returns the encoding of a real instruction at 'pc'
+func encode(instruction Instruction, pc uint32, address func(string) uint32) uint32 {
+    var (
+        args []string = operands(instruction)
+        reg           = func(i int) uint32 { return register_number(args[i]) }
+        // $f0-$f31 are numbered like the integer registers
+        freg = func(i int) uint32 { return register_number("$" + strings.TrimPrefix(args[i], "$f")) }
+        imm           = func(i int) uint32 {
+            value, ok := parse_immediate(args[i])
+            if !ok {
+                panic(fmt.Sprintf("bad immediate '%s' in '%s'", args[i], instruction.opcode))
+            }
+            return uint32(value) & 0xffff
+        }
+        branch = func(i int) uint32 {
+            return ((address(args[i]) - (pc + 4)) >> 2) & 0xffff
+        }
+    )
+    var op string = instruction.opcode
+    if opcode_table[op].memory != "" {
+        offset, base, _ := split_memory(args[1])
+        value, ok := parse_immediate(offset)
+        if !ok || value < -0x8000 || value >= 0x8000 {
+            panic(fmt.Sprintf("bad offset '%s' in '%s'", offset, op))
+        }
+        var target uint32
+        if op == "lwc1" || op == "ldc1" {
+            target = freg(0)
+        } else {
+            target = reg(0)
+        }
+        return opcodes[op]<<26 | register_number(base)<<21 | target<<16 | uint32(value)&0xffff
+    }
+    switch op {
+    case "syscall":
+        return 0x0000000c
+    case "eret":
+        return 0x42000018
+    case "mfc0":
+        return 0x40000000 | reg(0)<<16 | register_number("$"+strings.TrimPrefix(args[1], "$"))<<11
+    case "mtc0":
+        return 0x40800000 | reg(0)<<16 | register_number("$"+strings.TrimPrefix(args[1], "$"))<<11
+    case "mfc1":
+        return 0x44000000 | reg(0)<<16 | freg(1)<<11
+    case "mtc1":
+        return 0x44800000 | reg(0)<<16 | freg(1)<<11
+    case "cvt.s.w":
+        return 0x46800020 | freg(1)<<11 | freg(0)<<6
+    case "trunc.w.s":
+        return 0x4600000d | freg(1)<<11 | freg(0)<<6
+    case "mul":
+        return 0x1c<<26 | reg(1)<<21 | reg(2)<<16 | reg(0)<<11 | 0x02
+    case "clz":
+        return 0x1c<<26 | reg(1)<<21 | reg(0)<<16 | reg(0)<<11 | 0x20
+    case "seb", "seh":
+        return 0x1f<<26 | reg(1)<<16 | reg(0)<<11 | map[string]uint32{"seb": 0x10, "seh": 0x18}[op]<<6 | 0x20
+    case "sll", "srl", "sra":
+        value, _ := parse_immediate(args[2])
+        return reg(1)<<16 | reg(0)<<11 | (uint32(value)&0x1f)<<6 | r_functs[op]
+    case "sllv", "srlv", "srav":
+        return reg(2)<<21 | reg(1)<<16 | reg(0)<<11 | r_functs[op]
+    case "jr":
+        return reg(0)<<21 | r_functs[op]
+    case "jalr":
+        return reg(0)<<21 | 31<<11 | r_functs[op]
+    case "mfhi", "mflo":
+        return reg(0)<<11 | r_functs[op]
+    case "mult", "multu", "div", "divu":
+        return reg(0)<<21 | reg(1)<<16 | r_functs[op]
+    case "add", "addu", "sub", "subu", "and", "or", "xor", "nor", "slt", "sltu", "movz", "movn":
+        return reg(1)<<21 | reg(2)<<16 | reg(0)<<11 | r_functs[op]
+    case "addi", "addiu", "slti", "sltiu", "andi", "ori", "xori":
+        return opcodes[op]<<26 | reg(1)<<21 | reg(0)<<16 | imm(2)
+    case "lui":
+        return opcodes[op]<<26 | reg(0)<<16 | imm(1)
+    case "beq", "bne", "beql", "bnel":
+        return opcodes[op]<<26 | reg(0)<<21 | reg(1)<<16 | branch(2)
+    case "blez", "bgtz":
+        return opcodes[op]<<26 | reg(0)<<21 | branch(1)
+    case "bltz":
+        return 0x01<<26 | reg(0)<<21 | 0<<16 | branch(1)
+    case "bgez":
+        return 0x01<<26 | reg(0)<<21 | 1<<16 | branch(1)
+    case "j", "jal":
+        return opcodes[op]<<26 | (address(args[0])>>2)&0x3ffffff
+    }
+    panic(fmt.Sprintf("can't encode '%s'", instruction.opcode))
+}
+
+// unescapes the contents of an '.ascii' or '.asciiz' string
+func unescape(literal string) []byte {
+    var ret []byte
+    for i := 0; i < len(literal); i++ {
+        if literal[i] != '\\' || i+1 == len(literal) {
+            ret = append(ret, literal[i])
+            continue
+        }
+        i++
+        switch literal[i] {
+        case 'n':
+            ret = append(ret, '\n')
+        case 't':
+            ret = append(ret, '\t')
+        case 'r':
+            ret = append(ret, '\r')
+        case '0':
+            ret = append(ret, 0)
+        default:
+            ret = append(ret, literal[i])
+        }
+    }
+    return ret
+}
+
+// lays out a data section (as emitted by '__emit_data') starting
+// at 'address'; returns its bytes and the address of every label
+func layout_data(section string, address uint32, labels map[string]uint32, order binary.ByteOrder) []byte {
+    var data []byte
+    var align = func(n int) {
+        for (int(address)+len(data))%n != 0 {
+            data = append(data, 0)
+        }
+    }
+    for _, line := range strings.Split(section, "\n") {
+        line = strings.TrimSpace(strip_comment(line))
+        if line == "" {
+            continue
+        }
+        if colon := strings.Index(line, ":"); colon != -1 && !strings.HasPrefix(line, ".") {
+            var label string = line[:colon]
+            line = strings.TrimSpace(line[colon+1:])
+            // words are aligned before their label is placed
+            if strings.HasPrefix(line, ".word") || strings.HasPrefix(line, ".float") {
+                align(4)
+            } else if strings.HasPrefix(line, ".half") {
+                align(2)
+            } else if strings.HasPrefix(line, ".double") {
+                align(8)
+            }
+            labels[label] = address + uint32(len(data))
+            if line == "" {
+                // a label of its own
+                continue
+            }
+        }
+        var directive, rest string = line, ""
+        if space := strings.IndexAny(line, " \t"); space != -1 {
+            directive, rest = line[:space], strings.TrimSpace(line[space+1:])
+        }
+        switch directive {
+        case ".asciiz", ".ascii":
+            data = append(data, unescape(strings.Trim(rest, "\""))...)
+            if directive == ".asciiz" {
+                data = append(data, 0)
+            }
+        case ".space":
+            size, _ := parse_immediate(rest)
+            data = append(data, make([]byte, size)...)
+        case ".align":
+            power, _ := parse_immediate(rest)
+            align(1 << power)
+        case ".byte", ".half", ".word":
+            var size int = map[string]int{".byte": 1, ".half": 2, ".word": 4}[directive]
+            align(size)
+            for _, item := range strings.Split(rest, ",") {
+                value, ok := parse_immediate(strings.TrimSpace(item))
+                if !ok {
+                    // a label, which has to be defined by now (the
+                    // text and the data before it); labels that
+                    // aren't are 0
+                    value = int64(labels[strings.TrimSpace(item)])
+                }
+                var bytes [4]byte
+                switch size {
+                case 1:
+                    bytes[0] = byte(value)
+                case 2:
+                    order.PutUint16(bytes[:], uint16(value))
+                case 4:
+                    order.PutUint32(bytes[:], uint32(value))
+                }
+                data = append(data, bytes[:size]...)
+            }
+        case ".float", ".double":
+            var bytes [8]byte
+            for _, item := range strings.Split(rest, ",") {
+                value, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+                if err != nil {
+                    panic(fmt.Sprintf("bad floating-point value '%s'", item))
+                }
+                if directive == ".float" {
+                    align(4)
+                    order.PutUint32(bytes[:], math.Float32bits(float32(value)))
+                    data = append(data, bytes[:4]...)
+                } else {
+                    align(8)
+                    order.PutUint64(bytes[:], math.Float64bits(value))
+                    data = append(data, bytes[:8]...)
+                }
+            }
+        default:
+            panic(fmt.Sprintf("unsupported data directive '%s'", directive))
+        }
+    }
+    return data
+}
+
+// lays out and encodes the program at 'base'; the data section
+// directly follows the text section (aligned to a word)
+func (backend *MIPSBackend) link_image(base uint32) Image {
+    if len(backend.ktext_section) != 0 {
+        panic("exception handlers can't be part of a flat binary")
+    }
+    if backend.options.pic {
+        panic("position-independent code needs a GOT, which flat binaries don't have")
+    }
+    for _, section := range backend.sections {
+        if section.address != "" {
+            panic(fmt.Sprintf("section '%s' starts at an address, which flat binaries can't skip to (see 'linker_script')", section.name))
+        }
+    }
+    if len(backend.raw_lines) != 0 {
+        panic("raw lines can't be part of a flat binary, which only has what 'encode' knows")
+    }
+    var (
+        image   Image         = Image{base, nil, nil, 0, map[string]uint32{}}
+        text    []Instruction = backend.text_instructions()
+        address uint32        = base
+        unknown               = func(string) uint32 { return 0 }
+    )
+    // first pass: place every instruction and label
+    for _, instruction := range text {
+        if strings.HasSuffix(instruction.opcode, ":") {
+            image.labels[strings.TrimSuffix(instruction.opcode, ":")] = address
+            continue
+        }
+        var expansion []Instruction = expand(instruction, unknown)
+        image.text = append(image.text, Encoded{address, instruction, expansion, nil})
+        address += uint32(4 * len(expansion))
+    }
+    image.data_address = (address + 3) &^ 3
+    // the read-only data comes first, as in 'linker_script', and
+    // '__rodata_end' is where it ends (see 'Machine')
+    image.data = layout_data(backend.rodata_section+"__rodata_end:\n    .align 2\n"+backend.data_section, image.data_address,
+        image.labels, backend.byte_order())
+    // the bss follows the data, but isn't part of the image; the
+    // startup code zeroes it (see 'bare_metal_scaffold')
+    var bss_start uint32 = (image.data_address + uint32(len(image.data)) + 3) &^ 3
+    image.labels["__bss_start"] = bss_start
+    image.labels["__bss_end"] = bss_start + uint32(len(layout_data(backend.bss_section, bss_start, image.labels, backend.byte_order())))
+    // second pass: encode now that every label is known
+    var resolve = func(label string) uint32 {
+        value, ok := image.labels[label]
+        if !ok {
+            panic(fmt.Sprintf("undefined label '%s'", label))
+        }
+        return value
+    }
+    for i := range image.text {
+        var encoded *Encoded = &image.text[i]
+        encoded.expansion = expand(encoded.source, resolve)
+        for j, instruction := range encoded.expansion {
+            encoded.words = append(encoded.words,
+                encode(instruction, encoded.address+uint32(4*j), resolve))
+        }
+    }
+    return image
+}
+
+// returns the program as a flat binary image (in the target's
+// byte order), to be loaded at the 'binary_base' option; the text
+// section comes first, followed by the read-only data and the data
+// section
+func (backend *MIPSBackend) assemble_binary() []byte {
+    var (
+        image Image = backend.link_image(backend.options.binary_base)
+        ret   []byte
+    )
+    for _, encoded := range image.text {
+        for _, word := range encoded.words {
+            var bytes [4]byte
+            backend.byte_order().PutUint32(bytes[:], word)
+            ret = append(ret, bytes[:]...)
+        }
+    }
+    for uint32(len(ret)) < image.data_address-image.base {
+        ret = append(ret, 0)
+    }
+    return append(ret, image.data...)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+    "bytes"
+    "encoding/binary"
+    "encoding/hex"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// binary output is in the target's byte order unless the
+// 'byte_order' option (-byte-order) says otherwise, instructions and
+// data alike
+func Test_byte_order(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Static{"counter", "int", "0x11223344"},
+        Assignment{"counter", ArithmeticOp{Ident{"counter"}, "add", Integer{"1"}}},
+    }}
+    var cases = []struct {
+        target     string
+        byte_order string
+        expected   string
+    }{
+        {"mars", "", "EL"},
+        {"mars", "EB", "EB"},
+        {"bare", "", "EB"},
+        {"bare", "EL", "EL"},
+        {"linux", "EL", "EL"},
+    }
+    for _, test := range cases {
+        var flags *flag.FlagSet = flag.NewFlagSet("scg", flag.ContinueOnError)
+        var options BackendOptions = default_backend_options()
+        backend_flags(flags, &options)
+        if err := flags.Parse([]string{"-target", test.target, "-byte-order", test.byte_order}); err != nil {
+            t.Fatal(err)
+        }
+        var backend MIPSBackend = new_mips_backend_with(program, options)
+        if name := backend.byte_order_name(); name != test.expected {
+            t.Errorf("-target %s -byte-order '%s' is %s, expected %s", test.target, test.byte_order, name, test.expected)
+            continue
+        }
+        if test.target == "linux" {
+            // which flat binaries aren't for
+            continue
+        }
+        var (
+            image  []byte = backend.assemble_binary()
+            static []byte = []byte{0x11, 0x22, 0x33, 0x44}
+        )
+        if test.expected == "EL" {
+            static = []byte{0x44, 0x33, 0x22, 0x11}
+        }
+        // the static is the last word of the data
+        if stored := image[len(image)-4:]; !bytes.Equal(stored, static) {
+            t.Errorf("%s, %s: the static is stored as % x", test.target, test.expected, stored)
+        }
+        // and instructions are reversed in the other order
+        var other MIPSBackend = backend
+        other.options.byte_order = map[string]string{"EB": "EL", "EL": "EB"}[test.expected]
+        if first, reversed := image[:4], other.assemble_binary()[:4]; bytes.Equal(first, reversed) ||
+            first[0] != reversed[3] || first[1] != reversed[2] || first[2] != reversed[1] || first[3] != reversed[0] {
+            t.Errorf("%s, %s: the first instruction is % x, and % x in the other order", test.target, test.expected, first, reversed)
+        }
+    }
+}
+
+// multi-byte data is laid out in the given order too
+func Test_data_byte_order(t *testing.T) {
+    const section string = "table: .word 0x11223344\nhalf: .half 0x5566\nbyte: .byte 0x77"
+    for name, expected := range map[string][]byte{
+        "EB": {0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77},
+        "EL": {0x44, 0x33, 0x22, 0x11, 0x66, 0x55, 0x77},
+    } {
+        var data []byte = layout_data(section, 0x10010000, map[string]uint32{}, byte_orders[name])
+        if !bytes.Equal(data, expected) {
+            t.Errorf("%s: laid out as % x, expected % x", name, data, expected)
+        }
+    }
+    var words []byte = layout_data(".word 1, 2", 0, map[string]uint32{}, binary.LittleEndian)
+    if binary.LittleEndian.Uint32(words[4:]) != 2 {
+        t.Errorf("'.word 1, 2' is laid out as % x", words)
+    }
+}
+
+func Test_unknown_byte_order(t *testing.T) {
+    var options BackendOptions = default_backend_options()
+    options.byte_order = "middle"
+    if recovered, _ := recovered_from(func() { blank_mips_backend(options) }).(string); !strings.Contains(recovered, "unknown byte order") {
+        t.Errorf("an unknown byte order panicked with %q", recovered)
+    }
+}
+
+// -format bin writes what 'assemble_binary' returns, laid out at
+// -base
+func Test_binary_format(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Static{"counter", "int", "7"},
+        Function{"f", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "add", Ident{"counter"}}}}, false},
+        Assignment{"counter", Call{"f", []interface{}{Integer{"1"}}}},
+    }}
+    var inputs = map[string]interface{}{"program.json": program}
+    for _, base := range []uint32{0x00400000, 0x00001000} {
+        var options BackendOptions = default_backend_options()
+        options.target = "bare"
+        options.binary_base = base
+        var (
+            backend  MIPSBackend = new_mips_backend_with(program, options)
+            expected []byte      = backend.assemble_binary()
+            image    []byte      = run_scg(t, inputs, "-format", "bin", "-target", "bare", "-base", fmt.Sprintf("%#x", base), "program.json")
+        )
+        if !bytes.Equal(image, expected) {
+            t.Errorf("-base %#x: the image is\n% x\nexpected\n% x", base, image, expected)
+        }
+    }
+    // the base is where 'jal' and 'la' point
+    if bytes.Equal(run_scg(t, inputs, "-format", "bin", "-target", "bare", "program.json"),
+        run_scg(t, inputs, "-format", "bin", "-target", "bare", "-base", "0x1000", "program.json")) {
+        t.Errorf("-base didn't move the program")
+    }
+    if code := string(run_scg(t, inputs, "-target", "bare", "program.json")); !strings.Contains(code, "main:") {
+        t.Errorf("the default format isn't assembly:\n%s", code)
+    }
+}
+
+// every word of the listing (-listing) is at the address, and has
+// the encoding, that it has in the binary (-format bin); the data
+// follows the same way
+func Test_listing(t *testing.T) {
+    var (
+        program Program = Program{[]interface{}{
+            Static{"table", "int", "0x11223344"},
+            Assignment{"text", String{"abc"}},
+            If{ArithmeticOp{Integer{"100000"}, "slt", Ident{"table"}}, []interface{}{
+                Assignment{"table", ArithmeticOp{Ident{"table"}, "sub", Integer{"100000"}}},
+            }, nil},
+        }}
+        path   string = filepath.Join(t.TempDir(), "listing.txt")
+        image  []byte = run_scg(t, map[string]interface{}{"program.json": program},
+            "-format", "bin", "-target", "bare", "-base", "0x1000", "-listing", path, "program.json")
+        line   *regexp.Regexp = regexp.MustCompile(`^    ([0-9a-f]{8}):  (.*?)(  |$)`)
+        next   uint32         = 0x1000
+        data   bool
+        listed int
+    )
+    listing, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, text := range strings.Split(string(listing), "\n") {
+        if text == ".data" {
+            data = true
+            continue
+        }
+        var match []string = line.FindStringSubmatch(text)
+        if match == nil {
+            continue
+        }
+        address, _ := strconv.ParseUint(match[1], 16, 32)
+        encoding, err := hex.DecodeString(strings.ReplaceAll(match[2], " ", ""))
+        if err != nil {
+            t.Fatalf("%q: %v", text, err)
+        }
+        if !data {
+            // words, in the target's (big-endian) order
+            if uint32(address) != next {
+                t.Errorf("%q follows %08x", text, next-4)
+            }
+            next = uint32(address) + 4
+        }
+        var offset int = int(address) - 0x1000
+        if offset < 0 || offset+len(encoding) > len(image) || !bytes.Equal(image[offset:offset+len(encoding)], encoding) {
+            t.Errorf("%q isn't what the binary has there", text)
+        }
+        listed += len(encoding)
+    }
+    if !data || listed == 0 {
+        t.Fatalf("the listing has no instructions or no data:\n%s", listing)
+    }
+    // only the padding before the data isn't listed
+    if padding := len(image) - listed; padding < 0 || padding > 3 {
+        t.Errorf("%d of the binary's %d bytes are listed", listed, len(image))
+    }
+}
+
+// -size-report prints 'code_size_report' for the code the other
+// flags generate; MIPS32's size is the binary's, less the padding
+// before the data
+func Test_size_report(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Static{"table", "int", "3"},
+        Assignment{"a", ArithmeticOp{Ident{"table"}, "add", Integer{"1"}}},
+        Assignment{"table", ArithmeticOp{Ident{"a"}, "mul", Ident{"a"}}},
+    }}
+    var options BackendOptions = default_backend_options()
+    options.target = "bare"
+    var (
+        backend MIPSBackend = new_mips_backend_with(program, options)
+        report  SizeReport  = backend.code_size_report()
+    )
+    image, text := run_scg_with_stderr(t, map[string]interface{}{"program.json": program},
+        "-format", "bin", "-target", "bare", "-size-report", "program.json")
+    if text != report.String() {
+        t.Errorf("-size-report printed\n%s\nexpected\n%s", text, report)
+    }
+    if padding := len(image) - report.mips32; padding < 0 || padding > 3 {
+        t.Errorf("MIPS32 is %d bytes, the binary %d", report.mips32, len(image))
+    }
+    if report.micromips >= report.mips32 || !strings.HasPrefix(text, fmt.Sprintf("MIPS32:    %d bytes\n", report.mips32)) {
+        t.Errorf("the report is\n%s", text)
+    }
+}
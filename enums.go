@@ -0,0 +1,153 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// a member of an enum
+type EnumMember struct {
+    enum  string
+    value int64
+}
+
+// the state of enum folding
+type EnumFolder struct {
+    members map[string]EnumMember
+}
+
+// adds the members of an enum, panicking if another
+// enum already has one of them
+func (folder *EnumFolder) declare(node Enum) {
+    var next int64 = 0
+    for i, member := range node.members {
+        if other, ok := folder.members[member]; ok {
+            panic(fmt.Sprintf("enum member '%s' is declared by both '%s' and '%s'", member, other.enum, node.name))
+        }
+        if i < len(node.values) && node.values[i] != "" {
+            value, err := strconv.ParseInt(node.values[i], 0, 32)
+            if err != nil {
+                panic(fmt.Sprintf("enum member '%s' has invalid value '%s'", member, node.values[i]))
+            }
+            next = value
+        }
+        folder.members[member] = EnumMember{node.name, next}
+        next++
+    }
+}
+
+// returns the enum an expression's value comes from, or "" if
+// it isn't a member (or a hinted member) of one
+func (folder *EnumFolder) enum_of(__node interface{}) string {
+    switch node := __node.(type) {
+    case Ident:
+        return folder.members[node.name].enum
+    case Hint:
+        return folder.enum_of(node.cond)
+    }
+    return ""
+}
+
+// copies a node, replacing every enum member with its value; panics
+// if a member is assigned to, declared as a variable, shadowed by a
+// parameter, or used in an operation with a member of another enum
+func (folder *EnumFolder) fold(__node interface{}) interface{} {
+    switch node := __node.(type) {
+    case Ident:
+        if member, ok := folder.members[node.name]; ok {
+            return Integer{fmt.Sprint(member.value)}
+        }
+    case ArithmeticOp:
+        left, right := folder.enum_of(node.left), folder.enum_of(node.right)
+        if left != "" && right != "" && left != right {
+            panic(fmt.Sprintf("'%s' can't be used with members of both '%s' and '%s'", node.op, left, right))
+        }
+        return ArithmeticOp{folder.fold(node.left), node.op, folder.fold(node.right)}
+    case Assignment:
+        if member, ok := folder.members[node.name]; ok {
+            panic(fmt.Sprintf("can't assign to '%s', a member of '%s'", node.name, member.enum))
+        }
+        return Assignment{node.name, folder.fold(node.value)}
+    case Let:
+        if member, ok := folder.members[node.name]; ok {
+            panic(fmt.Sprintf("can't declare '%s', a member of '%s'", node.name, member.enum))
+        }
+        return Let{node.name, folder.fold(node.value)}
+    case Var:
+        if member, ok := folder.members[node.name]; ok {
+            panic(fmt.Sprintf("can't declare '%s', a member of '%s'", node.name, member.enum))
+        }
+        return Var{node.name, folder.fold(node.value)}
+    case ExprStmt:
+        return ExprStmt{folder.fold(node.value)}
+    case Call:
+        return Call{node.name, folder.fold_all(node.args)}
+    case Return:
+        if node.value == nil {
+            return node
+        }
+        return Return{folder.fold(node.value)}
+    case If:
+        return If{folder.fold(node.cond), folder.fold_all(node.then), folder.fold_all(node.otherwise)}
+    case Hint:
+        return Hint{folder.fold(node.cond), node.likely}
+    case Cast:
+        return Cast{folder.fold(node.value), node.to}
+    case Index:
+        return Index{folder.fold(node.value), folder.fold(node.index)}
+    case Slice:
+        return Slice{folder.fold(node.value), folder.fold(node.low), folder.fold(node.high)}
+    case Interp:
+        return Interp{folder.fold_all(node.parts)}
+    case VarArg:
+        return VarArg{folder.fold(node.index)}
+    case Function:
+        for _, param := range node.params {
+            if member, ok := folder.members[param]; ok {
+                panic(fmt.Sprintf("parameter '%s' of '%s' shadows a member of '%s'", param, node.name, member.enum))
+            }
+        }
+        return Function{node.name, node.params, folder.fold_all(node.body), node.variadic}
+    case ExceptionHandler:
+        return ExceptionHandler{folder.fold_all(node.nodes)}
+    case Enum:
+        panic(fmt.Sprintf("enum '%s' has to be declared at the top level", node.name))
+    }
+    return __node
+}
+
+// copies a list of nodes through 'fold'
+func (folder *EnumFolder) fold_all(nodes []interface{}) (ret []interface{}) {
+    for _, node := range nodes {
+        ret = append(ret, folder.fold(node))
+    }
+    return
+}
+
+// replaces the members of every enum with their values, which
+// lets codegen use them as immediates; converts:
+// enum Color { Red, Green = 5, Blue }
+// a = Blue + 1
+// =>
+// a = 6 + 1
+// enums are declared at the top level, and can be used
+// anywhere in the program (including before the declaration)
+func fold_enums(ast interface{}) interface{} {
+    var folder EnumFolder = EnumFolder{map[string]EnumMember{}}
+    program, ok := ast.(Program)
+    if !ok {
+        return folder.fold(ast)
+    }
+    var nodes []interface{}
+    for _, node := range program.nodes {
+        if enum, ok := node.(Enum); ok {
+            folder.declare(enum)
+        }
+    }
+    for _, node := range program.nodes {
+        if _, ok := node.(Enum); !ok {
+            nodes = append(nodes, folder.fold(node))
+        }
+    }
+    return Program{nodes}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+    "testing"
+)
+
+// enum members can be used in declarations like anywhere else,
+// but can't be declared
+func Test_enum_declarations(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Enum{"Color", []string{"red", "green", "blue"}, nil},
+        Var{"i", Ident{"blue"}},
+        Let{"j", ArithmeticOp{Ident{"green"}, "add", Ident{"i"}}},
+        Call{"Printf", []interface{}{String{"%d %d\\n"}, Ident{"i"}, Ident{"j"}}},
+    }}
+    if output := interpret(program); output != "2 3\n" {
+        t.Errorf("printed %q", output)
+    }
+    if _, diagnostics, ok := try_generate(program, default_backend_options()); !ok {
+        t.Errorf("didn't compile: %v", diagnostics)
+    }
+    for _, declaration := range []interface{}{Let{"red", Integer{"1"}}, Var{"red", Integer{"1"}}} {
+        var program Program = Program{[]interface{}{Enum{"Color", []string{"red"}, nil}, declaration}}
+        if _, _, ok := try_generate(program, default_backend_options()); ok {
+            t.Errorf("%s compiled", describe_node(declaration))
+        }
+    }
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+)
+
+// to be formatted by 'fmt.Sprintf'; appended to the
+// output when the program has an exception handler
+var mips_kernel_base string = `
+.kdata
+%s
+.ktext 0x80000180
+%s`
+
+// matches the registers an instruction argument refers to,
+// including base registers (e.g. "-4($sp)") and the numbered
+// ones (e.g. "$12", the temporaries of linux-n32)
+var register_pattern *regexp.Regexp = regexp.MustCompile(`\$([a-z]+[0-9]*|[0-9]+)`)
+
+// the size of the stack exception handlers run on (see
+// 'exception_handler')
+const kernel_stack_size = 1024
+
+// an exception handler; converts:
+// ExceptionHandler{<body>}
+// =>
+// .kdata
+// __k_save: .space 8
+// .ktext 0x80000180
+// .set noat
+// move $k1, $at
+// .set at
+// sw $t0, __k_save+0
+// sw $v0, __k_save+4
+// <code for body>
+// lw $t0, __k_save+0
+// lw $v0, __k_save+4
+// mfc0 $k0, $13
+// andi $k0, $k0, 0x7c
+// beq $k0, $0, kresume1
+// mfc0 $k0, $14
+// addiu $k0, $k0, 4
+// mtc0 $k0, $14
+// kresume1:
+// .set noat
+// move $at, $k1
+// .set at
+// eret
+// such that $t0 and $v0 are the registers the body uses (a body
+// that calls functions saves $ra and every caller-saved register
+// too, since they can clobber them); the saves go through $at, which is why it is kept in $k1 first.
+// after an exception, the handler resumes at the instruction after
+// the one that raised it, and after an interrupt (exception code
+// 0, in bits 2-6 of the cause register) at the one it interrupted,
+// which hasn't run yet. a body that uses the stack (for its
+// variables, or to call functions) runs on a stack of its own in
+// the kernel data:
+// sw $sp, __k_sp
+// la $sp, __k_stack+1024
+// <code for body>
+// lw $sp, __k_sp
+// since the code it interrupted may have values below its $sp;
+// for the same reason, it only sees its own variables (and statics)
+func (backend *MIPSBackend) exception_handler(node *ExceptionHandler) {
+    if backend.in_handler || len(backend.ktext_section) != 0 {
+        panic("a program can only have one exception handler")
+    }
+    // generate the body on its own frame, then wrap it in the scaffolding
+    var (
+        main_section []Instruction       = backend.main_section
+        cold_section []Instruction       = backend.cold_section
+        access_loc   map[string]string   = backend.access_loc
+        name_types   map[string]string   = backend.name_types
+        name_offset  uint                = backend.name_offset
+        ra_slot      string              = backend.ra_slot
+        gp_slot      string              = backend.gp_slot
+        spill_slots  []string            = backend.spill_slots
+        free_slots   []string            = backend.free_slots
+        enclosing    []map[string]string = backend.enclosing
+    )
+    backend.main_section, backend.cold_section, backend.in_handler = []Instruction{}, []Instruction{}, true
+    backend.access_loc, backend.name_types = map[string]string{}, map[string]string{}
+    backend.name_offset, backend.ra_slot, backend.gp_slot = backend.target.word_size, "", ""
+    backend.spill_slots, backend.free_slots, backend.enclosing = []string{}, []string{}, nil
+    for _, item := range node.nodes {
+        backend.statement(item)
+    }
+    var (
+        body []Instruction = backend.main_section
+        cold []Instruction = backend.cold_section
+    )
+    backend.main_section, backend.cold_section, backend.in_handler = []Instruction{}, cold_section, false
+    backend.access_loc, backend.name_types = access_loc, name_types
+    backend.name_offset, backend.ra_slot, backend.gp_slot = name_offset, ra_slot, gp_slot
+    backend.spill_slots, backend.free_slots, backend.enclosing = spill_slots, free_slots, enclosing
+
+    // find every register the body clobbers
+    var (
+        saved []string
+        seen  map[string]bool = map[string]bool{}
+        calls bool
+    )
+    for _, instruction := range append(append([]Instruction{}, body...), cold...) {
+        calls = calls || instruction.opcode == "jal" || instruction.opcode == "jalr"
+        for _, arg := range instruction.args {
+            for _, register := range register_pattern.FindAllString(arg, -1) {
+                if register == "$sp" {
+                    seen[register] = true
+                } else if !seen[register] && !backend.target.reserved_registers[register] {
+                    seen[register] = true
+                    saved = append(saved, register)
+                }
+            }
+        }
+    }
+    if calls {
+        // the functions it calls can clobber any of them
+        var clobbered []string = []string{"$ra"}
+        for register := range backend.target.convention.caller_saved {
+            clobbered = append(clobbered, register)
+        }
+        sort.Strings(clobbered)
+        for _, register := range clobbered {
+            if !seen[register] && !backend.target.reserved_registers[register] {
+                seen[register] = true
+                saved = append(saved, register)
+            }
+        }
+    }
+    if len(saved) != 0 {
+        backend.kdata_section += fmt.Sprintf("    __k_save: .space %d\n", 4*len(saved))
+    }
+    if seen["$sp"] {
+        backend.kdata_section += fmt.Sprintf("    __k_sp: .word 0\n    .align 3\n    __k_stack: .space %d\n", kernel_stack_size)
+    }
+
+    backend.__emit_main(".set", "noat", "", "")
+    backend.__emit_main("move", "$k1", "$at", "")
+    backend.__emit_main(".set", "at", "", "")
+    for i, register := range saved {
+        backend.__emit_main("sw", register, fmt.Sprintf("__k_save+%d", 4*i), "")
+    }
+    if seen["$sp"] {
+        backend.__emit_main("sw", "$sp", "__k_sp", "")
+        backend.__emit_main("la", "$sp", fmt.Sprintf("__k_stack+%d", kernel_stack_size), "")
+    }
+    backend.main_section = append(backend.main_section, body...)
+    if seen["$sp"] {
+        backend.__emit_main("lw", "$sp", "__k_sp", "")
+    }
+    for i, register := range saved {
+        backend.__emit_main("lw", register, fmt.Sprintf("__k_save+%d", 4*i), "")
+    }
+    // skip the faulting instruction, unless it was an interrupt
+    var resume string = backend.__new_label("kresume")
+    backend.__emit_main("mfc0", "$k0", "$13", "")
+    backend.__emit_main("andi", "$k0", "$k0", "0x7c")
+    backend.__emit_main("beq", "$k0", "$0", resume)
+    backend.__emit_main("mfc0", "$k0", "$14", "")
+    backend.__emit_main("addiu", "$k0", "$k0", "4")
+    backend.__emit_main("mtc0", "$k0", "$14", "")
+    backend.__emit_label(resume)
+    backend.__emit_main(".set", "noat", "", "")
+    backend.__emit_main("move", "$at", "$k1", "")
+    backend.__emit_main(".set", "at", "", "")
+    backend.__emit_main("eret", "", "", "")
+    backend.main_section = append(backend.main_section, cold...)
+
+    backend.ktext_section, backend.main_section = backend.main_section, main_section
+}
+
+// exception_cause() => int
+// emits:
+// mfc0 $t0, $13
+// srl $t0, $t0, 2
+// andi $t0, $t0, 31
+// such that $t0 is the first temporary register it could
+// get; the result is the exception code from the cause register
+func (backend *MIPSBackend) exception_cause(node *Call) {
+    if len(node.args) != 0 {
+        panic("'exception_cause' takes no arguments")
+    }
+    if !backend.in_handler {
+        panic("'exception_cause' can only be used in an exception handler")
+    }
+    var temp_register string = backend.__temp_register()
+    backend.stack.push(temp_register)
+    backend.__emit_main("mfc0", temp_register, "$13", "")
+    backend.__emit_main("srl", temp_register, temp_register, "2")
+    backend.__emit_main("andi", temp_register, temp_register, "31")
+}
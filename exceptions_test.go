@@ -0,0 +1,97 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// returns the kernel text of a program with an exception handler
+func handler_code(t *testing.T, body ...interface{}) string {
+    return handler_code_for(t, "mars", body...)
+}
+
+// 'handler_code' for a target
+func handler_code_for(t *testing.T, target string, body ...interface{}) string {
+    var program Program = Program{[]interface{}{
+        Function{"f", []string{"a"}, []interface{}{Return{Ident{"a"}}}, false},
+        Assignment{"x", Integer{"1"}},
+        ExceptionHandler{body},
+    }}
+    var options BackendOptions = default_backend_options()
+    options.target = target
+    backend, diagnostics, ok := try_generate(program, options)
+    if !ok {
+        t.Fatalf("didn't compile: %v", diagnostics)
+    }
+    return render_instructions(backend.ktext_section)
+}
+
+// a handler that uses the stack runs on one of its own, so that
+// it can't clobber the slots of the code it interrupted
+func Test_handler_stack(t *testing.T) {
+    var code string = handler_code(t,
+        Assignment{"code", Call{"exception_cause", nil}},
+        Assignment{"y", Call{"f", []interface{}{Ident{"code"}}}},
+    )
+    if !strings.Contains(code, "la $sp,__k_stack+") || !strings.Contains(code, "lw $sp,__k_sp") {
+        t.Fatalf("the handler doesn't switch stacks:\n%s", code)
+    }
+    var own_stack bool
+    for _, line := range strings.Split(code, "\n") {
+        if strings.Contains(line, "($sp)") && !own_stack {
+            t.Errorf("'%s' uses the interrupted code's stack", strings.TrimSpace(line))
+        }
+        if strings.Contains(line, "la $sp,__k_stack+") || strings.Contains(line, "lw $sp,__k_sp") {
+            own_stack = !own_stack
+        }
+    }
+    for _, register := range []string{"$ra", "$t1", "$a1"} {
+        if !strings.Contains(code, "sw "+register+",__k_save") {
+            t.Errorf("the handler calls a function without saving %s", register)
+        }
+    }
+    if code := handler_code(t, Call{"Printf", []interface{}{String{"x\\n"}}}); strings.Contains(code, "__k_sp") {
+        t.Errorf("a handler that doesn't use the stack switches stacks:\n%s", code)
+    }
+}
+
+// the return address only moves past the instruction that raised an
+// exception; an interrupted instruction hasn't run yet
+func Test_handler_resume(t *testing.T) {
+    var code string = handler_code(t, Call{"Printf", []interface{}{String{"x\\n"}}})
+    var expected string = "mfc0 $k0,$13\n        andi $k0,$k0,0x7c\n        beq $k0,$0,kresume"
+    if !strings.Contains(code, expected) || strings.Index(code, expected) > strings.Index(code, "addiu $k0,$k0,4") {
+        t.Errorf("the handler advances the return address after interrupts:\n%s", code)
+    }
+}
+
+// the handler can't see the variables of the code it interrupts,
+// which are on another stack
+func Test_handler_variables(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Assignment{"x", Integer{"1"}},
+        ExceptionHandler{[]interface{}{Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"x"}}}}},
+    }}
+    if _, _, ok := try_generate(program, default_backend_options()); ok {
+        t.Errorf("a handler read a variable of main")
+    }
+}
+
+// the temporaries of linux-n32 are numbered ($12-$15, $24, $25),
+// and the handler saves them like named ones (it makes no calls,
+// which would save every caller-saved register anyway)
+func Test_handler_numbered_registers(t *testing.T) {
+    var code string = handler_code_for(t, "linux-n32",
+        Assignment{"code", Call{"exception_cause", nil}},
+        Assignment{"square", ArithmeticOp{Ident{"code"}, "mul", Ident{"code"}}},
+    )
+    if !strings.Contains(code, "$12") {
+        t.Fatalf("the handler doesn't use $12:\n%s", code)
+    }
+    if !strings.Contains(code, "sw $12,__k_save") || !strings.Contains(code, "lw $12,__k_save") {
+        t.Errorf("the handler clobbers $12 without saving it:\n%s", code)
+    }
+    if strings.Contains(code, "sw $0,") {
+        t.Errorf("the handler saves $0:\n%s", code)
+    }
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// the directive and the size (in bytes, which is also the
+// alignment) of each floating-point type
+var float_directives = map[string]struct {
+    directive string
+    size      uint
+}{
+    "float":  {".float", 4},
+    "double": {".double", 8},
+}
+
+// returns the type of a floating-point literal
+func float_type(node Float) string {
+    if node.double {
+        return "double"
+    }
+    return "float"
+}
+
+// returns the label of a constant in the read-only data, emitting
+// it (aligned to 'size') the first time; equal constants share the
+// entry. converts:
+// ".double", "2.5", 8
+// =>
+// .align 3
+// double1: .double 2.5
+// the constants are keyed by their directive and text, so the
+// caller has to write equal values the same way
+func (backend *MIPSBackend) __pool_constant(directive string, value string, size uint) string {
+    var key string = directive + " " + value
+    if label, ok := backend.constant_pool[key]; ok {
+        return label
+    }
+    var label string = fmt.Sprintf("%s%d", strings.TrimPrefix(directive, "."), backend.data_temp_name)
+    backend.data_temp_name++
+    var power int
+    for 1<<power < size {
+        power++
+    }
+    backend.__emit_rodata(DataItem{fmt.Sprintf(".align %d", power), ""})
+    backend.__emit_rodata(DataItem{fmt.Sprintf("%s: %s %s", label, directive, value), ""})
+    backend.constant_pool[key] = label
+    return label
+}
+
+// loads a floating-point literal into a register of the
+// floating-point unit from the constant pool; converts:
+// 2.5
+// =>
+// la $t0, float1
+// lwc1 $f12, 0($t0)
+// such that 'register' is $f12 (doubles use 'ldc1' into $f12 and
+// $f13); literals are written in the pool in their shortest form,
+// so "2.5" and "2.50" share one entry (the load of "2.50" gets it
+// as its comment, see 'comment')
+func (backend *MIPSBackend) __load_float(register string, __node interface{}) {
+    node, ok := __node.(Float)
+    if !ok {
+        panic(fmt.Sprintf("expected a floating-point literal, got %s", node_type(__node)))
+    }
+    if backend.in_handler {
+        // it would have to save the registers it uses, and only
+        // saves the integer ones
+        panic("exception handlers can't use the floating-point unit")
+    }
+    var (
+        kind             string = float_type(node)
+        bits             int    = 8 * int(float_directives[kind].size)
+        text             string = strconv.FormatFloat(must_parse_float(node.value, bits), 'g', -1, bits)
+        label            string = backend.__pool_constant(float_directives[kind].directive, text, float_directives[kind].size)
+        address_register string = backend.__temp_register()
+        load             string = map[string]string{"float": "lwc1", "double": "ldc1"}[kind]
+    )
+    backend.__emit_address(address_register, label)
+    backend.__emit_main(load, register, fmt.Sprintf("0(%s)", address_register), "")
+    backend.__free(address_register)
+    if node.value != text {
+        backend.__comment_last(node.value)
+    }
+}
+
+// a floating-point literal anywhere but where it's loaded into
+// the floating-point unit, or cast (see 'cast'); the values of
+// expressions live in the integer registers, so it can't be used
+// there
+func (backend *MIPSBackend) float_literal(node *Float) {
+    panic(fmt.Sprintf("the %s %s can only be printed (with '%%f' in 'Printf') or cast", float_type(*node), node.value))
+}
+
+// parses a floating-point literal that 'validate' accepted
+func must_parse_float(literal string, bits int) float64 {
+    value, err := strconv.ParseFloat(literal, bits)
+    if err != nil {
+        panic(fmt.Sprintf("bad floating-point literal '%s'", literal))
+    }
+    return value
+}
+
+// returns a floating-point number the way MARS prints it (which is
+// Java's 'Float.toString' or 'Double.toString'); converts:
+// 2.5, 100, 1e10, 0.0001
+// =>
+// 2.5, 100.0, 1.0E10, 1.0E-4
+func mars_float_string(value float64, bits int) string {
+    switch {
+    case math.IsNaN(value):
+        return "NaN"
+    case math.IsInf(value, 1):
+        return "Infinity"
+    case math.IsInf(value, -1):
+        return "-Infinity"
+    }
+    if magnitude := math.Abs(value); magnitude == 0 || (magnitude >= 1e-3 && magnitude < 1e7) {
+        var text string = strconv.FormatFloat(value, 'f', -1, bits)
+        if !strings.Contains(text, ".") {
+            text += ".0"
+        }
+        return text
+    }
+    mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(value, 'e', -1, bits), "e")
+    if !strings.Contains(mantissa, ".") {
+        mantissa += ".0"
+    }
+    power, _ := strconv.Atoi(exponent)
+    return fmt.Sprintf("%sE%d", mantissa, power)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "bytes"
+    "flag"
+    "fmt"
+    "os"
+)
+
+// scg fmt [-w] ast.json...
+// prints JSON asts in their canonical form (see 'encode_ast'), or
+// rewrites the files that aren't in it with -w; exits with 1 if
+// any of them couldn't be read
+func format_files(args []string) {
+    var (
+        flags  *flag.FlagSet = flag.NewFlagSet("fmt", flag.ExitOnError)
+        write  *bool         = flags.Bool("w", false, "write the result to the files instead of stdout")
+        failed bool
+    )
+    flags.Parse(args)
+    for _, path := range flags.Args() {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            failed = true
+            continue
+        }
+        ast, err := decode_ast(data)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+            failed = true
+            continue
+        }
+        var formatted []byte = []byte(encode_ast(ast))
+        if !*write {
+            os.Stdout.Write(formatted)
+        } else if !bytes.Equal(data, formatted) {
+            if err := os.WriteFile(path, formatted, 0o644); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                failed = true
+            }
+        }
+    }
+    if failed {
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+    "fmt"
+    "math/bits"
+)
+
+// a function definition; converts:
+// func f(a, b) { body }
+// =>
+// f:
+// <prologue>
+// sw $a0, -4($sp)
+// sw $a1, -8($sp)
+// <code for body>
+// f_end:
+// <epilogue>
+// jr $ra
+// into the function section (which comes after main), such
+// that the parameters get the first slots of the function's
+// own frame; each function keeps its variables below $sp,
+// just like main, and callers move $sp past their own
+// variables before jumping to it (see 'user_call'). the
+// prologue and epilogue save and restore $ra (see
+// '__callee_saves')
+func (backend *MIPSBackend) function(node *Function) {
+    var label string = backend.__function_label(node.name)
+    if _, ok := backend.functions[label]; !ok {
+        // not in a list of statements that was declared up
+        // front (see '__declare_functions')
+        backend.__declare_function(node)
+    }
+    for _, procedure := range backend.procedures {
+        if procedure.label == label {
+            panic(fmt.Sprintf("function '%s' is already defined", node.name))
+        }
+    }
+    if escaping := escaping_functions(node.body); len(escaping) != 0 {
+        panic(fmt.Sprintf("nested function '%s' escapes '%s'; closures can only be called",
+            escaping[0], node.name))
+    }
+
+    // every function gets a fresh frame
+    var (
+        main_section    []Instruction       = backend.main_section
+        access_loc      map[string]string   = backend.access_loc
+        name_types      map[string]string   = backend.name_types
+        name_offset     uint                = backend.name_offset
+        stack           ValueStack          = backend.stack
+        ra_slot         string              = backend.ra_slot
+        gp_slot         string              = backend.gp_slot
+        spill_slots     []string            = backend.spill_slots
+        free_slots      []string            = backend.free_slots
+        cold_section    []Instruction       = backend.cold_section
+        enclosing       []map[string]string = backend.enclosing
+        enclosing_types []map[string]string = backend.enclosing_types
+        current         string              = backend.current_function
+    )
+    if current != "" {
+        // the variables of the enclosing functions stay visible
+        backend.enclosing = append(append([]map[string]string{}, enclosing...), access_loc)
+        backend.enclosing_types = append(append([]map[string]string{}, enclosing_types...), name_types)
+    } else {
+        backend.enclosing, backend.enclosing_types = nil, nil
+    }
+    backend.main_section, backend.stack = []Instruction{}, ValueStack{}
+    backend.access_loc, backend.name_types = map[string]string{}, map[string]string{}
+    backend.name_offset, backend.ra_slot, backend.spill_slots = backend.target.word_size, "", []string{}
+    backend.free_slots = []string{}
+    backend.gp_slot, backend.cold_section = "", []Instruction{}
+    backend.current_function = label
+    if current != "" {
+        // the static link (the enclosing function's $sp) always
+        // gets the first slot
+        backend.__emit_main("sw", "$v1", backend.__reserve_slot(), "")
+    }
+
+    var arg_registers []string = backend.target.convention.arg_registers
+    for i, param := range node.params {
+        backend.name_types[param] = "int"
+        // parameters past the register ones already have a home in
+        // the caller's argument area, and so do all of them when the
+        // function is variadic; that way every argument is
+        // contiguous in memory, which is what 'VarArg' relies on
+        if i >= len(arg_registers) || node.variadic {
+            backend.access_loc[param] = fmt.Sprintf("%d($sp)", backend.__arg_offset(node, i))
+            backend.__record_slot(param)
+            continue
+        }
+        backend.__emit_main("sw", arg_registers[i], backend.__variable_slot(param), "")
+    }
+    if node.variadic {
+        for i, register := range arg_registers {
+            backend.__emit_main("sw", register, fmt.Sprintf("%d($sp)", backend.__arg_offset(node, i)), "")
+        }
+    }
+    backend.__declare_functions(node.body)
+    var last map[string]int = last_uses(node.body)
+    for i, item := range node.body {
+        backend.statement(item)
+        backend.__free_slots(last, i)
+    }
+    var body []Instruction = backend.main_section
+    prologue, epilogue := backend.__callee_saves(body)
+    // 'return' jumps to the epilogue
+    backend.main_section = []Instruction{}
+    backend.__emit_label(label + "_end")
+    backend.main_section = append(backend.main_section, epilogue...)
+    backend.__emit_main("jr", "$ra", "", "")
+    backend.main_section = append(backend.main_section, backend.cold_section...)
+    backend.procedures = append(backend.procedures, Procedure{
+        label, append(backend.__cpload(), prologue...), body, backend.main_section})
+
+    backend.main_section, backend.stack = main_section, stack
+    backend.access_loc, backend.name_types = access_loc, name_types
+    backend.name_offset, backend.ra_slot, backend.spill_slots = name_offset, ra_slot, spill_slots
+    backend.free_slots = free_slots
+    backend.gp_slot, backend.cold_section = gp_slot, cold_section
+    backend.enclosing, backend.enclosing_types = enclosing, enclosing_types
+    backend.current_function = current
+}
+
+// returns the label of a function defined in the current one (or
+// at the top level); functions are labeled with their module, and
+// nested functions with the path to them
+func (backend *MIPSBackend) __function_label(name string) string {
+    if backend.current_function != "" {
+        return backend.current_function + "__" + name
+    }
+    return mangle(backend.options.module, name)
+}
+
+// records a function before its code is generated, panicking if
+// it's already defined or has the same name as a builtin
+func (backend *MIPSBackend) __declare_function(node *Function) {
+    var label string = backend.__function_label(node.name)
+    if _, ok := backend.functions[label]; ok {
+        panic(fmt.Sprintf("function '%s' is already defined", node.name))
+    }
+    if is_builtin(node.name) {
+        panic(fmt.Sprintf("function '%s' has the same name as a builtin", node.name))
+    }
+    backend.functions[label] = *node
+    backend.function_depths[label] = backend.__depth() + 1
+    // recursive calls can come before any 'return' is generated,
+    // so guess the type from the first one
+    backend.function_types[label] = guess_return_type(node)
+}
+
+// declares every function defined in a list of statements before
+// any of them is generated, so that they can be called before (and
+// above) their definitions; converts:
+// a = f(1)
+// func f(x) { return g(x) }
+// func g(x) { return f(x) }
+// =>
+// li $t0, 1
+// move $a0, $t0
+// ...
+// jal f
+// even though f (and g, which f calls) come after the call.
+// variables still have to be assigned before they're used
+// (see 'bind_declarations')
+func (backend *MIPSBackend) __declare_functions(nodes []interface{}) {
+    for _, item := range nodes {
+        if function, ok := item.(Function); ok {
+            backend.__declare_function(&function)
+        }
+    }
+}
+
+// guesses the return type of a function from its first 'return'
+func guess_return_type(function *Function) string {
+    var value interface{} = find_return_value(function.body)
+    if value == nil {
+        return "void"
+    }
+    switch value.(type) {
+    case String:
+        return "string"
+    case StringArray:
+        return "[]string"
+    }
+    return "int"
+}
+
+// returns the value of the first 'return' (with a value) in a
+// list of statements, or nil if there isn't one
+func find_return_value(nodes []interface{}) interface{} {
+    for _, __node := range nodes {
+        switch node := __node.(type) {
+        case Return:
+            if node.value != nil {
+                return node.value
+            }
+        case If:
+            if value := find_return_value(node.then); value != nil {
+                return value
+            }
+            if value := find_return_value(node.otherwise); value != nil {
+                return value
+            }
+        }
+    }
+    return nil
+}
+
+// reserves the slot $ra is saved in; the prologue saves
+// it once, so any call in the procedure can overwrite $ra
+func (backend *MIPSBackend) __save_ra() {
+    if backend.ra_slot == "" {
+        backend.ra_slot = backend.__reserve_slot()
+    }
+}
+
+// returns the code that saves (and restores) the registers the
+// callee has to preserve; converts:
+// <body>
+// =>
+// sw $ra, -8($sp)
+// <body>
+// lw $ra, -8($sp)
+// such that -8 is the slot reserved by '__save_ra' (if the
+// body calls anything). no temporary is callee-saved in either
+// calling convention, so the body never needs $s0-$s8 saved
+func (backend *MIPSBackend) __callee_saves(body []Instruction) (prologue, epilogue []Instruction) {
+    if backend.ra_slot != "" {
+        prologue = append(prologue, Instruction{"sw", []string{"$ra", backend.ra_slot, ""}, ""})
+        epilogue = append(epilogue, Instruction{"lw", []string{"$ra", backend.ra_slot, ""}, ""})
+    }
+    if backend.gp_slot != "" {
+        prologue = append(prologue, Instruction{"sw", []string{"$gp", backend.gp_slot, ""}, ""})
+    }
+    return
+}
+
+// a return statement; converts:
+// return a
+// =>
+// <code for a>
+// move $v0, $t0
+// j f_end
+// such that $t0 is a's register and 'f' is the
+// function being generated
+func (backend *MIPSBackend) return_statement(node *Return) {
+    if backend.current_function == "" {
+        panic("'return' outside of a function")
+    }
+    var return_type string = "void"
+    if node.value != nil {
+        return_type = backend.type_of(node.value)
+        backend.__load_arg(backend.target.convention.return_registers[0], node.value)
+    }
+    var previous string = backend.function_types[backend.current_function]
+    if previous != "void" && previous != return_type {
+        panic(fmt.Sprintf("function '%s' returns both %s and %s",
+            backend.current_function, previous, return_type))
+    }
+    backend.function_types[backend.current_function] = return_type
+    backend.__emit_main("j", backend.current_function+"_end", "", "")
+}
+
+// a call to a user function; converts:
+// a + f(b, c, d, e, g)
+// =>
+// <code for a>
+// <code for b, c, d, e, and g>
+// move $a0, $t1
+// move $a1, $t2
+// move $a2, $t3
+// move $a3, $t4
+// sw $t0, -12($sp)
+// addiu $sp, $sp, -32
+// sw $t5, 16($sp)
+// jal f
+// addiu $sp, $sp, 32
+// lw $t0, -12($sp)
+// move $t6, $v0
+// such that 12 is the number of bytes the caller's variables
+// take up, and 20 is the size of the argument area (the frame is
+// padded when the 'stack_alignment' option asks for it); the argument
+// area has room for every argument (and is at least as big as the
+// calling convention asks for), the first ones are passed in the
+// convention's registers (in O32, $a0-$a3), and the rest are
+// stored in their slots. values that are still on the stack
+// (here $t0) are spilled around the call if they're in
+// caller-saved registers, since the callee (or another activation
+// of the caller, when it is recursive) can overwrite them. calls to nested functions
+// also pass a static link in $v1 (see '__static_link'), and
+// position-independent code calls through the GOT (see '__emit_call')
+func (backend *MIPSBackend) user_call(node *Call, label string, function *Function) {
+    if len(node.args) != len(function.params) &&
+        !(function.variadic && len(node.args) > len(function.params)) {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d",
+            node.name, len(function.params), len(node.args)))
+    }
+    for i := range node.args {
+        backend.__expect_type(node, i, "int")
+    }
+    backend.__call(node.args, label, function, false)
+    if backend.function_types[label] != "void" {
+        backend.__push_result(backend.target.convention.return_registers[0])
+    }
+}
+
+// calls 'label' with the values of 'arg_nodes', as 'user_call' describes;
+// 'layout' decides where the arguments go (see '__arg_offset'), and
+// 'c' is true for C functions (see 'c_call'), which are called
+// through $t9 with $sp aligned as the ABI asks. the result is left
+// in the convention's first return register
+func (backend *MIPSBackend) __call(arg_nodes []interface{}, label string, layout *Function, c bool) {
+    // the slot of each argument that was spilled (see '__spill_arg'),
+    // or "" for the ones left in registers
+    var slots []string = make([]string, len(arg_nodes))
+    for i, arg := range arg_nodes {
+        backend.codegen(arg)
+        if i < len(arg_nodes)-1 && backend.registers.available() < min_temp_registers {
+            slots[i] = backend.__spill_arg()
+        }
+    }
+    var (
+        convention CallingConvention = backend.target.convention
+        in_use     []string          = backend.__pop_n(len(arg_nodes) - count_nonblank(slots))
+        args       []string          = make([]string, len(arg_nodes))
+        alignment  uint              = backend.options.stack_alignment
+        live       []string
+    )
+    for i := range args {
+        if slots[i] == "" {
+            args[i], in_use = in_use[0], in_use[1:]
+        }
+    }
+    if c && convention.stack_alignment > alignment {
+        alignment = convention.stack_alignment
+    }
+    for i := 0; i < len(args) && i < len(convention.arg_registers); i++ {
+        if slots[i] != "" {
+            backend.__emit_main("lw", convention.arg_registers[i], slots[i], "")
+        } else {
+            backend.__emit_main("move", convention.arg_registers[i], args[i], "")
+        }
+    }
+    backend.__save_ra()
+    backend.__save_gp()
+    for _, register := range backend.stack.live() {
+        if convention.caller_saved[register] {
+            live = append(live, register)
+        }
+    }
+    for i, register := range live {
+        backend.__emit_main("sw", register, backend.__spill_slot(i), "")
+    }
+    var argument_area uint = backend.__argument_area(layout, len(args))
+    var frame_size uint = backend.name_offset - backend.target.word_size + argument_area
+    if alignment != 0 {
+        frame_size = (frame_size + alignment - 1) / alignment * alignment
+    }
+    backend.__check_frame_size(frame_size)
+    backend.__emit_main("addiu", "$sp", "$sp", fmt.Sprintf("-%d", frame_size))
+    if backend.function_depths[label] > 1 {
+        backend.__static_link(backend.function_depths[label]-1, frame_size)
+    }
+    for i := len(convention.arg_registers); i < len(args); i++ {
+        var offset string = fmt.Sprintf("%d($sp)", backend.__arg_offset(layout, i))
+        if slots[i] == "" {
+            backend.__emit_main("sw", args[i], offset, "")
+            continue
+        }
+        // the slot is in the caller's frame, which $sp has moved past
+        var register string = backend.__temp_register()
+        backend.__emit_main("lw", register, moved_slot(slots[i], frame_size), "")
+        backend.__emit_main("sw", register, offset, "")
+        backend.__free(register)
+    }
+    backend.__free(filter_out_blank(args)...)
+    if c {
+        backend.__emit_c_call(label)
+    } else {
+        backend.__emit_call(label)
+    }
+    backend.__emit_main("addiu", "$sp", "$sp", fmt.Sprint(frame_size))
+    backend.__restore_gp()
+    for i, register := range live {
+        backend.__emit_main("lw", register, backend.__spill_slot(i), "")
+    }
+}
+
+// stores the argument on top of the stack in a slot of its own
+// and frees its register, so that the arguments after it still
+// have registers to be computed in; calls with more arguments
+// than the target has temporaries would run out of them otherwise.
+// converts:
+// <code for the argument>
+// =>
+// <code for the argument>
+// sw $t0, -12($sp)
+// such that $t0 is its register; returns the slot. the spill
+// slots (see '__spill_slot') are no good for it, since a call in a
+// later argument spills the values around it there
+func (backend *MIPSBackend) __spill_arg() string {
+    var (
+        register string = backend.__pop()
+        slot     string = backend.__reserve_slot()
+    )
+    backend.__emit_main("sw", register, slot, "")
+    backend.__free(register)
+    return slot
+}
+
+// returns a slot of the caller's frame (e.g. "-12($sp)") relative
+// to $sp once it has moved 'frame_size' bytes down for a call
+func moved_slot(slot string, frame_size uint) string {
+    offset, _, _ := split_memory(slot)
+    value, _ := parse_immediate(offset)
+    return fmt.Sprintf("%d($sp)", int64(frame_size)+value)
+}
+
+// returns how many strings aren't ""
+func count_nonblank(array []string) int {
+    return len(filter_out_blank(array))
+}
+
+// returns the offset of the i-th argument of a call to 'function'
+// in the argument area (from $sp at the call); the register
+// arguments only have a slot if the calling convention gives them
+// one (see 'register_homes'), and an int is in the low-order word of
+// its slot, since the callee may read the whole slot
+func (backend *MIPSBackend) __arg_offset(function *Function, i int) uint {
+    var (
+        convention CallingConvention = backend.target.convention
+        slot       uint              = uint(i)
+    )
+    if !convention.register_homes && !function.variadic {
+        slot -= uint(len(convention.arg_registers))
+    }
+    var offset uint = slot * convention.arg_slot_size
+    if backend.byte_order_name() == "EB" {
+        offset += convention.arg_slot_size - backend.target.word_size
+    }
+    return offset
+}
+
+// returns the size of the argument area of a call to 'function'
+// with 'count' arguments; it has a slot for every argument that
+// needs one (and for every argument register, if the function is
+// variadic, since it stores them all), and is at least as big as
+// the calling convention asks
+func (backend *MIPSBackend) __argument_area(function *Function, count int) uint {
+    var (
+        convention CallingConvention = backend.target.convention
+        slots      int               = count
+        area       uint              = convention.min_argument_area
+    )
+    if !convention.register_homes && !function.variadic {
+        slots -= len(convention.arg_registers)
+    }
+    if function.variadic && slots < len(convention.arg_registers) {
+        slots = len(convention.arg_registers)
+    }
+    if slots > 0 && uint(slots)*convention.arg_slot_size > area {
+        area = uint(slots) * convention.arg_slot_size
+    }
+    return area
+}
+
+// returns the i-th slot used for spilling registers around calls,
+// reserving it if needed; the slots are shared by every call in
+// the procedure
+func (backend *MIPSBackend) __spill_slot(i int) string {
+    for len(backend.spill_slots) <= i {
+        backend.spill_slots = append(backend.spill_slots, backend.__reserve_slot())
+    }
+    return backend.spill_slots[i]
+}
+
+// a variadic argument; converts:
+// VarArg(i)
+// =>
+// <code for i>
+// sll $t0, $t0, 2
+// addu $t0, $t0, $sp
+// lw $t0, 8($t0)
+// such that $t0 is i's register, 2 shifts it by the size of an
+// argument's slot (4 bytes in O32), and 8 is the offset of the
+// first variadic argument (here, after two named parameters)
+// in the argument area
+func (backend *MIPSBackend) var_arg(node *VarArg) {
+    if backend.current_function == "" || !backend.functions[backend.current_function].variadic {
+        panic("'VarArg' outside of a variadic function")
+    }
+    if backend.type_of(node.index) != "int" {
+        panic("the index passed to 'VarArg' must be an int")
+    }
+    backend.codegen(node.index)
+    var (
+        function Function = backend.functions[backend.current_function]
+        register string   = backend.__pop_n(1)[0]
+        base     uint     = backend.__arg_offset(&function, len(function.params))
+    )
+    backend.__emit_main("sll", register, register, fmt.Sprint(bits.TrailingZeros(backend.target.convention.arg_slot_size)))
+    backend.__emit_main("addu", register, register, "$sp")
+    backend.__emit_main("lw", register, fmt.Sprintf("%d(%s)", base, register), "")
+    backend.stack.push(register)
+}
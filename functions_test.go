@@ -0,0 +1,147 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// returns a function of ten parameters, p0 to p9, that returns
+// p0*1 + p1*2 + ... + p9*10 (so that every argument has to end up
+// in the right place), and a call of it with 1 to 10
+func ten_arguments() (Function, Call) {
+    var (
+        params []string
+        args   []interface{}
+        body   []interface{} = []interface{}{Assignment{"sum", Integer{"0"}}}
+    )
+    for i := 0; i < 10; i++ {
+        params = append(params, fmt.Sprintf("p%d", i))
+        args = append(args, Integer{fmt.Sprint(i + 1)})
+        body = append(body, Assignment{"sum", ArithmeticOp{Ident{"sum"}, "add",
+            ArithmeticOp{Ident{params[i]}, "mul", Integer{fmt.Sprint(i + 1)}}}})
+    }
+    return Function{"sum", params, append(body, Return{Ident{"sum"}}), false}, Call{"sum", args}
+}
+
+// the arguments past the registers are stored in the caller's
+// argument area, where the callee reads them
+func Test_many_arguments(t *testing.T) {
+    function, call := ten_arguments()
+    var program Program = Program{[]interface{}{function, Call{"Printf", []interface{}{String{"%d\\n"}, call}}}}
+    for _, alignment := range []uint{0, 8, 16} {
+        var options BackendOptions = default_backend_options()
+        options.stack_alignment = alignment
+        if stdout, _, err := run_with_emulator(program, options); err != nil || stdout != "385\n" {
+            t.Errorf("-stack-align %d: printed %q (%v)", alignment, stdout, err)
+        }
+    }
+}
+
+// returns the offsets from $sp that a procedure stores the given
+// registers at (or loads them from, for 'lw'), in order
+func sp_offsets(procedure Procedure, opcode string) (ret []string) {
+    for _, instruction := range procedure.instructions() {
+        if instruction.opcode == opcode && strings.HasSuffix(instruction.args[1], "($sp)") &&
+            !strings.HasPrefix(instruction.args[1], "-") && instruction.args[0] != "$ra" {
+            ret = append(ret, strings.TrimSuffix(instruction.args[1], "($sp)"))
+        }
+    }
+    return
+}
+
+// returns whether 'value' is one of 'array'
+func contains(array []string, value string) bool {
+    for _, element := range array {
+        if element == value {
+            return true
+        }
+    }
+    return false
+}
+
+// where each calling convention puts the arguments that don't fit
+// in registers: O32 has a 4-byte slot for every argument (the
+// first four are homes for the registers), and N32 has an 8-byte
+// slot for each of the rest, with an int in its low-order word
+func Test_argument_layout(t *testing.T) {
+    function, call := ten_arguments()
+    var program Program = Program{[]interface{}{function, Assignment{"x", call}}}
+    var cases = []struct {
+        target     string
+        byte_order string
+        registers  []string
+        offsets    []string
+    }{
+        {"mars", "", []string{"$a0", "$a1", "$a2", "$a3"}, []string{"16", "20", "24", "28", "32", "36"}},
+        {"linux", "", []string{"$a0", "$a1", "$a2", "$a3"}, []string{"16", "20", "24", "28", "32", "36"}},
+        {"linux-n32", "", []string{"$a0", "$a1", "$a2", "$a3", "$8", "$9", "$10", "$11"}, []string{"4", "12"}},
+        {"linux-n32", "EL", []string{"$a0", "$a1", "$a2", "$a3", "$8", "$9", "$10", "$11"}, []string{"0", "8"}},
+    }
+    for _, test := range cases {
+        var options BackendOptions = default_backend_options()
+        options.target, options.byte_order = test.target, test.byte_order
+        backend, diagnostics, ok := try_generate(program, options)
+        if !ok {
+            t.Errorf("%s: %s", test.target, strings.Join(diagnostics, "\n"))
+            continue
+        }
+        var registers []string
+        for _, instruction := range backend.main_procedure.body {
+            if (instruction.opcode == "move" || instruction.opcode == "lw") &&
+                contains(backend.target.convention.arg_registers, instruction.args[0]) {
+                registers = append(registers, instruction.args[0])
+            }
+        }
+        var name string = fmt.Sprintf("%s %s", test.target, test.byte_order)
+        if !reflect.DeepEqual(registers, test.registers) {
+            t.Errorf("%s: the arguments are passed in %v, expected %v", name, registers, test.registers)
+        }
+        if offsets := sp_offsets(backend.main_procedure, "sw"); !reflect.DeepEqual(offsets, test.offsets) {
+            t.Errorf("%s: main stores the arguments at %v, expected %v", name, offsets, test.offsets)
+        }
+        if offsets := sp_offsets(backend.procedures[0], "lw"); !reflect.DeepEqual(offsets, test.offsets) {
+            t.Errorf("%s: 'sum' reads its arguments from %v, expected %v", name, offsets, test.offsets)
+        }
+    }
+}
+
+// N64 would need 64-bit pointers, so it's refused (for now, see
+// 'unsupported_conventions') rather than generated wrong
+func Test_unsupported_abi(t *testing.T) {
+    var options BackendOptions = default_backend_options()
+    options.target, options.calling_convention = "linux", "n64"
+    if recovered, _ := recovered_from(func() { blank_mips_backend(options) }).(string); !strings.Contains(recovered, "n64 calling convention isn't supported") {
+        t.Errorf("-abi n64 panicked with %q", recovered)
+    }
+}
+
+// a frame too large for $sp-relative offsets is reported once for
+// each procedure, rather than for every statement after it filled up
+func Test_frame_too_large(t *testing.T) {
+    // returns statements that keep 9000 words (more than 'max_offset'
+    // bytes) in the frame, with every slot its own
+    var statements = func() (ret []interface{}) {
+        ret = append(ret, Assignment{"v0", Integer{"1"}})
+        for i := 1; i < 9000; i++ {
+            ret = append(ret, Assignment{fmt.Sprintf("v%d", i), ArithmeticOp{Ident{fmt.Sprintf("v%d", i-1)}, "addu", Integer{"1"}}})
+        }
+        return append(ret, Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"v8999"}}})
+    }
+    var program Program = Program{append([]interface{}{
+        Function{"f", nil, statements(), false},
+        ExprStmt{Call{"f", nil}},
+    }, statements()...)}
+    var options BackendOptions = default_backend_options()
+    options.share_slots = false
+    _, diagnostics, ok := try_generate(program, options)
+    var expected []string
+    for _, procedure := range []string{"f", "main"} {
+        expected = append(expected, fmt.Sprintf("Error: the frame of '%s' needs %d bytes, but $sp-relative offsets "+
+            "can only reach %d; split it into smaller functions", procedure, max_offset+1, max_offset))
+    }
+    if ok || !reflect.DeepEqual(diagnostics, expected) {
+        t.Errorf("reported %d diagnostic(s):\n%s", len(diagnostics), strings.Join(diagnostics, "\n"))
+    }
+}
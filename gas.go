@@ -0,0 +1,138 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "regexp"
+    "strconv"
+)
+
+// the cross toolchain used by 'build_with_gas'; programs that
+// call C functions are linked by the compiler driver, which
+// knows where libc and its start-up code are
+const (
+    gas_assembler = "mips-linux-gnu-as"
+    gas_linker    = "mips-linux-gnu-ld"
+    gas_compiler  = "mips-linux-gnu-gcc"
+)
+
+// the entry point of a linux binary; 'main' returns its exit
+// status in $v0 (GAS fills in the delay slots)
+const gas_start string = `
+.globl __start
+__start:
+        jal main
+        move $a0, $v0
+        li $v0, %d
+        syscall
+`
+
+// the entry point of a binary linked with libc is libc's own,
+// which calls main and then 'exit' (flushing stdio's buffers)
+// with what it returns
+const gas_libc_start string = `
+.globl main
+`
+
+// the options GNU as needs for each ABI (see
+// 'CallingConvention.gas_abi'); N32 needs a 64-bit ISA
+var gas_abis = map[string][]string{
+    "32":  {"-march=mips32", "-mabi=32"},
+    "n32": {"-march=mips64", "-mabi=n32"},
+}
+
+// the emulation ld needs for each ABI that isn't its default,
+// by byte order
+var ld_emulations = map[string]map[string]string{
+    "n32": {"EB": "elf32btsmipn32", "EL": "elf32ltsmipn32"},
+}
+
+// matches GAS's messages (e.g. "out.s:12: Error: ...")
+var gas_message *regexp.Regexp = regexp.MustCompile(`^[^:]*:(\d+): (Error|Warning): (.*)$`)
+
+// assembles and links the program into a linux executable at
+// 'output_path' with the GNU cross toolchain, returning the
+// assembler's diagnostics; the program must be generated for
+// a target GNU as supports (e.g. "linux"). an error is returned if the toolchain
+// isn't installed, or if assembling or linking fails
+func (backend *MIPSBackend) build_with_gas(output_path string) ([]Diagnostic, error) {
+    if !backend.target.capabilities["gas"] {
+        return nil, fmt.Errorf("only programs for linux targets can be built with GAS, not '%s'",
+            backend.options.target)
+    }
+    if backend.options.pic {
+        return nil, fmt.Errorf("position-independent code is meant for shared objects, not executables")
+    }
+    if len(backend.ktext_section) != 0 {
+        return nil, fmt.Errorf("exception handlers can't be part of a linux binary")
+    }
+    var linker string = gas_linker
+    if backend.options.libc {
+        linker = gas_compiler
+    }
+    for _, tool := range []string{gas_assembler, linker} {
+        if _, err := exec.LookPath(tool); err != nil {
+            return nil, fmt.Errorf("'%s' isn't installed", tool)
+        }
+    }
+    directory, err := os.MkdirTemp("", "scg")
+    if err != nil {
+        return nil, err
+    }
+    defer os.RemoveAll(directory)
+
+    code, lines := backend.assemble_mapped()
+    if backend.options.libc {
+        code += gas_libc_start
+    } else {
+        code += fmt.Sprintf(gas_start, backend.target.syscalls["exit"])
+    }
+    var (
+        source string = filepath.Join(directory, "out.s")
+        object string = filepath.Join(directory, "out.o")
+    )
+    if err := os.WriteFile(source, []byte(code), 0o644); err != nil {
+        return nil, err
+    }
+    var (
+        endian string   = "-" + backend.byte_order_name()
+        abi    string   = backend.target.convention.gas_abi
+        link   []string = []string{endian, "-o", output_path, object}
+    )
+    if backend.options.libc {
+        // statically, so that qemu doesn't need a sysroot
+        link = append(append(append([]string{}, gas_abis[abi]...), "-static"), link...)
+    } else if emulation, ok := ld_emulations[abi][backend.byte_order_name()]; ok {
+        link = append([]string{"-m", emulation}, link...)
+    }
+    output, err := exec.Command(gas_assembler, append(gas_abis[abi], endian, "-o", object, source)...).CombinedOutput()
+    var diagnostics []Diagnostic = parse_gas_messages(string(output), lines, backend)
+    if err != nil {
+        return diagnostics, fmt.Errorf("'%s' failed: %v", gas_assembler, err)
+    }
+    if output, err := exec.Command(linker, link...).CombinedOutput(); err != nil {
+        return diagnostics, fmt.Errorf("'%s' failed: %v\n%s", linker, err, output)
+    }
+    return diagnostics, nil
+}
+
+// maps every message in GAS's output back to the line of
+// generated code it refers to
+func parse_gas_messages(output string, lines map[int]Instruction, backend *MIPSBackend) (ret []Diagnostic) {
+    for _, line := range regexp.MustCompile(`\r?\n`).Split(output, -1) {
+        var match []string = gas_message.FindStringSubmatch(line)
+        if match == nil {
+            continue
+        }
+        number, _ := strconv.Atoi(match[1])
+        var diagnostic Diagnostic = Diagnostic{number, match[2], match[3], Instruction{}, nil}
+        if instruction, ok := lines[number]; ok {
+            diagnostic.instruction = instruction
+            diagnostic.node = backend.origin(instruction)
+        }
+        ret = append(ret, diagnostic)
+    }
+    return
+}
@@ -1,19 +1,47 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "flag"
     "fmt"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "strconv"
     "strings"
+    "time"
+    "unicode/utf8"
 )
 
-// to be formatterd by 'fmt.Sprintf'
+// to be formatterd by 'fmt.Sprintf' with the data
+// section and the procedures (see 'Procedure')
 var mips_code_base string = `.data
 %s
 .text
-    main:
-%s
-        move $2, $0
-        j $31
-`
+%s`
+
+// the code around the generated program, for users embedding
+// the generator (e.g. to add a boot stub, or to put the text
+// section first)
+type Scaffold struct {
+    // like 'mips_code_base'; explicit argument indexes (e.g.
+    // "%[2]s") let it put the procedures first
+    code string
+    // the start of main's prologue and the end of its epilogue
+    // (the latter returns 0 by default)
+    startup []Instruction
+    exit    []Instruction
+}
+
+// the scaffold used unless the options say otherwise
+func default_scaffold() Scaffold {
+    return Scaffold{
+        mips_code_base,
+        nil,
+        []Instruction{{"move", []string{"$2", "$0", ""}, ""}, {"j", []string{"$31", "", ""}, ""}},
+    }
+}
 
 // filters out all empty strings ("") from a given input
 func filter_out_blank(array []string) (ret []string) {
@@ -53,133 +81,1189 @@ type Assignment struct {
     value interface{}
 }
 
+// an expression used as a statement, for its side effects
+// (e.g. a call); its value is discarded
+type ExprStmt struct {
+    value interface{}
+}
+
 // a basic integer
 type Integer struct {
     value string
 }
 
+// a floating-point literal (e.g. "2.5" or "1e10"), which is a
+// float, or a double when 'double' is set; it lives in the constant
+// pool (see '__load_float')
+type Float struct {
+    value  string
+    double bool
+}
+
 // a basic string
 type String struct {
     value string
 }
 
+// an array of strings, of the form:
+// ["a", "b", "c"]
+// its value is the address of a table of the strings (see
+// 'string_array'), whose type is "[]string"; indexing it gives
+// a string
+type StringArray struct {
+    values []string
+}
+
+// a call of the form:
+// name(a, b, c)
+// builtins (such as 'Printf') are expanded at compile time
+type Call struct {
+    name string
+    args []interface{}
+}
+
+// a function definition of the form:
+// func name(a, b, c) { body }
+// or, when 'variadic' is set:
+// func name(a, b, c, ...) { body }
+// the parameters are ints; the first four are passed in
+// $a0-$a3, and the rest on the stack (see 'user_call')
+type Function struct {
+    name     string
+    params   []string
+    body     []interface{}
+    variadic bool
+}
+
+// the i-th variadic argument (counting from 0) of the
+// function being generated
+type VarArg struct {
+    index interface{}
+}
+
+// a return statement of the form:
+// return value
+// where 'value' is nil for functions that don't return anything
+type Return struct {
+    value interface{}
+}
+
+// a conditional of the form:
+// if cond { then } else { otherwise }
+// where cond is true if it isn't 0; 'otherwise' may be empty
+type If struct {
+    cond      interface{}
+    then      []interface{}
+    otherwise []interface{}
+}
+
+// a condition annotated with whether it is likely to be true;
+// 'if_statement' keeps the code for the likely outcome on the
+// fall-through path
+type Hint struct {
+    cond   interface{}
+    likely bool
+}
+
+// a conversion of the form:
+// to(value)
+// where 'to' is one of the types in 'cast_types'; the value is
+// truncated to the type's width and extended back to a word
+type Cast struct {
+    value interface{}
+    to    string
+}
+
+// a byte of a string, of the form:
+// value[index]
+// the byte is zero-extended (it is a uint8)
+type Index struct {
+    value interface{}
+    index interface{}
+}
+
+// the bytes of a string from 'low' up to 'high', of the form:
+// value[low:high]
+// a new string, copied to the heap (see 'slice')
+type Slice struct {
+    value interface{}
+    low   interface{}
+    high  interface{}
+}
+
+// an interpolated string (see 'parse_interp'); a statement
+// that prints its parts, which are either literal text (a
+// 'String') or expressions whose values are printed
+type Interp struct {
+    parts []interface{}
+}
+
+// a declaration of the form:
+// let name = value
+// 'name' can't be assigned to afterwards (see 'bind_declarations')
+type Let struct {
+    name  string
+    value interface{}
+}
+
+// a declaration of the form:
+// var name = value
+type Var struct {
+    name  string
+    value interface{}
+}
+
+// a static variable of the form:
+// static name kind = value
+// it lives in the data section (rather than in a stack slot), so
+// every function sees the same one; 'kind' is one of the types in
+// 'cast_types', and values assigned to it are truncated to it
+type Static struct {
+    name  string
+    kind  string
+    value string
+}
+
+// the body of the exception handler; there can only
+// be one per program
+type ExceptionHandler struct {
+    nodes []interface{}
+}
+
+// an enumeration of the form:
+// enum name { a, b = 5, c }
+// each member is a named integer constant; members without a
+// value ("", or past the end of 'values') are one more than the
+// member before them (the first one is 0)
+type Enum struct {
+    name    string
+    members []string
+    values  []string
+}
+
+// lines of assembly that go into the output as they are, at a
+// 'placement' (one of 'raw_placements') rather than where the node
+// is; only allowed at the top level (see 'raw')
+type Raw struct {
+    placement string
+    lines     []string
+}
+
+// a section of its own for some of the functions, of the form:
+// section name at address { f, g }
+// where 'address' is "" if the section can go anywhere; "main" is
+// main itself. only allowed at the top level (see 'section')
+type Section struct {
+    name      string
+    address   string
+    functions []string
+}
+
 // an instruction of the form (where (a, b, c) are the arguments):
 // opcode a, b, c
 type Instruction struct {
     opcode string
     args   []string
+    // what a pass wrote about it (see 'comment'), which 'assemble'
+    // writes after it; "" for none
+    comment string
+}
+
+// options that control code generation
+type BackendOptions struct {
+    // the environment the code is generated for; "mars" (the
+    // MARS simulator), "linux" (e.g. running under qemu-mips),
+    // "linux-n32" (the N32 ABI, e.g. under qemu-mipsn32), or "bare"
+    // (no operating system, see 'bare_metal_scaffold')
+    target string
+    // the base address and width (in units) of the MARS bitmap
+    // display; the default base is the heap (0x10040000) so that
+    // pixels don't overwrite the data section
+    bitmap_base  uint32
+    bitmap_width uint32
+    // always call the runtime library for intrinsics instead
+    // of expanding them inline (e.g. to compare code size)
+    library_intrinsics bool
+    // use movn instead of branches for simple conditional
+    // assignments (see 'if_statement')
+    branchless bool
+    // skip the code for unlikely conditions with branch-likely
+    // instructions (e.g. beql) instead of moving it out of line,
+    // on targets that have them (see 'if_statement')
+    branch_likely bool
+    // inline calls to leaf functions whose bodies have at most
+    // this many nodes (see 'inline_functions'); 0 disables inlining
+    inline_threshold int
+    // how many words each pass of the word loops of 'memcpy' and
+    // 'memset' copies, when the size isn't a constant (see
+    // 'memory_op'); 0 is 'default_unroll_factor' at -O2, and 1
+    // (no unrolling) otherwise
+    unroll_factor int
+    // the optimization level; 2 also reorders basic blocks
+    // (see 'layout_blocks')
+    optimize int
+    // the ast is the whole program (no other code calls its
+    // functions), which allows removing the functions main can't
+    // reach (see 'eliminate_dead_code'), and interprocedural
+    // optimizations at -O2 (see 'propagate_constants')
+    whole_program bool
+    // let variables that are no longer used give their stack slots
+    // to new ones (see '__free_slots'); turning it off gives every
+    // variable its own slot, which is easier to debug
+    share_slots bool
+    // the module being compiled, which qualifies the labels of
+    // its functions (see 'mangle'), and the functions it imports
+    // from other modules by name (see 'compile_modules')
+    module  string
+    externs map[string]Extern
+    // where 'assemble_binary' places the program in memory
+    binary_base uint32
+    // generate position-independent code (see 'pic.go')
+    pic bool
+    // the byte order of binary output; "EB" (big-endian), "EL"
+    // (little-endian), or "" for the target's own
+    byte_order string
+    // registers the generated code must leave alone (e.g. for
+    // the user's own assembly); see 'reserve_registers'
+    reserved_registers []string
+    // the code around the program
+    scaffold Scaffold
+    // count how often each basic block runs, and print the
+    // counts (with estimated cycles) when main returns
+    profile bool
+    // count how often each basic block runs, and print which
+    // ones never did when main returns
+    coverage bool
+    // called with every instruction (including labels) as it is
+    // emitted; 'before_emit' can change it before it is added to
+    // the code, and 'after_emit' gets the copy that was added
+    before_emit []func(instruction *Instruction)
+    after_emit  []func(instruction *Instruction)
+    // the severity of each warning that doesn't have its default
+    // one (see 'warning_severities'), and whether every warning is
+    // an error
+    warnings           map[string]string
+    warnings_as_errors bool
+    // stop after this many errors (0 for no limit)
+    max_errors int
+    // logs every node visited, register allocated, and instruction
+    // emitted (see '__trace'); nil doesn't log anything
+    logger *slog.Logger
+    // where the time each phase takes is added up (see
+    // 'TimeReport'); nil doesn't time anything
+    time_report *TimeReport
+    // stops compilation (with a 'Cancelled') once it's done, e.g.
+    // when a request to 'serve' times out
+    context context.Context
+    // keep track of the statement each instruction is generated for
+    // (see 'assemble_debug')
+    debug_info bool
+    // panic when a statement leaves the expression stack or the
+    // registers inconsistent (see '__check_discipline'), to catch
+    // bugs in the generator
+    check_discipline bool
+    // the calling convention (see 'calling_conventions'), or ""
+    // for the target's own
+    calling_convention string
+    // pad the frames of calls so that $sp is a multiple of this
+    // many bytes in the callee, as the ABI asks when linking with
+    // libc (8 for O32, 16 for N32, see 'stack_alignment'); 0 leaves
+    // frames as small as they can be. main's own $sp is assumed to
+    // be aligned already
+    stack_alignment uint
+    // let the program call C library functions (see 'c_call'), and
+    // link it with libc, whose start-up code calls main
+    libc bool
+    // where $sp starts on targets without an operating system
+    // (see 'bare_metal_scaffold'); the stack grows down from it
+    stack_top uint32
+    // the template of the labels of string literals (e.g.
+    // "str_<func>_<n>", see '__string_label'); "" is "string<n>"
+    string_labels string
+}
+
+// the options used by 'new_mips_backend'
+func default_backend_options() BackendOptions {
+    return BackendOptions{
+        "mars",
+        0x10040000,
+        64,
+        false,
+        false,
+        false,
+        0,
+        0,
+        0,
+        false,
+        true,
+        "",
+        map[string]Extern{},
+        0x00400000,
+        false,
+        "",
+        []string{},
+        default_scaffold(),
+        false,
+        false,
+        nil,
+        nil,
+        map[string]string{},
+        false,
+        20,
+        nil,
+        nil,
+        context.Background(),
+        false,
+        check_discipline_by_default,
+        "",
+        0,
+        false,
+        0x7ffffff0,
+        "",
+    }
 }
 
 // the code generator
 type MIPSBackend struct {
-    temp_registers [10]string
+    options        BackendOptions
+    target         TargetConfig
     access_loc     map[string]string
+    name_types     map[string]string
     name_offset    uint
-    temp_reg_id    uint
+    registers      RegisterFile
     data_temp_name uint
-    stack          []string
+    stack          ValueStack
     data_section   string
+    // the zero-initialized data, which takes no room in the output
+    // (see '__emit_bss'), and the data nothing writes to (see
+    // 'read_only_literal')
+    bss_section    string
+    rodata_section string
     main_section   []Instruction
+    kdata_section  string
+    ktext_section  []Instruction
+    in_handler     bool
+    label_id       uint
+    runtime_used   map[string]bool
+    // the C functions the program calls (see 'c_call')
+    c_used map[string]bool
+    // the labels of the read-only constants, by their directive
+    // and value (see '__pool_constant')
+    constant_pool map[string]string
+    // the procedure each entry of the data sections belongs to, by
+    // label (see '__data_owner')
+    data_owners map[string]string
+    // how many strings each procedure has labeled (see
+    // '__string_label')
+    string_counts map[string]int
+    // the lines of the 'Raw' nodes, by placement
+    raw_lines map[string][]string
+    // the sections declared by 'Section' nodes, in order, and
+    // the section of each procedure they place, by label
+    sections           []Section
+    procedure_sections map[string]string
+    ra_slot            string
+    gp_slot            string
+    spill_slots        []string
+    // slots '__variable_slot' can give out again (see '__free_slots')
+    free_slots     []string
+    functions      map[string]Function
+    function_types map[string]string
+    statics        map[string]Static
+    main_procedure Procedure
+    procedures     []Procedure
+    // code moved out of line (see 'if_statement'), which goes
+    // after the epilogue of the procedure being generated
+    cold_section     []Instruction
+    current_function string
+    function_depths  map[string]int
+    enclosing        []map[string]string
+    enclosing_types  []map[string]string
+    // the node each emitted instruction came from, keyed by its
+    // first operand (which every instruction has its own copy of,
+    // and which stays put when instructions move between sections)
+    origins      map[*string]interface{}
+    current_node interface{}
+    // the branches taken on the likely paths through the code before
+    // 'layout_procedures' reordered it (see 'taken_branches')
+    taken_before_layout int
+    // every slot a variable got, in the order they were given out
+    // (a slot can be shared, see '__free_slots')
+    stack_slots []StackSlot
+    // the procedures whose frames '__check_frame_size' found too
+    // large, which it reports once each
+    oversized_frames map[string]bool
+    // the line info for '-g', if the options ask for it
+    debug DebugInfo
+    // what the checks found (see 'lower')
+    diagnostics Diagnostics
+}
+
+// adds the flags that set code generation options (e.g. -O2) to a
+// flag set, for 'main' and 'diff_options'
+func backend_flags(flags *flag.FlagSet, options *BackendOptions) {
+    flags.StringVar(&options.target, "target", options.target, "the target to generate code for")
+    flags.StringVar(&options.calling_convention, "abi", "", "the calling convention (e.g. o32); the target's own by default")
+    flags.UintVar(&options.stack_alignment, "stack-align", 0, "align $sp at calls to this many bytes (8 or 16)")
+    flags.BoolVar(&options.libc, "libc", false, "let the program call C library functions (e.g. printf), and link it with libc")
+    flags.Func("stack-top", "where $sp starts on the bare target (default 0x7ffffff0)", func(value string) error {
+        top, err := strconv.ParseUint(value, 0, 32)
+        options.stack_top = uint32(top)
+        return err
+    })
+    flags.Func("base", "where -format bin places the program in memory (default 0x00400000)", func(value string) error {
+        base, err := strconv.ParseUint(value, 0, 32)
+        options.binary_base = uint32(base)
+        return err
+    })
+    flags.BoolVar(&options.pic, "fpic", false, "generate position-independent code (see 'pic.go'), on targets that support it")
+    flags.Func("freserve", "registers the generated code must leave alone, separated by commas (e.g. -freserve=$t8,$t9)", func(value string) error {
+        for _, register := range strings.Split(value, ",") {
+            options.reserved_registers = append(options.reserved_registers, strings.TrimSpace(register))
+        }
+        return nil
+    })
+    flags.StringVar(&options.byte_order, "byte-order", "", "the byte order of binary output and of the assembler (EB or EL); the target's own by default")
+    flags.StringVar(&options.string_labels, "string-labels", "", "the template of string labels, with <n> and optionally <func> (e.g. str_<func>_<n>)")
+    flags.BoolVar(&options.profile, "profile", false, "make the program print a basic block profile")
+    flags.BoolVar(&options.coverage, "coverage", false, "make the program print which basic blocks ran")
+    flags.BoolFunc("O2", "optimize, reordering basic blocks", func(string) error {
+        options.optimize = 2
+        return nil
+    })
+    flags.BoolFunc("no-slot-sharing", "give every variable its own stack slot", func(string) error {
+        options.share_slots = false
+        return nil
+    })
+    flags.BoolVar(&options.branch_likely, "fbranch-likely", false, "skip unlikely code with branch-likely instructions, on targets that have them")
+    flags.IntVar(&options.inline_threshold, "finline-threshold", 0, "inline calls to leaf functions of at most this many nodes (0 disables inlining)")
+    flags.Func("funroll-loops", fmt.Sprintf("unroll the word loops of memcpy and memset this many times, up to %d (default %d at -O2, 1 otherwise)", max_unroll_factor, default_unroll_factor), func(value string) error {
+        factor, err := strconv.Atoi(value)
+        if err == nil && (factor < 1 || factor > max_unroll_factor) {
+            err = fmt.Errorf("the factor must be between 1 and %d", max_unroll_factor)
+        }
+        options.unroll_factor = factor
+        return err
+    })
+    flags.BoolVar(&options.branchless, "fbranchless", false, "use movn instead of branches for simple conditional assignments")
+    flags.BoolVar(&options.whole_program, "whole-program", false, "assume nothing else calls the program's functions")
+    flags.BoolVar(&options.check_discipline, "check-discipline", false, "check that every statement frees its registers (to catch generator bugs)")
+    flags.BoolVar(&options.warnings_as_errors, "Werror", false, "report every warning as an error")
+    flags.IntVar(&options.max_errors, "fmax-errors", options.max_errors, "stop after this many errors (0 for no limit)")
+    flags.Func("W", "set the severity of a warning (e.g. -W unused-variable=error)", func(option string) error {
+        return parse_severity(option, options.warnings)
+    })
 }
 
 // 'MIPSBackend' constructor
 func new_mips_backend(ast interface{}) MIPSBackend {
+    return new_mips_backend_with(ast, default_backend_options())
+}
+
+// 'MIPSBackend' constructor taking explicit options
+func new_mips_backend_with(ast interface{}, options BackendOptions) MIPSBackend {
+    var backend MIPSBackend = blank_mips_backend(options)
+    backend.generate(ast)
+    return backend
+}
+
+// generates a whole program into a blank backend; when it panics,
+// the backend still has the diagnostics found until then
+func (backend *MIPSBackend) generate(ast interface{}) {
+    var report *TimeReport = backend.options.time_report
+    report.time("analysis", func() {
+        ast = lower(ast, &backend.diagnostics)
+    })
+    if backend.options.optimize >= 2 && backend.options.whole_program {
+        check_cancelled(backend.options.context)
+        report.time("constant propagation", func() {
+            ast = propagate_constants(ast)
+        })
+    }
+    if backend.options.inline_threshold > 0 {
+        check_cancelled(backend.options.context)
+        report.time("inlining", func() {
+            ast = inline_functions(ast, backend.options.inline_threshold)
+        })
+    }
+    // generate the code
+    check_cancelled(backend.options.context)
+    report.time("codegen", func() {
+        backend.codegen(ast)
+    })
+    backend.__finish_main()
+}
+
+// the passes every program goes through before it is generated
+// (or interpreted); enums and declarations become integers and
+// assignments, which is all codegen knows about. panics with
+// every error the checks found, after all of them ran (the
+// other passes only run on asts that are valid, see 'validate')
+func lower(ast interface{}, diagnostics *Diagnostics) interface{} {
+    for _, violation := range validate(ast) {
+        diagnostics.error(nil, "%s", violation)
+    }
+    diagnostics.check()
+    ast = bind_declarations(fold_enums(ast), diagnostics)
+    diagnostics.check()
+    return ast
+}
+
+// returns a backend that hasn't generated anything yet; code can
+// be generated into it piece by piece (see 'link_modules'), as long
+// as '__finish_main' is called at the end
+func blank_mips_backend(options BackendOptions) MIPSBackend {
+    target, ok := targets[options.target]
+    if !ok {
+        panic(fmt.Sprintf("unknown target '%s'", options.target))
+    }
+    if _, ok := byte_orders[options.byte_order]; !ok && options.byte_order != "" {
+        panic(fmt.Sprintf("unknown byte order '%s'", options.byte_order))
+    }
+    if options.pic && !target.capabilities["pic"] {
+        panic(fmt.Sprintf("target '%s' doesn't support position-independent code", options.target))
+    }
+    if options.libc && !target.capabilities["libc"] {
+        panic(fmt.Sprintf("target '%s' can't be linked with libc", options.target))
+    }
+    if target.capabilities["bare_metal"] {
+        options.scaffold = bare_metal_scaffold(options.scaffold, options.stack_top)
+    }
+    if options.string_labels != "" {
+        check_label_template(options.string_labels)
+    }
+    if options.calling_convention != "" {
+        convention, ok := calling_conventions[options.calling_convention]
+        if reason, unsupported := unsupported_conventions[options.calling_convention]; unsupported {
+            panic(fmt.Sprintf("the %s calling convention isn't supported: %s", options.calling_convention, reason))
+        }
+        if !ok {
+            panic(fmt.Sprintf("unknown calling convention '%s'", options.calling_convention))
+        }
+        target.convention = convention
+    }
+    for _, register := range target.convention.arg_registers {
+        for _, temp := range target.temp_registers {
+            if register_number(register) == register_number(temp) {
+                panic(fmt.Sprintf("target '%s' keeps temporaries in '%s', which the calling convention passes arguments in",
+                    options.target, temp))
+            }
+        }
+    }
+    for _, temp := range target.temp_registers {
+        if target.convention.callee_saved[temp] {
+            // functions would have to save it (see '__callee_saves')
+            panic(fmt.Sprintf("target '%s' keeps temporaries in '%s', which the calling convention has functions preserve",
+                options.target, temp))
+        }
+    }
+    if options.stack_alignment != 0 && options.stack_alignment != 8 && options.stack_alignment != 16 {
+        panic(fmt.Sprintf("the stack can only be aligned to 8 or 16 bytes, not %d", options.stack_alignment))
+    }
+    target = reserve_registers(target, options)
+    if marked := fmt.Sprintf(options.scaffold.code, "\x00", "\x01"); strings.Count(marked, "\x00") != 1 ||
+        strings.Count(marked, "\x01") != 1 || strings.Contains(marked, "%!") {
+        panic("the scaffold's code must include the data section and the procedures once each")
+    }
     var backend MIPSBackend = MIPSBackend{
-        [10]string{
-            "$t9", "$t8", "$t7", "$t6", "$t5",
-            "$t4", "$t3", "$t2", "$t1", "$t0",
-        },
+        options,
+        target,
         map[string]string{},
-        4,
-        0,
+        map[string]string{},
+        target.word_size,
+        new_register_file(target.temp_registers),
         1,
-        []string{},
+        ValueStack{},
+        "",
+        "",
         "",
         []Instruction{},
+        "",
+        []Instruction{},
+        false,
+        0,
+        map[string]bool{},
+        map[string]bool{},
+        map[string]string{},
+        map[string]string{},
+        map[string]int{},
+        map[string][]string{},
+        []Section{},
+        map[string]string{},
+        "",
+        "",
+        []string{},
+        []string{},
+        map[string]Function{},
+        map[string]string{},
+        map[string]Static{},
+        Procedure{},
+        []Procedure{},
+        []Instruction{},
+        "",
+        map[string]int{},
+        nil,
+        nil,
+        map[*string]interface{}{},
+        nil,
+        0,
+        []StackSlot{},
+        map[string]bool{},
+        DebugInfo{nil, 0, 0, map[*string]int{}},
+        new_diagnostics(options),
+    }
+    for _, extern := range options.externs {
+        backend.functions[extern.label] = extern.function
+        backend.function_depths[extern.label] = 1
+        backend.function_types[extern.label] = guess_return_type(&extern.function)
     }
-    // generate the code
-    backend.codegen(ast)
     return backend
 }
 
+// main is a procedure too, and has to preserve $ra; by default
+// it returns 0 to whatever called it (e.g. MARS, or the linux
+// start-up code), and the scaffold can add code to either end
+func (backend *MIPSBackend) __finish_main() {
+    // nothing is finished if codegen found errors
+    backend.diagnostics.check()
+    prologue, epilogue := backend.__callee_saves(backend.main_section)
+    prologue = append(backend.__cpload(), prologue...)
+    if backend.target.reserve_at {
+        // makes the assembler reject any pseudo-instruction that
+        // would need $at (the generated code never uses it)
+        prologue = append([]Instruction{{".set", []string{"noat", "", ""}, ""}}, prologue...)
+    }
+    prologue = append(append([]Instruction{}, backend.options.scaffold.startup...), prologue...)
+    epilogue = append(epilogue, backend.options.scaffold.exit...)
+    epilogue = append(epilogue, backend.cold_section...)
+    backend.main_procedure = Procedure{"main", prologue, backend.main_section, epilogue}
+    if backend.options.profile || backend.options.coverage {
+        var blocks []BasicBlock = backend.instrument_blocks()
+        backend.__add_report(func() {
+            var print_literal func(string) = backend.__literal_printer()
+            if backend.options.profile {
+                backend.profile_report(blocks, print_literal)
+            }
+            if backend.options.coverage {
+                backend.coverage_report(blocks, print_literal)
+            }
+        })
+    }
+    if backend.options.whole_program {
+        backend.options.time_report.time("dead code elimination", backend.eliminate_dead_code)
+    }
+    backend.group_data()
+    if backend.options.optimize >= 2 {
+        backend.options.time_report.time("block layout", backend.layout_procedures)
+    }
+}
+
 // emit an instruction
 func (backend *MIPSBackend) __emit_main(params ...string) {
     if len(params) > 4 {
         panic("too many arguments supplied to '__emit_main'")
     }
-    backend.main_section = append(backend.main_section, Instruction{params[0],
-        []string{params[1], params[2], params[3]}})
+    var instruction Instruction = Instruction{params[0], []string{params[1], params[2], params[3]}, ""}
+    backend.__emit_instruction(&instruction)
+}
+
+// adds an instruction to the code, running the emission hooks
+func (backend *MIPSBackend) __emit_instruction(instruction *Instruction) {
+    check_operands(*instruction)
+    for _, hook := range backend.options.before_emit {
+        hook(instruction)
+    }
+    backend.main_section = append(backend.main_section, *instruction)
+    var added *Instruction = &backend.main_section[len(backend.main_section)-1]
+    if len(added.args) != 0 {
+        backend.origins[&added.args[0]] = backend.current_node
+        if backend.options.debug_info {
+            backend.debug.lines[&added.args[0]] = backend.debug.line
+        }
+    }
+    backend.__trace("emit", "instruction", render_instruction(*added))
+    for _, hook := range backend.options.after_emit {
+        hook(added)
+    }
+}
+
+// returns the node an instruction was generated for (the
+// innermost one), or nil if it wasn't emitted by '__emit_main'
+func (backend *MIPSBackend) origin(instruction Instruction) interface{} {
+    if len(instruction.args) == 0 {
+        return nil
+    }
+    return backend.origins[&instruction.args[0]]
+}
+
+// emit a label
+func (backend *MIPSBackend) __emit_label(label string) {
+    backend.__emit_instruction(&Instruction{label + ":", []string{}, ""})
+}
+
+// create a new unique label
+func (backend *MIPSBackend) __new_label(prefix string) string {
+    backend.label_id++
+    return fmt.Sprintf("%s%d", prefix, backend.label_id)
 }
 
 // emit to the data section
-func (backend *MIPSBackend) __emit_data(data string) {
-    backend.data_section += fmt.Sprintf("    %s\n", data)
+func (backend *MIPSBackend) __emit_data(item DataItem) {
+    backend.__own_data(item.text)
+    backend.data_section += fmt.Sprintf("    %s\n", item.render())
+}
+
+// reserves 'size' bytes of zeros at a label; emits:
+// __static_a: .space 4
+// in the bss, such that a is a static without a value. every entry
+// takes a whole number of words, so that they all stay aligned
+func (backend *MIPSBackend) __emit_bss(label string, size uint) {
+    var word uint = backend.target.word_size
+    backend.__own_data(label + ":")
+    backend.bss_section += fmt.Sprintf("    %s: .space %d\n", label, (size+word-1)/word*word)
 }
 
-// create a new temporary register
-// NOTE: this doesn't to see if we have used up
-// all the temporary registers
-// TODO: implement the register allocation algorithm
+// emit to the read-only data section
+func (backend *MIPSBackend) __emit_rodata(item DataItem) {
+    backend.__own_data(item.text)
+    backend.rodata_section += fmt.Sprintf("    %s\n", item.render())
+}
+
+// returns what goes in the data section's place in the code: the
+// raw lines placed at its top (see 'raw') and the data section,
+// followed by the read-only data and the bss, which
+// are sections of their own on targets whose assemblers have them
+// (see the "rdata" and "bss" capabilities), and are merged into the
+// data section's groups otherwise, so each owner has one header
+// (see '__merge_groups'); converts:
+// string1: .asciiz "abc"
+// __static_a: .space 4
+// =>
+// .rdata
+// string1: .asciiz "abc"
+// .bss
+// .align 2
+// __static_a: .space 4
+func (backend *MIPSBackend) __data_sections() string {
+    var (
+        sections []string = []string{backend.data_section}
+        prefixes []string = []string{""}
+        own      string
+    )
+    if backend.rodata_section != "" {
+        if backend.target.capabilities["rdata"] {
+            own += ".rdata\n" + backend.rodata_section
+        } else {
+            sections = append(sections, backend.rodata_section)
+            prefixes = append(prefixes, "")
+        }
+    }
+    if backend.bss_section != "" {
+        if backend.target.capabilities["bss"] {
+            own += ".bss\n    .align 2\n" + backend.bss_section
+        } else {
+            sections = append(sections, backend.bss_section)
+            prefixes = append(prefixes, "    .align 2\n")
+        }
+    }
+    return backend.__raw_text("data") + backend.__merge_groups(sections, prefixes) + own
+}
+
+// create a new temporary register; it stays in use until
+// its value is used (see '__free'). if every one is in use,
+// a value on the stack gives up its own (see '__spill')
 func (backend *MIPSBackend) __temp_register() string {
-    backend.temp_reg_id++
-    return fmt.Sprintf("$t%d", backend.temp_reg_id-1)
+    if backend.registers.available() == 0 {
+        // 'allocate' panics if nothing could be spilled
+        backend.__spill()
+    }
+    var register string = backend.registers.allocate()
+    backend.__trace("allocate", "register", register)
+    return register
+}
+
+// the largest offset a load or store (or 'addiu') can take;
+// immediates are signed 16-bit values
+const max_offset = 0x7fff
+
+// reports an error if a frame has grown past what the 16-bit
+// offsets of 'lw' and 'sw' (relative to $sp) can reach; only the
+// first time for each procedure, and without stopping the
+// statement, since every statement after it would fail too
+func (backend *MIPSBackend) __check_frame_size(size uint) {
+    var procedure string = "main"
+    if backend.current_function != "" {
+        procedure = backend.current_function
+    }
+    if size <= max_offset || backend.oversized_frames[procedure] {
+        return
+    }
+    backend.oversized_frames[procedure] = true
+    backend.diagnostics.error(backend.current_node, "the frame of '%s' needs %d bytes, but $sp-relative offsets "+
+        "can only reach %d; split it into smaller functions", procedure, size, max_offset)
+}
+
+// returns the next free stack slot (below the ones
+// already in use), reserving it
+func (backend *MIPSBackend) __reserve_slot() string {
+    // -32768 would fit, but the frame has to be adjusted
+    // by the positive size around calls too
+    backend.__check_frame_size(backend.name_offset)
+    var slot string = fmt.Sprintf("-%d($sp)", backend.name_offset)
+    backend.name_offset += backend.target.word_size
+    return slot
+}
+
+// renders a list of instructions, one per line, followed by their
+// comments (see 'comment')
+func render_instructions(instructions []Instruction) string {
+    // a builder, since large programs have millions of lines
+    var ret strings.Builder
+    for _, instruction := range instructions {
+        if strings.HasSuffix(instruction.opcode, ":") {
+            // labels line up with 'main:'
+            fmt.Fprintf(&ret, "    %s\n", instruction.opcode)
+            continue
+        }
+        var line string = render_instruction(instruction)
+        if instruction.comment != "" {
+            line = with_comment(line, instruction.comment)
+        }
+        fmt.Fprintf(&ret, "        %s\n", line)
+    }
+    return ret.String()
+}
+
+// renders a single instruction (without indentation)
+func render_instruction(instruction Instruction) string {
+    var args string = strings.Join(filter_out_blank(instruction.args), ",")
+    if args == "" {
+        // instructions without operands (e.g. syscall)
+        return instruction.opcode
+    }
+    return fmt.Sprintf("%s %s", instruction.opcode, args)
 }
 
 // returns the final mips code
 func (backend *MIPSBackend) assemble() string {
-    var main_section string
-    for _, instruction := range backend.main_section {
-        var args string = strings.Join(filter_out_blank(instruction.args), ",")
-        main_section += fmt.Sprintf("        %s %s\n", instruction.opcode, args)
+    code, _ := backend.assemble_mapped()
+    return code
+}
+
+// returns the final mips code, along with the instruction on
+// each line of it (by line number, starting at 1)
+func (backend *MIPSBackend) assemble_mapped() (string, map[int]Instruction) {
+    var lines map[int]Instruction = map[int]Instruction{}
+    // records the lines 'instructions' will take up once they
+    // are rendered at the end of 'code'
+    var record = func(code string, instructions []Instruction) {
+        var first int = strings.Count(code, "\n") + 1
+        for i, instruction := range instructions {
+            lines[first+i] = instruction
+        }
     }
-    return fmt.Sprintf(mips_code_base, backend.data_section, main_section)
+    var prefix string
+    if backend.options.pic {
+        prefix = pic_header
+    }
+    prefix += backend.__c_externs()
+    var (
+        template string = backend.options.scaffold.code
+        // everything before the procedures
+        marked  string = prefix + fmt.Sprintf(template, backend.__data_sections(), "\x00")
+        header  string = marked[:strings.Index(marked, "\x00")]
+        text    string = backend.__raw_text("main")
+        section string
+    )
+    for _, procedure := range backend.text_procedures(true) {
+        if next := backend.procedure_sections[procedure.label]; next != section {
+            text += backend.__switch_section(section, next)
+            section = next
+        }
+        var instructions []Instruction = procedure.instructions()
+        record(header+text, instructions)
+        text += render_instructions(instructions)
+    }
+    if section == "" {
+        text += backend.__raw_text("end")
+    }
+    var code string = prefix + fmt.Sprintf(template, backend.__data_sections(), text)
+    if len(backend.ktext_section) != 0 {
+        var header string = mips_kernel_base[:strings.LastIndex(mips_kernel_base, "%s")]
+        record(code+fmt.Sprintf(header, backend.kdata_section), backend.ktext_section)
+        code += fmt.Sprintf(mips_kernel_base,
+            backend.kdata_section, render_instructions(backend.ktext_section))
+    }
+    return code, lines
 }
 
 // a recursive function that generates code
 // for a given ast
 func (backend *MIPSBackend) codegen(__node interface{}) {
+    var parent interface{} = backend.current_node
+    backend.current_node = __node
+    backend.__trace("visit", "node", describe_node(__node))
+    check_cancelled(backend.options.context)
+    defer func() {
+        backend.__trace("leave", "node", describe_node(__node), "stack", append([]string{}, backend.stack.registers...))
+        backend.current_node = parent
+    }()
     switch node := __node.(type) {
     case Program:
+        // top-level functions can't see main's variables
+        var statements []interface{}
+        for _, item := range node.nodes {
+            if _, ok := item.(Function); ok {
+                item = nil
+            }
+            statements = append(statements, item)
+        }
+        var last map[string]int = last_uses(statements)
+        // statics can be used before (and above) their declaration,
+        // and so can functions
         for _, item := range node.nodes {
-            backend.codegen(item)
+            if static, ok := item.(Static); ok {
+                backend.static_variable(&static)
+            }
+        }
+        backend.__declare_functions(node.nodes)
+        for i, item := range node.nodes {
+            backend.statement(item)
+            backend.__free_slots(last, i)
         }
     case ArithmeticOp:
         backend.arithmetic_op(&node)
     case Assignment:
         backend.assignment(&node)
+    case ExprStmt:
+        backend.expr_stmt(&node)
     case Ident:
         backend.ident(&node)
     case Integer:
         backend._integer(&node)
     case String:
-        backend._string(&node)
+        backend._string(&node, parent)
+    case StringArray:
+        backend.string_array(&node)
+    case Float:
+        backend.float_literal(&node)
+    case Call:
+        backend.call(&node)
+    case If:
+        backend.if_statement(&node)
+    case Hint:
+        backend.codegen(node.cond)
+    case Cast:
+        backend.cast(&node)
+    case Index:
+        backend.index(&node)
+    case Slice:
+        backend.slice(&node)
+    case Interp:
+        backend.interp(&node)
+    case Static:
+        if _, ok := backend.statics[node.name]; !ok {
+            panic(fmt.Sprintf("static '%s' has to be declared at the top level", node.name))
+        }
+    case Function:
+        backend.function(&node)
+    case Return:
+        backend.return_statement(&node)
+    case VarArg:
+        backend.var_arg(&node)
+    case ExceptionHandler:
+        backend.exception_handler(&node)
+    case Raw:
+        backend.raw_node(&node, parent)
+    case Section:
+        backend.section(&node, parent)
     }
 }
 
+// the immediate form of each operation that has one
+var immediate_ops = map[string]string{
+    "add": "addi", "addu": "addiu", "slt": "slti", "sltu": "sltiu",
+    "and": "andi", "or": "ori", "xor": "xori",
+    "sllv": "sll", "srlv": "srl", "srav": "sra",
+}
+
+// operations whose operands can be swapped
+var commutative_ops = map[string]bool{
+    "add": true, "addu": true, "mul": true, "and": true, "or": true, "xor": true,
+}
+
+// returns the immediate form of an operation whose right operand is
+// an integer that fits in its immediate field, along with the
+// immediate (e.g. "addi", "-5" for 'a sub 5'); the logical operations
+// zero-extend their immediates, and the shifts only use 5 bits
+func immediate_form(op string, right interface{}) (string, string, bool) {
+    integer, ok := right.(Integer)
+    if !ok {
+        return "", "", false
+    }
+    value, err := strconv.ParseInt(integer.value, 0, 64)
+    if err != nil {
+        return "", "", false
+    }
+    if op == "sub" || op == "subu" {
+        // subtracting is adding the negated value
+        op, value = map[string]string{"sub": "add", "subu": "addu"}[op], -value
+    }
+    var immediate_op string = immediate_ops[op]
+    switch immediate_op {
+    case "":
+        return "", "", false
+    case "sll", "srl", "sra":
+        value &= 31
+    case "andi", "ori", "xori":
+        if value < 0 || value > 0xffff {
+            return "", "", false
+        }
+    default:
+        if value < -max_offset-1 || value > max_offset {
+            return "", "", false
+        }
+    }
+    return immediate_op, fmt.Sprint(value), true
+}
+
+// returns the number of registers it takes to evaluate an expression
+// (its Sethi-Ullman number); calls count as needing one more than
+// their arguments, since everything live across them is spilled
+func registers_needed(__node interface{}) int {
+    switch node := __node.(type) {
+    case ArithmeticOp:
+        left, right := registers_needed(node.left), registers_needed(node.right)
+        if left == right {
+            return left + 1
+        }
+        return max(left, right)
+    case Call:
+        var needed int = len(node.args)
+        for i, arg := range node.args {
+            needed = max(needed, registers_needed(arg)+i)
+        }
+        return needed + 1
+    case Hint:
+        return registers_needed(node.cond)
+    case Cast:
+        return registers_needed(node.value)
+    case Index:
+        return registers_needed(ArithmeticOp{node.value, "addu", node.index})
+    case Slice:
+        // like a call (see 'slice')
+        return registers_needed(Call{"", []interface{}{node.value, node.low, node.high}})
+    case VarArg:
+        return registers_needed(node.index)
+    }
+    return 1
+}
+
+// returns true if the right operand of an operation should be
+// generated first; it has to need more registers (see
+// 'registers_needed'), so that fewer values are live while it's
+// generated (and spilled around its calls), and swapping them can't
+// change either value: the left one can't make any calls, and the
+// right one can't change the variables the left one reads
+func (backend *MIPSBackend) __right_first(left interface{}, right interface{}) bool {
+    if registers_needed(right) <= registers_needed(left) {
+        return false
+    }
+    var (
+        left_calls  map[string][]Call = map[string][]Call{}
+        right_calls map[string][]Call = map[string][]Call{}
+        names       map[string]string = map[string]string{}
+    )
+    collect_calls(left, left_calls, map[string]bool{}, false)
+    collect_calls(right, right_calls, map[string]bool{}, false)
+    collect_names(left, "", names)
+    if len(left_calls) != 0 {
+        return false
+    }
+    for name := range names {
+        if assigns_to(right, name) {
+            return false
+        }
+    }
+    for name := range right_calls {
+        // nested functions can assign to the caller's variables
+        if label, ok := backend.__resolve_function(name); ok && backend.function_depths[label] > 1 && len(names) != 0 {
+            return false
+        }
+    }
+    return true
+}
+
 // an arithmetic operation; converts:
 // a + b
 // =>
 // <code for a>
 // <code for b>
 // op $t1, $t0, $t1
-// such that $t0 is a's register, and $t1 is b's
+// such that $t0 is a's register, and $t1 is b's; if either
+// operand is a small integer (see 'immediate_form'), converts:
+// a + 5
+// =>
+// <code for a>
+// addi $t0, $t0, 5
+// instead (integers on the left only move to the right
+// for commutative operations, and 'sizeof' and 'alignof'
+// count as integers). b is generated first if it
+// needs more registers than a (see '__right_first')
 func (backend *MIPSBackend) arithmetic_op(node *ArithmeticOp) {
-    backend.codegen(node.left)
-    backend.codegen(node.right)
+    if backend.type_of(node.left) == "fd" || backend.type_of(node.right) == "fd" {
+        panic("file descriptors can't be used in arithmetic")
+    }
+    if backend.type_of(node.left) == "float" || backend.type_of(node.right) == "float" {
+        panic("floats can't be used in arithmetic (cast them to int first)")
+    }
+    var (
+        left, right interface{} = backend.__fold_size(node.left), backend.__fold_size(node.right)
+        // what they were before '__fold_size'
+        left_source, right_source interface{} = node.left, node.right
+    )
+    if _, ok := left.(Integer); ok && commutative_ops[node.op] {
+        if _, ok := right.(Integer); !ok {
+            left, right = right, left
+            left_source, right_source = right_source, left_source
+        }
+    }
+    if op, immediate, ok := immediate_form(node.op, right); ok {
+        backend.codegen(left)
+        backend.__comment_folded(left_source)
+        var register string = backend.__peek()
+        backend.__emit_main(op, register, register, immediate)
+        backend.__comment_folded(right_source)
+        return
+    }
+    var right_first bool = backend.__right_first(node.left, node.right)
+    if right_first {
+        backend.codegen(node.right)
+        backend.codegen(node.left)
+    } else {
+        backend.codegen(node.left)
+        backend.codegen(node.right)
+    }
     var (
-        left_register  string
-        right_register string
-        i              int = len(backend.stack) - 1
+        registers      []string = backend.__pop_n(2)
+        left_register  string   = registers[0]
+        right_register string   = registers[1]
     )
-    // we have to pop the right register from the stack,
-    // then the left register because the right hand-side
-    // was generated last
-    right_register, backend.stack = backend.stack[i], append(backend.stack[:i], backend.stack[0:]...)
-    left_register, backend.stack = backend.stack[i], append(backend.stack[:i], backend.stack[0:]...)
+    // the side generated last is on top of the stack
+    if right_first {
+        left_register, right_register = right_register, left_register
+    }
     // store the value in the right register
-    backend.__emit_main(node.op, right_register, left_register, right_register)
-    // push the right register onto the stack
-    backend.stack = append(backend.stack, right_register)
+    if node.op == "div" && !backend.target.pseudo_ops["div"] {
+        // the real 'div' leaves the quotient in LO
+        backend.__emit_main("div", left_register, right_register, "")
+        backend.__emit_main("mflo", right_register, "", "")
+    } else {
+        backend.__emit_main(node.op, right_register, left_register, right_register)
+    }
+    // the left value is used up, and the right register holds the result
+    backend.__free(left_register)
+    backend.stack.push(right_register)
 }
 
 // an assignment; converts:
@@ -188,31 +1272,135 @@ func (backend *MIPSBackend) arithmetic_op(node *ArithmeticOp) {
 // <code for b>
 // sw $t0, -4($sp)
 // such that $t0 is b's register and -4 is the
-// current offset from the stack pointer
+// current offset from the stack pointer (or the offset
+// 'a' already has if it was assigned before)
 func (backend *MIPSBackend) assignment(node *Assignment) {
     backend.codegen(node.value)
-    backend.access_loc[node.name] = fmt.Sprintf("-%d($sp)", backend.name_offset)
-    // increment the offset by 4 (the word size)
-    backend.name_offset += 4
-    var (
-        value_register string
-        i              int = len(backend.stack) - 1
-    )
+    if _, ok := backend.statics[node.name]; ok {
+        if actual := backend.type_of(node.value); actual != "int" {
+            panic(fmt.Sprintf("can't assign %s to static '%s'", actual, node.name))
+        }
+    } else if !backend.__captured(node.name) {
+        backend.name_types[node.name] = backend.type_of(node.value)
+    }
     // pop the stack to get the register the value is stored in
-    value_register, backend.stack = backend.stack[i], append(backend.stack[:i], backend.stack[0:]...)
-    backend.__emit_main("sw", value_register, backend.access_loc[node.name], "")
+    var register string = backend.__pop()
+    backend.__store_variable(node.name, register)
+    backend.__free(register)
+}
+
+// an expression statement; converts:
+// f(a)
+// =>
+// <code for f(a)>
+// and pops the register holding the value off the stack,
+// so that nothing after it has to keep (or spill, see
+// 'user_call') a value that is never used
+func (backend *MIPSBackend) expr_stmt(node *ExprStmt) {
+    var depth int = backend.stack.depth()
+    backend.codegen(node.value)
+    backend.__drop_values(depth)
+}
+
+// stores a register into a variable; statics are stored in the
+// data section (see '__store_static'), variables of enclosing
+// functions are reached through the static link, and any other
+// name gets a slot in the current frame (see '__variable_slot')
+func (backend *MIPSBackend) __store_variable(name string, register string) {
+    if _, ok := backend.statics[name]; ok {
+        backend.__store_static(name, register)
+        return
+    }
+    if _, ok := backend.access_loc[name]; !ok && backend.__captured(name) {
+        var address_register string = backend.__temp_register()
+        backend.__emit_main("sw", register, backend.__variable_location(name, address_register), "")
+        backend.__free(address_register)
+        return
+    }
+    backend.__emit_main("sw", register, backend.__variable_slot(name), "")
+}
+
+// returns the stack slot of a variable, giving it the
+// next free one if it doesn't have one yet; reusing the
+// slot makes assignments in branches update the same location
+func (backend *MIPSBackend) __variable_slot(name string) string {
+    _, ok := backend.access_loc[name]
+    if !ok && len(backend.free_slots) != 0 {
+        var i int = len(backend.free_slots) - 1
+        backend.access_loc[name], backend.free_slots = backend.free_slots[i], backend.free_slots[:i]
+    } else if !ok {
+        backend.access_loc[name] = backend.__reserve_slot()
+    }
+    if !ok {
+        backend.__record_slot(name)
+    }
+    return backend.access_loc[name]
+}
+
+// returns the compile-time type of an expression;
+// one of "int", "string", "[]string", "float", "double", "fd",
+// "closed fd", or "void"
+func (backend *MIPSBackend) type_of(__node interface{}) string {
+    switch node := __node.(type) {
+    case ArithmeticOp, Integer, VarArg:
+        return "int"
+    case Cast:
+        if node.to == "float" {
+            return "float"
+        }
+        return "int"
+    case String, Slice:
+        return "string"
+    case StringArray:
+        return "[]string"
+    case Float:
+        return float_type(node)
+    case Index:
+        // the elements of string arrays, or the bytes of strings
+        if backend.type_of(node.value) == "[]string" {
+            return "string"
+        }
+        return "int"
+    case Ident:
+        var name_type string = backend.__variable_type(node.name)
+        if name_type == "" && len(backend.diagnostics.with_severity("Error")) != 0 {
+            // the statement that assigned it failed
+            panic(Cascaded{})
+        }
+        return name_type
+    case Call:
+        if label, ok := backend.__resolve_function(node.name); ok {
+            return backend.function_types[label]
+        }
+        if function, ok := backend.__c_function(node.name); ok {
+            return function.result
+        }
+        return builtin_type(node.name)
+    case Hint:
+        return backend.type_of(node.cond)
+    }
+    return "void"
 }
 
 // emits:
 // lw $t0, -4($sp)
 // such that $t0 is the first temporary register it could
-// get, and -4 is the offset from the stack pointer
+// get, and -4 is the offset from the stack pointer (statics
+// are loaded from the data section, see '__load_static')
 func (backend *MIPSBackend) ident(node *Ident) {
     // get a new temporary register
     var temp_register string = backend.__temp_register()
     // push the register onto the stack
-    backend.stack = append(backend.stack, temp_register)
-    backend.__emit_main("lw", temp_register, backend.access_loc[node.name], "")
+    backend.stack.push(temp_register)
+    if _, ok := backend.statics[node.name]; ok {
+        backend.__load_static(node.name, temp_register)
+        return
+    }
+    if _, ok := backend.access_loc[node.name]; !ok && backend.in_handler {
+        // it runs on a stack of its own (see 'exception_handler')
+        panic(fmt.Sprintf("exception handlers can't read '%s', a variable of the code they interrupt (use a static)", node.name))
+    }
+    backend.__emit_main("lw", temp_register, backend.__variable_location(node.name, temp_register), "")
 }
 
 // emits:
@@ -223,7 +1411,7 @@ func (backend *MIPSBackend) _integer(node *Integer) {
     // get a new temporary register
     var temp_register string = backend.__temp_register()
     // push the register onto the stack
-    backend.stack = append(backend.stack, temp_register)
+    backend.stack.push(temp_register)
     backend.__emit_main("li", temp_register, node.value, "")
 }
 
@@ -232,23 +1420,173 @@ func (backend *MIPSBackend) _integer(node *Integer) {
 // in the data section, and:
 // la $t0, string1
 // such that $t0 is the first temporary register it could
-// get, and "abc" is the value of the string
-func (backend *MIPSBackend) _string(node *String) {
+// get, and "abc" is the value of the string; the string goes
+// in the read-only data if its parent only reads it (see
+// 'read_only_literal')
+func (backend *MIPSBackend) _string(node *String, parent interface{}) {
     // get a new temporary register
     var temp_register string = backend.__temp_register()
     // push the register onto the stack
-    backend.stack = append(backend.stack, temp_register)
+    backend.stack.push(temp_register)
     // we have to store the string in the data section
-    backend.__emit_data(
-        fmt.Sprintf("string%d: .asciiz \"%s\"", backend.data_temp_name, node.value))
-    backend.__emit_main("la", temp_register, fmt.Sprintf("string%d", backend.data_temp_name), "")
-    backend.data_temp_name++
+    var label string = backend.__string_label()
+    backend.__emit_string(label, node.value, backend.read_only_literal(*node, parent))
+    backend.__emit_address(temp_register, label)
 }
 
+// the escapes '__emit_string' writes in an '.asciiz' string, which
+// every assembler reads the same way
+var ascii_escapes = map[byte]string{'"': `\"`, '\\': `\\`, '\n': `\n`, '\t': `\t`}
+
+// emits:
+// string1: .asciiz "abc"
+// in the data section, such that string1 is 'label' and "abc"
+// is the text, escaped again from its bytes (so a quote, a
+// backslash or a line break in it can't end the directive);
+// text with non-ASCII characters (or control characters other
+// than tabs and line breaks) is emitted a byte at a time instead,
+// since not every assembler reads its input as UTF-8:
+// string1: .byte 0x68, 0xc3, 0xa9, 0x00 # "hé"
+// for "hé" (see 'DataItem'); panics if the text isn't valid UTF-8. strings the
+// program can't write to go in the read-only data instead
+func (backend *MIPSBackend) __emit_string(label string, text string, read_only bool) {
+    var emit func(item DataItem) = backend.__emit_data
+    if read_only {
+        emit = backend.__emit_rodata
+    }
+    var bytes []byte = unescape(text)
+    if !utf8.Valid(bytes) {
+        panic(fmt.Sprintf("string literal \"%s\" isn't valid UTF-8", strings.ToValidUTF8(text, "\uFFFD")))
+    }
+    var (
+        ascii   bool = true
+        escaped strings.Builder
+    )
+    for _, b := range bytes {
+        if escape, ok := ascii_escapes[b]; ok {
+            escaped.WriteString(escape)
+            continue
+        }
+        ascii = ascii && b >= ' ' && b <= '~'
+        escaped.WriteByte(b)
+    }
+    if ascii {
+        emit(DataItem{fmt.Sprintf("%s: .asciiz \"%s\"", label, escaped.String()), ""})
+        return
+    }
+    var items []string
+    for _, b := range append(bytes, 0) {
+        items = append(items, fmt.Sprintf("0x%02x", b))
+    }
+    emit(DataItem{fmt.Sprintf("%s: .byte %s", label, strings.Join(items, ", ")), strconv.Quote(string(bytes))})
+}
+
+// replaces the CLI on platforms without one (see 'wasm.go')
+var js_main func()
+
 func main() {
-    // ast is equivlent to:
+    if js_main != nil {
+        js_main()
+        return
+    }
+    var (
+        options     BackendOptions = default_backend_options()
+        print_stats *bool          = flag.Bool("stats", false, "print statistics about the generated code")
+        output      *string        = flag.String("o", "", "write the output to a file instead of stdout")
+        go_package  *string        = flag.String("go-package", "", "output a Go file in this package, with the assembly as a constant")
+        go_const    *string        = flag.String("go-const", "program", "the name of the constant for -go-package")
+        watch_input *bool          = flag.Bool("watch", false, "regenerate the program whenever its file changes")
+        config      *string        = flag.String("config", "scg.toml", "read the project's inputs and flags from this file, if it exists")
+        stream      *bool          = flag.Bool("stream", false, "generate the program as its file is read, without holding all of it (see 'Stream')")
+        artifact    *string        = flag.String("artifact", "", "also write the symbols, stack slots, and statistics (see 'Artifact') as JSON to this file")
+        debug_info  *string        = flag.String("g", "", "write a listing of the statements to this file, and add line info for it (linux target only)")
+        symbolic    *bool          = flag.Bool("symbolic", false, "annotate each instruction with what it computes (see 'symbolic_trace')")
+        source_map  *string        = flag.String("source-map", "", "write the node each line of assembly came from as JSON to this file")
+        ld_script   *string        = flag.String("ld-script", "", "write a GNU ld linker script for the output to this file (bare target only)")
+        split       *string        = flag.String("split", "", "write one .s file per function, and main.s with the rest (or with several inputs, one per module), to this directory instead")
+        timeout     *time.Duration = flag.Duration("timeout", 0, "give up on compiling after this long (0 for no limit)")
+        listing     *string        = flag.String("listing", "", "write the addresses and encodings of the instructions and data (see 'assemble_listing') to this file")
+        size_report *bool          = flag.Bool("size-report", false, "print an estimate of how big the code would be as microMIPS (see 'code_size_report') to stderr")
+        format      *string        = flag.String("format", "asm", "the output: asm (assembly) or bin (a flat binary to load at -base, see 'assemble_binary')")
+    )
+    flag.Usage = func() {
+        fmt.Fprintln(flag.CommandLine.Output(), "usage: scg [build] [flags] [ast.json...]\n       scg serve [-addr address] [-timeout duration]\n       scg repl [-run] [-target target]\n       scg fmt [-w] ast.json...\n       scg diff [flags] -against flags ast.json\n       scg disassemble [-base address] [-byte-order EB|EL] image.bin...\n       scg debug [flags] ast.json\n       scg snapshot|verify [flags] directory")
+        flag.PrintDefaults()
+    }
+    backend_flags(flag.CommandLine, &options)
+    flag.BoolFunc("trace", "log every codegen decision to stderr", func(string) error {
+        options.logger = trace_logger()
+        return nil
+    })
+    flag.BoolFunc("time-report", "print how long each phase of compilation took to stderr", func(string) error {
+        options.time_report = &TimeReport{}
+        return nil
+    })
+    if len(os.Args) > 1 && os.Args[1] == "serve" {
+        serve(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "repl" {
+        repl(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "fmt" {
+        format_files(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "diff" {
+        diff_options(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "disassemble" {
+        disassemble_files(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "debug" {
+        debug(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "proptest" {
+        proptest(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && (os.Args[1] == "snapshot" || os.Args[1] == "verify") {
+        snapshot(os.Args[1], os.Args[2:])
+        return
+    }
+    var args []string = os.Args[1:]
+    if len(args) != 0 && args[0] == "build" {
+        // the default command
+        args = args[1:]
+    }
+    flag.CommandLine.Parse(args)
+    var inputs []string = flag.Args()
+    if _, err := os.Stat(*config); err == nil || given_flags(flag.CommandLine)["config"] {
+        // the flags win over the file, and the inputs on the
+        // command line replace the file's
+        config_inputs, err := apply_config(*config, flag.CommandLine, options.warnings)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(2)
+        }
+        if len(inputs) == 0 {
+            inputs = config_inputs
+        }
+    }
+    if *timeout != 0 && !*watch_input {
+        // '-watch' gives each regeneration a deadline of its own
+        var cancel context.CancelFunc
+        options.context, cancel = context.WithTimeout(options.context, *timeout)
+        defer cancel()
+    }
+    if *format != "asm" && *format != "bin" {
+        fmt.Fprintf(os.Stderr, "unknown format '%s' (expected asm or bin)\n", *format)
+        os.Exit(2)
+    }
+    options.debug_info = *debug_info != ""
+    // without an input, ast is equivlent to:
     // abc = 123 + (321 - 123)
-    var ast Program = Program{
+    var ast interface{} = Program{
         []interface{}{
             Assignment{
                 "foo",
@@ -272,8 +1610,243 @@ func main() {
             },
         },
     }
-    var backend MIPSBackend = new_mips_backend(ast)
-    fmt.Println(backend.assemble())
+    // writes the assembly where the flags say
+    var write = func(code string, input string) error {
+        if *go_package != "" {
+            code = go_source(*go_package, *go_const, input, code)
+        }
+        if *output == "" {
+            _, err := fmt.Print(code)
+            return err
+        }
+        return os.WriteFile(*output, []byte(code), 0o644)
+    }
+    var input string = "the built-in example"
+    if *watch_input && len(inputs) != 1 {
+        flag.Usage()
+        os.Exit(2)
+    } else if *watch_input {
+        // the changes are printed, so only a file gets the code
+        watch(inputs[0], options, *timeout, func(code string) {
+            if *output == "" {
+                return
+            }
+            if err := write(code, filepath.Base(inputs[0])); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+            }
+        })
+    } else if len(inputs) > 1 {
+        // every file is a module of one program (see 'link_modules')
+        var modules []Module
+        for _, input := range inputs {
+            data, err := os.ReadFile(input)
+            if err == nil {
+                options.time_report.time("parse", func() {
+                    ast, err = decode_ast_with(options.context, data)
+                })
+            }
+            if program, ok := ast.(Program); err == nil && !ok {
+                err = fmt.Errorf("a module has to be a Program")
+            } else if err == nil {
+                var name string = filepath.Base(input)
+                modules = append(modules, Module{strings.TrimSuffix(name, filepath.Ext(name)), program, nil})
+            }
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "%s: %v\n", input, err)
+                os.Exit(1)
+            }
+        }
+        if *split != "" {
+            // each module on its own (see 'compile_modules')
+            var files map[string]string
+            if !run_build(func() { files = compile_modules(modules, options) }, nil) {
+                os.Exit(1)
+            }
+            if err := write_split(*split, files); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                os.Exit(1)
+            }
+            return
+        }
+        var code string
+        if !run_build(func() { code = link_modules(modules, options) }, nil) {
+            os.Exit(1)
+        }
+        if err := write(code+"\n", filepath.Base(inputs[0])); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        if options.time_report != nil {
+            fmt.Fprint(os.Stderr, options.time_report)
+        }
+        return
+    } else if len(inputs) == 1 && *stream {
+        file, err := os.Open(inputs[0])
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        defer file.Close()
+        var (
+            program *Stream = new_stream(options)
+            code    string
+        )
+        if !run_build(func() {
+            if err = decode_stream(file, program); err == nil {
+                code = program.finish()
+            }
+        }, &program.backend.diagnostics) {
+            os.Exit(1)
+        }
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", inputs[0], err)
+            os.Exit(1)
+        }
+        if err := write(code+"\n", filepath.Base(inputs[0])); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    } else if len(inputs) == 1 {
+        input = inputs[0]
+        data, err := os.ReadFile(input)
+        if err == nil {
+            options.time_report.time("parse", func() {
+                ast, err = decode_ast_with(options.context, data)
+            })
+        }
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %v\n", input, err)
+            os.Exit(1)
+        }
+        // the file name is all go:generate output mentions
+        input = filepath.Base(input)
+    }
+    var backend MIPSBackend
+    if !run_build(func() {
+        backend = blank_mips_backend(options)
+        backend.generate(ast)
+    }, &backend.diagnostics) {
+        os.Exit(1)
+    }
+    if *split != "" {
+        // for incremental builds (see 'assemble_split')
+        var files map[string]string
+        options.time_report.time("assembly", func() {
+            files = backend.assemble_split()
+        })
+        if err := write_split(*split, files); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        if options.time_report != nil {
+            fmt.Fprint(os.Stderr, options.time_report)
+        }
+        return
+    }
+    if *listing != "" {
+        // laid out as for -format bin
+        var text string
+        if !run_build(func() { text = backend.assemble_listing() }, nil) {
+            os.Exit(1)
+        }
+        if err := os.WriteFile(*listing, []byte(text), 0o644); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    }
+    if *size_report {
+        var report SizeReport
+        if !run_build(func() { report = backend.code_size_report() }, nil) {
+            os.Exit(1)
+        }
+        fmt.Fprint(os.Stderr, report)
+    }
+    if *format == "bin" {
+        // the image isn't text, so it's written as is
+        var image []byte
+        if !run_build(func() {
+            options.time_report.time("assembly", func() {
+                image = backend.assemble_binary()
+            })
+        }, nil) {
+            os.Exit(1)
+        }
+        var err error
+        if *output == "" {
+            _, err = os.Stdout.Write(image)
+        } else {
+            err = os.WriteFile(*output, image, 0o644)
+        }
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        return
+    }
+    var code string
+    options.time_report.time("assembly", func() {
+        if *symbolic {
+            code = backend.symbolic_trace()
+            return
+        }
+        if *debug_info == "" {
+            code = backend.assemble()
+            return
+        }
+        // gdb finds the listing next to the assembly
+        code = backend.assemble_debug(filepath.Base(*debug_info))
+    })
+    if *debug_info != "" {
+        if err := os.WriteFile(*debug_info, []byte(backend.debug_listing()), 0o644); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    }
+    if err := write(code+"\n", input); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    if *print_stats {
+        fmt.Fprint(os.Stderr, backend.stats())
+    }
+    if *source_map != "" {
+        var assembly string
+        if *output != "" {
+            assembly = filepath.Base(*output)
+        }
+        data, err := backend.source_map(assembly, input)
+        if err == nil {
+            err = os.WriteFile(*source_map, append(data, '\n'), 0o644)
+        }
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    }
+    if *ld_script != "" {
+        script, err := backend.linker_script()
+        if err == nil {
+            err = os.WriteFile(*ld_script, []byte(script), 0o644)
+        }
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    }
+    if *artifact != "" {
+        data, err := json.MarshalIndent(backend.artifact(), "", "  ")
+        if err == nil {
+            err = os.WriteFile(*artifact, append(data, '\n'), 0o644)
+        }
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    }
+    if options.time_report != nil {
+        fmt.Fprint(os.Stderr, options.time_report)
+    }
     // output MIPS assembly is:
 
     //  .data
@@ -281,17 +1854,14 @@ func main() {
     //
     // .text
     //     main:
-    //         li $t0,123
-    //         li $t1,321
-    //         li $t2,123
-    //         sub $t2,$t0,$t2
-    //         add $t2,$t0,$t2
-    //         sw $t2,-4($sp)
-    //         la $t3,string1
-    //         sw $t3,-8($sp)
-    //         lw $t4,-8($sp)
-    //         sw $t4,-12($sp)
-    //
-    //         move $2, $0
+    //         li $t0,321
+    //         addi $t0,$t0,-123
+    //         addi $t0,$t0,123
+    //         sw $t0,-4($sp)
+    //         la $t0,string1
+    //         sw $t0,-4($sp)
+    //         lw $t0,-4($sp)
+    //         sw $t0,-8($sp)
+    //         move $2,$0
     //         j $31
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// runs scg (the test binary, see 'TestMain') with the arguments in
+// an empty directory, and returns what it wrote to stdout; the
+// inputs are written there first, by file name
+func run_scg(t *testing.T, inputs map[string]interface{}, args ...string) []byte {
+    stdout, _ := run_scg_with_stderr(t, inputs, args...)
+    return stdout
+}
+
+// 'run_scg', which also returns what scg wrote to stderr
+func run_scg_with_stderr(t *testing.T, inputs map[string]interface{}, args ...string) ([]byte, string) {
+    var (
+        command *exec.Cmd = exec.Command(os.Args[0], args...)
+        stderr  bytes.Buffer
+    )
+    command.Dir = t.TempDir()
+    command.Env = append(os.Environ(), "SCG_MAIN=1")
+    command.Stderr = &stderr
+    for name, ast := range inputs {
+        if err := os.WriteFile(filepath.Join(command.Dir, name), []byte(encode_ast(ast)), 0o644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    stdout, err := command.Output()
+    if err != nil {
+        t.Fatalf("scg %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+    }
+    return stdout, stderr.String()
+}
+
+// string literals are escaped again from their bytes, so that
+// quotes, backslashes and line breaks can't end the directive
+func Test_string_escapes(t *testing.T) {
+    var cases = map[string]string{
+        `plain`:      `.asciiz "plain"`,
+        `say \"hi\"`: `.asciiz "say \"hi\""`,
+        "say \"hi\"": `.asciiz "say \"hi\""`,
+        `a\\b`:       `.asciiz "a\\b"`,
+        "one\ntwo":   `.asciiz "one\ntwo"`,
+        `one\ntwo`:   `.asciiz "one\ntwo"`,
+        "bell\a":     `.byte 0x62, 0x65, 0x6c, 0x6c, 0x07, 0x00`,
+        `nul\0`:      `.byte 0x6e, 0x75, 0x6c, 0x00, 0x00`,
+        "hé":         `.byte 0x68, 0xc3, 0xa9, 0x00`,
+    }
+    for text, expected := range cases {
+        var backend MIPSBackend = new_mips_backend(Program{[]interface{}{Assignment{"s", String{text}}}})
+        var line string
+        for _, data := range strings.Split(backend.data_section, "\n") {
+            if strings.Contains(data, "string1:") {
+                // without the text in its comment (see 'DataItem')
+                line = strings.TrimSpace(strip_comment(data))
+            }
+        }
+        if line != "string1: "+expected {
+            t.Errorf("%q was emitted as %s", text, line)
+        }
+        _, literal, _ := strings.Cut(expected, `"`)
+        if strings.HasPrefix(expected, ".asciiz") && string(unescape(strings.TrimSuffix(literal, `"`))) != string(unescape(text)) {
+            t.Errorf("%q doesn't unescape to the bytes it was emitted from", text)
+        }
+    }
+}
+
+// the comments passes give instructions and data items (see
+// 'comment' and 'DataItem') are written after them, and stay with
+// the instructions -O2 moves around
+func Test_comments(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Static{"b", "uint8", "300"},
+        Assignment{"s", String{"hé"}},
+        Assignment{"n", Call{"sizeof", []interface{}{String{"int16"}}}},
+        If{Hint{ArithmeticOp{Ident{"n"}, "slt", Integer{"3"}}, false}, []interface{}{
+            Call{"Printf", []interface{}{String{"%d\\n"}, Integer{"1"}}},
+        }, []interface{}{Call{"Printf", []interface{}{String{"%s\\n"}, Ident{"s"}}}}},
+    }}
+    var cases = []struct {
+        target   string
+        program  Program
+        expected []string
+    }{
+        {"linux", program, []string{
+            with_comment("__static_b: .byte 44", "300 as uint8"),
+            with_comment("string1: .byte 0x68, 0xc3, 0xa9, 0x00", `"hé"`),
+            with_comment("li $t0,2", `folded from sizeof("int16")`),
+            with_comment("bne $t0,$0,block3", "inverted from beql"),
+        }},
+        {"mars", Program{[]interface{}{Call{"Printf", []interface{}{String{"%f"}, Float{"2.50", false}}}}}, []string{
+            with_comment("lwc1 $f12,0($t0)", "2.50"),
+        }},
+    }
+    for _, test := range cases {
+        var options BackendOptions = default_backend_options()
+        options.target, options.optimize, options.branch_likely = test.target, 2, true
+        var (
+            backend MIPSBackend = new_mips_backend_with(test.program, options)
+            code    string      = "\n" + strings.Join(code_lines(backend.assemble()), "\n") + "\n"
+        )
+        for _, expected := range test.expected {
+            if !strings.Contains(code, "\n"+expected+"\n") {
+                t.Errorf("%s: no %q in:%s", test.target, expected, code)
+            }
+        }
+    }
+}
+
+// the emission hooks run for every instruction (and label) the
+// statements emit, the 'before_emit' ones first, each in the order
+// it was added; what a 'before_emit' hook changes is what gets
+// added, and what the 'after_emit' hooks see
+func Test_emission_hooks(t *testing.T) {
+    var (
+        events []string
+        logged = func(name string) func(*Instruction) {
+            return func(instruction *Instruction) {
+                events = append(events, name+": "+render_instruction(*instruction))
+            }
+        }
+        // replaces the 5 with a 6
+        six = func(instruction *Instruction) {
+            if instruction.opcode == "li" && instruction.args[1] == "5" {
+                instruction.args[1] = "6"
+            }
+        }
+    )
+    var program Program = Program{[]interface{}{
+        Assignment{"a", Integer{"5"}},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"a"}}},
+    }}
+    var cases = map[string]struct {
+        before, after []func(*Instruction)
+        // what's logged for the assignment
+        expected []string
+        // and what the program prints
+        printed string
+    }{
+        "none": {nil, nil, nil, "5\n"},
+        "in order": {[]func(*Instruction){logged("before 1"), logged("before 2")}, []func(*Instruction){logged("after 1"), logged("after 2")},
+            []string{
+                "before 1: li $t0,5", "before 2: li $t0,5", "after 1: li $t0,5", "after 2: li $t0,5",
+                "before 1: sw $t0,-4($sp)", "before 2: sw $t0,-4($sp)", "after 1: sw $t0,-4($sp)", "after 2: sw $t0,-4($sp)",
+            }, "5\n"},
+        "changed": {[]func(*Instruction){logged("before"), six}, []func(*Instruction){logged("after")},
+            []string{
+                "before: li $t0,5", "after: li $t0,6",
+                "before: sw $t0,-4($sp)", "after: sw $t0,-4($sp)",
+            }, "6\n"},
+    }
+    for name, test := range cases {
+        var options BackendOptions = default_backend_options()
+        options.before_emit, options.after_emit, events = test.before, test.after, nil
+        stdout, _, err := run_with_emulator(program, options)
+        if err != nil || stdout != test.printed {
+            t.Errorf("%s: printed %q (%v), expected %q", name, stdout, err, test.printed)
+        }
+        if len(events) < len(test.expected) || !reflect.DeepEqual(events[:len(test.expected)], test.expected) {
+            t.Errorf("%s: the hooks logged\n%s\nexpected it to start with\n%s", name, strings.Join(events, "\n"), strings.Join(test.expected, "\n"))
+        }
+        // and every hook ran for each of the rest
+        if hooks := len(test.before) + len(test.after); hooks != 0 && len(events)%hooks != 0 {
+            t.Errorf("%s: %d hook(s) logged %d event(s)", name, hooks, len(events))
+        }
+    }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+    "fmt"
+)
+
+// a byte of a string; converts:
+// a[i]
+// =>
+// <code for a>
+// <code for i>
+// addu $t1, $t0, $t1
+// lbu $t1, 0($t1)
+// such that $t0 is a's register, and $t1 is i's; small integer
+// indices become the offset of the load instead:
+// a[3]
+// =>
+// <code for a>
+// lbu $t0, 3($t0)
+// there are no bounds checks (the NUL terminator can be read);
+// string arrays are indexed by 'index_table'
+func (backend *MIPSBackend) index(node *Index) {
+    var kind string = backend.type_of(node.value)
+    if kind != "string" && kind != "[]string" {
+        panic(fmt.Sprintf("can't index %s", kind))
+    }
+    if actual := backend.type_of(node.index); actual != "int" {
+        panic(fmt.Sprintf("%s indices must be int, got %s", kind, actual))
+    }
+    if kind == "[]string" {
+        backend.index_table(node)
+        return
+    }
+    if _, offset, ok := immediate_form("addu", backend.__fold_size(node.index)); ok {
+        backend.codegen(node.value)
+        var register string = backend.__peek()
+        backend.__emit_main("lbu", register, fmt.Sprintf("%s(%s)", offset, register), "")
+        return
+    }
+    backend.codegen(node.value)
+    backend.codegen(node.index)
+    var registers []string = backend.__pop_n(2)
+    backend.__emit_main("addu", registers[1], registers[0], registers[1])
+    backend.__emit_main("lbu", registers[1], fmt.Sprintf("0(%s)", registers[1]), "")
+    backend.__free(registers[0])
+    backend.stack.push(registers[1])
+}
+
+// a substring; converts:
+// a[i:j]
+// =>
+// <code for a>
+// <code for i>
+// <code for j>
+// move $a0, $t0
+// move $a1, $t1
+// move $a2, $t2
+// jal __scg_substring
+// move $t3, $v0
+// where the routine copies the bytes to the heap (with 'sbrk'),
+// so the target needs that syscall; like indexing, there are no
+// bounds checks
+func (backend *MIPSBackend) slice(node *Slice) {
+    if kind := backend.type_of(node.value); kind != "string" {
+        panic(fmt.Sprintf("can't slice %s", kind))
+    }
+    for _, bound := range []interface{}{node.low, node.high} {
+        if actual := backend.type_of(bound); actual != "int" {
+            panic(fmt.Sprintf("string bounds must be int, got %s", actual))
+        }
+    }
+    if _, ok := backend.target.syscalls["sbrk"]; !ok {
+        panic(fmt.Sprintf("'a[i:j]' needs the 'sbrk' syscall, which target '%s' doesn't have", backend.options.target))
+    }
+    backend.__load_args([]interface{}{node.value, node.low, node.high})
+    // 'jal' overwrites $ra, which the caller needs to return
+    backend.__save_ra()
+    backend.__emit_local_call("__scg_substring")
+    backend.runtime_used["__scg_substring"] = true
+    backend.__push_result("$v0")
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+    "fmt"
+)
+
+// counts the nodes in an ast
+func count_nodes(__node interface{}) int {
+    switch node := __node.(type) {
+    case ArithmeticOp:
+        return 1 + count_nodes(node.left) + count_nodes(node.right)
+    case Assignment:
+        return 1 + count_nodes(node.value)
+    case Let:
+        return 1 + count_nodes(node.value)
+    case Var:
+        return 1 + count_nodes(node.value)
+    case ExprStmt:
+        return count_nodes(node.value)
+    case Call:
+        var count int = 1
+        for _, arg := range node.args {
+            count += count_nodes(arg)
+        }
+        return count
+    case Return:
+        if node.value == nil {
+            return 1
+        }
+        return 1 + count_nodes(node.value)
+    case If:
+        var count int = 1 + count_nodes(node.cond)
+        for _, item := range append(append([]interface{}{}, node.then...), node.otherwise...) {
+            count += count_nodes(item)
+        }
+        return count
+    case Hint:
+        return count_nodes(node.cond)
+    case Cast:
+        return 1 + count_nodes(node.value)
+    case Index:
+        return 1 + count_nodes(node.value) + count_nodes(node.index)
+    case Slice:
+        return 1 + count_nodes(node.value) + count_nodes(node.low) + count_nodes(node.high)
+    case Interp:
+        var count int = 1
+        for _, part := range node.parts {
+            count += count_nodes(part)
+        }
+        return count
+    }
+    return 1
+}
+
+// returns true if 'node' contains a 'Return', a nested function,
+// or a call to one of the user functions in 'functions'
+func has_call_or_return(__node interface{}, functions map[string]Function) bool {
+    switch node := __node.(type) {
+    case ArithmeticOp:
+        return has_call_or_return(node.left, functions) || has_call_or_return(node.right, functions)
+    case Assignment:
+        return has_call_or_return(node.value, functions)
+    case Let:
+        return has_call_or_return(node.value, functions)
+    case Var:
+        return has_call_or_return(node.value, functions)
+    case ExprStmt:
+        return has_call_or_return(node.value, functions)
+    case Call:
+        if _, ok := functions[node.name]; ok {
+            return true
+        }
+        for _, arg := range node.args {
+            if has_call_or_return(arg, functions) {
+                return true
+            }
+        }
+    case Hint:
+        return has_call_or_return(node.cond, functions)
+    case Cast:
+        return has_call_or_return(node.value, functions)
+    case Index:
+        return has_call_or_return(node.value, functions) || has_call_or_return(node.index, functions)
+    case Slice:
+        return has_call_or_return(node.value, functions) || has_call_or_return(node.low, functions) ||
+            has_call_or_return(node.high, functions)
+    case Interp:
+        for _, part := range node.parts {
+            if has_call_or_return(part, functions) {
+                return true
+            }
+        }
+    case Return, Function:
+        // nested functions need the caller's frame
+        return true
+    case If:
+        if has_call_or_return(node.cond, functions) {
+            return true
+        }
+        for _, item := range append(append([]interface{}{}, node.then...), node.otherwise...) {
+            if has_call_or_return(item, functions) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// returns true if calls to 'function' can be replaced by its body; it has
+// to be a leaf (it doesn't call any user functions), small enough, and
+// can only return at the very end
+func inlinable(function Function, functions map[string]Function, threshold int) bool {
+    if function.variadic {
+        return false
+    }
+    var size int = 0
+    for i, item := range function.body {
+        size += count_nodes(item)
+        if ret, ok := item.(Return); ok && i == len(function.body)-1 {
+            if ret.value != nil && has_call_or_return(ret.value, functions) {
+                return false
+            }
+            continue
+        }
+        if has_call_or_return(item, functions) {
+            return false
+        }
+    }
+    return size <= threshold
+}
+
+// copies a node, renaming every variable through 'names'
+func rename_node(__node interface{}, names map[string]string) interface{} {
+    switch node := __node.(type) {
+    case Ident:
+        return Ident{names[node.name]}
+    case ArithmeticOp:
+        return ArithmeticOp{rename_node(node.left, names), node.op, rename_node(node.right, names)}
+    case Assignment:
+        return Assignment{names[node.name], rename_node(node.value, names)}
+    case Let:
+        return Let{names[node.name], rename_node(node.value, names)}
+    case Var:
+        return Var{names[node.name], rename_node(node.value, names)}
+    case ExprStmt:
+        return ExprStmt{rename_node(node.value, names)}
+    case Call:
+        return Call{node.name, rename_nodes(node.args, names)}
+    case VarArg:
+        return VarArg{rename_node(node.index, names)}
+    case If:
+        return If{rename_node(node.cond, names),
+            rename_nodes(node.then, names), rename_nodes(node.otherwise, names)}
+    case Hint:
+        return Hint{rename_node(node.cond, names), node.likely}
+    case Cast:
+        return Cast{rename_node(node.value, names), node.to}
+    case Index:
+        return Index{rename_node(node.value, names), rename_node(node.index, names)}
+    case Slice:
+        return Slice{rename_node(node.value, names), rename_node(node.low, names), rename_node(node.high, names)}
+    case Interp:
+        return Interp{rename_nodes(node.parts, names)}
+    }
+    return __node
+}
+
+// copies a list of nodes, renaming every variable through 'names'
+func rename_nodes(nodes []interface{}, names map[string]string) (ret []interface{}) {
+    for _, node := range nodes {
+        ret = append(ret, rename_node(node, names))
+    }
+    return
+}
+
+// fills 'names' with a unique name for every variable in 'node'
+func collect_names(__node interface{}, prefix string, names map[string]string) {
+    switch node := __node.(type) {
+    case Ident:
+        names[node.name] = prefix + node.name
+    case ArithmeticOp:
+        collect_names(node.left, prefix, names)
+        collect_names(node.right, prefix, names)
+    case Assignment:
+        names[node.name] = prefix + node.name
+        collect_names(node.value, prefix, names)
+    case Let:
+        names[node.name] = prefix + node.name
+        collect_names(node.value, prefix, names)
+    case Var:
+        names[node.name] = prefix + node.name
+        collect_names(node.value, prefix, names)
+    case ExprStmt:
+        collect_names(node.value, prefix, names)
+    case Call:
+        for _, arg := range node.args {
+            collect_names(arg, prefix, names)
+        }
+    case Return:
+        collect_names(node.value, prefix, names)
+    case If:
+        collect_names(node.cond, prefix, names)
+        for _, item := range append(append([]interface{}{}, node.then...), node.otherwise...) {
+            collect_names(item, prefix, names)
+        }
+    case Hint:
+        collect_names(node.cond, prefix, names)
+    case Cast:
+        collect_names(node.value, prefix, names)
+    case Index:
+        collect_names(node.value, prefix, names)
+        collect_names(node.index, prefix, names)
+    case Slice:
+        collect_names(node.value, prefix, names)
+        collect_names(node.low, prefix, names)
+        collect_names(node.high, prefix, names)
+    case Interp:
+        for _, part := range node.parts {
+            collect_names(part, prefix, names)
+        }
+    case VarArg:
+        collect_names(node.index, prefix, names)
+    }
+}
+
+// the state of the inliner
+type Inliner struct {
+    functions map[string]Function
+    inlinable map[string]bool
+    statics   map[string]bool
+    count     uint
+}
+
+// replaces a call to an inlinable function with its body; converts:
+// x = f(1, 2)
+// =>
+// __f1_a = 1
+// __f1_b = 2
+// <body of f>
+// x = <value returned by f>
+// such that every variable of f is renamed (a => __f1_a), so
+// that it can't clash with the caller's; 'target' is nil when
+// the result is discarded
+func (inliner *Inliner) expand(call Call, target *string) (ret []interface{}) {
+    var function Function = inliner.functions[call.name]
+    if len(call.args) != len(function.params) {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d",
+            call.name, len(function.params), len(call.args)))
+    }
+    inliner.count++
+    // the symbol table for this copy of the body
+    var (
+        prefix string            = fmt.Sprintf("__%s%d_", function.name, inliner.count)
+        names  map[string]string = map[string]string{}
+    )
+    for _, param := range function.params {
+        names[param] = prefix + param
+    }
+    for _, item := range function.body {
+        collect_names(item, prefix, names)
+    }
+    // statics are shared with the caller
+    for name := range inliner.statics {
+        names[name] = name
+    }
+    for i, param := range function.params {
+        ret = append(ret, Assignment{names[param], call.args[i]})
+    }
+    for _, item := range function.body {
+        if value, ok := item.(Return); ok {
+            if value.value != nil && target != nil {
+                ret = append(ret, Assignment{*target, rename_node(value.value, names)})
+            } else if value.value != nil {
+                ret = append(ret, ExprStmt{rename_node(value.value, names)})
+            }
+            break
+        }
+        ret = append(ret, rename_node(item, names))
+    }
+    return
+}
+
+// inlines every call to an inlinable function in a list of statements;
+// only calls that are statements (bare, or in an 'ExprStmt'), or the
+// whole value of an assignment, are inlined
+func (inliner *Inliner) inline(nodes []interface{}) (ret []interface{}) {
+    for _, __node := range nodes {
+        switch node := __node.(type) {
+        case Call:
+            if inliner.inlinable[node.name] {
+                ret = append(ret, inliner.expand(node, nil)...)
+                continue
+            }
+        case ExprStmt:
+            if call, ok := node.value.(Call); ok && inliner.inlinable[call.name] {
+                ret = append(ret, inliner.expand(call, nil)...)
+                continue
+            }
+        case Assignment:
+            if call, ok := node.value.(Call); ok && inliner.inlinable[call.name] {
+                ret = append(ret, inliner.expand(call, &node.name)...)
+                continue
+            }
+        case If:
+            __node = If{node.cond, inliner.inline(node.then), inliner.inline(node.otherwise)}
+        case Function:
+            __node = Function{node.name, node.params, inliner.inline(node.body), node.variadic}
+        case ExceptionHandler:
+            __node = ExceptionHandler{inliner.inline(node.nodes)}
+        }
+        ret = append(ret, __node)
+    }
+    return
+}
+
+// substitutes the bodies of small leaf functions at their call
+// sites; a function is inlined if its body has at most 'threshold'
+// nodes (see 'inlinable'). the definitions are kept, since they
+// may still be called from places that weren't inlined
+func inline_functions(ast interface{}, threshold int) interface{} {
+    program, ok := ast.(Program)
+    if !ok {
+        return ast
+    }
+    var inliner Inliner = Inliner{map[string]Function{}, map[string]bool{}, map[string]bool{}, 0}
+    for _, node := range program.nodes {
+        if function, ok := node.(Function); ok {
+            inliner.functions[function.name] = function
+        } else if static, ok := node.(Static); ok {
+            inliner.statics[static.name] = true
+        }
+    }
+    for name, function := range inliner.functions {
+        inliner.inlinable[name] = inlinable(function, inliner.functions, threshold)
+    }
+    return Program{inliner.inline(program.nodes)}
+}
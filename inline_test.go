@@ -0,0 +1,42 @@
+package main
+
+import (
+    "testing"
+)
+
+// the variables an inlined body declares are renamed like the ones
+// it assigns, so that they can't clash with the caller's
+func Test_inline_declarations(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Function{"f", []string{"a"}, []interface{}{
+            Let{"t", ArithmeticOp{Ident{"a"}, "add", Integer{"1"}}},
+            Var{"u", ArithmeticOp{Ident{"t"}, "mul", Integer{"2"}}},
+            Return{Ident{"u"}},
+        }, false},
+        Var{"t", Integer{"100"}},
+        Var{"u", Integer{"200"}},
+        Assignment{"x", Call{"f", []interface{}{Integer{"5"}}}},
+        Call{"Printf", []interface{}{String{"%d %d %d\\n"}, Ident{"t"}, Ident{"u"}, Ident{"x"}}},
+    }}
+    var inlined interface{} = inline_functions(program, 20)
+    if output := interpret(inlined); output != "100 200 12\n" {
+        t.Errorf("the inlined program printed %q", output)
+    }
+    if _, diagnostics, ok := try_generate(inlined, default_backend_options()); !ok {
+        t.Errorf("the inlined program didn't compile: %v", diagnostics)
+    }
+}
+
+// a declaration whose value calls a user function keeps the function
+// around it from being inlined, like an assignment would
+func Test_inline_declaration_calls(t *testing.T) {
+    var functions = map[string]Function{
+        "g": {"g", nil, []interface{}{Return{Integer{"1"}}}, false},
+    }
+    for _, declaration := range []interface{}{Let{"a", Call{"g", nil}}, Var{"a", Call{"g", nil}}} {
+        var function Function = Function{"f", nil, []interface{}{declaration, Return{Ident{"a"}}}, false}
+        if inlinable(function, functions, 20) {
+            t.Errorf("%s is inlinable", describe_node(declaration))
+        }
+    }
+}
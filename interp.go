@@ -0,0 +1,85 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// parses an interpolated string; converts:
+// "x = {x}, {{y}}"
+// =>
+// Interp{String{"x = "}, Ident{"x"}, String{", {y}"}}
+// such that doubled braces stand for themselves
+func parse_interp(text string) Interp {
+    var (
+        parts   []interface{}
+        literal string
+    )
+    for i := 0; i < len(text); i++ {
+        if strings.HasPrefix(text[i:], "{{") || strings.HasPrefix(text[i:], "}}") {
+            literal += text[i : i+1]
+            i++
+            continue
+        }
+        if text[i] == '}' {
+            panic(fmt.Sprintf("unmatched '}' in \"%s\"", text))
+        }
+        if text[i] != '{' {
+            literal += text[i : i+1]
+            continue
+        }
+        var end int = strings.IndexByte(text[i:], '}')
+        if end == -1 {
+            panic(fmt.Sprintf("unmatched '{' in \"%s\"", text))
+        }
+        var name string = strings.TrimSpace(text[i+1 : i+end])
+        if name == "" {
+            panic(fmt.Sprintf("empty '{}' in \"%s\"", text))
+        }
+        if literal != "" {
+            parts = append(parts, String{literal})
+            literal = ""
+        }
+        parts = append(parts, Ident{name})
+        i += end
+    }
+    if literal != "" {
+        parts = append(parts, String{literal})
+    }
+    return Interp{parts}
+}
+
+// an interpolated string, printed like 'Printf'; converts:
+// "x = {x}\n"
+// =>
+// Printf("x = %d\n", x)
+// such that each part gets the verb for its type; every name
+// has to be a variable that exists at this point
+func (backend *MIPSBackend) interp(node *Interp) {
+    var (
+        format string
+        args   []interface{}
+    )
+    for _, part := range node.parts {
+        if literal, ok := part.(String); ok {
+            format += strings.ReplaceAll(literal.value, "%", "%%")
+            continue
+        }
+        if ident, ok := part.(Ident); ok {
+            _, static := backend.statics[ident.name]
+            if _, ok := backend.__hops(ident.name); !ok && !static {
+                panic(fmt.Sprintf("'{%s}' refers to undefined variable '%s'", ident.name, ident.name))
+            }
+        }
+        switch actual := backend.type_of(part); actual {
+        case "int":
+            format += "%d"
+        case "string":
+            format += "%s"
+        default:
+            panic(fmt.Sprintf("%s can't be interpolated", actual))
+        }
+        args = append(args, part)
+    }
+    backend.printf(&Call{"Printf", append([]interface{}{String{format}}, args...)})
+}
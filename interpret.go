@@ -0,0 +1,398 @@
+package main
+
+import (
+    "fmt"
+    "math/bits"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// a file descriptor, as returned by 'stdout' and friends
+type Descriptor int32
+
+// a function along with the variables it can see
+type Closure struct {
+    function Function
+    scope    *Scope
+}
+
+// the variables (and nested functions) of one activation; the
+// parent is the activation of the enclosing function, which is
+// what the static link points to in generated code
+type Scope struct {
+    variables map[string]interface{}
+    functions map[string]*Closure
+    // the function being run (nil for main) and its
+    // arguments, for 'VarArg'
+    closure *Closure
+    args    []interface{}
+    parent  *Scope
+}
+
+// evaluates an ast directly, as a reference for the generated
+// code; only the builtins with observable results outside of
+// MARS are supported ('Printf', 'write' to the standard streams,
+// intrinsics, and atomics)
+type Interpreter struct {
+    output    strings.Builder
+    functions map[string]*Closure
+    // the statics' types and values (see 'Static')
+    static_kinds  map[string]string
+    static_values map[string]int32
+}
+
+// the result of each arithmetic opcode, on 32-bit registers
+var interpreted_ops = map[string]func(a, b int32) int32{
+    "add":  func(a, b int32) int32 { return a + b },
+    "addu": func(a, b int32) int32 { return a + b },
+    "sub":  func(a, b int32) int32 { return a - b },
+    "subu": func(a, b int32) int32 { return a - b },
+    "mul":  func(a, b int32) int32 { return a * b },
+    "div": func(a, b int32) int32 {
+        if b == 0 {
+            panic("division by zero")
+        }
+        return a / b
+    },
+    "and":  func(a, b int32) int32 { return a & b },
+    "or":   func(a, b int32) int32 { return a | b },
+    "xor":  func(a, b int32) int32 { return a ^ b },
+    "nor":  func(a, b int32) int32 { return ^(a | b) },
+    "slt":  func(a, b int32) int32 { return bool_to_int(a < b) },
+    "sltu": func(a, b int32) int32 { return bool_to_int(uint32(a) < uint32(b)) },
+    "sllv": func(a, b int32) int32 { return a << (uint32(b) & 31) },
+    "srlv": func(a, b int32) int32 { return int32(uint32(a) >> (uint32(b) & 31)) },
+    "srav": func(a, b int32) int32 { return a >> (uint32(b) & 31) },
+}
+
+func bool_to_int(value bool) int32 {
+    if value {
+        return 1
+    }
+    return 0
+}
+
+// runs a program, returning what it printed to stdout
+func interpret(ast interface{}) string {
+    var interpreter Interpreter = Interpreter{strings.Builder{}, map[string]*Closure{}, map[string]string{}, map[string]int32{}}
+    // warnings are the generator's business
+    var diagnostics Diagnostics = new_diagnostics(default_backend_options())
+    interpreter.execute(lower(ast, &diagnostics), &Scope{map[string]interface{}{}, map[string]*Closure{}, nil, nil, nil})
+    return interpreter.output.String()
+}
+
+// runs a statement; the result is the value of a 'return'
+// (and whether one was reached)
+func (interpreter *Interpreter) execute(__node interface{}, scope *Scope) (interface{}, bool) {
+    switch node := __node.(type) {
+    case Program:
+        for _, item := range node.nodes {
+            if static, ok := item.(Static); ok {
+                value, _ := strconv.ParseInt(static.value, 0, 64)
+                interpreter.static_kinds[static.name] = static.kind
+                interpreter.static_values[static.name] = convert(int32(value), static.kind)
+            }
+        }
+        return interpreter.execute_all(node.nodes, scope)
+    case Assignment:
+        var value interface{} = interpreter.evaluate(node.value, scope)
+        if kind, ok := interpreter.static_kinds[node.name]; ok {
+            interpreter.static_values[node.name] = convert(value.(int32), kind)
+            return nil, false
+        }
+        // like '__captured', assigning to an enclosing function's
+        // variable updates it in place
+        for outer := scope; outer != nil; outer = outer.parent {
+            if _, ok := outer.variables[node.name]; ok {
+                outer.variables[node.name] = value
+                return nil, false
+            }
+        }
+        scope.variables[node.name] = value
+    case ExprStmt:
+        interpreter.evaluate(node.value, scope)
+    case If:
+        if interpreter.evaluate(node.cond, scope).(int32) != 0 {
+            return interpreter.execute_all(node.then, scope)
+        }
+        return interpreter.execute_all(node.otherwise, scope)
+    case Function:
+        var closure *Closure = &Closure{node, nil}
+        if scope.closure == nil {
+            interpreter.functions[node.name] = closure
+        } else {
+            closure.scope = scope
+            scope.functions[node.name] = closure
+        }
+    case Return:
+        if node.value == nil {
+            return nil, true
+        }
+        return interpreter.evaluate(node.value, scope), true
+    case Interp:
+        for _, part := range node.parts {
+            if literal, ok := part.(String); ok {
+                interpreter.output.Write(unescape(literal.value))
+                continue
+            }
+            fmt.Fprint(&interpreter.output, interpreter.evaluate(part, scope))
+        }
+    case Static:
+        // declared before the program runs (see 'Program')
+    case ExceptionHandler:
+        // handlers only run on exceptions, which the
+        // interpreter doesn't raise
+    case Raw, Section:
+        // only about the assembly
+    default:
+        interpreter.evaluate(__node, scope)
+    }
+    return nil, false
+}
+
+// runs a list of statements, stopping at a 'return'
+func (interpreter *Interpreter) execute_all(nodes []interface{}, scope *Scope) (interface{}, bool) {
+    // functions can be called before (and above) their definitions
+    for _, node := range nodes {
+        if _, ok := node.(Function); ok {
+            interpreter.execute(node, scope)
+        }
+    }
+    for _, node := range nodes {
+        if value, returned := interpreter.execute(node, scope); returned {
+            return value, true
+        }
+    }
+    return nil, false
+}
+
+// evaluates an expression
+func (interpreter *Interpreter) evaluate(__node interface{}, scope *Scope) interface{} {
+    switch node := __node.(type) {
+    case Integer:
+        value, err := strconv.ParseInt(node.value, 0, 64)
+        if err != nil {
+            panic(fmt.Sprintf("bad integer '%s'", node.value))
+        }
+        return int32(value)
+    case String:
+        return string(unescape(node.value))
+    case Float:
+        var value float64 = must_parse_float(node.value, 8*int(float_directives[float_type(node)].size))
+        if !node.double {
+            return float32(value)
+        }
+        return value
+    case StringArray:
+        var values []string
+        for _, value := range node.values {
+            values = append(values, string(unescape(value)))
+        }
+        return values
+    case Ident:
+        if value, ok := interpreter.static_values[node.name]; ok {
+            return value
+        }
+        for outer := scope; outer != nil; outer = outer.parent {
+            if value, ok := outer.variables[node.name]; ok {
+                return value
+            }
+        }
+        panic(fmt.Sprintf("undefined variable '%s'", node.name))
+    case ArithmeticOp:
+        op, ok := interpreted_ops[node.op]
+        if !ok {
+            panic(fmt.Sprintf("can't interpret '%s'", node.op))
+        }
+        var left interface{} = interpreter.evaluate(node.left, scope)
+        return op(left.(int32), interpreter.evaluate(node.right, scope).(int32))
+    case VarArg:
+        var index int32 = interpreter.evaluate(node.index, scope).(int32)
+        return scope.args[len(scope.closure.function.params)+int(index)]
+    case Call:
+        return interpreter.call(&node, scope)
+    case Hint:
+        return interpreter.evaluate(node.cond, scope)
+    case Index:
+        var (
+            value interface{} = interpreter.evaluate(node.value, scope)
+            index int32       = interpreter.evaluate(node.index, scope).(int32)
+        )
+        if values, ok := value.([]string); ok {
+            if index < 0 || int(index) >= len(values) {
+                panic(fmt.Sprintf("index %d is out of range for an array of length %d", index, len(values)))
+            }
+            return values[index]
+        }
+        var text string = value.(string) + "\x00"
+        if index < 0 || int(index) >= len(text) {
+            panic(fmt.Sprintf("index %d is out of range for a string of length %d", index, len(text)-1))
+        }
+        return int32(text[index])
+    case Slice:
+        var (
+            text string = interpreter.evaluate(node.value, scope).(string)
+            low  int32  = interpreter.evaluate(node.low, scope).(int32)
+            high int32  = interpreter.evaluate(node.high, scope).(int32)
+        )
+        if low < 0 || high < low || int(high) > len(text) {
+            panic(fmt.Sprintf("slice [%d:%d] is out of range for a string of length %d", low, high, len(text)))
+        }
+        return text[low:high]
+    case Cast:
+        var value interface{} = interpreter.evaluate(node.value, scope)
+        if node.to == "float" {
+            if number, ok := value.(int32); ok {
+                return float32(number)
+            }
+            return value
+        }
+        if number, ok := value.(float32); ok {
+            return convert(truncate_float(number), node.to)
+        }
+        return convert(value.(int32), node.to)
+    }
+    panic(fmt.Sprintf("can't interpret %T", __node))
+}
+
+// returns the function a call refers to, looking through the
+// enclosing functions first (like '__resolve_function')
+func (interpreter *Interpreter) resolve(name string, scope *Scope) (*Closure, bool) {
+    for outer := scope; outer != nil; outer = outer.parent {
+        if closure, ok := outer.functions[name]; ok {
+            return closure, true
+        }
+    }
+    closure, ok := interpreter.functions[name]
+    return closure, ok
+}
+
+// evaluates a call to a builtin or a user function
+func (interpreter *Interpreter) call(node *Call, scope *Scope) interface{} {
+    if closure, ok := interpreter.resolve(node.name, scope); ok {
+        var args []interface{}
+        for _, arg := range node.args {
+            args = append(args, interpreter.evaluate(arg, scope))
+        }
+        var activation *Scope = &Scope{
+            map[string]interface{}{}, map[string]*Closure{}, closure, args, closure.scope}
+        for i, param := range closure.function.params {
+            activation.variables[param] = args[i]
+        }
+        value, _ := interpreter.execute_all(closure.function.body, activation)
+        return value
+    }
+    var int_arg = func(i int) int32 {
+        return interpreter.evaluate(node.args[i], scope).(int32)
+    }
+    switch node.name {
+    case "Printf":
+        interpreter.printf(node, scope)
+        return nil
+    case "stdin", "stdout", "stderr":
+        return Descriptor(map[string]int32{"stdin": 0, "stdout": 1, "stderr": 2}[node.name])
+    case "write":
+        var (
+            fd     Descriptor  = interpreter.evaluate(node.args[0], scope).(Descriptor)
+            buffer interface{} = interpreter.evaluate(node.args[1], scope)
+            length int32       = int_arg(2)
+        )
+        text, ok := buffer.(string)
+        if !ok || fd < 1 || fd > 2 {
+            panic("'write' can only be interpreted for strings written to stdout or stderr")
+        }
+        if int(length) > len(text)+1 {
+            length = int32(len(text) + 1)
+        }
+        // the terminating NUL is part of the data
+        text = (text + "\x00")[:length]
+        if fd == 1 {
+            interpreter.output.WriteString(text)
+        }
+        return length
+    case "rune_at", "next_rune":
+        var (
+            text  []byte = append([]byte(interpreter.evaluate(node.args[0], scope).(string)), 0)
+            index int32  = int_arg(1)
+        )
+        value, size := utf8.DecodeRune(text[index:])
+        if value == utf8.RuneError && size == 1 {
+            // like the runtime routines, stray bytes stand for themselves
+            value = rune(text[index])
+        }
+        if node.name == "next_rune" {
+            return index + int32(size)
+        }
+        return int32(value)
+    case "sizeof", "alignof":
+        // the interpreter models 32-bit registers
+        size, ok := type_size(node.args[0].(String).value, 4)
+        if !ok {
+            panic(fmt.Sprintf("unknown type in '%s'", node.name))
+        }
+        return int32(size)
+    case "__clz":
+        return int32(bits.LeadingZeros32(uint32(int_arg(0))))
+    case "__min", "__max":
+        a, b := int_arg(0), int_arg(1)
+        if (a < b) == (node.name == "__min") {
+            return a
+        }
+        return b
+    case "__abs":
+        if value := int_arg(0); value < 0 {
+            return -value
+        } else {
+            return value
+        }
+    case "AtomicAdd", "CompareAndSwap":
+        var (
+            name string      = node.args[0].(Ident).name
+            old  int32       = int_arg(0)
+            ret  interface{} = old
+        )
+        if node.name == "AtomicAdd" {
+            interpreter.execute(Assignment{name, Integer{fmt.Sprint(old + int_arg(1))}}, scope)
+        } else if ret = bool_to_int(old == int_arg(1)); ret == int32(1) {
+            interpreter.execute(Assignment{name, Integer{fmt.Sprint(int_arg(2))}}, scope)
+        }
+        return ret
+    }
+    panic(fmt.Sprintf("can't interpret a call to '%s'", node.name))
+}
+
+// prints the arguments of 'Printf' (see 'printf' for the verbs)
+func (interpreter *Interpreter) printf(node *Call, scope *Scope) {
+    var (
+        format []byte        = unescape(node.args[0].(String).value)
+        args   []interface{} = node.args[1:]
+    )
+    for i := 0; i < len(format); i++ {
+        if format[i] != '%' {
+            interpreter.output.WriteByte(format[i])
+            continue
+        }
+        i++
+        if format[i] == '%' {
+            interpreter.output.WriteByte('%')
+            continue
+        }
+        var value interface{} = interpreter.evaluate(args[0], scope)
+        args = args[1:]
+        switch format[i] {
+        case 'd':
+            fmt.Fprint(&interpreter.output, value.(int32))
+        case 'c':
+            interpreter.output.WriteByte(byte(value.(int32)))
+        case 's':
+            interpreter.output.WriteString(value.(string))
+        case 'f':
+            if double, ok := value.(float64); ok {
+                interpreter.output.WriteString(mars_float_string(double, 64))
+            } else {
+                interpreter.output.WriteString(mars_float_string(float64(value.(float32)), 32))
+            }
+        }
+    }
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+    "fmt"
+)
+
+// an intrinsic; a function that is expanded into a short
+// instruction sequence wherever the target implements it, and
+// into a call to a runtime library routine everywhere else
+type Intrinsic struct {
+    arity int
+    // the inline expansion for each target; it receives the
+    // registers holding the arguments, and must leave the
+    // result in the first one
+    lower map[string]func(backend *MIPSBackend, args []string)
+    // the runtime library routine to call instead
+    library string
+}
+
+// emits:
+// clz $t0, $t0
+func lower_clz(backend *MIPSBackend, args []string) {
+    backend.__emit_main("clz", args[0], args[0], "")
+}
+
+// emits:
+// slt $t2, $t1, $t0
+// movn $t0, $t1, $t2
+// such that $t0 and $t1 hold the arguments
+func lower_min(backend *MIPSBackend, args []string) {
+    var temp_register string = backend.__temp_register()
+    backend.__emit_main("slt", temp_register, args[1], args[0])
+    backend.__emit_main("movn", args[0], args[1], temp_register)
+    backend.__free(temp_register)
+}
+
+// emits:
+// slt $t2, $t0, $t1
+// movn $t0, $t1, $t2
+// such that $t0 and $t1 hold the arguments
+func lower_max(backend *MIPSBackend, args []string) {
+    var temp_register string = backend.__temp_register()
+    backend.__emit_main("slt", temp_register, args[0], args[1])
+    backend.__emit_main("movn", args[0], args[1], temp_register)
+    backend.__free(temp_register)
+}
+
+// emits:
+// sra $t1, $t0, 31
+// xor $t0, $t0, $t1
+// subu $t0, $t0, $t1
+// such that $t0 holds the argument
+func lower_abs(backend *MIPSBackend, args []string) {
+    var temp_register string = backend.__temp_register()
+    backend.__emit_main("sra", temp_register, args[0], "31")
+    backend.__emit_main("xor", args[0], args[0], temp_register)
+    backend.__emit_main("subu", args[0], args[0], temp_register)
+    backend.__free(temp_register)
+}
+
+// every intrinsic, by name
+var intrinsics = map[string]Intrinsic{
+    "__clz": {1, map[string]func(*MIPSBackend, []string){
+        "mars": lower_clz, "linux": lower_clz, "linux-n32": lower_clz}, "__scg_clz"},
+    "__min": {2, map[string]func(*MIPSBackend, []string){
+        "mars": lower_min, "linux": lower_min, "linux-n32": lower_min}, "__scg_min"},
+    "__max": {2, map[string]func(*MIPSBackend, []string){
+        "mars": lower_max, "linux": lower_max, "linux-n32": lower_max}, "__scg_max"},
+    "__abs": {1, map[string]func(*MIPSBackend, []string){
+        "mars": lower_abs, "linux": lower_abs, "linux-n32": lower_abs}, "__scg_abs"},
+}
+
+// the order the runtime library routines are emitted in
+var runtime_order = []string{
+    "__scg_clz", "__scg_min", "__scg_max", "__scg_abs", "__scg_rune_at", "__scg_next_rune",
+    "__scg_print_int", "__scg_print_char", "__scg_print_string", "__scg_substring",
+}
+
+// the runtime library; every routine takes its arguments in $a0
+// and $a1, returns its result in $v0, and only uses $a0, $a1,
+// $v0, and $v1, so callers don't need to save any temporaries.
+// the printing routines (see '__print') also use $a2 and $a3,
+// which the 'write' syscall takes and returns, and "<write>"
+// stands for its number (see 'runtime_procedure'); the substring
+// routine (see 'slice') takes a third argument in $a2 and uses
+// $a3 too
+var runtime_library = map[string][]Instruction{
+    "__scg_clz": {
+        {"__scg_clz:", []string{}, ""},
+        {"li", []string{"$v0", "32", ""}, ""},
+        {"beq", []string{"$a0", "$0", "__scg_clz_done"}, ""},
+        {"li", []string{"$v0", "0", ""}, ""},
+        {"__scg_clz_loop:", []string{}, ""},
+        {"bltz", []string{"$a0", "__scg_clz_done", ""}, ""},
+        {"sll", []string{"$a0", "$a0", "1"}, ""},
+        {"addiu", []string{"$v0", "$v0", "1"}, ""},
+        {"j", []string{"__scg_clz_loop", "", ""}, ""},
+        {"__scg_clz_done:", []string{}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    "__scg_min": {
+        {"__scg_min:", []string{}, ""},
+        {"move", []string{"$v0", "$a0", ""}, ""},
+        {"slt", []string{"$v1", "$a1", "$a0"}, ""},
+        {"beq", []string{"$v1", "$0", "__scg_min_done"}, ""},
+        {"move", []string{"$v0", "$a1", ""}, ""},
+        {"__scg_min_done:", []string{}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    "__scg_max": {
+        {"__scg_max:", []string{}, ""},
+        {"move", []string{"$v0", "$a0", ""}, ""},
+        {"slt", []string{"$v1", "$a0", "$a1"}, ""},
+        {"beq", []string{"$v1", "$0", "__scg_max_done"}, ""},
+        {"move", []string{"$v0", "$a1", ""}, ""},
+        {"__scg_max_done:", []string{}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    "__scg_abs": {
+        {"__scg_abs:", []string{}, ""},
+        {"move", []string{"$v0", "$a0", ""}, ""},
+        {"bgez", []string{"$a0", "__scg_abs_done", ""}, ""},
+        {"subu", []string{"$v0", "$0", "$a0"}, ""},
+        {"__scg_abs_done:", []string{}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    // see 'rune_op'; $a1 counts the continuation bytes
+    "__scg_rune_at": {
+        {"__scg_rune_at:", []string{}, ""},
+        {"addu", []string{"$a0", "$a0", "$a1"}, ""},
+        {"lbu", []string{"$v0", "0($a0)", ""}, ""},
+        {"sltiu", []string{"$v1", "$v0", "192"}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_rune_at_done"}, ""},
+        {"li", []string{"$a1", "1", ""}, ""},
+        {"sltiu", []string{"$v1", "$v0", "224"}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_rune_at_lead"}, ""},
+        {"li", []string{"$a1", "2", ""}, ""},
+        {"sltiu", []string{"$v1", "$v0", "240"}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_rune_at_lead"}, ""},
+        {"li", []string{"$a1", "3", ""}, ""},
+        {"__scg_rune_at_lead:", []string{}, ""},
+        // the lead byte keeps its low (6 - continuation bytes) bits
+        {"li", []string{"$v1", "64", ""}, ""},
+        {"srlv", []string{"$v1", "$v1", "$a1"}, ""},
+        {"addiu", []string{"$v1", "$v1", "-1"}, ""},
+        {"and", []string{"$v0", "$v0", "$v1"}, ""},
+        {"__scg_rune_at_loop:", []string{}, ""},
+        {"addiu", []string{"$a0", "$a0", "1"}, ""},
+        {"lbu", []string{"$v1", "0($a0)", ""}, ""},
+        {"andi", []string{"$v1", "$v1", "63"}, ""},
+        {"sll", []string{"$v0", "$v0", "6"}, ""},
+        {"or", []string{"$v0", "$v0", "$v1"}, ""},
+        {"addiu", []string{"$a1", "$a1", "-1"}, ""},
+        {"bne", []string{"$a1", "$0", "__scg_rune_at_loop"}, ""},
+        {"__scg_rune_at_done:", []string{}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    "__scg_next_rune": {
+        {"__scg_next_rune:", []string{}, ""},
+        {"addu", []string{"$a0", "$a0", "$a1"}, ""},
+        {"lbu", []string{"$a0", "0($a0)", ""}, ""},
+        {"addiu", []string{"$v0", "$a1", "1"}, ""},
+        {"sltiu", []string{"$v1", "$a0", "192"}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_next_rune_done"}, ""},
+        {"addiu", []string{"$v0", "$a1", "2"}, ""},
+        {"sltiu", []string{"$v1", "$a0", "224"}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_next_rune_done"}, ""},
+        {"addiu", []string{"$v0", "$a1", "3"}, ""},
+        {"sltiu", []string{"$v1", "$a0", "240"}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_next_rune_done"}, ""},
+        {"addiu", []string{"$v0", "$a1", "4"}, ""},
+        {"__scg_next_rune_done:", []string{}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    // the digits are stored backwards from $sp, below which the
+    // caller's frame ends (see '__print'); the absolute value is
+    // divided unsigned, so the smallest int prints too
+    "__scg_print_int": {
+        {"__scg_print_int:", []string{}, ""},
+        {"move", []string{"$a1", "$sp", ""}, ""},
+        {"move", []string{"$v1", "$a0", ""}, ""},
+        {"bgez", []string{"$a0", "__scg_print_int_digits", ""}, ""},
+        {"subu", []string{"$v1", "$0", "$a0"}, ""},
+        {"__scg_print_int_digits:", []string{}, ""},
+        {"li", []string{"$v0", "10", ""}, ""},
+        {"divu", []string{"$v1", "$v0", ""}, ""},
+        {"mflo", []string{"$v1", "", ""}, ""},
+        {"mfhi", []string{"$v0", "", ""}, ""},
+        {"addiu", []string{"$v0", "$v0", "48"}, ""},
+        {"addiu", []string{"$a1", "$a1", "-1"}, ""},
+        {"sb", []string{"$v0", "0($a1)", ""}, ""},
+        {"bne", []string{"$v1", "$0", "__scg_print_int_digits"}, ""},
+        {"bgez", []string{"$a0", "__scg_print_int_write", ""}, ""},
+        {"li", []string{"$v0", "45", ""}, ""},
+        {"addiu", []string{"$a1", "$a1", "-1"}, ""},
+        {"sb", []string{"$v0", "0($a1)", ""}, ""},
+        {"__scg_print_int_write:", []string{}, ""},
+        {"subu", []string{"$a2", "$sp", "$a1"}, ""},
+        {"li", []string{"$a0", "1", ""}, ""},
+        {"li", []string{"$v0", "<write>", ""}, ""},
+        {"syscall", []string{"", "", ""}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    "__scg_print_char": {
+        {"__scg_print_char:", []string{}, ""},
+        {"sb", []string{"$a0", "-1($sp)", ""}, ""},
+        {"addiu", []string{"$a1", "$sp", "-1"}, ""},
+        {"li", []string{"$a2", "1", ""}, ""},
+        {"li", []string{"$a0", "1", ""}, ""},
+        {"li", []string{"$v0", "<write>", ""}, ""},
+        {"syscall", []string{"", "", ""}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    "__scg_print_string": {
+        {"__scg_print_string:", []string{}, ""},
+        {"move", []string{"$a1", "$a0", ""}, ""},
+        {"__scg_print_string_loop:", []string{}, ""},
+        {"lbu", []string{"$v0", "0($a0)", ""}, ""},
+        {"beq", []string{"$v0", "$0", "__scg_print_string_write"}, ""},
+        {"addiu", []string{"$a0", "$a0", "1"}, ""},
+        {"j", []string{"__scg_print_string_loop", "", ""}, ""},
+        {"__scg_print_string_write:", []string{}, ""},
+        {"subu", []string{"$a2", "$a0", "$a1"}, ""},
+        {"li", []string{"$a0", "1", ""}, ""},
+        {"li", []string{"$v0", "<write>", ""}, ""},
+        {"syscall", []string{"", "", ""}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+    // the bytes from $a0+$a1 up to $a0+$a2 are copied to a new
+    // block from 'sbrk', followed by a NUL
+    "__scg_substring": {
+        {"__scg_substring:", []string{}, ""},
+        {"addu", []string{"$a1", "$a0", "$a1"}, ""},
+        {"addu", []string{"$a2", "$a0", "$a2"}, ""},
+        {"subu", []string{"$a0", "$a2", "$a1"}, ""},
+        {"addiu", []string{"$a0", "$a0", "1"}, ""},
+        {"li", []string{"$v0", "<sbrk>", ""}, ""},
+        {"syscall", []string{"", "", ""}, ""},
+        {"move", []string{"$a0", "$v0", ""}, ""},
+        {"__scg_substring_loop:", []string{}, ""},
+        {"beq", []string{"$a1", "$a2", "__scg_substring_done"}, ""},
+        {"lbu", []string{"$a3", "0($a1)", ""}, ""},
+        {"sb", []string{"$a3", "0($a0)", ""}, ""},
+        {"addiu", []string{"$a1", "$a1", "1"}, ""},
+        {"addiu", []string{"$a0", "$a0", "1"}, ""},
+        {"j", []string{"__scg_substring_loop", "", ""}, ""},
+        {"__scg_substring_done:", []string{}, ""},
+        {"sb", []string{"$0", "0($a0)", ""}, ""},
+        {"jr", []string{"$ra", "", ""}, ""},
+    },
+}
+
+// an intrinsic call; converts:
+// __min(a, b)
+// =>
+// <code for a>
+// <code for b>
+// <the target's expansion>
+// or, when the target has no expansion (or the
+// 'library_intrinsics' option is set):
+// <code for a>
+// <code for b>
+// move $a0, $t0
+// move $a1, $t1
+// jal __scg_min
+// move $t2, $v0
+// where the library routine doesn't touch any temporaries,
+// so nothing needs to be spilled (unlike 'user_call')
+func (backend *MIPSBackend) intrinsic(node *Call, intrinsic Intrinsic) {
+    if len(node.args) != intrinsic.arity {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d",
+            node.name, intrinsic.arity, len(node.args)))
+    }
+    for i := range node.args {
+        backend.__expect_type(node, i, "int")
+    }
+    lower, ok := intrinsic.lower[backend.options.target]
+    if ok && !backend.options.library_intrinsics {
+        for _, arg := range node.args {
+            backend.codegen(arg)
+        }
+        var args []string = backend.__pop_n(intrinsic.arity)
+        lower(backend, args)
+        backend.__free(args[1:]...)
+        backend.stack.push(args[0])
+        return
+    }
+    backend.__load_args(node.args)
+    // 'jal' overwrites $ra, which the caller needs to return
+    backend.__save_ra()
+    backend.__emit_local_call(intrinsic.library)
+    backend.runtime_used[intrinsic.library] = true
+    backend.__push_result("$v0")
+}
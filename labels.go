@@ -0,0 +1,49 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// matches the names that can be labels
+var valid_label *regexp.Regexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// panics unless a template for the labels of strings (see the
+// 'string_labels' option) numbers them, and gives valid labels
+func check_label_template(template string) {
+    if !strings.Contains(template, "<n>") {
+        panic(fmt.Sprintf("the string label template '%s' has to contain <n>", template))
+    }
+    var sample string = strings.NewReplacer("<func>", "main", "<n>", "1").Replace(template)
+    if !valid_label.MatchString(sample) {
+        panic(fmt.Sprintf("the string label template '%s' gives invalid labels (e.g. '%s')", template, sample))
+    }
+}
+
+// returns the label of the next string literal; converts:
+// "str_<func>_<n>"
+// =>
+// str_main_1, str_main_2, str_f_1
+// such that the third string is the first one f emitted (see
+// '__data_owner'). with "<func>", every procedure numbers its own
+// strings from 1, so that editing one doesn't renumber the strings
+// of the others (which keeps diffs and golden files small); without
+// it, the strings are numbered along with the rest of the data
+// (e.g. "float2", see '__pool_constant'), as with the default
+// template, "string<n>"
+func (backend *MIPSBackend) __string_label() string {
+    var template string = backend.options.string_labels
+    if template == "" {
+        template = "string<n>"
+    }
+    if !strings.Contains(template, "<func>") {
+        var label string = strings.ReplaceAll(template, "<n>", fmt.Sprint(backend.data_temp_name))
+        backend.data_temp_name++
+        return label
+    }
+    // e.g. "exception handler"
+    var owner string = strings.ReplaceAll(backend.__data_owner(), " ", "_")
+    backend.string_counts[owner]++
+    return strings.NewReplacer("<func>", owner, "<n>", fmt.Sprint(backend.string_counts[owner])).Replace(template)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+    "regexp"
+    "strings"
+    "testing"
+)
+
+// string labels follow the template; with <func> every procedure
+// numbers its own strings, so adding one to 'f' leaves main's labels
+// as they were, while the other templates number them all in order.
+// generating a program again always gives the same labels
+func Test_string_labels(t *testing.T) {
+    var (
+        printed = func(text string) Call { return Call{"Printf", []interface{}{String{text}}} }
+        // 'f' with an extra string at its start, or not
+        program = func(edited bool) Program {
+            var body []interface{} = []interface{}{printed("b"), printed("c"), Return{Integer{"0"}}}
+            if edited {
+                body = append([]interface{}{printed("new")}, body...)
+            }
+            return Program{[]interface{}{Function{"f", nil, body, false}, printed("a"), ExprStmt{Call{"f", nil}}, printed("d")}}
+        }
+        label = regexp.MustCompile(`(?m)^\s*(\S+): \.asciiz "(.*)"$`)
+    )
+    var cases = map[string]struct {
+        template string
+        // each label and its string, before and after the edit
+        expected, edited []string
+    }{
+        "default": {"",
+            []string{"string1 b", "string2 c", "string3 a", "string4 d"},
+            []string{"string1 new", "string2 b", "string3 c", "string4 a", "string5 d"}},
+        "numbered": {"s<n>_x",
+            []string{"s1_x b", "s2_x c", "s3_x a", "s4_x d"},
+            []string{"s1_x new", "s2_x b", "s3_x c", "s4_x a", "s5_x d"}},
+        "by function": {"str_<func>_<n>",
+            []string{"str_f_1 b", "str_f_2 c", "str_main_1 a", "str_main_2 d"},
+            []string{"str_f_1 new", "str_f_2 b", "str_f_3 c", "str_main_1 a", "str_main_2 d"}},
+    }
+    for name, test := range cases {
+        for i, expected := range [][]string{test.expected, test.edited} {
+            var options BackendOptions = default_backend_options()
+            options.string_labels = test.template
+            var (
+                first  MIPSBackend = new_mips_backend_with(program(i == 1), options)
+                second MIPSBackend = new_mips_backend_with(program(i == 1), options)
+                code   string      = first.assemble()
+                labels []string
+            )
+            for _, match := range label.FindAllStringSubmatch(code, -1) {
+                labels = append(labels, match[1]+" "+match[2])
+            }
+            if strings.Join(labels, "\n") != strings.Join(expected, "\n") {
+                t.Errorf("%s (edited: %t): the strings are labeled\n%s\nexpected\n%s", name, i == 1,
+                    strings.Join(labels, "\n"), strings.Join(expected, "\n"))
+            }
+            if code != second.assemble() {
+                t.Errorf("%s (edited: %t): generating the program twice gave different code", name, i == 1)
+            }
+        }
+    }
+    for template, expected := range map[string]string{
+        "str":         "the string label template 'str' has to contain <n>",
+        "9_<n>":       "the string label template '9_<n>' gives invalid labels (e.g. '9_1')",
+        "s-<func><n>": "the string label template 's-<func><n>' gives invalid labels (e.g. 's-main1')",
+    } {
+        var options BackendOptions = default_backend_options()
+        options.string_labels = template
+        if recovered, _ := recovered_from(func() { blank_mips_backend(options) }).(string); recovered != expected {
+            t.Errorf("%q panicked with %q, expected %q", template, recovered, expected)
+        }
+    }
+}
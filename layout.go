@@ -0,0 +1,237 @@
+package main
+
+import (
+    "strings"
+)
+
+// the opposite of each conditional branch; branch-likely
+// instructions become ordinary branches, since the branch
+// they're inverted into is the unlikely one
+var inverted_branches = map[string]string{
+    "beq": "bne", "bne": "beq", "blez": "bgtz", "bgtz": "blez", "bltz": "bgez", "bgez": "bltz",
+    "beql": "bne", "bnel": "beq",
+}
+
+// a basic block of a procedure being laid out
+type LayoutBlock struct {
+    // the labels the block starts with (maybe none)
+    labels       []string
+    instructions []Instruction
+}
+
+// returns the instruction that ends a block, or nil if the
+// block just falls through into the next one
+func (block *LayoutBlock) last() *Instruction {
+    if len(block.instructions) == 0 {
+        return nil
+    }
+    var instruction *Instruction = &block.instructions[len(block.instructions)-1]
+    if instruction.opcode == "j" || instruction.opcode == "jr" || instruction.opcode == "eret" ||
+        inverted_branches[instruction.opcode] != "" {
+        return instruction
+    }
+    return nil
+}
+
+// returns true if control can reach the next block from the end of
+// this one; jumps and returns (e.g. 'j $31') don't fall through
+func (block *LayoutBlock) falls_through() bool {
+    var last *Instruction = block.last()
+    return last == nil || inverted_branches[last.opcode] != ""
+}
+
+// returns the label a block branches or jumps to, or "" if it
+// doesn't (returns jump to a register)
+func (block *LayoutBlock) target() string {
+    var last *Instruction = block.last()
+    if last == nil || last.opcode == "jr" || last.opcode == "eret" {
+        return ""
+    }
+    var args []string = operands(*last)
+    if strings.HasPrefix(args[len(args)-1], "$") {
+        return ""
+    }
+    return args[len(args)-1]
+}
+
+// splits a procedure into basic blocks; calls don't end a block,
+// since they come back to the instruction after them
+func split_blocks(instructions []Instruction) []LayoutBlock {
+    var blocks []LayoutBlock = []LayoutBlock{{}}
+    for _, instruction := range instructions {
+        var current *LayoutBlock = &blocks[len(blocks)-1]
+        if strings.HasSuffix(instruction.opcode, ":") {
+            if len(current.instructions) != 0 {
+                blocks = append(blocks, LayoutBlock{})
+                current = &blocks[len(blocks)-1]
+            }
+            current.labels = append(current.labels, strings.TrimSuffix(instruction.opcode, ":"))
+            continue
+        }
+        current.instructions = append(current.instructions, instruction)
+        if current.last() != nil {
+            blocks = append(blocks, LayoutBlock{})
+        }
+    }
+    if len(blocks) > 1 && len(blocks[len(blocks)-1].labels) == 0 {
+        // the one added after the last branch
+        blocks = blocks[:len(blocks)-1]
+    }
+    return blocks
+}
+
+// returns the instructions of a list of blocks, in order
+func join_blocks(blocks []LayoutBlock) (ret []Instruction) {
+    for _, block := range blocks {
+        for _, label := range block.labels {
+            ret = append(ret, Instruction{label + ":", []string{}, ""})
+        }
+        ret = append(ret, block.instructions...)
+    }
+    return
+}
+
+// returns the index of every block by its labels
+func block_indices(blocks []LayoutBlock) map[string]int {
+    var indices map[string]int = map[string]int{}
+    for i, block := range blocks {
+        for _, label := range block.labels {
+            indices[label] = i
+        }
+    }
+    return indices
+}
+
+// returns the block that most likely runs after the i-th one, or -1
+// for returns and jumps out of the procedure; jumps always go to their
+// target, and conditional branches are assumed not to be taken (the
+// code for likely outcomes comes first, see 'if_statement'), unless
+// they are branch-likely instructions
+func likely_successor(blocks []LayoutBlock, indices map[string]int, i int) int {
+    var last *Instruction = blocks[i].last()
+    if last == nil || (inverted_branches[last.opcode] != "" && last.opcode != "beql" && last.opcode != "bnel") {
+        if i+1 < len(blocks) {
+            return i + 1
+        }
+        return -1
+    }
+    if target, ok := indices[blocks[i].target()]; ok {
+        return target
+    }
+    return -1
+}
+
+// returns the number of branches taken on the likely path through
+// a procedure (from its first block, following 'likely_successor'),
+// which is what 'layout_blocks' tries to reduce
+func taken_branches(blocks []LayoutBlock) (taken int) {
+    var (
+        indices map[string]int = block_indices(blocks)
+        visited map[int]bool   = map[int]bool{}
+    )
+    for i := 0; i != -1 && !visited[i] && len(blocks) != 0; i = likely_successor(blocks, indices, i) {
+        visited[i] = true
+        if blocks[i].target() != "" && likely_successor(blocks, indices, i) != i+1 {
+            taken++
+        }
+    }
+    return
+}
+
+// orders the blocks of a procedure so that each one is followed by
+// its likely successor (see 'likely_successor'), which turns jumps
+// on the likely path into fall-throughs; converts:
+// beq $t0, $0, else1
+// <then>
+// j endif2
+// else1:
+// <else>
+// endif2:
+// <rest>
+// =>
+// beq $t0, $0, else1
+// <then>
+// endif2:
+// <rest>
+// else1:
+// <else>
+// j endif2
+// the first block stays first, branches are inverted when their
+// fall-through block has to move, and jumps are added when a block
+// can no longer fall through
+func (backend *MIPSBackend) layout_blocks(instructions []Instruction) []Instruction {
+    var (
+        blocks  []LayoutBlock  = split_blocks(instructions)
+        indices map[string]int = block_indices(blocks)
+        placed  map[int]bool   = map[int]bool{}
+        order   []int
+    )
+    // chains of likely successors, starting with the first block
+    for start := range blocks {
+        for i := start; i != -1 && !placed[i]; i = likely_successor(blocks, indices, i) {
+            placed[i] = true
+            order = append(order, i)
+        }
+    }
+    var ret []LayoutBlock
+    for position, i := range order {
+        var (
+            block LayoutBlock = blocks[i]
+            next  int         = -1
+        )
+        block.instructions = append([]Instruction{}, block.instructions...)
+        if position+1 < len(order) {
+            next = order[position+1]
+        }
+        var (
+            last       *Instruction = block.last()
+            target, ok              = indices[block.target()]
+        )
+        switch {
+        case ok && target == next && last.opcode == "j":
+            // the jump became a fall-through
+            block.instructions = block.instructions[:len(block.instructions)-1]
+        case !block.falls_through() || i+1 >= len(blocks) || i+1 == next:
+        case ok && target == next:
+            // branch to the block that used to follow instead
+            var args []string = last.args
+            args[len(operands(*last))-1] = backend.__block_label(&blocks[i+1])
+            var opcode string = last.opcode
+            *last = Instruction{inverted_branches[opcode], args, ""}
+            backend.comment(last, "inverted from "+opcode)
+        default:
+            block.instructions = append(block.instructions,
+                Instruction{"j", []string{backend.__block_label(&blocks[i+1]), "", ""}, ""})
+        }
+        ret = append(ret, block)
+    }
+    // the labels added by '__block_label' go on the blocks that were copied
+    for position, i := range order {
+        ret[position].labels = blocks[i].labels
+    }
+    return join_blocks(ret)
+}
+
+// returns a label of a block, giving it one if it doesn't have any
+func (backend *MIPSBackend) __block_label(block *LayoutBlock) string {
+    if len(block.labels) == 0 {
+        block.labels = append(block.labels, backend.__new_label("block"))
+    }
+    return block.labels[0]
+}
+
+// lays out main and every user function (the runtime library is
+// already laid out by hand), recording how many branches were taken
+// on the likely paths before; each procedure's code ends up in its
+// body, so this runs after everything else has been added
+func (backend *MIPSBackend) layout_procedures() {
+    var procedures []*Procedure = []*Procedure{&backend.main_procedure}
+    for i := range backend.procedures {
+        procedures = append(procedures, &backend.procedures[i])
+    }
+    for _, procedure := range procedures {
+        var instructions []Instruction = procedure.instructions()[1:]
+        backend.taken_before_layout += taken_branches(split_blocks(instructions))
+        procedure.prologue, procedure.body, procedure.epilogue = nil, backend.layout_blocks(instructions), nil
+    }
+}
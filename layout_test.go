@@ -0,0 +1,68 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// returns a statement that adds to r when cond holds (with a hint
+// of how likely it is), and adds something else when it doesn't
+func hinted(cond interface{}, likely bool, then string, otherwise string) If {
+    var add = func(value string) []interface{} {
+        return []interface{}{Assignment{"r", ArithmeticOp{Ident{"r"}, "addu", Integer{value}}}}
+    }
+    return If{Hint{cond, likely}, add(then), add(otherwise)}
+}
+
+// laying out blocks (and inverting the branch-likely instructions
+// that skip unlikely code) doesn't change what the program prints,
+// whichever way each branch goes
+func Test_layout_branch_likely(t *testing.T) {
+    var (
+        x        Ident = Ident{"x"}
+        classify       = Function{"classify", []string{"x"}, []interface{}{
+            Assignment{"r", Integer{"0"}},
+            If{Hint{ArithmeticOp{x, "slt", Integer{"0"}}, false}, []interface{}{
+                hinted(ArithmeticOp{x, "slt", Integer{"-10"}}, false, "1000", "100"),
+            }, []interface{}{
+                hinted(ArithmeticOp{x, "slt", Integer{"5"}}, true, "1", "2"),
+                hinted(ArithmeticOp{Integer{"50"}, "slt", x}, false, "30", "0"),
+            }},
+            If{Hint{ArithmeticOp{x, "and", Integer{"1"}}, false}, []interface{}{
+                Assignment{"r", ArithmeticOp{Ident{"r"}, "xor", Integer{"64"}}},
+            }, nil},
+            If{Hint{ArithmeticOp{x, "xor", Integer{"7"}}, true}, nil, []interface{}{Return{Integer{"-7"}}}},
+            Return{Ident{"r"}},
+        }, false}
+        program Program = Program{[]interface{}{classify}}
+    )
+    for _, x := range []string{"-20", "-10", "-3", "0", "1", "4", "5", "7", "51", "100"} {
+        program.nodes = append(program.nodes, Call{"Printf", []interface{}{
+            String{x + ": %d\\n"}, Call{"classify", []interface{}{Integer{x}}}}})
+    }
+    for _, target := range []string{"linux", "linux-n32"} {
+        for _, optimize := range []int{0, 2} {
+            var (
+                options BackendOptions = default_backend_options()
+                args    []string       = []string{"-target", target, "-fbranch-likely"}
+            )
+            if optimize == 2 {
+                args = append(args, "-O2")
+            }
+            flag_options(args...)(&options)
+            var name string = fmt.Sprintf("%s -O%d", target, optimize)
+            if err := check_on_target(program, options); err != nil {
+                t.Errorf("%s: %v", name, err)
+            }
+            // the branches over unlikely code are branch-likely ones
+            // until the layout inverts them
+            var backend MIPSBackend = new_mips_backend_with(program, options)
+            var code string = backend.assemble()
+            if inverted := strings.Contains(code, "inverted from beql"); !strings.Contains(code, "beql") && !inverted ||
+                inverted != (optimize == 2) {
+                t.Errorf("%s: the branch-likely instructions weren't laid out as expected:\n%s", name, code)
+            }
+        }
+    }
+}
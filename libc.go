@@ -0,0 +1,103 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+)
+
+// a function of the C library, which programs linked with libc
+// can call (see 'c_call')
+type CFunction struct {
+    // the types of its parameters ("int" or "string"; pointers are
+    // ints), and whether it takes more arguments after them
+    params   []string
+    variadic bool
+    // the type of its result, or "void"
+    result string
+}
+
+// the C functions programs can call when the 'libc' option is on;
+// user functions with the same names take precedence
+var libc_functions = map[string]CFunction{
+    "printf":  {[]string{"string"}, true, "int"},
+    "puts":    {[]string{"string"}, false, "int"},
+    "putchar": {[]string{"int"}, false, "int"},
+    "getchar": {[]string{}, false, "int"},
+    "strlen":  {[]string{"string"}, false, "int"},
+    "strcmp":  {[]string{"string", "string"}, false, "int"},
+    "atoi":    {[]string{"string"}, false, "int"},
+    "abs":     {[]string{"int"}, false, "int"},
+    "malloc":  {[]string{"int"}, false, "int"},
+    "calloc":  {[]string{"int", "int"}, false, "int"},
+    "free":    {[]string{"int"}, false, "void"},
+    "rand":    {[]string{}, false, "int"},
+    "srand":   {[]string{"int"}, false, "void"},
+    "exit":    {[]string{"int"}, false, "void"},
+}
+
+// returns the C function a call refers to, if the program is
+// linked with libc
+func (backend *MIPSBackend) __c_function(name string) (CFunction, bool) {
+    if !backend.options.libc {
+        return CFunction{}, false
+    }
+    function, ok := libc_functions[name]
+    return function, ok
+}
+
+// a call to a C function; converts:
+// printf("%d %s\n", a, s)
+// =>
+// <code for the arguments>
+// move $a0, $t0
+// move $a1, $t1
+// move $a2, $t2
+// addiu $sp, $sp, -16
+// la $t9, printf
+// jalr $t9
+// addiu $sp, $sp, 16
+// move $t3, $v0
+// such that the arguments are passed as for a user function (see
+// 'user_call'), with the convention's own layout even when the
+// function is variadic (the callee saves the register arguments
+// itself), and $sp aligned as the ABI asks; the function is
+// declared with '.extern' (see 'assemble_mapped')
+func (backend *MIPSBackend) c_call(node *Call, function CFunction) {
+    if len(node.args) < len(function.params) || (!function.variadic && len(node.args) > len(function.params)) {
+        var expected string = fmt.Sprint(len(function.params))
+        if function.variadic {
+            expected = "at least " + expected
+        }
+        panic(fmt.Sprintf("'%s' expects %s argument(s), got %d", node.name, expected, len(node.args)))
+    }
+    for i := range node.args {
+        if i < len(function.params) {
+            backend.__expect_type(node, i, function.params[i])
+        } else {
+            backend.__expect_type(node, i, "int", "string")
+        }
+    }
+    backend.c_used[node.name] = true
+    backend.__call(node.args, node.name, &Function{node.name, nil, nil, false}, true)
+    if function.result != "void" {
+        backend.__push_result(backend.target.convention.return_registers[0])
+    }
+}
+
+// returns the '.extern' directives for the C functions the program
+// calls, in a stable order; converts:
+// printf, malloc
+// =>
+// .extern malloc
+// .extern printf
+func (backend *MIPSBackend) __c_externs() (ret string) {
+    var names []string
+    for name := range backend.c_used {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        ret += fmt.Sprintf(".extern %s\n", name)
+    }
+    return
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+)
+
+// returns a listing of the program as it would be laid out by
+// 'assemble_binary', like 'objdump -d'; for example:
+// main:
+//     00400000:  afbffffc  sw $ra,-4($sp)
+//     00400004:  3c0a0001  lui $t2,1          # li $t2,100000
+//     00400008:  354a86a0  ori $t2,$t2,34464
+// every word is shown with the real instruction it encodes, and
+// pseudo-instructions are shown next to their first word. the
+// data section follows, one word per line
+func (backend *MIPSBackend) assemble_listing() string {
+    var (
+        image  Image               = backend.link_image(backend.options.binary_base)
+        labels map[uint32][]string = map[uint32][]string{}
+        ret    string
+    )
+    for label, address := range image.labels {
+        labels[address] = append(labels[address], label)
+    }
+    // several labels can share an address (e.g. an empty 'else')
+    var emit_labels = func(address uint32) {
+        sort.Strings(labels[address])
+        for _, label := range labels[address] {
+            ret += fmt.Sprintf("%s:\n", label)
+        }
+        delete(labels, address)
+    }
+    for _, encoded := range image.text {
+        emit_labels(encoded.address)
+        for i, word := range encoded.words {
+            var text string = render_instruction(encoded.expansion[i])
+            if word == 0 {
+                // the delay slots filled in by 'expand'
+                text = "nop"
+            }
+            var line string = fmt.Sprintf("    %08x:  %08x  %s", encoded.address+uint32(4*i), word, text)
+            // show what a pseudo-instruction expanded to
+            if i == 0 && text != render_instruction(encoded.source) {
+                line = fmt.Sprintf("%-44s# %s", line, render_instruction(encoded.source))
+            }
+            ret += line + "\n"
+        }
+    }
+    if len(image.data) == 0 {
+        return ret
+    }
+    ret += "\n.data\n"
+    // lines end at word boundaries and before labels (strings
+    // aren't aligned)
+    for offset := 0; offset < len(image.data); {
+        var address uint32 = image.data_address + uint32(offset)
+        emit_labels(address)
+        var end int = offset + 1
+        for end < len(image.data) && end%4 != 0 && len(labels[image.data_address+uint32(end)]) == 0 {
+            end++
+        }
+        ret += fmt.Sprintf("    %08x:  % x\n", address, image.data[offset:end])
+        offset = end
+    }
+    return ret
+}
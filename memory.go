@@ -0,0 +1,272 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// 'memcpy' and 'memset' copy (or fill) at most this many bytes
+// without a loop
+const max_unrolled_bytes = 64
+
+// how many times the word loops of 'memcpy' and 'memset' are
+// unrolled at -O2 (see 'unroll_factor'), and at most
+const (
+    default_unroll_factor = 4
+    max_unroll_factor     = 16
+)
+
+// memcpy(dst, src, n)
+// memset(dst, value, n)
+// copy n bytes from src to dst, or set n bytes of dst to
+// value (its low byte); a word at a time when the addresses are
+// word-aligned, then a byte at a time for what's left, or a byte
+// at a time throughout when they aren't (e.g. strings, which are
+// laid out back to back). converts:
+// memcpy(a, b, n)
+// =>
+// <code for a, b, and n>
+// or $t3, $t0, $t1
+// andi $t3, $t3, 3
+// bne $t3, $0, memcpy2
+// sltiu $t3, $t2, 4
+// bne $t3, $0, memcpy2
+// memcpy1:
+// lw $t4, 0($t1)
+// sw $t4, 0($t0)
+// addiu $t0, $t0, 4
+// addiu $t1, $t1, 4
+// addiu $t2, $t2, -4
+// sltiu $t3, $t2, 4
+// beq $t3, $0, memcpy1
+// memcpy2:
+// beq $t2, $0, memcpy3
+// lbu $t4, 0($t1)
+// sb $t4, 0($t0)
+// addiu $t0, $t0, 1
+// addiu $t1, $t1, 1
+// addiu $t2, $t2, -1
+// j memcpy2
+// memcpy3:
+// such that $t0, $t1, and $t2 are a's, b's, and n's registers; when
+// n is an integer (up to 'max_unrolled_bytes'), the aligned case is
+// unrolled, and the other one keeps the byte loop:
+// memcpy(a, b, 6)
+// =>
+// <code for a and b>
+// or $t3, $t0, $t1
+// andi $t3, $t3, 3
+// beq $t3, $0, memcpy2
+// li $t3, 6
+// memcpy1:
+// lbu $t2, 0($t1)
+// sb $t2, 0($t0)
+// addiu $t0, $t0, 1
+// addiu $t1, $t1, 1
+// addiu $t3, $t3, -1
+// bne $t3, $0, memcpy1
+// j memcpy3
+// memcpy2:
+// lw $t2, 0($t1)
+// sw $t2, 0($t0)
+// lbu $t2, 4($t1)
+// sb $t2, 4($t0)
+// lbu $t2, 5($t1)
+// sb $t2, 5($t0)
+// memcpy3:
+// (fewer than 4 bytes are copied a byte at a time, with no check.)
+// with a variable n, the 'unroll_factor' option (or -O2) copies
+// several words in each pass of another word loop, ahead of the
+// first form's, which copies what's left:
+// bne $t3, $0, memcpy2
+// sltiu $t3, $t2, 8
+// bne $t3, $0, memcpy5
+// memcpy4:
+// lw $t4, 0($t1)
+// sw $t4, 0($t0)
+// lw $t4, 4($t1)
+// sw $t4, 4($t0)
+// addiu $t0, $t0, 8
+// addiu $t1, $t1, 8
+// addiu $t2, $t2, -8
+// sltiu $t3, $t2, 8
+// beq $t3, $0, memcpy4
+// memcpy5:
+// sltiu $t3, $t2, 4
+// bne $t3, $0, memcpy2
+// memcpy1:
+// ...
+// for a factor of 2.
+// 'memset' stores the value (with its byte copied into every byte
+// of the word) instead of loading anything, and only checks dst's
+// alignment
+func (backend *MIPSBackend) memory_op(node *Call) {
+    if len(node.args) != 3 {
+        panic(fmt.Sprintf("'%s' expects 3 argument(s), got %d", node.name, len(node.args)))
+    }
+    backend.__expect_type(node, 0, "string", "int")
+    if node.name == "memcpy" {
+        backend.__expect_type(node, 1, "string", "int")
+    } else {
+        backend.__expect_type(node, 1, "int")
+    }
+    backend.__expect_type(node, 2, "int")
+    var (
+        args []interface{} = node.args
+        size int64         = -1
+    )
+    if integer, ok := backend.__fold_size(node.args[2]).(Integer); ok {
+        if value, err := strconv.ParseInt(integer.value, 0, 64); err == nil && value >= 0 && value <= max_unrolled_bytes {
+            args, size = args[:2], value
+        }
+    }
+    if integer, ok := args[1].(Integer); ok && node.name == "memset" {
+        // replicate the byte at compile time
+        if value, err := strconv.ParseInt(integer.value, 0, 64); err == nil {
+            args = append([]interface{}{args[0], Integer{fmt.Sprint((value & 0xff) * 0x01010101)}}, args[2:]...)
+        }
+    }
+    for _, arg := range args {
+        backend.codegen(arg)
+    }
+    var (
+        registers []string = backend.__pop_n(len(args))
+        data      string   = registers[1]
+        // the registers that are free again once it's done
+        used []string = registers
+    )
+    if node.name == "memcpy" {
+        data = backend.__temp_register()
+        used = append(used, data)
+    } else if _, ok := args[1].(Integer); !ok {
+        backend.__replicate_byte(data)
+    }
+    // copies (or sets) the bytes at 'offset' from the addresses
+    var copy = func(load string, store string, offset int64) {
+        if node.name == "memcpy" {
+            backend.__emit_main(load, data, fmt.Sprintf("%d(%s)", offset, registers[1]), "")
+        }
+        backend.__emit_main(store, data, fmt.Sprintf("%d(%s)", offset, registers[0]), "")
+    }
+    // moves the addresses (and the count) past what was copied
+    var advance = func(count string, step int) {
+        backend.__emit_main("addiu", registers[0], registers[0], fmt.Sprint(step))
+        if node.name == "memcpy" {
+            backend.__emit_main("addiu", registers[1], registers[1], fmt.Sprint(step))
+        }
+        backend.__emit_main("addiu", count, count, fmt.Sprint(-step))
+    }
+    if size != -1 {
+        if size < 4 {
+            for offset := int64(0); offset < size; offset++ {
+                copy("lbu", "sb", offset)
+            }
+            backend.__free(used...)
+            return
+        }
+        var (
+            count   string = backend.__temp_register()
+            bytes   string = backend.__new_label(node.name)
+            aligned string = backend.__new_label(node.name)
+            done    string = backend.__new_label(node.name)
+        )
+        backend.__check_alignment(node.name, registers, count)
+        backend.__emit_main("beq", count, "$0", aligned)
+        backend.__emit_main("li", count, fmt.Sprint(size), "")
+        backend.__emit_label(bytes)
+        copy("lbu", "sb", 0)
+        advance(count, 1)
+        backend.__emit_main("bne", count, "$0", bytes)
+        backend.__emit_main("j", done, "", "")
+        backend.__emit_label(aligned)
+        for offset := int64(0); offset+4 <= size; offset += 4 {
+            copy("lw", "sw", offset)
+        }
+        for offset := size &^ 3; offset < size; offset++ {
+            copy("lbu", "sb", offset)
+        }
+        backend.__emit_label(done)
+        backend.__free(append(used, count)...)
+        return
+    }
+    var (
+        count string = registers[2]
+        small string = backend.__temp_register()
+        words string = backend.__new_label(node.name)
+        bytes string = backend.__new_label(node.name)
+        done  string = backend.__new_label(node.name)
+    )
+    backend.__check_alignment(node.name, registers, small)
+    backend.__emit_main("bne", small, "$0", bytes)
+    if factor := backend.__unroll_factor(); factor > 1 {
+        var (
+            unrolled string = backend.__new_label(node.name)
+            rest     string = backend.__new_label(node.name)
+            step     int    = 4 * factor
+        )
+        backend.__emit_main("sltiu", small, count, fmt.Sprint(step))
+        backend.__emit_main("bne", small, "$0", rest)
+        backend.__emit_label(unrolled)
+        for offset := 0; offset < step; offset += 4 {
+            copy("lw", "sw", int64(offset))
+        }
+        advance(count, step)
+        backend.__emit_main("sltiu", small, count, fmt.Sprint(step))
+        backend.__emit_main("beq", small, "$0", unrolled)
+        backend.__emit_label(rest)
+    }
+    backend.__emit_main("sltiu", small, count, "4")
+    backend.__emit_main("bne", small, "$0", bytes)
+    backend.__emit_label(words)
+    copy("lw", "sw", 0)
+    advance(count, 4)
+    backend.__emit_main("sltiu", small, count, "4")
+    backend.__emit_main("beq", small, "$0", words)
+    backend.__emit_label(bytes)
+    backend.__emit_main("beq", count, "$0", done)
+    copy("lbu", "sb", 0)
+    advance(count, 1)
+    backend.__emit_main("j", bytes, "", "")
+    backend.__emit_label(done)
+    backend.__free(append(used, small)...)
+}
+
+// returns how many words each pass of a word loop copies (see
+// 'unroll_factor')
+func (backend *MIPSBackend) __unroll_factor() int {
+    if backend.options.unroll_factor == 0 && backend.options.optimize >= 2 {
+        return default_unroll_factor
+    }
+    return max(backend.options.unroll_factor, 1)
+}
+
+// sets a register to the low two bits of the addresses 'memcpy' (or
+// 'memset') works on, which are 0 when it can copy a word at a time;
+// emits:
+// or $t3, $t0, $t1
+// andi $t3, $t3, 3
+// (just the 'andi', on dst's register, for 'memset')
+func (backend *MIPSBackend) __check_alignment(name string, registers []string, result string) {
+    var address string = registers[0]
+    if name == "memcpy" {
+        backend.__emit_main("or", result, registers[0], registers[1])
+        address = result
+    }
+    backend.__emit_main("andi", result, address, "3")
+}
+
+// copies the low byte of a register into every byte of it; emits:
+// andi $t0, $t0, 255
+// sll $t1, $t0, 8
+// or $t0, $t0, $t1
+// sll $t1, $t0, 16
+// or $t0, $t0, $t1
+func (backend *MIPSBackend) __replicate_byte(register string) {
+    var temp_register string = backend.__temp_register()
+    backend.__emit_main("andi", register, register, "255")
+    backend.__emit_main("sll", temp_register, register, "8")
+    backend.__emit_main("or", register, register, temp_register)
+    backend.__emit_main("sll", temp_register, register, "16")
+    backend.__emit_main("or", register, register, temp_register)
+    backend.__free(temp_register)
+}
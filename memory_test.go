@@ -0,0 +1,127 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// 'memcpy' and 'memset' work on strings at any offset, word-aligned
+// or not, whether they're unrolled (a constant size) or loop (a
+// variable one)
+func Test_unaligned_memory(t *testing.T) {
+    const dst, src string = "abcdefghijklmnop", "ABCDEFGHIJKLMNOP"
+    var (
+        sizes = map[int]interface{}{2: Integer{"2"}, 6: Integer{"6"}, 9: Ident{"n"}}
+        at    = func(name string, offset int) interface{} {
+            return ArithmeticOp{Ident{name}, "add", Integer{fmt.Sprint(offset)}}
+        }
+    )
+    for to := 0; to < 4; to++ {
+        for from := 0; from < 4; from++ {
+            for count, n := range sizes {
+                var (
+                    copied string = dst[:to] + src[from:from+count] + dst[to+count:]
+                    filled string = dst[:to] + strings.Repeat("x", count) + dst[to+count:]
+                )
+                var program Program = Program{[]interface{}{
+                    Assignment{"a", String{dst}},
+                    Assignment{"b", String{src}},
+                    Assignment{"c", String{dst}},
+                    Assignment{"n", Integer{"9"}},
+                    Call{"memcpy", []interface{}{at("a", to), at("b", from), n}},
+                    Call{"memset", []interface{}{at("c", to), Integer{"120"}, n}},
+                    Call{"Printf", []interface{}{String{"%s %s\\n"}, Ident{"a"}, Ident{"c"}}},
+                }}
+                var expected string = copied + " " + filled + "\n"
+                stdout, status, err := run_with_emulator(program, default_backend_options())
+                if err != nil || status != 0 || stdout != expected {
+                    t.Errorf("%d bytes from offset %d to offset %d: printed %q and exited with %d (%v), expected %q",
+                        count, from, to, stdout, status, err, expected)
+                }
+            }
+        }
+    }
+}
+
+// an unrolled 'memcpy' (a constant size, up to 'max_unrolled_bytes')
+// copies the same bytes as the loop a variable size runs
+func Test_unrolled_memory(t *testing.T) {
+    var source string = strings.Repeat("0123456789", 7)
+    for size := 0; size <= max_unrolled_bytes+1; size++ {
+        var outputs []string
+        for _, n := range []interface{}{Integer{fmt.Sprint(size)}, Ident{"n"}} {
+            var program Program = Program{[]interface{}{
+                Assignment{"a", String{strings.Repeat(".", len(source))}},
+                Assignment{"n", Integer{fmt.Sprint(size)}},
+                Call{"memcpy", []interface{}{Ident{"a"}, String{source}, n}},
+                Call{"Printf", []interface{}{String{"%s\\n"}, Ident{"a"}}},
+            }}
+            stdout, _, err := run_with_emulator(program, default_backend_options())
+            if err != nil {
+                t.Fatalf("copying %d bytes: %v", size, err)
+            }
+            outputs = append(outputs, stdout)
+        }
+        if expected := source[:size] + strings.Repeat(".", len(source)-size) + "\n"; outputs[0] != expected || outputs[1] != expected {
+            t.Errorf("copying %d bytes printed %q unrolled and %q in a loop, expected %q", size, outputs[0], outputs[1], expected)
+        }
+    }
+}
+
+// unrolling the word loops (see 'unroll_factor') copies and sets the
+// same bytes as the loops that copy a word at a time, for sizes on
+// either side of a pass, and each pass copies 'factor' words
+func Test_unroll_factor(t *testing.T) {
+    const dst, src string = "abcdefghijklmnopqrstuvwxyz0123456789", "ABCDEFGHIJKLMNOPQRSTUVWXYZ)!@#$%^&*("
+    var program = func(size int) Program {
+        return Program{[]interface{}{
+            Assignment{"n", Integer{fmt.Sprint(size)}},
+            Call{"memcpy", []interface{}{String{dst}, String{src}, Ident{"n"}}},
+            Assignment{"a", String{dst}},
+            Assignment{"c", String{dst}},
+            Call{"memcpy", []interface{}{Ident{"a"}, String{src}, Ident{"n"}}},
+            Call{"memset", []interface{}{Ident{"c"}, Integer{"120"}, Ident{"n"}}},
+            Call{"Printf", []interface{}{String{"%s %s\\n"}, Ident{"a"}, Ident{"c"}}},
+        }}
+    }
+    for _, args := range [][]string{{"-funroll-loops=1"}, {"-funroll-loops=2"}, {"-O2"}, {"-O2", "-funroll-loops=3"}} {
+        var options BackendOptions = default_backend_options()
+        flag_options(args...)(&options)
+        for size := 0; size <= 32; size++ {
+            var expected string = src[:size] + dst[size:] + " " + strings.Repeat("x", size) + dst[size:] + "\n"
+            stdout, status, err := run_with_emulator(program(size), options)
+            if err != nil || status != 0 || stdout != expected {
+                t.Errorf("%s, %d bytes: printed %q and exited with %d (%v), expected %q", args, size, stdout, status, err, expected)
+            }
+        }
+        // a pass of the unrolled loops loads (for 'memcpy') and stores
+        // 'factor' words, next to the loops that do one
+        var (
+            factor  int            = options.unroll_factor
+            backend MIPSBackend    = new_mips_backend_with(program(8), options)
+            counts  map[string]int = map[string]int{}
+        )
+        if factor == 0 {
+            factor = default_unroll_factor
+        }
+        for _, instruction := range backend.main_procedure.body {
+            if (instruction.opcode == "lw" || instruction.opcode == "sw") && !strings.Contains(instruction.args[1], "$sp") {
+                counts[instruction.opcode]++
+            }
+        }
+        var words int = 1
+        if factor > 1 {
+            words += factor
+        }
+        if counts["lw"] != 2*words || counts["sw"] != 3*words {
+            t.Errorf("%s: %d lw and %d sw, expected %d and %d", args, counts["lw"], counts["sw"], 2*words, 3*words)
+        }
+    }
+    for _, factor := range []string{"0", "17", "x"} {
+        var options BackendOptions = default_backend_options()
+        if recovered_from(func() { flag_options("-funroll-loops=" + factor)(&options) }) == nil {
+            t.Errorf("-funroll-loops=%s was accepted", factor)
+        }
+    }
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// the registers the 16-bit microMIPS instructions can encode
+// in their 3-bit fields
+var micromips_registers = map[uint32]bool{2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 16: true, 17: true}
+
+// the immediates 'addiur2' can encode
+var addiur2_immediates = map[int64]bool{1: true, 4: true, 8: true, 12: true, 16: true, 20: true, 24: true, -1: true}
+
+// the size (in bytes) of the code laid out by 'assemble_binary'
+// for MIPS32 and for microMIPS, which has 16-bit forms of common
+// instructions; shows which instructions get in the way of the
+// shorter encodings. it's only an estimate: the code is always
+// generated (and encoded) as MIPS32, and there's no microMIPS or
+// MIPS16e mode. one would need the 16-bit encodings, 'jalx' to call
+// MIPS32 code such as libc, and temporaries in the registers those
+// encodings can name, which are the argument and return registers
+// ($2-$7) and callee-saved ones ($16, $17) here
+type SizeReport struct {
+    mips32    int
+    micromips int
+    // how many of each opcode got a 16-bit encoding, and
+    // how many didn't
+    short map[string]int
+    long  map[string]int
+}
+
+// returns the number of bytes microMIPS needs for a real
+// instruction (as produced by 'expand'); 'delay_slot' is true
+// for the 'nop' after a branch or jump
+func micromips_size(instruction Instruction, delay_slot bool, previous Instruction) int {
+    var (
+        args   []string = operands(instruction)
+        subset          = func(i int) bool { return micromips_registers[register_number(args[i])] }
+        imm             = func(i int) int64 { value, _ := parse_immediate(args[i]); return value }
+        memory          = func() (int64, uint32) {
+            offset, base, _ := split_memory(args[1])
+            value, _ := parse_immediate(offset)
+            return value, register_number(base)
+        }
+    )
+    if delay_slot {
+        // 'jr' becomes the compact 'jrc', which has no delay
+        // slot; the others get a 16-bit 'nop'
+        if previous.opcode == "jr" {
+            return 0
+        }
+        return 2
+    }
+    switch instruction.opcode {
+    case "jr", "jalr", "mflo", "mfhi":
+        return 2
+    case "addu":
+        // 'move' is 'addu $d, $s, $zero', and 'move16' takes any register
+        if args[2] == "$zero" || args[2] == "$0" {
+            return 2
+        }
+        if subset(0) && subset(1) && subset(2) {
+            return 2
+        }
+    case "subu":
+        if subset(0) && subset(1) && subset(2) {
+            return 2
+        }
+    case "and", "or", "xor":
+        if args[0] == args[1] && subset(0) && subset(2) {
+            return 2
+        }
+    case "addiu":
+        var value int64 = imm(2)
+        switch {
+        case args[1] == "$zero" && subset(0) && value >= -1 && value <= 126:
+            // 'li16'
+            return 2
+        case args[0] == "$sp" && args[1] == "$sp" && value%4 == 0 && value >= -1032 && value <= 1028:
+            // 'addiusp'
+            return 2
+        case args[0] == args[1] && value >= -8 && value <= 7:
+            // 'addius5'
+            return 2
+        case subset(0) && subset(1) && addiur2_immediates[value]:
+            return 2
+        }
+    case "sll", "srl":
+        if subset(0) && subset(1) && imm(2) >= 1 && imm(2) <= 8 {
+            return 2
+        }
+    case "lw", "sw":
+        offset, base := memory()
+        // 'lwsp'/'swsp' only take positive offsets from $sp
+        if base == 29 && offset >= 0 && offset <= 124 && offset%4 == 0 {
+            return 2
+        }
+        if micromips_registers[base] && subset(0) && offset >= 0 && offset <= 60 && offset%4 == 0 {
+            return 2
+        }
+    case "beq", "bne":
+        // 'beqz16'/'bnez16' (assuming the target is in range)
+        if (args[1] == "$zero" || args[1] == "$0") && subset(0) {
+            return 2
+        }
+    }
+    return 4
+}
+
+// returns the size of the program in MIPS32 and in microMIPS
+func (backend *MIPSBackend) code_size_report() SizeReport {
+    var (
+        image  Image      = backend.link_image(backend.options.binary_base)
+        report SizeReport = SizeReport{0, 0, map[string]int{}, map[string]int{}}
+    )
+    for _, encoded := range image.text {
+        for i, instruction := range encoded.expansion {
+            report.mips32 += 4
+            var delay_slot bool = i > 0 && opcode_table[encoded.expansion[i-1].opcode].delay_slot
+            var previous Instruction
+            if delay_slot {
+                previous = encoded.expansion[i-1]
+            }
+            var size int = micromips_size(instruction, delay_slot, previous)
+            report.micromips += size
+            var opcode string = instruction.opcode
+            if delay_slot {
+                opcode = "nop"
+            }
+            if size == 0 {
+                opcode = "nop (dropped)"
+            }
+            if size == 4 {
+                report.long[opcode]++
+            } else {
+                report.short[opcode]++
+            }
+        }
+    }
+    var data int = len(image.data)
+    report.mips32 += data
+    report.micromips += data
+    return report
+}
+
+func (report SizeReport) String() string {
+    var ret string = fmt.Sprintf("MIPS32:    %d bytes\nmicroMIPS: %d bytes (%.1f%%, estimated)\n",
+        report.mips32, report.micromips, 100*float64(report.micromips)/float64(report.mips32))
+    var format = func(counts map[string]int) string {
+        var items []string
+        for opcode, count := range counts {
+            items = append(items, fmt.Sprintf("%s %d", opcode, count))
+        }
+        sort.Strings(items)
+        return strings.Join(items, ", ")
+    }
+    ret += fmt.Sprintf("16-bit: %s\n32-bit: %s\n", format(report.short), format(report.long))
+    return ret
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "fmt"
+)
+
+// the MARS keyboard (receiver) MMIO registers
+const (
+    keyboard_control uint32 = 0xffff0000
+    keyboard_data    uint32 = 0xffff0004
+)
+
+// set_pixel(x, y, color)
+// key_ready() => int
+// read_key() => int
+// converts:
+// set_pixel(x, y, color)
+// =>
+// <code for x>
+// <code for y>
+// <code for color>
+// li $t3, 64
+// mul $t3, $t1, $t3
+// addu $t3, $t3, $t0
+// sll $t3, $t3, 2
+// li $t4, 0x10040000
+// addu $t3, $t3, $t4
+// sw $t2, 0($t3)
+// such that 64 is the width of the bitmap display (in units)
+// and 0x10040000 is its base address; 'key_ready' returns 1 when
+// a key is waiting in the keyboard MMIO data register, and
+// 'read_key' returns that key
+func (backend *MIPSBackend) mmio(node *Call) {
+    var arity int = 0
+    if node.name == "set_pixel" {
+        arity = 3
+    }
+    if len(node.args) != arity {
+        panic(fmt.Sprintf("'%s' expects %d argument(s), got %d", node.name, arity, len(node.args)))
+    }
+    if backend.options.target != "mars" {
+        panic(fmt.Sprintf("'%s' is only available on target 'mars'", node.name))
+    }
+    switch node.name {
+    case "set_pixel":
+        for i := range node.args {
+            backend.__expect_type(node, i, "int")
+            backend.codegen(node.args[i])
+        }
+        var (
+            registers        []string = backend.__pop_n(3)
+            address_register string   = backend.__temp_register()
+            base_register    string   = backend.__temp_register()
+        )
+        backend.__emit_main("li", address_register, fmt.Sprint(backend.options.bitmap_width), "")
+        backend.__emit_main("mul", address_register, registers[1], address_register)
+        backend.__emit_main("addu", address_register, address_register, registers[0])
+        // each unit is one word
+        backend.__emit_main("sll", address_register, address_register, "2")
+        backend.__emit_main("li", base_register, fmt.Sprintf("0x%08x", backend.options.bitmap_base), "")
+        backend.__emit_main("addu", address_register, address_register, base_register)
+        backend.__emit_main("sw", registers[2], fmt.Sprintf("0(%s)", address_register), "")
+        backend.__free(append(registers, address_register, base_register)...)
+    case "key_ready":
+        var temp_register string = backend.__temp_register()
+        backend.__emit_main("li", temp_register, fmt.Sprintf("0x%08x", keyboard_control), "")
+        backend.__emit_main("lw", temp_register, fmt.Sprintf("0(%s)", temp_register), "")
+        // the ready bit is the lowest bit of the control register
+        backend.__emit_main("andi", temp_register, temp_register, "1")
+        backend.stack.push(temp_register)
+    case "read_key":
+        var temp_register string = backend.__temp_register()
+        backend.__emit_main("li", temp_register, fmt.Sprintf("0x%08x", keyboard_data), "")
+        backend.__emit_main("lw", temp_register, fmt.Sprintf("0(%s)", temp_register), "")
+        backend.stack.push(temp_register)
+    }
+}
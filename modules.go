@@ -0,0 +1,224 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// a compilation unit; one module (the entry) may have top-level
+// statements, which become main, while every other module can
+// only define functions
+type Module struct {
+    name    string
+    program Program
+    // the functions other modules can call; nil exports every
+    // function, and the rest stay local to the module
+    exports []string
+}
+
+// a function imported from another module
+type Extern struct {
+    label    string
+    function Function
+}
+
+// returns the label for a function of a module; converts:
+// module, name
+// =>
+// module.name
+// so that modules can use the same names for their own
+// functions without clashing
+func mangle(module string, name string) string {
+    if module == "" {
+        return name
+    }
+    return module + "." + name
+}
+
+// returns true if other modules can call 'name'
+func (module *Module) exported(name string) bool {
+    if module.exports == nil {
+        return true
+    }
+    for _, export := range module.exports {
+        if export == name {
+            return true
+        }
+    }
+    return false
+}
+
+// returns true if a module has any top-level statements
+// (function, enum, and static declarations aren't statements)
+func has_statements(module *Module) bool {
+    for _, node := range module.program.nodes {
+        _, function := node.(Function)
+        _, enum := node.(Enum)
+        _, static := node.(Static)
+        if !function && !enum && !static {
+            return true
+        }
+    }
+    return false
+}
+
+// returns every function the modules export by name, panicking if
+// two modules export the same one, or export one they don't define
+func collect_exports(modules []Module) map[string]Extern {
+    var (
+        exports map[string]Extern = map[string]Extern{}
+        owners  map[string]string = map[string]string{}
+    )
+    for _, module := range modules {
+        var defined map[string]bool = map[string]bool{}
+        for _, node := range module.program.nodes {
+            function, ok := node.(Function)
+            if !ok {
+                continue
+            }
+            defined[function.name] = true
+            if !module.exported(function.name) {
+                continue
+            }
+            if owner, ok := owners[function.name]; ok {
+                panic(fmt.Sprintf("function '%s' is exported by both '%s' and '%s'",
+                    function.name, owner, module.name))
+            }
+            exports[function.name] = Extern{mangle(module.name, function.name), function}
+            owners[function.name] = module.name
+        }
+        for _, export := range module.exports {
+            if !defined[export] {
+                panic(fmt.Sprintf("module '%s' exports undefined function '%s'", module.name, export))
+            }
+        }
+    }
+    return exports
+}
+
+// returns the functions 'module' can import; everything the other
+// modules export, except for names it defines itself
+func imports_for(module *Module, exports map[string]Extern) map[string]Extern {
+    var imports map[string]Extern = map[string]Extern{}
+    for name, extern := range exports {
+        if extern.label != mangle(module.name, name) {
+            imports[name] = extern
+        }
+    }
+    return imports
+}
+
+// returns the index of the entry module (or -1 if there
+// isn't one), panicking if there is more than one
+func find_entry(modules []Module) int {
+    var entry int = -1
+    for i := range modules {
+        if !has_statements(&modules[i]) {
+            continue
+        }
+        if entry != -1 {
+            panic(fmt.Sprintf("both '%s' and '%s' have top-level statements",
+                modules[entry].name, modules[i].name))
+        }
+        entry = i
+    }
+    return entry
+}
+
+// compiles every module on its own, returning the assembly for each
+// one by file name ("<module>.s"); exported functions are marked with
+// '.globl', and calls to functions in other modules are left for the
+// assembler/linker to resolve (e.g. MARS with "assemble all files in
+// directory", or 'as' and 'ld')
+func compile_modules(modules []Module, options BackendOptions) map[string]string {
+    var (
+        exports map[string]Extern = collect_exports(modules)
+        entry   int               = find_entry(modules)
+        ret     map[string]string = map[string]string{}
+    )
+    for i, module := range modules {
+        var module_options BackendOptions = options
+        module_options.module = module.name
+        module_options.externs = imports_for(&module, exports)
+        // other modules call the exported functions
+        module_options.whole_program = false
+        var backend MIPSBackend = new_mips_backend_with(module.program, module_options)
+        ret[module.name+".s"] = backend.assemble_module(&module, i == entry)
+    }
+    return ret
+}
+
+// returns the assembly for a single module; the entry module
+// keeps main, and every other one only has its functions
+func (backend *MIPSBackend) assemble_module(module *Module, entry bool) string {
+    var globals string
+    if entry {
+        globals += "    .globl main\n"
+    }
+    for _, node := range module.program.nodes {
+        if function, ok := node.(Function); ok && module.exported(function.name) {
+            globals += fmt.Sprintf("    .globl %s\n", mangle(module.name, function.name))
+        }
+    }
+    if entry {
+        return strings.Replace(backend.assemble(), ".text\n", ".text\n"+globals, 1)
+    }
+    var code string = fmt.Sprintf(".data\n%s\n.text\n%s", backend.__data_sections(), globals)
+    code += backend.__raw_text("main")
+    var section string
+    for _, procedure := range backend.text_procedures(false) {
+        if next := backend.procedure_sections[procedure.label]; next != section {
+            code += backend.__switch_section(section, next)
+            section = next
+        }
+        code += render_instructions(procedure.instructions())
+    }
+    if section == "" {
+        code += backend.__raw_text("end")
+    }
+    return code
+}
+
+// the single-unit alternative to 'compile_modules'; generates every
+// module into one program (the other modules first, so that their
+// functions are defined before the entry calls them)
+func link_modules(modules []Module, options BackendOptions) string {
+    var (
+        exports map[string]Extern = collect_exports(modules)
+        entry   int               = find_entry(modules)
+        order   []int
+    )
+    for i := range modules {
+        if i != entry {
+            order = append(order, i)
+        }
+    }
+    if entry != -1 {
+        order = append(order, entry)
+    }
+    var backend MIPSBackend = blank_mips_backend(options)
+    if entry == -1 {
+        // without main, every function is there for other code
+        backend.options.whole_program = false
+    }
+    var (
+        report *TimeReport = options.time_report
+        code   string
+    )
+    for _, i := range order {
+        var ast interface{}
+        backend.options.module = modules[i].name
+        backend.options.externs = imports_for(&modules[i], exports)
+        report.time("analysis", func() {
+            ast = lower(modules[i].program, &backend.diagnostics)
+        })
+        report.time("codegen", func() {
+            backend.codegen(ast)
+        })
+    }
+    backend.__finish_main()
+    report.time("assembly", func() {
+        code = backend.assemble()
+    })
+    return code
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// two modules that both define 'helper'; 'lib' only exports 'f',
+// which 'app' calls
+var two_modules = []Module{
+    {"lib", Program{[]interface{}{
+        Function{"helper", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "add", Integer{"10"}}}}, false},
+        Function{"f", []string{"x"}, []interface{}{
+            Return{ArithmeticOp{Call{"helper", []interface{}{Ident{"x"}}}, "add", Integer{"1"}}},
+        }, false},
+    }}, []string{"f"}},
+    {"app", Program{[]interface{}{
+        Function{"helper", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "mul", Integer{"2"}}}}, false},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Call{"f", []interface{}{Call{"helper", []interface{}{Integer{"3"}}}}}}},
+    }}, nil},
+}
+
+// each module's functions are named after it, so that both can have
+// a 'helper'; only the exports are global, and calls to another
+// module's functions use its names
+func Test_module_names(t *testing.T) {
+    var files map[string]string = compile_modules(two_modules, default_backend_options())
+    var cases = map[string]struct {
+        present []string
+        absent  []string
+    }{
+        "lib.s": {[]string{".globl lib.f", "lib.f:", "lib.helper:", "jal lib.helper"},
+            []string{".globl lib.helper", "main:", "app."}},
+        "app.s": {[]string{".globl main", ".globl app.helper", "app.helper:", "jal app.helper", "jal lib.f"},
+            []string{"lib.helper", "lib.f:"}},
+    }
+    for name, test := range cases {
+        var lines []string = code_lines(files[name])
+        var has = func(text string) bool {
+            for _, line := range lines {
+                if strings.Contains(line, text) {
+                    return true
+                }
+            }
+            return false
+        }
+        for _, text := range test.present {
+            if !has(text) {
+                t.Errorf("%s has no %q:\n%s", name, text, files[name])
+            }
+        }
+        for _, text := range test.absent {
+            if has(text) {
+                t.Errorf("%s has %q:\n%s", name, text, files[name])
+            }
+        }
+    }
+    if len(files) != 2 {
+        t.Errorf("the modules were compiled into %d file(s)", len(files))
+    }
+}
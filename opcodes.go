@@ -0,0 +1,184 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// what the backend knows about an opcode
+type OpcodeInfo struct {
+    // the kinds of its operands, in the order they're written
+    // (see 'operand_kinds'); opcodes that can be written with
+    // different operands have each form, separated by '|'
+    operands string
+    // true if its first operand is read rather than written
+    reads_first bool
+    // whether it reads or writes the HI and LO registers
+    reads_hi_lo  bool
+    writes_hi_lo bool
+    // the cycles it takes beyond the one every instruction takes,
+    // on a simple in-order pipeline; loads stall the next
+    // instruction, and HI/LO results take a while
+    latency int
+    // true if it's followed by a delay slot, and if it ends
+    // a basic block
+    delay_slot bool
+    ends_block bool
+    // "load" or "store" if it reads or writes memory through its
+    // memory operand ('sc' is a store), or ""
+    memory string
+}
+
+// what each letter of 'OpcodeInfo.operands' stands for
+var operand_kinds = map[byte]string{
+    'r': "a register",
+    'c': "a coprocessor 0 register",
+    'f': "a floating-point register",
+    'i': "an immediate",
+    'm': "a memory operand (e.g. '4($sp)', or a label)",
+    'l': "a label",
+}
+
+// every opcode the backend emits, including the pseudo-instructions
+// 'expand' (or the assembler) turns into real ones
+var opcode_table = map[string]OpcodeInfo{
+    // arithmetic and logic
+    "add":   {"rrr", false, false, false, 0, false, false, ""},
+    "addu":  {"rrr", false, false, false, 0, false, false, ""},
+    "sub":   {"rrr", false, false, false, 0, false, false, ""},
+    "subu":  {"rrr", false, false, false, 0, false, false, ""},
+    "and":   {"rrr", false, false, false, 0, false, false, ""},
+    "or":    {"rrr", false, false, false, 0, false, false, ""},
+    "xor":   {"rrr", false, false, false, 0, false, false, ""},
+    "nor":   {"rrr", false, false, false, 0, false, false, ""},
+    "slt":   {"rrr", false, false, false, 0, false, false, ""},
+    "sltu":  {"rrr", false, false, false, 0, false, false, ""},
+    "sllv":  {"rrr", false, false, false, 0, false, false, ""},
+    "srlv":  {"rrr", false, false, false, 0, false, false, ""},
+    "srav":  {"rrr", false, false, false, 0, false, false, ""},
+    "movn":  {"rrr", false, false, false, 0, false, false, ""},
+    "movz":  {"rrr", false, false, false, 0, false, false, ""},
+    "sll":   {"rri", false, false, false, 0, false, false, ""},
+    "srl":   {"rri", false, false, false, 0, false, false, ""},
+    "sra":   {"rri", false, false, false, 0, false, false, ""},
+    "addi":  {"rri", false, false, false, 0, false, false, ""},
+    "addiu": {"rri", false, false, false, 0, false, false, ""},
+    "slti":  {"rri", false, false, false, 0, false, false, ""},
+    "sltiu": {"rri", false, false, false, 0, false, false, ""},
+    "andi":  {"rri", false, false, false, 0, false, false, ""},
+    "ori":   {"rri", false, false, false, 0, false, false, ""},
+    "xori":  {"rri", false, false, false, 0, false, false, ""},
+    "lui":   {"ri", false, false, false, 0, false, false, ""},
+    "clz":   {"rr", false, false, false, 0, false, false, ""},
+    "seb":   {"rr", false, false, false, 0, false, false, ""},
+    "seh":   {"rr", false, false, false, 0, false, false, ""},
+    // multiplication and division; 'mul' leaves HI and LO
+    // unpredictable, and 'div' with three operands is a
+    // pseudo-instruction that reads LO afterwards
+    "mul":   {"rrr", false, false, true, 4, false, false, ""},
+    "mult":  {"rr", true, false, true, 4, false, false, ""},
+    "multu": {"rr", true, false, true, 4, false, false, ""},
+    "div":   {"rr|rrr", false, false, true, 34, false, false, ""},
+    "divu":  {"rr", true, false, true, 34, false, false, ""},
+    "mfhi":  {"r", false, true, false, 0, false, false, ""},
+    "mflo":  {"r", false, true, false, 0, false, false, ""},
+    // loads and stores
+    "lw":  {"rm", false, false, false, 1, false, false, "load"},
+    "lh":  {"rm", false, false, false, 1, false, false, "load"},
+    "lhu": {"rm", false, false, false, 1, false, false, "load"},
+    "lb":  {"rm", false, false, false, 1, false, false, "load"},
+    "lbu": {"rm", false, false, false, 1, false, false, "load"},
+    "ll":  {"rm", false, false, false, 1, false, false, "load"},
+    "sw":  {"rm", true, false, false, 0, false, false, "store"},
+    "sh":  {"rm", true, false, false, 0, false, false, "store"},
+    "sb":  {"rm", true, false, false, 0, false, false, "store"},
+    // 'sc' writes whether it succeeded into its register
+    "sc": {"rm", false, false, false, 0, false, false, "store"},
+    // loads into the floating-point unit (coprocessor 1); 'ldc1'
+    // loads an even register and the one after it
+    "lwc1": {"fm", false, false, false, 1, false, false, "load"},
+    "ldc1": {"fm", false, false, false, 1, false, false, "load"},
+    // moves between the integer registers and the floating-point
+    // unit, and conversions between words and singles there
+    "mtc1":      {"rf", true, false, false, 0, false, false, ""},
+    "mfc1":      {"rf", false, false, false, 1, false, false, ""},
+    "cvt.s.w":   {"ff", false, false, false, 3, false, false, ""},
+    "trunc.w.s": {"ff", false, false, false, 3, false, false, ""},
+    // branches and jumps ('j $31' is accepted as 'jr $31')
+    "beq":  {"rrl", true, false, false, 0, true, true, ""},
+    "bne":  {"rrl", true, false, false, 0, true, true, ""},
+    "beql": {"rrl", true, false, false, 0, true, true, ""},
+    "bnel": {"rrl", true, false, false, 0, true, true, ""},
+    "blez": {"rl", true, false, false, 0, true, true, ""},
+    "bgtz": {"rl", true, false, false, 0, true, true, ""},
+    "bltz": {"rl", true, false, false, 0, true, true, ""},
+    "bgez": {"rl", true, false, false, 0, true, true, ""},
+    "j":    {"l|r", false, false, false, 0, true, true, ""},
+    "jal":  {"l", false, false, false, 0, true, true, ""},
+    "bal":  {"l", false, false, false, 0, true, true, ""},
+    "jr":   {"r", true, false, false, 0, true, true, ""},
+    "jalr": {"r", true, false, false, 0, true, true, ""},
+    // the system
+    "syscall": {"", false, false, false, 0, false, false, ""},
+    "eret":    {"", false, false, false, 0, false, true, ""},
+    "mfc0":    {"rc", false, false, false, 0, false, false, ""},
+    "mtc0":    {"rc", true, false, false, 0, false, false, ""},
+    // pseudo-instructions
+    "move": {"rr", false, false, false, 0, false, false, ""},
+    "li":   {"ri", false, false, false, 0, false, false, ""},
+    "la":   {"rl", false, false, false, 0, false, false, ""},
+    "nop":  {"", false, false, false, 0, false, false, ""},
+}
+
+// returns true if an operand can be of the given kind; registers
+// (including coprocessor ones) start with '$', and nothing else
+// does, since the rest are written in so many ways (e.g. '0x10',
+// '%lo(label)', or 'label+4')
+func operand_matches(kind byte, operand string) bool {
+    return strings.HasPrefix(operand, "$") == (kind == 'r' || kind == 'c' || kind == 'f')
+}
+
+// panics if the backend emits an instruction whose opcode isn't in
+// 'opcode_table', or whose operands don't match any of the opcode's
+// forms; labels and directives aren't checked. converts:
+// Instruction{"lw", []string{"4($sp)", "$t0", ""}}
+// =>
+// panic("'lw' takes a register and a memory operand (...), not '4($sp)', '$t0'")
+func check_operands(instruction Instruction) {
+    if strings.HasSuffix(instruction.opcode, ":") || strings.HasPrefix(instruction.opcode, ".") {
+        return
+    }
+    info, ok := opcode_table[instruction.opcode]
+    if !ok {
+        panic(fmt.Sprintf("unknown opcode '%s'", instruction.opcode))
+    }
+    var args []string = operands(instruction)
+    for _, form := range strings.Split(info.operands, "|") {
+        if len(form) != len(args) {
+            continue
+        }
+        var matches bool = true
+        for i := range args {
+            matches = matches && operand_matches(form[i], args[i])
+        }
+        if matches {
+            return
+        }
+    }
+    var kinds []string = []string{"no operands"}
+    if form := strings.Split(info.operands, "|")[0]; form != "" {
+        kinds = nil
+        for i := range form {
+            kinds = append(kinds, operand_kinds[form[i]])
+        }
+    }
+    var written []string
+    for _, arg := range args {
+        written = append(written, fmt.Sprintf("'%s'", arg))
+    }
+    var takes string = strings.Join(kinds, " and ")
+    if len(kinds) > 2 {
+        takes = strings.Join(kinds[:len(kinds)-1], ", ") + ", and " + kinds[len(kinds)-1]
+    }
+    panic(fmt.Sprintf("'%s' takes %s, not %s", instruction.opcode, takes, strings.Join(written, ", ")))
+}
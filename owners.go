@@ -0,0 +1,145 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// the owner of the data the exception handler emits, which isn't
+// a procedure of the text section
+const handler_owner string = "exception handler"
+
+// returns the procedure the data emitted now belongs to: the
+// function being generated, main, or the exception handler
+func (backend *MIPSBackend) __data_owner() string {
+    switch {
+    case backend.in_handler:
+        return handler_owner
+    case backend.current_function != "":
+        return backend.current_function
+    }
+    return "main"
+}
+
+// records who a line of a data section belongs to (see
+// '__data_owner'), if it has a label; statics belong to no
+// procedure (the owner is "")
+func (backend *MIPSBackend) __own_data(data string) {
+    if label, ok := data_label(data); ok {
+        backend.data_owners[label] = backend.__data_owner()
+    }
+}
+
+// returns the label a line of a data section defines, if any
+func data_label(line string) (string, bool) {
+    line = strings.TrimSpace(line)
+    if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ".") {
+        return "", false
+    }
+    label, _, ok := strings.Cut(line, ":")
+    return label, ok
+}
+
+// returns a data section with its entries grouped by their owners
+// (in the order each owner first emitted something), under a
+// comment naming the owner; converts:
+// string1: .asciiz "a"
+// string2: .asciiz "b"
+// string3: .asciiz "c"
+// =>
+// # main
+// string1: .asciiz "a"
+// string3: .asciiz "c"
+// # f
+// string2: .asciiz "b"
+// such that f emitted string2; lines without a label (e.g. '.align')
+// stay with the entry after them
+func (backend *MIPSBackend) __group_data(section string) string {
+    return backend.__merge_groups([]string{section}, []string{""})
+}
+
+// returns the owners of a data section's entries (in the order each
+// first emitted something), their entries, and the lines after the
+// last entry; old headers are dropped
+func (backend *MIPSBackend) __split_groups(section string) ([]string, map[string]string, string) {
+    var (
+        owners  []string
+        groups  map[string]string = map[string]string{}
+        pending string
+    )
+    for _, line := range strings.SplitAfter(section, "\n") {
+        if strings.HasPrefix(strings.TrimSpace(line), "#") {
+            // an old header
+            continue
+        }
+        label, ok := data_label(line)
+        if !ok {
+            pending += line
+            continue
+        }
+        var owner string = backend.data_owners[label]
+        if _, seen := groups[owner]; !seen {
+            owners = append(owners, owner)
+        }
+        groups[owner] += pending + line
+        pending = ""
+    }
+    return owners, groups, pending
+}
+
+// returns data sections that share a section of the target grouped
+// by owner together, with one header per owner; each owner's entries
+// from a section follow the section's prefix; converts:
+// # main
+// string1: .asciiz "a"
+// and
+// # main
+// __static_a: .space 4
+// with the prefixes "" and ".align 2" =>
+// # main
+// string1: .asciiz "a"
+// .align 2
+// __static_a: .space 4
+func (backend *MIPSBackend) __merge_groups(sections []string, prefixes []string) string {
+    var (
+        owners   []string
+        groups   []map[string]string
+        seen     map[string]bool = map[string]bool{}
+        trailing string
+    )
+    for i, section := range sections {
+        section_owners, section_groups, pending := backend.__split_groups(section)
+        for _, owner := range section_owners {
+            if !seen[owner] {
+                seen[owner] = true
+                owners = append(owners, owner)
+            }
+        }
+        groups = append(groups, section_groups)
+        if pending != "" {
+            trailing += prefixes[i] + pending
+        }
+    }
+    var merged string
+    for _, owner := range owners {
+        var header string = owner
+        if owner == "" {
+            header = "statics"
+        }
+        merged += fmt.Sprintf("    # %s\n", header)
+        for i, section_groups := range groups {
+            if group, ok := section_groups[owner]; ok {
+                merged += prefixes[i] + group
+            }
+        }
+    }
+    return merged + trailing
+}
+
+// groups every data section by owner (see '__group_data'), once
+// they're finished
+func (backend *MIPSBackend) group_data() {
+    for _, section := range []*string{&backend.data_section, &backend.rodata_section, &backend.bss_section} {
+        *section = backend.__group_data(*section)
+    }
+}
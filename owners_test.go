@@ -0,0 +1,41 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// on MARS, the read-only data and the bss go in the data section
+// (see '__data_sections'), and each owner still has one header there
+func Test_one_header_per_owner(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Static{"counter", "int", "1"},
+        Static{"total", "int", ""},
+        Function{"f", []string{"a"}, []interface{}{
+            Assignment{"s", String{"f"}},
+            Call{"Printf", []interface{}{String{"%s %d\\n"}, Ident{"s"}, Ident{"a"}}},
+        }, false},
+        Assignment{"s", String{"main"}},
+        Call{"Printf", []interface{}{String{"%s\\n"}, Ident{"s"}}},
+        ExprStmt{Call{"f", []interface{}{Integer{"1"}}}},
+    }}
+    var (
+        backend MIPSBackend    = new_mips_backend(program)
+        data    string         = backend.__data_sections()
+        headers map[string]int = map[string]int{}
+    )
+    for _, line := range strings.Split(data, "\n") {
+        if header, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok {
+            headers[header]++
+        }
+    }
+    for _, owner := range []string{"main", "f", "statics"} {
+        if headers[owner] != 1 {
+            t.Errorf("'%s' has %d headers in:\n%s", owner, headers[owner], data)
+        }
+    }
+    var bss_entry string = "__static_total: .space 4"
+    if before, _, _ := strings.Cut(data, bss_entry); !strings.HasSuffix(strings.TrimRight(before, " "), ".align 2\n") {
+        t.Errorf("'%s' isn't aligned in:\n%s", bss_entry, data)
+    }
+}
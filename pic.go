@@ -0,0 +1,102 @@
+package main
+
+import (
+    "fmt"
+)
+
+// the directives that start position-independent code
+const pic_header string = ".abicalls\n.option pic2\n"
+
+// emits:
+// la $t0, string1
+// or, for position-independent code:
+// lw $t0, %got(string1)($gp)
+// addiu $t0, $t0, %lo(string1)
+// such that the address is looked up in the GOT ($gp
+// points to it), since data labels are local
+func (backend *MIPSBackend) __emit_address(register string, label string) {
+    if !backend.options.pic {
+        backend.__emit_main("la", register, label, "")
+        return
+    }
+    backend.__emit_main("lw", register, fmt.Sprintf("%%got(%s)($gp)", label), "")
+    backend.__emit_main("addiu", register, register, fmt.Sprintf("%%lo(%s)", label))
+}
+
+// emits:
+// jal f
+// or, for position-independent code:
+// lw $t9, %call16(f)($gp)
+// jalr $t9
+// such that the callee gets its own address in $t9, which it
+// needs for '.cpload'; the caller restores $gp afterwards
+// (see '__restore_gp')
+func (backend *MIPSBackend) __emit_call(label string) {
+    if !backend.options.pic {
+        backend.__emit_main("jal", label, "", "")
+        return
+    }
+    backend.__emit_main("lw", "$t9", fmt.Sprintf("%%call16(%s)($gp)", label), "")
+    backend.__emit_main("jalr", "$t9", "", "")
+}
+
+// emits:
+// la $t9, printf
+// jalr $t9
+// or, for position-independent code, the same as '__emit_call';
+// C functions are compiled as position-independent code (even in
+// libc.a), and they find the GOT from their own address in $t9.
+// any value in $t9 has already been spilled (see 'user_call')
+func (backend *MIPSBackend) __emit_c_call(label string) {
+    if backend.options.pic {
+        backend.__emit_call(label)
+        return
+    }
+    backend.__emit_main("la", "$t9", label, "")
+    backend.__emit_main("jalr", "$t9", "", "")
+}
+
+// calls a runtime routine; for position-independent code this
+// is 'bal', which is pc-relative and (unlike '__emit_call')
+// leaves $t9 and $gp alone, as the routines don't need them
+func (backend *MIPSBackend) __emit_local_call(label string) {
+    if !backend.options.pic {
+        backend.__emit_main("jal", label, "", "")
+        return
+    }
+    backend.__emit_main("bal", label, "", "")
+}
+
+// returns:
+// .set noreorder
+// .cpload $t9
+// .set reorder
+// for position-independent code (nothing otherwise), which
+// points $gp at the GOT; it has to start every procedure
+func (backend *MIPSBackend) __cpload() []Instruction {
+    if !backend.options.pic {
+        return nil
+    }
+    return []Instruction{
+        {".set", []string{"noreorder", "", ""}, ""},
+        {".cpload", []string{"$t9", "", ""}, ""},
+        {".set", []string{"reorder", "", ""}, ""},
+    }
+}
+
+// reserves the slot $gp is saved in, like '__save_ra'; the
+// callee's '.cpload' overwrites $gp
+func (backend *MIPSBackend) __save_gp() {
+    if backend.options.pic && backend.gp_slot == "" {
+        backend.gp_slot = backend.__reserve_slot()
+    }
+}
+
+// emits:
+// lw $gp, -8($sp)
+// after a call, for position-independent code
+func (backend *MIPSBackend) __restore_gp() {
+    if backend.options.pic {
+        backend.__emit_main("lw", "$gp", backend.gp_slot, "")
+    }
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "flag"
+    "strings"
+    "testing"
+)
+
+// -fpic calls every function through the GOT (C functions too, see
+// '__emit_c_call') and looks up every data label in it, with each
+// procedure pointing $gp at the GOT and callers restoring $gp after
+// each call; without it, calls and addresses are absolute
+func Test_position_independent_code(t *testing.T) {
+    var program Program = Program{[]interface{}{
+        Function{"f", []string{"n"}, []interface{}{Return{ArithmeticOp{Ident{"n"}, "addu", Integer{"1"}}}}, false},
+        Assignment{"s", String{"hi"}},
+        ExprStmt{Call{"puts", []interface{}{Ident{"s"}}}},
+        ExprStmt{Call{"printf", []interface{}{String{"%d\\n"}, Call{"f", []interface{}{Integer{"1"}}}}}},
+    }}
+    // the lines each one has in a row, which the other one doesn't
+    var expected = map[bool][]string{
+        true: {
+            ".abicalls\n.option pic2",
+            "main:\n.set noreorder\n.cpload $t9\n.set reorder",
+            "f:\n.set noreorder\n.cpload $t9\n.set reorder",
+            "lw $t0,%got(string1)($gp)\naddiu $t0,$t0,%lo(string1)",
+            "lw $t9,%call16(puts)($gp)\njalr $t9\naddiu $sp,$sp,32\nlw $gp,-12($sp)",
+            "lw $t9,%call16(f)($gp)\njalr $t9\naddiu $sp,$sp,32\nlw $gp,-12($sp)",
+            "lw $t9,%call16(printf)($gp)\njalr $t9",
+        },
+        false: {
+            "la $t0,string1",
+            "la $t9,puts\njalr $t9",
+            "jal f",
+            "la $t9,printf\njalr $t9",
+        },
+    }
+    for _, pic := range []bool{false, true} {
+        var (
+            flags   *flag.FlagSet  = flag.NewFlagSet("scg", flag.ContinueOnError)
+            options BackendOptions = default_backend_options()
+            args    []string       = []string{"-target", "linux", "-libc"}
+        )
+        backend_flags(flags, &options)
+        if pic {
+            args = append(args, "-fpic")
+        }
+        if err := flags.Parse(args); err != nil {
+            t.Fatal(err)
+        }
+        backend, diagnostics, ok := try_generate(program, options)
+        if !ok {
+            t.Fatalf("%v: %s", args, strings.Join(diagnostics, "\n"))
+        }
+        var lines []string = strings.Split(backend.assemble(), "\n")
+        for i := range lines {
+            lines[i] = strings.TrimSpace(lines[i])
+        }
+        var assembly string = strings.Join(lines, "\n")
+        for _, code := range expected[pic] {
+            if !strings.Contains(assembly, code) {
+                t.Errorf("%v doesn't have\n%s\nin\n%s", args, code, assembly)
+            }
+        }
+        for _, code := range expected[!pic] {
+            if strings.Contains(assembly, code) {
+                t.Errorf("%v has\n%s\nin\n%s", args, code, assembly)
+            }
+        }
+    }
+    var options BackendOptions = default_backend_options()
+    options.pic = true
+    if _, diagnostics, ok := try_generate(program, options); ok ||
+        !strings.Contains(strings.Join(diagnostics, "\n"), "target 'mars' doesn't support position-independent code") {
+        t.Errorf("-fpic on mars gave %q", diagnostics)
+    }
+}
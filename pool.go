@@ -0,0 +1,38 @@
+package main
+
+import "sync"
+
+// backends that are done with their programs, for compiling one
+// program after another without allocating new buffers for each
+// (see 'reset'); nothing may use a backend (or the instructions
+// it generated) after putting it back
+var backend_pool sync.Pool = sync.Pool{
+    New: func() interface{} {
+        return &MIPSBackend{}
+    },
+}
+
+// returns an empty slice with the memory of some instructions,
+// which nothing may use anymore
+func reuse_instructions(instructions []Instruction) []Instruction {
+    if instructions == nil {
+        return []Instruction{}
+    }
+    // drops the operands, which the next program doesn't need
+    clear(instructions[:cap(instructions)])
+    return instructions[:0]
+}
+
+// makes a backend blank again (see 'blank_mips_backend'), keeping
+// the memory its sections took up for the next program
+func (backend *MIPSBackend) reset(options BackendOptions) {
+    var old MIPSBackend = *backend
+    *backend = blank_mips_backend(options)
+    backend.main_section = reuse_instructions(old.main_section)
+    backend.ktext_section = reuse_instructions(old.ktext_section)
+    backend.cold_section = reuse_instructions(old.cold_section)
+    if old.procedures != nil {
+        clear(old.procedures[:cap(old.procedures)])
+        backend.procedures = old.procedures[:0]
+    }
+}
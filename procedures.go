@@ -0,0 +1,167 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// matches the labels an instruction argument refers to, once the
+// registers and relocation operators (e.g. "%call16") are removed
+var label_pattern *regexp.Regexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_.]*`)
+
+// matches the relocation operators of position-independent code
+var relocation_pattern *regexp.Regexp = regexp.MustCompile(`%[a-z0-9]+`)
+
+// a procedure in the text section; 'main', every user function,
+// and every runtime library routine in use become one
+type Procedure struct {
+    label    string
+    prologue []Instruction
+    body     []Instruction
+    // ends with the return (e.g. 'jr $ra')
+    epilogue []Instruction
+}
+
+// returns every instruction of the procedure, starting with its label
+func (procedure *Procedure) instructions() []Instruction {
+    var ret []Instruction = []Instruction{{procedure.label + ":", []string{}, ""}}
+    ret = append(ret, procedure.prologue...)
+    ret = append(ret, procedure.body...)
+    return append(ret, procedure.epilogue...)
+}
+
+// returns a runtime library routine as a procedure, with the
+// target's number in place of each "<syscall>" it makes
+func runtime_procedure(name string, syscalls map[string]int) Procedure {
+    var body []Instruction
+    // the routines start with their label
+    for _, instruction := range runtime_library[name][1:] {
+        var args []string = append([]string{}, instruction.args...)
+        for i, arg := range args {
+            if number, ok := syscalls[strings.Trim(arg, "<>")]; ok && strings.HasPrefix(arg, "<") {
+                args[i] = fmt.Sprint(number)
+            }
+        }
+        body = append(body, Instruction{instruction.opcode, args, instruction.comment})
+    }
+    return Procedure{name, nil, body, nil}
+}
+
+// returns the procedures of the text section, in order: main
+// (unless 'with_main' is false), the user functions, and the
+// runtime library routines in use, followed by the procedures of
+// other sections (see '__by_section')
+func (backend *MIPSBackend) text_procedures(with_main bool) []Procedure {
+    var ret []Procedure
+    if with_main {
+        ret = append(ret, backend.main_procedure)
+    }
+    ret = append(ret, backend.procedures...)
+    for _, name := range runtime_order {
+        if backend.runtime_used[name] {
+            ret = append(ret, runtime_procedure(name, backend.target.syscalls))
+        }
+    }
+    return backend.__by_section(ret)
+}
+
+// returns the instructions of the text section, in order
+func (backend *MIPSBackend) text_instructions() []Instruction {
+    var text []Instruction
+    for _, procedure := range backend.text_procedures(true) {
+        text = append(text, procedure.instructions()...)
+    }
+    return text
+}
+
+// returns every label the instructions refer to
+func referenced_labels(instructions []Instruction) map[string]bool {
+    var labels map[string]bool = map[string]bool{}
+    for _, instruction := range instructions {
+        for _, arg := range instruction.args {
+            arg = relocation_pattern.ReplaceAllString(register_pattern.ReplaceAllString(arg, ""), "")
+            for _, label := range label_pattern.FindAllString(arg, -1) {
+                labels[label] = true
+            }
+        }
+    }
+    return labels
+}
+
+// whole-program dead code elimination; removes the user functions
+// and runtime library routines that can't be reached from main (or
+// the exception handler), then every data section entry nothing
+// refers to anymore (e.g. the strings of the removed functions),
+// along with the '.align's before them; entries can refer to the
+// ones before them (see 'string_array'). the entries of a removed
+// function that live ones still use (e.g. a pooled constant) go to
+// the first of those (see '__data_owner')
+func (backend *MIPSBackend) eliminate_dead_code() {
+    var (
+        procedures map[string]Procedure = map[string]Procedure{}
+        reachable  map[string]bool      = map[string]bool{}
+        pending    []string             = []string{"main"}
+    )
+    for _, procedure := range backend.text_procedures(true) {
+        procedures[procedure.label] = procedure
+    }
+    for label := range referenced_labels(backend.ktext_section) {
+        pending = append(pending, label)
+    }
+    for len(pending) != 0 {
+        var label string = pending[len(pending)-1]
+        pending = pending[:len(pending)-1]
+        procedure, ok := procedures[label]
+        if !ok || reachable[label] {
+            continue
+        }
+        reachable[label] = true
+        for label := range referenced_labels(procedure.instructions()) {
+            pending = append(pending, label)
+        }
+    }
+    var live []Procedure
+    for _, procedure := range backend.procedures {
+        if reachable[procedure.label] {
+            live = append(live, procedure)
+        }
+    }
+    backend.procedures = live
+    for name := range backend.runtime_used {
+        if !reachable[name] {
+            delete(backend.runtime_used, name)
+        }
+    }
+    for _, procedure := range backend.text_procedures(true) {
+        for label := range referenced_labels(procedure.instructions()) {
+            var owner string = backend.data_owners[label]
+            if _, ok := procedures[owner]; ok && !reachable[owner] {
+                backend.data_owners[label] = procedure.label
+            }
+        }
+    }
+    var used map[string]bool = referenced_labels(append(backend.text_instructions(), backend.ktext_section...))
+    for _, section := range []*string{&backend.data_section, &backend.rodata_section, &backend.bss_section} {
+        var (
+            lines   []string = strings.SplitAfter(*section, "\n")
+            data    string
+            removed bool
+        )
+        // backwards, so the entries a live one refers to are known
+        // to be used by the time they're reached
+        for i := len(lines) - 1; i >= 0; i-- {
+            if label, ok := data_label(lines[i]); ok {
+                removed = !used[label]
+            }
+            if removed {
+                continue
+            }
+            for _, label := range data_references(lines[i]) {
+                used[label] = true
+            }
+            data = lines[i] + data
+        }
+        *section = data
+    }
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "math/rand"
+    "os"
+    "strings"
+)
+
+// the opcodes random programs use; division only gets a
+// nonzero constant divisor (see 'expression')
+var random_ops = []string{"addu", "subu", "mul", "and", "or", "xor", "nor", "slt", "sltu", "sllv", "srlv", "srav"}
+
+// the state of generating a random program
+type RandomProgram struct {
+    rng *rand.Rand
+    // the variables (or parameters) an expression can use, and
+    // the functions it can call
+    names     []string
+    functions int
+}
+
+// returns a random integer literal, mostly small ones, so that
+// comparisons and shifts do something interesting
+func (program *RandomProgram) literal() Integer {
+    if program.rng.Intn(4) == 0 {
+        return Integer{fmt.Sprint(program.rng.Int31() - 1<<30)}
+    }
+    return Integer{fmt.Sprint(program.rng.Intn(64) - 16)}
+}
+
+// returns a random integer expression at most 'depth' levels deep
+func (program *RandomProgram) expression(depth int) interface{} {
+    var rng *rand.Rand = program.rng
+    if depth == 0 || rng.Intn(3) == 0 {
+        if len(program.names) != 0 && rng.Intn(3) != 0 {
+            return Ident{program.names[rng.Intn(len(program.names))]}
+        }
+        return program.literal()
+    }
+    switch {
+    case program.functions != 0 && rng.Intn(6) == 0:
+        return Call{fmt.Sprintf("f%d", rng.Intn(program.functions)),
+            []interface{}{program.expression(depth - 1), program.expression(depth - 1)}}
+    case rng.Intn(8) == 0:
+        // never zero, and never -1 (which overflows on the
+        // smallest integer)
+        return ArithmeticOp{program.expression(depth - 1), "div", Integer{fmt.Sprint(rng.Intn(9) + 1)}}
+    }
+    return ArithmeticOp{program.expression(depth - 1), random_ops[rng.Intn(len(random_ops))], program.expression(depth - 1)}
+}
+
+// returns a random statement changing one of the variables
+func (program *RandomProgram) statement(depth int) interface{} {
+    var rng *rand.Rand = program.rng
+    if depth > 0 && rng.Intn(4) == 0 {
+        var then, otherwise []interface{}
+        for i := rng.Intn(3) + 1; i > 0; i-- {
+            then = append(then, program.statement(depth-1))
+        }
+        for i := rng.Intn(3); i > 0; i-- {
+            otherwise = append(otherwise, program.statement(depth-1))
+        }
+        return If{program.expression(1), then, otherwise}
+    }
+    return Assignment{program.names[rng.Intn(len(program.names))], program.expression(2)}
+}
+
+// returns a random program that only uses integers; it defines a
+// few leaf functions (of two parameters), assigns its variables
+// 'size' times (some of them under conditions), and prints the
+// final value of each variable; converts:
+// rng, 1
+// =>
+// func f0(a, b) { return a xor 3 }
+// v0 = 5
+// v0 = f0(v0, 7)
+// Printf("%d\n", v0)
+// the programs never divide by zero, so the interpreter runs
+// them all the way through
+func random_program(rng *rand.Rand, size int) Program {
+    var (
+        program   RandomProgram = RandomProgram{rng, []string{"a", "b"}, 0}
+        variables int           = rng.Intn(4) + 1
+        nodes     []interface{}
+    )
+    for i := rng.Intn(3); i > 0; i-- {
+        nodes = append(nodes, Function{fmt.Sprintf("f%d", program.functions), []string{"a", "b"},
+            []interface{}{Return{program.expression(2)}}, false})
+        program.functions++
+    }
+    program.names = nil
+    for i := 0; i < variables; i++ {
+        program.names = append(program.names, fmt.Sprintf("v%d", i))
+        nodes = append(nodes, Assignment{program.names[i], program.literal()})
+    }
+    for i := 0; i < size; i++ {
+        nodes = append(nodes, program.statement(1))
+    }
+    for _, name := range program.names {
+        nodes = append(nodes, Call{"Printf", []interface{}{String{"%d\\n"}, Ident{name}}})
+    }
+    return Program{nodes}
+}
+
+// a way of compiling random programs, for 'scg proptest'
+type PropertyBackend struct {
+    name    string
+    options func(options *BackendOptions)
+}
+
+// the option sets every random program has to compile with
+var property_backends = []PropertyBackend{
+    {"default", flag_options()},
+    {"-O2", flag_options("-O2")},
+    {"-O2 -whole-program", flag_options("-O2", "-whole-program")},
+    {"-finline-threshold=8", flag_options("-finline-threshold=8")},
+    {"-fbranchless", flag_options("-fbranchless")},
+    {"-no-slot-sharing", flag_options("-no-slot-sharing")},
+}
+
+// returns a function that sets options the way the flags 'args'
+// do on the command line (see 'backend_flags')
+func flag_options(args ...string) func(options *BackendOptions) {
+    return func(options *BackendOptions) {
+        var flags *flag.FlagSet = flag.NewFlagSet("proptest", flag.PanicOnError)
+        backend_flags(flags, options)
+        flags.Parse(args)
+    }
+}
+
+// returns what an ast prints when it's interpreted, or the
+// panic that stopped it
+func interpret_safely(ast interface{}) (output string, err error) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            err = fmt.Errorf("%v", recovered)
+        }
+    }()
+    return interpret(ast), nil
+}
+
+// checks one random program, returning what went wrong; the
+// interpreter's output is the reference, which the ast has to
+// keep through the ast-level optimizations (constant propagation
+// and inlining), and the code every option set generates has to
+// print the same when it runs on a 'Machine' (see 'run_emulated').
+// every option set has to compile it without errors, with the
+// stack discipline checked (see '__check_discipline')
+func check_program(program Program) []string {
+    var (
+        problems    []string
+        diagnostics Diagnostics = new_diagnostics(default_backend_options())
+    )
+    expected, err := interpret_safely(program)
+    if err != nil {
+        return []string{fmt.Sprintf("the interpreter failed: %v", err)}
+    }
+    var optimized = map[string]func(ast interface{}) interface{}{
+        "constant propagation": propagate_constants,
+        "inlining": func(ast interface{}) interface{} {
+            return inline_functions(ast, 8)
+        },
+    }
+    for _, name := range []string{"constant propagation", "inlining"} {
+        var output string
+        output, err = interpret_safely(optimized[name](lower(program, &diagnostics)))
+        if err != nil {
+            problems = append(problems, fmt.Sprintf("%s: the interpreter failed: %v", name, err))
+        } else if output != expected {
+            problems = append(problems, fmt.Sprintf("%s: printed\n%sinstead of\n%s", name, output, expected))
+        }
+    }
+    for _, property_backend := range property_backends {
+        var options BackendOptions = default_backend_options()
+        property_backend.options(&options)
+        options.check_discipline = true
+        backend, diagnostics, ok := try_generate(program, options)
+        if !ok {
+            problems = append(problems, fmt.Sprintf("%s: %s", property_backend.name, strings.Join(diagnostics, "\n")))
+            continue
+        }
+        if output, _, err := backend.run_emulated(); err != nil {
+            problems = append(problems, fmt.Sprintf("%s: the emulator failed: %v", property_backend.name, err))
+        } else if output != expected {
+            problems = append(problems, fmt.Sprintf("%s: the generated code printed\n%sinstead of\n%s",
+                property_backend.name, output, expected))
+        }
+    }
+    return problems
+}
+
+// scg proptest [-n count] [-seed seed] [-size size]
+// generates random integer-only programs (see 'random_program')
+// and checks each one (see 'check_program'), printing the programs
+// that fail as JSON along with their seeds, which '-n 1 -seed' gets
+// back; exits with 1 if any of them failed
+func proptest(args []string) {
+    var (
+        flags  *flag.FlagSet = flag.NewFlagSet("proptest", flag.ExitOnError)
+        count  *int          = flags.Int("n", 100, "how many programs to generate")
+        seed   *int64        = flags.Int64("seed", 1, "the seed of the first program (the rest follow it)")
+        size   *int          = flags.Int("size", 20, "how many statements each program has")
+        failed int
+    )
+    flags.Parse(args)
+    for i := int64(0); i < int64(*count); i++ {
+        var program Program = random_program(rand.New(rand.NewSource(*seed+i)), *size)
+        if problems := check_program(program); len(problems) != 0 {
+            fmt.Printf("seed %d:\n%s%s\n\n", *seed+i, encode_ast(program), strings.Join(problems, "\n"))
+            failed++
+        }
+    }
+    fmt.Printf("%d of %d program(s) failed\n", failed, *count)
+    if failed != 0 {
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "math/rand"
+    "os"
+    "os/exec"
+    "strings"
+    "testing"
+)
+
+// what 'scg proptest' checks, on fewer programs
+func Test_random_programs(t *testing.T) {
+    for seed := int64(1); seed <= 50; seed++ {
+        var program Program = random_program(rand.New(rand.NewSource(seed)), 20)
+        if problems := check_program(program); len(problems) != 0 {
+            t.Errorf("seed %d:\n%s%s", seed, encode_ast(program), strings.Join(problems, "\n"))
+        }
+    }
+}
+
+// the random programs print what the interpreter does when they're
+// built with the GNU toolchain and run under qemu, on both linux
+// targets; only with SCG_QEMU set (see 'check_with_qemu')
+func Test_random_programs_on_qemu(t *testing.T) {
+    if os.Getenv(qemu_opt_in) == "" {
+        t.Skipf("set %s to run the programs under qemu", qemu_opt_in)
+    }
+    for _, target := range []string{"linux", "linux-n32"} {
+        t.Run(target, func(t *testing.T) {
+            var qemu_user string = qemu_users[target][targets[target].byte_order]
+            if _, err := exec.LookPath(qemu_user); err != nil {
+                t.Skipf("'%s' isn't installed", qemu_user)
+            }
+            for seed := int64(1); seed <= 20; seed++ {
+                var program Program = random_program(rand.New(rand.NewSource(seed)), 20)
+                if _, err := check_with_qemu(program, target); err != nil {
+                    t.Errorf("seed %d:\n%s%v", seed, encode_ast(program), err)
+                }
+            }
+        })
+    }
+}
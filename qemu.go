@@ -0,0 +1,84 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+)
+
+// the emulator used by 'run_with_qemu', for each linux target
+// and byte order
+var qemu_users = map[string]map[string]string{
+    "linux":     {"EB": "qemu-mips", "EL": "qemu-mipsel"},
+    "linux-n32": {"EB": "qemu-mipsn32", "EL": "qemu-mipsn32el"},
+}
+
+// end-to-end checks only run when this environment variable is
+// set, since they need a cross toolchain and qemu
+const qemu_opt_in = "SCG_QEMU"
+
+// builds a program for a linux target (the "linux" one, unless the
+// options pick "linux-n32") and runs it under qemu-mips (or the
+// qemu for its ABI and byte order), returning what it printed and
+// its exit status
+func run_with_qemu(ast interface{}, options BackendOptions) (string, int, error) {
+    if _, ok := qemu_users[options.target]; !ok {
+        options.target = "linux"
+    }
+    var backend MIPSBackend = new_mips_backend_with(ast, options)
+    var qemu_user string = qemu_users[options.target][backend.byte_order_name()]
+    if _, err := exec.LookPath(qemu_user); err != nil {
+        return "", 0, fmt.Errorf("'%s' isn't installed", qemu_user)
+    }
+    directory, err := os.MkdirTemp("", "scg")
+    if err != nil {
+        return "", 0, err
+    }
+    defer os.RemoveAll(directory)
+
+    var executable string = filepath.Join(directory, "out")
+    diagnostics, err := backend.build_with_gas(executable)
+    if err != nil {
+        for _, diagnostic := range diagnostics {
+            err = fmt.Errorf("%v\n%v", err, diagnostic)
+        }
+        return "", 0, err
+    }
+    var (
+        command *exec.Cmd    = exec.Command(qemu_user, executable)
+        stdout  bytes.Buffer = bytes.Buffer{}
+    )
+    command.Stdout = &stdout
+    err = command.Run()
+    var exit_error *exec.ExitError
+    if errors.As(err, &exit_error) {
+        return stdout.String(), exit_error.ExitCode(), nil
+    }
+    return stdout.String(), 0, err
+}
+
+// runs a program for 'target' under qemu and compares its output
+// with the interpreter's (generated programs always exit with 0);
+// returns false without doing anything unless SCG_QEMU is set
+func check_with_qemu(ast interface{}, target string) (bool, error) {
+    if os.Getenv(qemu_opt_in) == "" {
+        return false, nil
+    }
+    var expected string = interpret(ast)
+    var options BackendOptions = default_backend_options()
+    options.target = target
+    stdout, status, err := run_with_qemu(ast, options)
+    if err != nil {
+        return true, err
+    }
+    if stdout != expected {
+        return true, fmt.Errorf("qemu printed %q, but the interpreter printed %q", stdout, expected)
+    }
+    if status != 0 {
+        return true, fmt.Errorf("exited with %d", status)
+    }
+    return true, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// where the lines of a 'Raw' node go: the top of the data section,
+// the start of the text section (before main's label), or the end of
+// the text section (after every procedure in it, including the
+// runtime's, but before the other sections, see 'section')
+var raw_placements = map[string]bool{"data": true, "main": true, "end": true}
+
+// the directives that switch sections; the code after a raw line
+// that used one would end up in the wrong section
+var section_directives = map[string]bool{
+    ".text": true, ".data": true, ".rdata": true, ".bss": true, ".sdata": true, ".sbss": true,
+    ".ktext": true, ".kdata": true, ".section": true, ".pushsection": true, ".popsection": true,
+    ".previous": true,
+}
+
+// returns what's wrong with a raw line at a placement, or "" if it
+// can go there; lines have to keep to the section they're put in,
+// and only data (labels, directives and comments) goes in the data
+// section. converts:
+// "data", "table: .word 1, 2"
+// =>
+// ""
+// and e.g. "data", "nop" into "only data can go in the data section"
+func raw_line_problem(placement string, line string) string {
+    if !raw_placements[placement] {
+        return fmt.Sprintf("unknown placement '%s' (expected data, main or end)", placement)
+    }
+    if strings.ContainsAny(line, "\r\n") {
+        return "raw lines can't contain line breaks"
+    }
+    var code string = strings.TrimSpace(strip_comment(line))
+    if _, rest, ok := strings.Cut(code, ":"); ok && !strings.HasPrefix(code, ".") {
+        code = strings.TrimSpace(rest)
+    }
+    var directive string
+    if fields := strings.Fields(code); len(fields) != 0 {
+        directive = fields[0]
+    }
+    if section_directives[directive] {
+        return fmt.Sprintf("'%s' would switch sections", directive)
+    }
+    if placement == "data" && directive != "" && !strings.HasPrefix(directive, ".") {
+        return fmt.Sprintf("only data can go in the data section, not '%s'", directive)
+    }
+    return ""
+}
+
+// adds lines to the output as they are, at a placement (see
+// 'raw_placements'), after the lines added there before; converts:
+// "main", ".set noreorder"
+// =>
+// .text
+// .set noreorder
+// main:
+// this is the escape hatch for whatever the generator doesn't
+// support (e.g. a directive for one assembler); the lines are
+// checked with 'raw_line_problem', but nothing else: what they mean
+// is up to the assembler
+func (backend *MIPSBackend) raw(placement string, lines ...string) {
+    for _, line := range lines {
+        if problem := raw_line_problem(placement, line); problem != "" {
+            panic(fmt.Sprintf("bad raw line '%s': %s", line, problem))
+        }
+    }
+    backend.raw_lines[placement] = append(backend.raw_lines[placement], lines...)
+}
+
+// a 'Raw' node, which has to be at the top level of the program
+// (its lines don't go where it is, so it would be misleading
+// anywhere else, and inlining a function would add them again)
+func (backend *MIPSBackend) raw_node(node *Raw, parent interface{}) {
+    if _, ok := parent.(Program); !ok {
+        panic("raw lines have to be at the top level")
+    }
+    backend.raw(node.placement, node.lines...)
+}
+
+// returns the raw lines at a placement, indented like the code
+// around them (labels line up with 'main:' in the text section)
+func (backend *MIPSBackend) __raw_text(placement string) (ret string) {
+    for _, line := range backend.raw_lines[placement] {
+        var indent string = "        "
+        if placement == "data" || strings.HasSuffix(strings.TrimSpace(line), ":") {
+            indent = "    "
+        }
+        ret += indent + strings.TrimSpace(line) + "\n"
+    }
+    return
+}
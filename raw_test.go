@@ -0,0 +1,59 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// the lines of 'Raw' nodes go into the output as they are (only
+// indented), in the order they were given, at their placement;
+// lines that would break the sections around them, and 'Raw' nodes
+// below the top level, are errors
+func Test_raw_lines(t *testing.T) {
+    var (
+        f       Function = Function{"f", nil, []interface{}{Return{Integer{"1"}}}, false}
+        printed Call     = Call{"Printf", []interface{}{String{"%d\\n"}, Call{"f", nil}}}
+    )
+    var cases = map[string]struct {
+        nodes []interface{}
+        // lines that follow each other in the output
+        expected []string
+    }{
+        "data": {[]interface{}{Raw{"data", []string{"table: .word 1, 2 # <raw>", ".align 2"}}, f, printed},
+            []string{".data", "table: .word 1, 2 # <raw>", ".align 2", "# main", `string1: .asciiz "\n"`}},
+        "data, twice": {[]interface{}{Raw{"data", []string{"a: .byte 1"}}, f, Raw{"data", []string{"  b: .byte 2  "}}, printed},
+            []string{".data", "a: .byte 1", "b: .byte 2", "# main"}},
+        "main": {[]interface{}{Raw{"main", []string{".set noreorder", "start:"}}, f, printed},
+            []string{".text", ".set noreorder", "start:", "main:"}},
+        // after the runtime library too
+        "end": {[]interface{}{Raw{"end", []string{"extra:", "jr $ra"}}, f, printed},
+            []string{"f_end:", "jr $ra", "extra:", "jr $ra"}},
+    }
+    for name, test := range cases {
+        backend, diagnostics, ok := try_generate(Program{test.nodes}, default_backend_options())
+        if !ok {
+            t.Errorf("%s: %s", name, strings.Join(diagnostics, "\n"))
+            continue
+        }
+        var code string = "\n" + strings.Join(code_lines(backend.assemble()), "\n") + "\n"
+        if !strings.Contains(code, "\n"+strings.Join(test.expected, "\n")+"\n") {
+            t.Errorf("%s: no\n%s\nin:%s", name, strings.Join(test.expected, "\n"), code)
+        }
+    }
+    var problems = map[string]struct {
+        node     interface{}
+        expected string
+    }{
+        "a section":        {Raw{"end", []string{".data"}}, "'.data' would switch sections"},
+        "after a label":    {Raw{"main", []string{"here: .section .foo"}}, "'.section' would switch sections"},
+        "code in the data": {Raw{"data", []string{"nop"}}, "only data can go in the data section, not 'nop'"},
+        "a line break":     {Raw{"data", []string{".word 1\n.word 2"}}, "raw lines can't contain line breaks"},
+        "nested":           {Function{"g", nil, []interface{}{Raw{"end", []string{"nop"}}}, false}, "raw lines have to be at the top level"},
+    }
+    for name, test := range problems {
+        if _, diagnostics, ok := try_generate(Program{[]interface{}{test.node}}, default_backend_options()); ok ||
+            !strings.Contains(strings.Join(diagnostics, "\n"), test.expected) {
+            t.Errorf("%s: generating it reported %q, expected %q", name, diagnostics, test.expected)
+        }
+    }
+}
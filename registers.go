@@ -0,0 +1,236 @@
+package main
+
+import (
+    "fmt"
+)
+
+// what the generator panics with when one of its own invariants
+// breaks (e.g. a register is freed twice, or popped off an empty
+// 'ValueStack'); it isn't a string, so 'statement' treats it as a
+// bug in the generator rather than an error in the program
+type InternalError string
+
+func (err InternalError) Error() string {
+    return "internal error: " + string(err)
+}
+
+// the temporary registers of a target, and which of them
+// hold values that are still needed
+type RegisterFile struct {
+    // in the order they are handed out
+    registers []string
+    in_use    map[string]bool
+}
+
+// 'RegisterFile' constructor
+func new_register_file(registers []string) RegisterFile {
+    return RegisterFile{registers, map[string]bool{}}
+}
+
+// hands out the first free register, panicking if
+// every one of them is in use
+func (file *RegisterFile) allocate() string {
+    for _, register := range file.registers {
+        if !file.in_use[register] {
+            file.in_use[register] = true
+            return register
+        }
+    }
+    panic(fmt.Sprintf("ran out of temporary registers (the target has %d)", len(file.registers)))
+}
+
+// frees a register, panicking if it isn't in use
+func (file *RegisterFile) free(register string) {
+    if !file.in_use[register] {
+        panic(InternalError(fmt.Sprintf("freeing '%s', which isn't in use", register)))
+    }
+    delete(file.in_use, register)
+}
+
+// returns how many registers are free
+func (file *RegisterFile) available() int {
+    return len(file.registers) - len(file.in_use)
+}
+
+// returns the registers in use right now (see 'release_since')
+func (file *RegisterFile) mark() map[string]bool {
+    var mark map[string]bool = map[string]bool{}
+    for register := range file.in_use {
+        mark[register] = true
+    }
+    return mark
+}
+
+// frees every register handed out since 'mark'
+func (file *RegisterFile) release_since(mark map[string]bool) {
+    for _, register := range file.registers {
+        if file.in_use[register] && !mark[register] {
+            file.free(register)
+        }
+    }
+}
+
+// generates a statement; any value it left on the stack (e.g. the
+// result of a call that isn't used) is dropped, and every temporary
+// it used has to be free again afterwards, since values only outlive
+// the statement that computed them in stack slots (a register it
+// didn't free is a bug, see '__check_leaks'). an error in the
+// statement is reported (see 'Diagnostics') unless it only follows
+// from an earlier one (see 'Cascaded'), and codegen goes on with
+// the next one, so that one run finds every error
+func (backend *MIPSBackend) statement(node interface{}) {
+    var (
+        depth int             = backend.stack.depth()
+        floor int             = backend.stack.floor
+        mark  map[string]bool = backend.registers.mark()
+    )
+    backend.stack.floor = depth
+    defer func() {
+        backend.stack.floor = floor
+    }()
+    if backend.options.debug_info {
+        defer backend.__debug_statement(node)()
+    }
+    defer func() {
+        var recovered interface{} = recover()
+        if recovered == nil {
+            return
+        }
+        message, ok := recovered.(string)
+        if _, cascaded := recovered.(Cascaded); !ok && !cascaded {
+            // a bug in the generator (or 'ErrorLimit')
+            panic(recovered)
+        } else if ok {
+            backend.diagnostics.error(node, "%s", message)
+        }
+        // the statement stopped halfway, so whatever it
+        // allocated is freed for it
+        backend.stack.truncate(depth)
+        backend.registers.release_since(mark)
+    }()
+    if backend.options.check_discipline {
+        var below []string = backend.stack.live()
+        backend.codegen(node)
+        backend.__check_discipline(node, below, mark)
+    } else {
+        backend.codegen(node)
+    }
+    backend.__drop_values(depth)
+    backend.__check_leaks(node, mark)
+}
+
+// frees registers whose values have been used; a register
+// is freed once its value is consumed, so that deep
+// expressions don't run out of them
+func (backend *MIPSBackend) __free(registers ...string) {
+    for _, register := range registers {
+        backend.registers.free(register)
+        backend.__trace("free", "register", register)
+    }
+}
+
+// pops (and frees) values until only 'depth' are left
+func (backend *MIPSBackend) __drop_values(depth int) {
+    for _, location := range backend.stack.pop_n(backend.stack.depth() - depth) {
+        if !spilled(location) {
+            backend.__free(location)
+        }
+    }
+}
+
+// stores the oldest value of the statement being generated that
+// is still in a register in a stack slot of its own, and frees the
+// register; converts:
+// <code for a>
+// <code for b>
+// <code for c, which needs another register>
+// =>
+// <code for a>
+// <code for b>
+// sw $t0, -12($sp)
+// <code for c>
+// such that $t0 is a's register, which c can use now; a is loaded
+// back when it's popped (see '__pop_n'). the value on top stays
+// put, since whatever is being generated can be using it (see
+// '__peek'), and so do the values of the statements around this
+// one (see 'ValueStack')
+func (backend *MIPSBackend) __spill() {
+    var live []string = backend.stack.live()
+    for i := backend.stack.floor; i < len(live)-1; i++ {
+        if spilled(live[i]) {
+            continue
+        }
+        var slot string = backend.__reserve_slot()
+        backend.__emit_main("sw", live[i], slot, "")
+        backend.__comment_last("spill")
+        backend.__free(live[i])
+        backend.stack.move(i, slot)
+        return
+    }
+}
+
+// pops the registers holding the last 'count' values (in the
+// order they were pushed), loading the ones '__spill' stored in
+// slots back into registers
+func (backend *MIPSBackend) __pop_n(count int) []string {
+    var registers []string = backend.stack.pop_n(count)
+    for i, location := range registers {
+        if spilled(location) {
+            registers[i] = backend.__reload(location)
+        }
+    }
+    return registers
+}
+
+// pops the register holding the last value pushed (see '__pop_n')
+func (backend *MIPSBackend) __pop() string {
+    return backend.__pop_n(1)[0]
+}
+
+// returns the register holding the last value pushed, without
+// popping it (loading it back if it was spilled, see '__pop_n')
+func (backend *MIPSBackend) __peek() string {
+    var location string = backend.stack.peek()
+    if spilled(location) {
+        location = backend.__reload(location)
+        backend.stack.move(backend.stack.depth()-1, location)
+    }
+    return location
+}
+
+// loads a spilled value (see '__spill') into a new register
+func (backend *MIPSBackend) __reload(slot string) string {
+    var register string = backend.__temp_register()
+    backend.__emit_main("lw", register, slot, "")
+    backend.__comment_last("reload")
+    return register
+}
+
+// panics with an 'InternalError' if a statement left a register
+// in use that wasn't in use before it ('mark'), i.e. it allocated
+// one without freeing it once its value was used
+func (backend *MIPSBackend) __check_leaks(node interface{}, mark map[string]bool) {
+    for _, register := range backend.registers.registers {
+        if backend.registers.in_use[register] && !mark[register] {
+            panic(InternalError(fmt.Sprintf("%s left '%s' in use", describe_node(node), register)))
+        }
+    }
+}
+
+// returns true if an instruction gives 'register' a new value
+// without reading its old one
+func defines(instruction Instruction, register string) bool {
+    var args []string = operands(instruction)
+    if len(args) == 0 || args[0] != register || opcode_table[instruction.opcode].reads_first ||
+        (instruction.opcode == "div" && len(args) == 2) {
+        return false
+    }
+    for _, arg := range args[1:] {
+        for _, used := range register_pattern.FindAllString(arg, -1) {
+            if used == register {
+                return false
+            }
+        }
+    }
+    return true
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+// returns what a function panicked with, or nil
+func recovered_from(function func()) (recovered interface{}) {
+    defer func() {
+        recovered = recover()
+    }()
+    function()
+    return
+}
+
+func Test_register_file(t *testing.T) {
+    var file RegisterFile = new_register_file([]string{"$t0", "$t1"})
+    var first string = file.allocate()
+    if second := file.allocate(); first != "$t0" || second != "$t1" {
+        t.Fatalf("allocated %s and %s, expected $t0 and $t1", first, second)
+    }
+    if recovered, ok := recovered_from(func() { file.allocate() }).(string); !ok ||
+        !strings.Contains(recovered, "ran out of temporary registers") {
+        t.Errorf("allocating a third register panicked with %#v", recovered)
+    }
+    file.free(first)
+    if register := file.allocate(); register != first {
+        t.Errorf("allocated %s after freeing %s", register, first)
+    }
+    file.free("$t1")
+    if _, ok := recovered_from(func() { file.free("$t1") }).(InternalError); !ok {
+        t.Errorf("freeing a register twice didn't panic with an 'InternalError'")
+    }
+}
+
+// programs that use every kind of node that takes registers; each
+// has to leave the register file as it found it after every
+// statement (see '__check_leaks'), warnings aside
+var register_programs = map[string]Program{
+    "arithmetic": {[]interface{}{
+        Assignment{"a", ArithmeticOp{Integer{"1"}, "add", ArithmeticOp{Integer{"2"}, "mul", Integer{"3"}}}},
+        Assignment{"b", ArithmeticOp{Ident{"a"}, "div", ArithmeticOp{Ident{"a"}, "sub", Integer{"1"}}}},
+        Call{"Printf", []interface{}{String{"%d %d\\n"}, Ident{"a"}, Ident{"b"}}},
+    }},
+    "conditions": {[]interface{}{
+        Assignment{"a", Integer{"1"}},
+        If{Ident{"a"}, []interface{}{Assignment{"a", Integer{"2"}}}, []interface{}{Assignment{"a", Integer{"3"}}}},
+        If{Hint{Ident{"a"}, false}, []interface{}{Assignment{"a", Integer{"4"}}}, []interface{}{Assignment{"a", Integer{"5"}}}},
+    }},
+    "calls": {[]interface{}{
+        Function{"f", []string{"a", "b", "c", "d", "e", "f"}, []interface{}{
+            Return{ArithmeticOp{Ident{"a"}, "add", Ident{"f"}}},
+        }, false},
+        Assignment{"x", Call{"f", []interface{}{Integer{"1"}, Integer{"2"}, Integer{"3"}, Integer{"4"}, Integer{"5"}, Integer{"6"}}}},
+        ExprStmt{Call{"f", []interface{}{Ident{"x"}, Ident{"x"}, Ident{"x"}, Ident{"x"}, Ident{"x"}, Ident{"x"}}}},
+        Assignment{"y", ArithmeticOp{Ident{"x"}, "add", Call{"f", []interface{}{Integer{"1"}, Integer{"2"}, Integer{"3"}, Integer{"4"}, Integer{"5"}, Integer{"6"}}}}},
+    }},
+    "strings": {[]interface{}{
+        Assignment{"s", String{"abc"}},
+        Assignment{"c", Index{Ident{"s"}, Integer{"1"}}},
+        Assignment{"i", Integer{"2"}},
+        Assignment{"d", Index{Ident{"s"}, Ident{"i"}}},
+        Assignment{"words", StringArray{[]string{"a", "b"}}},
+        Assignment{"w", Index{Ident{"words"}, Ident{"i"}}},
+        Call{"Printf", []interface{}{String{"%s %d %d\\n"}, Ident{"w"}, Ident{"c"}, Ident{"d"}}},
+    }},
+    "builtins": {[]interface{}{
+        Assignment{"a", Call{"random_range", []interface{}{Integer{"10"}}}},
+        Assignment{"b", Call{"__clz", []interface{}{Ident{"a"}}}},
+        Assignment{"c", Call{"__min", []interface{}{Ident{"a"}, Ident{"b"}}}},
+        Assignment{"d", Call{"__abs", []interface{}{Ident{"c"}}}},
+        Assignment{"e", Cast{Ident{"d"}, "int8"}},
+        ExprStmt{Call{"write", []interface{}{Call{"stdout", nil}, String{"x"}, Integer{"1"}}}},
+    }},
+    "memory": {[]interface{}{
+        Assignment{"a", String{"abcdefgh"}},
+        Assignment{"b", String{"hgfedcba"}},
+        Assignment{"n", Integer{"5"}},
+        Call{"memcpy", []interface{}{Ident{"a"}, Ident{"b"}, Integer{"6"}}},
+        Call{"memcpy", []interface{}{Ident{"a"}, Ident{"b"}, Ident{"n"}}},
+        Call{"memset", []interface{}{Ident{"a"}, Integer{"0"}, Ident{"n"}}},
+        Call{"memset", []interface{}{Ident{"a"}, Ident{"n"}, Integer{"3"}}},
+    }},
+    "statics": {[]interface{}{
+        Static{"counter", "int16", "0"},
+        Assignment{"counter", ArithmeticOp{Ident{"counter"}, "add", Integer{"1"}}},
+    }},
+    "bitmap": {[]interface{}{
+        Call{"set_pixel", []interface{}{Integer{"1"}, Integer{"2"}, Integer{"3"}}},
+        Assignment{"k", Call{"read_key", nil}},
+    }},
+}
+
+func Test_registers_are_freed(t *testing.T) {
+    for name, program := range register_programs {
+        backend, diagnostics, ok := try_generate(program, default_backend_options())
+        if !ok {
+            t.Errorf("%s: %s", name, strings.Join(diagnostics, "\n"))
+            continue
+        }
+        if len(backend.registers.in_use) != 0 {
+            t.Errorf("%s: %d register(s) are still in use", name, len(backend.registers.in_use))
+        }
+    }
+}
+
+// a value that's still in use after the statement that computed it
+// is a bug in the generator, not in the program
+func Test_leaked_register(t *testing.T) {
+    var backend MIPSBackend = blank_mips_backend(default_backend_options())
+    var recovered interface{} = recovered_from(func() {
+        backend.__check_leaks(Assignment{"a", Integer{"1"}}, backend.registers.mark())
+        backend.__temp_register()
+        backend.__check_leaks(Assignment{"a", Integer{"1"}}, map[string]bool{})
+    })
+    if _, ok := recovered.(InternalError); !ok {
+        t.Fatalf("a leaked register panicked with %#v", recovered)
+    }
+    if len(backend.diagnostics.reported) != 0 {
+        t.Errorf("a leaked register was reported as %v", backend.diagnostics.reported)
+    }
+}
+
+// returns a+(b*(c+(d*...))), 'depth' operations deep, whose operands
+// are all variables (so none of them is an immediate)
+func right_leaning(depth int) interface{} {
+    var (
+        names []string    = []string{"a", "b", "c", "d", "e", "f", "g"}
+        ret   interface{} = Ident{names[depth%len(names)]}
+    )
+    for i := depth - 1; i >= 0; i-- {
+        ret = ArithmeticOp{Ident{names[i%len(names)]}, []string{"add", "mul"}[i%2], ret}
+    }
+    return ret
+}
+
+// returns a tree of additions 'depth' levels deep, whose every
+// operand needs as many registers as the other
+func balanced(depth int) interface{} {
+    if depth == 0 {
+        return Ident{"a"}
+    }
+    return ArithmeticOp{balanced(depth - 1), "add", balanced(depth - 1)}
+}
+
+// expressions deeper than the target has registers compile, since
+// registers are freed as soon as their values are used, and the
+// operand that needs more of them is generated first (see
+// '__right_first')
+func Test_deep_expressions(t *testing.T) {
+    var expressions = map[string]interface{}{
+        "depth 6":             right_leaning(6),
+        "depth 40":            right_leaning(40),
+        "balanced, depth 9":   balanced(9),
+        "left and right deep": ArithmeticOp{right_leaning(30), "sub", right_leaning(30)},
+    }
+    for name, expression := range expressions {
+        var nodes []interface{}
+        for _, variable := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+            nodes = append(nodes, Assignment{variable, Call{"random", nil}})
+        }
+        nodes = append(nodes, Call{"Printf", []interface{}{String{"%d\\n"}, expression}})
+        if _, diagnostics, ok := try_generate(Program{nodes}, default_backend_options()); !ok {
+            t.Errorf("%s: %s", name, strings.Join(diagnostics, "\n"))
+        }
+    }
+}
+
+// an expression whose left operands are calls can't have its right
+// ones generated first, so each level keeps a value live; once the
+// registers run out, the oldest values are spilled to the frame and
+// loaded back when they're used (see '__spill'), on targets with
+// fewer temporaries too (linux-n32 has 6)
+func Test_spilling(t *testing.T) {
+    var (
+        expression interface{} = Call{"f", []interface{}{Integer{"0"}}}
+        expected   int         = 0
+    )
+    for i := 1; i <= 24; i++ {
+        expression = ArithmeticOp{Call{"f", []interface{}{Integer{fmt.Sprint(i)}}}, "sub", expression}
+        expected = 3*i - expected
+    }
+    var program Program = Program{[]interface{}{
+        Function{"f", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "mul", Integer{"3"}}}}, false},
+        Assignment{"a", expression},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"a"}}},
+    }}
+    if err := check_with_emulator(program, default_backend_options()); err != nil {
+        t.Error(err)
+    }
+    for _, target := range []string{"mars", "linux", "linux-n32"} {
+        var options BackendOptions = default_backend_options()
+        options.target = target
+        backend, diagnostics, ok := try_generate(program, options)
+        if !ok {
+            t.Errorf("%s: %s", target, strings.Join(diagnostics, "\n"))
+            continue
+        }
+        if stdout, _, err := backend.run_emulated(); err != nil || stdout != fmt.Sprintf("%d\n", expected) {
+            t.Errorf("%s printed %q (%v), expected %d", target, stdout, err, expected)
+        }
+        if code := backend.assemble(); !strings.Contains(code, "# spill") || !strings.Contains(code, "# reload") {
+            t.Errorf("%s didn't spill:\n%s", target, code)
+        }
+    }
+}
+
+// -freserve keeps the generated code away from registers (even
+// when it runs out of the others and spills), and refuses the ones
+// it can't do without
+func Test_reserved_registers(t *testing.T) {
+    var (
+        expression interface{} = Integer{"0"}
+        nodes      []interface{}
+    )
+    for i := 1; i <= 12; i++ {
+        expression = ArithmeticOp{Call{"g", []interface{}{Integer{fmt.Sprint(i)}}}, "sub", expression}
+    }
+    nodes = append(nodes, Function{"g", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "mul", Integer{"3"}}}}, false})
+    nodes = append(nodes, Call{"Printf", []interface{}{String{"%d\\n"}, expression}})
+    nodes = append(nodes, register_programs["arithmetic"].nodes...)
+    nodes = append(nodes, register_programs["calls"].nodes...)
+    var program Program = Program{nodes}
+    var cases = []struct {
+        target  string
+        reserve string
+    }{
+        {"mars", "$t8,$t9"},
+        {"mars", "$t0, $t1,$t2"},
+        {"linux", "$t8,$t9"},
+        {"linux-n32", "$24"},
+    }
+    for _, test := range cases {
+        var options BackendOptions = default_backend_options()
+        flag_options("-target", test.target, "-freserve="+test.reserve)(&options)
+        if err := check_on_target(program, options); err != nil {
+            t.Errorf("%s -freserve=%s: %v", test.target, test.reserve, err)
+            continue
+        }
+        var reserved map[uint32]bool = map[uint32]bool{}
+        for _, register := range options.reserved_registers {
+            reserved[register_number(register)] = true
+        }
+        var backend MIPSBackend = new_mips_backend_with(program, options)
+        for _, instruction := range backend.text_instructions() {
+            for _, arg := range instruction.args {
+                for _, word := range strings.FieldsFunc(arg, func(r rune) bool { return r == '(' || r == ')' || r == ',' }) {
+                    if strings.HasPrefix(word, "$") && reserved[register_number(word)] {
+                        t.Errorf("%s -freserve=%s: %s uses %s", test.target, test.reserve, instruction.opcode, word)
+                    }
+                }
+            }
+        }
+    }
+    for _, register := range []string{"$zero", "$sp", "$0", "$29"} {
+        var options BackendOptions = default_backend_options()
+        flag_options("-freserve=$t8," + register)(&options)
+        var expected string = fmt.Sprintf("'%s' can't be reserved; the generated code needs it", register)
+        if _, diagnostics, ok := try_generate(program, options); ok || !strings.Contains(strings.Join(diagnostics, "\n"), expected) {
+            t.Errorf("-freserve=$t8,%s gave %q", register, diagnostics)
+        }
+    }
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// the state of 'scg repl'
+type Repl struct {
+    options BackendOptions
+    // the statements entered so far (that compiled)
+    nodes []interface{}
+    // run the program on the emulator after every statement
+    run bool
+    // the data and text sections, diagnostics, and output of
+    // the last program that compiled
+    data        []string
+    text        []string
+    diagnostics map[string]bool
+    output      string
+    // the machine the last program ran on, the addresses of its
+    // labels, and the slots of main's variables (see 'command')
+    machine *Machine
+    labels  map[string]uint32
+    slots   map[string]string
+}
+
+// returns the lines of some code without their indentation,
+// leaving out blank ones
+func code_lines(code string) (ret []string) {
+    for _, line := range strings.Split(code, "\n") {
+        if line = strings.TrimSpace(line); line != "" {
+            ret = append(ret, line)
+        }
+    }
+    return
+}
+
+// adds a statement (a JSON node, see 'decode_ast') to the program,
+// printing the code that changed; converts:
+// {"node": "Assignment", "name": "a", "value": {"node": "Integer", "value": 5}}
+// =>
+// + li $t0,5
+// + sw $t0,-4($sp)
+// (along with the lines it changed, see 'diff_lines'); the
+// statement is dropped if the program doesn't compile with it
+func (session *Repl) enter(line string, out io.Writer) {
+    node, err := decode_ast([]byte(line))
+    if err != nil {
+        fmt.Fprintf(out, "Error: %v\n", err)
+        return
+    }
+    var nodes []interface{} = append(append([]interface{}{}, session.nodes...), node)
+    backend, diagnostics, ok := try_generate(Program{nodes}, session.options)
+    for _, diagnostic := range diagnostics {
+        if !session.diagnostics[diagnostic] {
+            fmt.Fprintln(out, diagnostic)
+        }
+    }
+    if !ok {
+        return
+    }
+    var (
+        data []string = code_lines(backend.data_section + backend.rodata_section + backend.bss_section)
+        text []string = code_lines(render_instructions(backend.text_instructions()))
+    )
+    for _, change := range append(diff_lines(session.data, data), diff_lines(session.text, text)...) {
+        fmt.Fprintln(out, change)
+    }
+    session.nodes, session.data, session.text = nodes, data, text
+    session.diagnostics = map[string]bool{}
+    for _, diagnostic := range diagnostics {
+        session.diagnostics[diagnostic] = true
+    }
+    if session.run {
+        session.__run(backend, out)
+    }
+}
+
+// runs the whole program on the emulator (see 'Machine'), printing
+// what it printed since the last statement; the machine is kept,
+// as main left it, for ':regs' and ':mem'
+func (session *Repl) __run(backend MIPSBackend, out io.Writer) {
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            fmt.Fprintf(out, "Error: %v\n", recovered)
+        }
+    }()
+    var (
+        image   Image    = backend.link_image(backend.options.binary_base)
+        machine *Machine = backend.emulated_machine(image)
+        err     error    = machine.run(max_emulated_steps)
+        output  string   = machine.output.String()
+    )
+    if strings.HasPrefix(output, session.output) {
+        fmt.Fprint(out, output[len(session.output):])
+    } else {
+        fmt.Fprint(out, output)
+    }
+    session.output, session.machine, session.labels = output, machine, image.labels
+    session.slots = map[string]string{}
+    for _, slot := range backend.stack_slots {
+        // the last slot it got is the one it's in
+        if slot.procedure == "main" {
+            session.slots[slot.name] = slot.location
+        }
+    }
+    if err != nil {
+        fmt.Fprintf(out, "Error: %v\n", err)
+    }
+}
+
+// returns the address ':mem' shows, which is a variable of main
+// (its stack slot), a label, a memory operand (e.g. '-4($sp)'), or
+// a number
+func (session *Repl) __address(text string) (uint32, error) {
+    if location, ok := session.slots[text]; ok {
+        text = location
+    }
+    if address, ok := session.labels[text]; ok {
+        return address, nil
+    }
+    if offset, base, ok := split_memory(text); ok {
+        number, known := register_numbers[base]
+        value, valid := parse_immediate(offset)
+        if known && valid {
+            return session.machine.registers[number] + uint32(value), nil
+        }
+    }
+    if value, ok := parse_immediate(text); ok {
+        return uint32(value), nil
+    }
+    return 0, fmt.Errorf("'%s' isn't a variable, a label, or an address", text)
+}
+
+// runs a command of the session, about the machine the last
+// statement ran on (with '-run'); the commands are:
+// :regs: show the registers
+// :mem <address> [words]: show the words at a variable, a label,
+// or an address (see '__address')
+func (session *Repl) command(line string, out io.Writer) {
+    var fields []string = strings.Fields(line)
+    if fields[0] != ":regs" && fields[0] != ":mem" {
+        fmt.Fprintf(out, "Error: unknown command '%s'\n", fields[0])
+        return
+    }
+    if session.machine == nil {
+        fmt.Fprintln(out, "Error: nothing has run yet (see '-run')")
+        return
+    }
+    var machine *Machine = session.machine
+    if fields[0] == ":regs" {
+        for number, name := range register_names() {
+            fmt.Fprintf(out, "%-6s0x%08x\n", name, machine.registers[number])
+        }
+        fmt.Fprintf(out, "%-6s0x%08x\n%-6s0x%08x\n", "hi", machine.hi, "lo", machine.lo)
+        return
+    }
+    var words int = 1
+    if len(fields) == 3 {
+        if _, err := fmt.Sscan(fields[2], &words); err != nil || words < 1 {
+            fields = nil
+        }
+    }
+    if len(fields) != 2 && len(fields) != 3 {
+        fmt.Fprintln(out, "Error: usage: :mem <address> [words]")
+        return
+    }
+    address, err := session.__address(fields[1])
+    if err != nil {
+        fmt.Fprintf(out, "Error: %v\n", err)
+        return
+    }
+    defer func() {
+        if recovered := recover(); recovered != nil {
+            fmt.Fprintf(out, "Error: %v\n", recovered)
+        }
+    }()
+    for i := 0; i < words; i++ {
+        var value uint32 = machine.load(address+uint32(4*i), 4)
+        fmt.Fprintf(out, "0x%08x: 0x%08x (%d)\n", address+uint32(4*i), value, int32(value))
+    }
+}
+
+// scg repl [-run] [-target target]
+// reads statements from stdin, one JSON node per line, and shows
+// the code each one adds (see 'enter'), or commands starting with
+// ':' (see 'command'); variables are usually used by later
+// statements, so they aren't reported as unused
+func repl(args []string) {
+    var (
+        flags   *flag.FlagSet  = flag.NewFlagSet("repl", flag.ExitOnError)
+        options BackendOptions = default_backend_options()
+        session Repl
+    )
+    flags.BoolVar(&session.run, "run", false, "run the program on the emulator after every statement, showing its output")
+    flags.StringVar(&options.target, "target", options.target, "the target to generate code for")
+    flags.Parse(args)
+    options.warnings["unused-variable"] = "ignore"
+    session.options = options
+    var scanner *bufio.Scanner = bufio.NewScanner(os.Stdin)
+    scanner.Buffer(nil, max_request_bytes)
+    for fmt.Fprint(os.Stderr, "> "); scanner.Scan(); fmt.Fprint(os.Stderr, "> ") {
+        if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, ":") {
+            session.command(line, os.Stdout)
+        } else if line != "" {
+            session.enter(line, os.Stdout)
+        }
+    }
+    fmt.Fprintln(os.Stderr)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+)
+
+// with -run, every statement runs the compiled program on the
+// emulator, showing only what's new in its output, and ':regs' and
+// ':mem' show the machine main left behind
+func Test_repl_run(t *testing.T) {
+    var session Repl
+    session.options, session.run = default_backend_options(), true
+    session.options.warnings["unused-variable"] = "ignore"
+    var steps = []struct {
+        line string
+        // what the output has, and what it doesn't
+        expected   []string
+        unexpected []string
+    }{
+        {":regs", []string{"Error: nothing has run yet (see '-run')"}, nil},
+        {encode_ast(Assignment{"a", Integer{"42"}}), []string{"+ li $t0,42"}, nil},
+        {encode_ast(Call{"Printf", []interface{}{String{"%d\\n"}, ArithmeticOp{Ident{"a"}, "mul", Integer{"2"}}}}),
+            []string{"84\n"}, nil},
+        {encode_ast(Call{"Printf", []interface{}{String{"%d!\\n"}, Ident{"a"}}}), []string{"42!\n"}, []string{"84\n"}},
+        {":mem a", []string{": 0x0000002a (42)\n"}, nil},
+        {":mem -4($sp) 2", []string{"0x7fffeff8: 0x0000002a (42)\n", "0x7fffeffc: "}, nil},
+        {":regs", []string{"$zero 0x00000000\n", "$sp   0x7fffeffc\n", "$ra   0xfffffff0\n"}, nil},
+        {":mem b", []string{"Error: 'b' isn't a variable, a label, or an address"}, nil},
+        {":mem a 0", []string{"Error: usage: :mem <address> [words]"}, nil},
+        {":mem 0x10", []string{"Error: 0x00000010 is outside the program's memory"}, nil},
+        {":step", []string{"Error: unknown command ':step'"}, nil},
+    }
+    for _, step := range steps {
+        var out bytes.Buffer
+        if strings.HasPrefix(step.line, ":") {
+            session.command(step.line, &out)
+        } else {
+            session.enter(step.line, &out)
+        }
+        for _, expected := range step.expected {
+            if !strings.Contains(out.String(), expected) {
+                t.Errorf("%s printed\n%s\nwithout %q", step.line, out.String(), expected)
+            }
+        }
+        for _, unexpected := range step.unexpected {
+            if strings.Contains(out.String(), unexpected) {
+                t.Errorf("%s printed\n%s\nwith %q", step.line, out.String(), unexpected)
+            }
+        }
+    }
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "reflect"
+)
+
+// the arguments of builtins that are written to (e.g. the buffer
+// of 'read'), by position; a string literal passed there is a
+// buffer, and has to stay writable
+var written_args = map[string][]int{
+    "read":   {1},
+    "memcpy": {0},
+    "memset": {0},
+}
+
+// returns whether a string literal is only ever read, so that it
+// can go in the read-only data (see '__data_sections'); that's the
+// case for the text of 'Printf' and interpolated strings, the
+// strings indexed into or sliced, and the arguments of builtins,
+// unless the same text is passed where the builtin writes (e.g.
+// read(0, "    ", 4)), since a literal can't tell which of the
+// arguments it is.
+// user and C functions can write to any argument, and strings
+// stored in variables (or returned) may end up anywhere, so they
+// stay writable
+func (backend *MIPSBackend) read_only_literal(literal String, parent interface{}) bool {
+    switch parent := parent.(type) {
+    case Call:
+        // user functions take precedence over builtins (see 'call')
+        if _, ok := backend.__resolve_function(parent.name); ok || !is_builtin(parent.name) {
+            return false
+        }
+        return !writes_literal(parent, literal)
+    case Index, Slice, Interp:
+        return true
+    }
+    return false
+}
+
+// returns whether a call writes to an argument that is the same
+// string literal
+func writes_literal(call Call, literal String) bool {
+    for _, i := range written_args[call.name] {
+        if i < len(call.args) && reflect.DeepEqual(call.args[i], literal) {
+            return true
+        }
+    }
+    return false
+}
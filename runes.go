@@ -0,0 +1,36 @@
+package main
+
+import (
+    "fmt"
+)
+
+// rune_at(s, i) => int
+// next_rune(s, i) => int
+// the code point that starts at byte i of s, and the index of
+// the byte after it; these iterate over the code points of a
+// string (rune_at returns 0 at the end of one). both call
+// their runtime library routine; converts:
+// rune_at(s, i)
+// =>
+// <code for s and i>
+// move $a0, $t0
+// move $a1, $t1
+// jal __scg_rune_at
+// move $t2, $v0
+// the string is expected to be valid UTF-8 (literals are checked
+// by '__emit_string'); stray continuation bytes are returned as
+// they are, and count as a code point of their own
+func (backend *MIPSBackend) rune_op(node *Call) {
+    if len(node.args) != 2 {
+        panic(fmt.Sprintf("'%s' expects 2 argument(s), got %d", node.name, len(node.args)))
+    }
+    backend.__expect_type(node, 0, "string")
+    backend.__expect_type(node, 1, "int")
+    var library string = "__scg_" + node.name
+    backend.__load_args(node.args)
+    // 'jal' overwrites $ra, which the caller needs to return
+    backend.__save_ra()
+    backend.__emit_local_call(library)
+    backend.runtime_used[library] = true
+    backend.__push_result("$v0")
+}
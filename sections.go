@@ -0,0 +1,125 @@
+package main
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+)
+
+// the user text segment of MARS (in its default memory
+// configuration), where '.text <address>' can start code; the kernel
+// text (from 0x80000000) is only for the exception handler
+const (
+    mars_text_start = 0x00400000
+    mars_text_end   = 0x0ffffffc
+)
+
+// matches the names of sections (e.g. ".text.hot")
+var valid_section *regexp.Regexp = regexp.MustCompile(`^\.?[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// puts functions (and maybe main) in a section of their own (see
+// 'Section'); the section has to be declared at the top level, and
+// a function can only be in one section. converts:
+// section .text.hot { f }
+// =>
+// .section .text.hot,"ax",@progbits
+// f:
+// <code for f>
+// after the procedures of the text section (see '__section_header'
+// for the other targets)
+func (backend *MIPSBackend) section(node *Section, parent interface{}) {
+    if _, ok := parent.(Program); !ok {
+        panic("sections have to be declared at the top level")
+    }
+    if !valid_section.MatchString(node.name) || section_directives[node.name] {
+        panic(fmt.Sprintf("'%s' can't be the name of a section", node.name))
+    }
+    for _, other := range backend.sections {
+        if other.name == node.name {
+            panic(fmt.Sprintf("section '%s' is declared twice", node.name))
+        }
+    }
+    if node.address != "" {
+        address, ok := parse_immediate(node.address)
+        if !ok || address < 0 || address > 0xffffffff || address%4 != 0 {
+            panic(fmt.Sprintf("section '%s' can't start at %s, which isn't a word address", node.name, node.address))
+        }
+        if backend.target.capabilities["sections"] && !backend.target.capabilities["bare_metal"] {
+            // where it goes is up to the operating system's linker script
+            panic(fmt.Sprintf("sections can't be put at an address on target '%s'", backend.options.target))
+        }
+        if !backend.target.capabilities["sections"] && (address < mars_text_start || address > mars_text_end) {
+            panic(fmt.Sprintf("section '%s' can't start at %s, which is outside the text segment (0x%08x-0x%08x)",
+                node.name, node.address, mars_text_start, mars_text_end))
+        }
+    }
+    for _, name := range node.functions {
+        var label string = "main"
+        if name != "main" {
+            resolved, ok := backend.__resolve_function(name)
+            if _, extern := backend.options.externs[name]; !ok || extern {
+                panic(fmt.Sprintf("section '%s' places '%s', which isn't a function of the program", node.name, name))
+            }
+            label = resolved
+        }
+        if other, ok := backend.procedure_sections[label]; ok {
+            panic(fmt.Sprintf("'%s' is in section '%s' already", name, other))
+        }
+        backend.procedure_sections[label] = node.name
+    }
+    backend.sections = append(backend.sections, *node)
+}
+
+// orders procedures by section: the ones in the text section first,
+// then the ones of each section (see 'section') in the order the
+// sections were declared; procedures in the same section keep their
+// order
+func (backend *MIPSBackend) __by_section(procedures []Procedure) []Procedure {
+    var positions map[string]int = map[string]int{}
+    for i, section := range backend.sections {
+        positions[section.name] = i + 1
+    }
+    sort.SliceStable(procedures, func(i, j int) bool {
+        return positions[backend.procedure_sections[procedures[i].label]] <
+            positions[backend.procedure_sections[procedures[j].label]]
+    })
+    return procedures
+}
+
+// returns the line that starts a section (see 'section'); converts:
+// Section{".hot", "0x00500000", {"main"}}
+// =>
+// .section .hot,"ax",@progbits
+// on targets whose assemblers have named sections (the "sections"
+// capability), where the linker places it (see 'linker_script'),
+// and:
+// .text 0x00500000
+// on MARS, which only has the one text segment, but can start code
+// at an address there (see 'mars_text_start'); sections without an address are only named
+// in a comment on MARS
+func (backend *MIPSBackend) __section_header(name string) string {
+    var section Section
+    for _, other := range backend.sections {
+        if other.name == name {
+            section = other
+        }
+    }
+    switch {
+    case backend.target.capabilities["sections"]:
+        return fmt.Sprintf(".section %s,\"ax\",@progbits\n", section.name)
+    case section.address != "":
+        return fmt.Sprintf(".text %s\n", section.address)
+    }
+    return with_comment(".text", section.name) + "\n"
+}
+
+// returns the code that ends a section of the text and starts the
+// next one (see 'section'); the text section itself ("") ends with
+// the raw lines placed at its end (see 'raw')
+func (backend *MIPSBackend) __switch_section(from string, to string) string {
+    var ret string
+    if from == "" {
+        ret = backend.__raw_text("end")
+    }
+    return ret + backend.__section_header(to)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+// on MARS, a section can only start code in the user text segment
+func Test_section_addresses(t *testing.T) {
+    var cases = map[string]string{
+        "0x00400000": "",
+        "0x00500000": "",
+        "0x0ffffffc": "",
+        "0x10000000": "outside the text segment",
+        "0x80000180": "outside the text segment",
+        "0xbfc00000": "outside the text segment",
+        "0x00000100": "outside the text segment",
+        "0x00400002": "isn't a word address",
+    }
+    for address, expected := range cases {
+        var program Program = Program{[]interface{}{
+            Section{".boot", address, []string{"main"}},
+            Call{"Printf", []interface{}{String{"hi\\n"}}},
+        }}
+        _, diagnostics, ok := try_generate(program, default_backend_options())
+        if expected == "" {
+            if !ok {
+                t.Errorf("%s: %s", address, strings.Join(diagnostics, "\n"))
+            }
+            continue
+        }
+        if ok || !strings.Contains(strings.Join(diagnostics, "\n"), expected) {
+            t.Errorf("%s was reported as %v, expected '%s'", address, diagnostics, expected)
+        }
+    }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "time"
+)
+
+// the largest ast 'serve' accepts, in bytes
+const max_request_bytes = 1 << 20
+
+// returns the options a compile request asks for, given a way to
+// look each one up ("" if it isn't set); e.g. the query
+// ?target=linux&O=2&Werror=1&pic=1 for 'serve'
+func compile_options(get func(name string) string) (BackendOptions, error) {
+    var options BackendOptions = default_backend_options()
+    if target := get("target"); target != "" {
+        if _, ok := targets[target]; !ok {
+            return options, fmt.Errorf("unknown target '%s'", target)
+        }
+        options.target = target
+    }
+    switch get("O") {
+    case "", "0", "1":
+    case "2":
+        options.optimize = 2
+    default:
+        return options, fmt.Errorf("unknown optimization level '%s'", get("O"))
+    }
+    options.warnings_as_errors = get("Werror") == "1"
+    options.pic = get("pic") == "1"
+    return options, nil
+}
+
+// returns the handler for POST /compile with a JSON ast (see
+// 'decode_ast') as the body; responds with the artifact (see
+// 'Artifact.MarshalJSON'):
+// {"assembly": "...", "diagnostics": ["Warning: ..."], "ok": true, ...}
+// where "ok" is false (and "assembly" is empty) if the program
+// has errors, or if compiling it took longer than the timeout (0
+// for no limit) or the client went away. requests that aren't
+// compile requests at all get an error status and a plain-text
+// message
+func compile_handler(timeout time.Duration) http.HandlerFunc {
+    return func(writer http.ResponseWriter, request *http.Request) {
+        handle_compile(writer, request, timeout)
+    }
+}
+
+// see 'compile_handler'
+func handle_compile(writer http.ResponseWriter, request *http.Request, timeout time.Duration) {
+    if request.Method != http.MethodPost {
+        writer.Header().Set("Allow", http.MethodPost)
+        http.Error(writer, "only POST is supported", http.StatusMethodNotAllowed)
+        return
+    }
+    options, err := compile_options(request.URL.Query().Get)
+    if err != nil {
+        http.Error(writer, err.Error(), http.StatusBadRequest)
+        return
+    }
+    data, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, max_request_bytes))
+    if err != nil {
+        http.Error(writer, err.Error(), http.StatusRequestEntityTooLarge)
+        return
+    }
+    var ctx context.Context = request.Context()
+    if timeout != 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+    writer.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(writer).Encode(new_compiler(options).compile(ctx, data))
+}
+
+// scg serve [-addr address] [-timeout duration]
+// runs the compile service (see 'compile_handler') until it fails
+func serve(args []string) {
+    var (
+        flags   *flag.FlagSet = flag.NewFlagSet("serve", flag.ExitOnError)
+        address *string       = flags.String("addr", "localhost:8080", "the address to listen on")
+        timeout *time.Duration = flags.Duration("timeout", 10*time.Second, "give up on a compilation after this long (0 for no limit)")
+        mux     *http.ServeMux = http.NewServeMux()
+    )
+    flags.Parse(args)
+    mux.HandleFunc("/compile", compile_handler(*timeout))
+    fmt.Fprintf(os.Stderr, "serving on http://%s/compile\n", *address)
+    if err := http.ListenAndServe(*address, mux); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// a response of the compile service (see 'Artifact.MarshalJSON')
+type CompileResponse struct {
+    Assembly    string   `json:"assembly"`
+    Ok          bool     `json:"ok"`
+    Diagnostics []string `json:"diagnostics"`
+    StackSlots  []struct {
+        Name string `json:"name"`
+    } `json:"stack_slots"`
+}
+
+// posts a body to the compile service, returning the status and
+// the body of the response
+func post_compile(handler http.HandlerFunc, query string, body string) (int, string) {
+    var (
+        recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+        request  *http.Request              = httptest.NewRequest(http.MethodPost, "/compile"+query, strings.NewReader(body))
+    )
+    handler(recorder, request)
+    return recorder.Code, recorder.Body.String()
+}
+
+// 'post_compile' for requests that compile, returning the artifact
+func compile_request(t *testing.T, handler http.HandlerFunc, query string, ast interface{}) CompileResponse {
+    status, body := post_compile(handler, query, encode_ast(ast))
+    var response CompileResponse
+    if status != http.StatusOK {
+        t.Fatalf("%s responded with %d: %s", query, status, body)
+    }
+    if err := json.Unmarshal([]byte(body), &response); err != nil {
+        t.Fatalf("%v in:\n%s", err, body)
+    }
+    return response
+}
+
+var (
+    // a program with a warning
+    warned_program Program = Program{[]interface{}{
+        Assignment{"unused", Integer{"1"}},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Integer{"2"}}},
+    }}
+    // a program with an error
+    broken_program Program = Program{[]interface{}{Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"missing"}}}}}
+    // a program without diagnostics
+    clean_program Program = Program{[]interface{}{
+        Assignment{"b", Integer{"3"}},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"b"}}},
+    }}
+)
+
+// backends go back to the pool after each request (see
+// 'Compiler.compile'), and nothing one request reported shows up
+// in the next, in turn or at the same time
+func Test_serve_diagnostics(t *testing.T) {
+    var handler http.HandlerFunc = compile_handler(0)
+    for i := 0; i < 3; i++ {
+        if response := compile_request(t, handler, "", warned_program); !response.Ok || len(response.Diagnostics) != 1 ||
+            response.Diagnostics[0] != "Warning: 'unused' is never used [-Wunused-variable]" {
+            t.Errorf("the warned program responded with %+v", response)
+        }
+        if response := compile_request(t, handler, "", broken_program); response.Ok || response.Assembly != "" ||
+            len(response.Diagnostics) != 1 || !strings.HasPrefix(response.Diagnostics[0], "Error: ") {
+            t.Errorf("the broken program responded with %+v", response)
+        }
+        var response CompileResponse = compile_request(t, handler, "", clean_program)
+        if !response.Ok || len(response.Diagnostics) != 0 {
+            t.Errorf("the clean program responded with %+v", response)
+        }
+        for _, slot := range response.StackSlots {
+            if slot.Name != "b" {
+                t.Errorf("the clean program has a slot for '%s'", slot.Name)
+            }
+        }
+    }
+    var (
+        expected CompileResponse = compile_request(t, handler, "", clean_program)
+        group    sync.WaitGroup
+    )
+    for i := 0; i < 16; i++ {
+        group.Add(1)
+        go func(program Program) {
+            defer group.Done()
+            status, body := post_compile(handler, "", encode_ast(program))
+            var response CompileResponse
+            if err := json.Unmarshal([]byte(body), &response); status != http.StatusOK || err != nil {
+                t.Errorf("responded with %d: %s", status, body)
+            } else if program.nodes[0] == clean_program.nodes[0] &&
+                (response.Assembly != expected.Assembly || len(response.Diagnostics) != 0) {
+                t.Errorf("the clean program responded with %+v at the same time as others", response)
+            }
+        }([]Program{warned_program, broken_program, clean_program}[i%3])
+    }
+    group.Wait()
+}
+
+// the query chooses the target, the optimization level, whether
+// the code is position-independent and whether warnings are errors
+func Test_serve_options(t *testing.T) {
+    var handler http.HandlerFunc = compile_handler(0)
+    for _, query := range []string{"?target=linux", "?O=2", "?target=linux-n32&O=2", "?target=linux&pic=1"} {
+        options, err := compile_options(httptest.NewRequest(http.MethodPost, "/compile"+query, nil).URL.Query().Get)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if options.pic != strings.Contains(query, "pic=1") {
+            t.Errorf("%s asked for pic: %t", query, options.pic)
+        }
+        var backend MIPSBackend = new_mips_backend_with(clean_program, options)
+        if response := compile_request(t, handler, query, clean_program); response.Assembly != backend.assemble() {
+            t.Errorf("%s generated\n%s\ninstead of\n%s", query, response.Assembly, backend.assemble())
+        }
+    }
+    if response := compile_request(t, handler, "?Werror=1", warned_program); response.Ok ||
+        len(response.Diagnostics) == 0 || !strings.HasPrefix(response.Diagnostics[0], "Error: 'unused' is never used") {
+        t.Errorf("-Werror responded with %+v", response)
+    }
+}
+
+// requests that aren't compile requests get an error status, and
+// ones that can't be compiled get an artifact without assembly
+func Test_serve_errors(t *testing.T) {
+    var handler http.HandlerFunc = compile_handler(0)
+    var recorder *httptest.ResponseRecorder = httptest.NewRecorder()
+    handler(recorder, httptest.NewRequest(http.MethodGet, "/compile", nil))
+    if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodPost {
+        t.Errorf("GET responded with %d (Allow: %s)", recorder.Code, recorder.Header().Get("Allow"))
+    }
+    var cases = []struct {
+        query    string
+        body     string
+        status   int
+        expected string
+    }{
+        {"?target=vax", "{}", http.StatusBadRequest, "unknown target 'vax'\n"},
+        {"?O=3", "{}", http.StatusBadRequest, "unknown optimization level '3'\n"},
+        {"", strings.Repeat(" ", max_request_bytes+1), http.StatusRequestEntityTooLarge, "http: request body too large\n"},
+    }
+    for _, test := range cases {
+        if status, body := post_compile(handler, test.query, test.body); status != test.status || body != test.expected {
+            t.Errorf("%s responded with %d: %q, expected %d: %q", test.query, status, body, test.status, test.expected)
+        }
+    }
+    for body, expected := range map[string]string{
+        `{"node": "Program"`: "Error: unexpected EOF",
+        `{"node": "Loop"}`:   "Error: $.node: unknown node type 'Loop'",
+    } {
+        status, data := post_compile(handler, "", body)
+        var response CompileResponse
+        if err := json.Unmarshal([]byte(data), &response); err != nil || status != http.StatusOK || response.Ok ||
+            len(response.Diagnostics) != 1 || response.Diagnostics[0] != expected {
+            t.Errorf("%s responded with %d: %s", body, status, data)
+        }
+    }
+    // a compilation that runs out of time stops with an error
+    var response CompileResponse = compile_request(t, compile_handler(time.Nanosecond), "", clean_program)
+    if response.Ok || len(response.Diagnostics) != 1 ||
+        response.Diagnostics[0] != "Error: compilation stopped: context deadline exceeded" {
+        t.Errorf("a compilation that timed out responded with %+v", response)
+    }
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+    "fmt"
+)
+
+// returns the size of a type in bytes, which is also its alignment
+// (every type is a scalar); the narrow integer types of 'cast_types'
+// take as many bytes as they have bits, while ints, strings (which
+// are addresses), and file descriptors take a word
+func type_size(name string, word_size uint) (uint, bool) {
+    switch name {
+    case "int", "string", "fd":
+        return word_size, true
+    }
+    if cast_type, ok := cast_types[name]; ok {
+        return cast_type.bits / 8, true
+    }
+    return 0, false
+}
+
+// returns the value of a 'sizeof' or 'alignof' call
+func (backend *MIPSBackend) __size_query(node *Call) uint {
+    if len(node.args) != 1 {
+        panic(fmt.Sprintf("'%s' expects 1 argument(s), got %d", node.name, len(node.args)))
+    }
+    name, ok := node.args[0].(String)
+    if !ok {
+        panic(fmt.Sprintf("the argument of '%s' must be the name of a type", node.name))
+    }
+    size, ok := type_size(name.value, backend.target.word_size)
+    if !ok {
+        panic(fmt.Sprintf("unknown type '%s' in '%s'", name.value, node.name))
+    }
+    return size
+}
+
+// returns an expression with 'sizeof' and 'alignof' calls replaced
+// by their values, so that e.g. 'arithmetic_op' can use them as
+// immediates; anything else is returned as it is
+func (backend *MIPSBackend) __fold_size(__node interface{}) interface{} {
+    node, ok := __node.(Call)
+    if !ok || (node.name != "sizeof" && node.name != "alignof") {
+        return __node
+    }
+    if _, ok := backend.__resolve_function(node.name); ok {
+        return __node
+    }
+    return Integer{fmt.Sprint(backend.__size_query(&node))}
+}
+
+// sizeof(type) => int
+// alignof(type) => int
+// where 'type' is a string naming the type (see 'type_size');
+// both are known at compile time, so converts:
+// sizeof("int16")
+// =>
+// li $t0, 2
+func (backend *MIPSBackend) size_query(node *Call) {
+    backend._integer(&Integer{fmt.Sprint(backend.__size_query(node))})
+    backend.__comment_folded(*node)
+}
+
+// gives the instruction emitted last a comment saying it has the
+// value of a 'sizeof' or 'alignof' call (see 'comment'), if
+// '__fold_size' folded the expression it was emitted for; converts:
+// sizeof("int16")
+// =>
+// li $t0, 2                      # folded from sizeof("int16")
+func (backend *MIPSBackend) __comment_folded(__node interface{}) {
+    if _, ok := backend.__fold_size(__node).(Integer); !ok {
+        return
+    }
+    if node, ok := __node.(Call); ok {
+        backend.__comment_last(fmt.Sprintf("folded from %s(\"%s\")", node.name, node.args[0].(String).value))
+    }
+}
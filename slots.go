@@ -0,0 +1,82 @@
+package main
+
+import (
+    "strings"
+)
+
+// adds every name used in a nested function or the exception
+// handler in 'node' to 'pinned'; those can run at any time
+// (whenever the function is called, or an exception happens),
+// so the variables they use have to keep their slots
+func pin_names(__node interface{}, pinned map[string]bool) {
+    var all = func(nodes []interface{}) {
+        var names map[string]string = map[string]string{}
+        for _, item := range nodes {
+            collect_names(item, "", names)
+            pin_names(item, pinned)
+        }
+        for name := range names {
+            pinned[name] = true
+        }
+    }
+    switch node := __node.(type) {
+    case If:
+        for _, item := range append(append([]interface{}{}, node.then...), node.otherwise...) {
+            pin_names(item, pinned)
+        }
+    case Function:
+        all(node.body)
+    case ExceptionHandler:
+        all(node.nodes)
+    }
+}
+
+// returns the index of the last statement that uses each variable;
+// the code has no loops, so a variable isn't needed after that.
+// variables that are pinned (see 'pin_names') are left out
+func last_uses(nodes []interface{}) map[string]int {
+    var (
+        last   map[string]int  = map[string]int{}
+        pinned map[string]bool = map[string]bool{}
+    )
+    for i, node := range nodes {
+        var names map[string]string = map[string]string{}
+        collect_names(node, "", names)
+        for name := range names {
+            last[name] = i
+        }
+        pin_names(node, pinned)
+    }
+    for name := range pinned {
+        delete(last, name)
+    }
+    return last
+}
+
+// gives the slots of the variables last used by the i-th statement
+// (see 'last_uses') back to '__variable_slot', so that variables
+// assigned later can share them; converts:
+// a = 1
+// Printf("%d", a)
+// b = 2
+// =>
+// li $t0, 1
+// sw $t0, -4($sp)
+// ...
+// li $t2, 2
+// sw $t2, -4($sp)
+// such that a's slot (-4) is reused for b
+func (backend *MIPSBackend) __free_slots(last map[string]int, i int) {
+    if !backend.options.share_slots {
+        return
+    }
+    for _, name := range sorted_keys(last) {
+        slot, ok := backend.access_loc[name]
+        // parameters past the fourth live in the caller's frame
+        if last[name] != i || !ok || !strings.HasPrefix(slot, "-") {
+            continue
+        }
+        backend.free_slots = append(backend.free_slots, slot)
+        delete(backend.access_loc, name)
+    }
+}
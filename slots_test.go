@@ -0,0 +1,107 @@
+package main
+
+import (
+    "testing"
+)
+
+// variables whose uses overlap (in the branches of one 'if', or
+// through a nested function that runs after their last use in the
+// code around it) keep their slots, and the ones that come after
+// them can share those; the program prints the same either way
+func Test_slot_sharing(t *testing.T) {
+    var (
+        sum = func(left string, right string) ArithmeticOp {
+            return ArithmeticOp{Ident{left}, "addu", Ident{right}}
+        }
+        printed = func(format string, args ...interface{}) Call {
+            return Call{"Printf", append([]interface{}{String{format}}, args...)}
+        }
+    )
+    // returns the statements, where 'kept' is captured by a nested
+    // function if there can be one (top-level functions don't see
+    // main's variables)
+    var statements = func(nested bool) []interface{} {
+        var kept interface{} = ArithmeticOp{Ident{"kept"}, "mul", Integer{"2"}}
+        var g interface{} = ExprStmt{Call{"id", []interface{}{Ident{"kept"}}}}
+        if nested {
+            // 'kept' is last used by 'g', which runs after 'w' takes
+            // a slot
+            g, kept = Function{"g", nil, []interface{}{Return{kept}}, false}, Call{"g", nil}
+        }
+        return []interface{}{
+            Assignment{"a", Integer{"5"}},
+            Assignment{"b", Integer{"7"}},
+            Assignment{"c", Call{"id", []interface{}{Integer{"1"}}}},
+            // 'a' and 'b' are last used in different branches, and
+            // 'x' is assigned in both
+            If{Ident{"c"}, []interface{}{
+                Assignment{"x", sum("a", "a")},
+            }, []interface{}{
+                Assignment{"x", sum("b", "b")},
+            }},
+            // these can take the slots of 'a' and 'b'
+            Assignment{"y", Integer{"100"}},
+            Assignment{"z", sum("x", "y")},
+            Assignment{"kept", Integer{"-3"}},
+            g,
+            Assignment{"w", Integer{"11"}},
+            If{Hint{ArithmeticOp{Ident{"w"}, "slt", Ident{"z"}}, false}, []interface{}{
+                // first assigned here, then used after the 'if'
+                Assignment{"v", sum("w", "w")},
+            }, []interface{}{
+                Assignment{"v", sum("z", "w")},
+            }},
+            printed("%d %d %d %d\\n", Ident{"x"}, Ident{"z"}, Ident{"v"}, kept),
+            Assignment{"last", Call{"id", []interface{}{ArithmeticOp{Ident{"v"}, "subu", kept}}}},
+            printed("%d\\n", Ident{"last"}),
+        }
+    }
+    var program Program = Program{[]interface{}{
+        Function{"id", []string{"n"}, []interface{}{Return{Ident{"n"}}}, false},
+        // the same statements in a function and in main
+        Function{"run", nil, append(statements(true), Return{Ident{"last"}}), false},
+        printed("%d\\n", Call{"run", nil}),
+    }}
+    program.nodes = append(program.nodes, statements(false)...)
+    for _, share_slots := range []bool{true, false} {
+        for _, inline_threshold := range []int{0, 8} {
+            for _, target := range []string{"mars", "linux-n32"} {
+                var options BackendOptions = default_backend_options()
+                options.target, options.share_slots, options.inline_threshold = target, share_slots, inline_threshold
+                if err := check_on_target(program, options); err != nil {
+                    t.Errorf("%s (share_slots: %t, -finline-threshold=%d): %v", target, share_slots, inline_threshold, err)
+                }
+            }
+        }
+        // the slots of each procedure, and how many variables
+        // shared one
+        var options BackendOptions = default_backend_options()
+        options.share_slots = share_slots
+        var (
+            backend MIPSBackend                = new_mips_backend_with(program, options)
+            owners  map[string]map[string]bool = map[string]map[string]bool{}
+            shared  map[string]int             = map[string]int{}
+            kept    string
+        )
+        for _, slot := range backend.stack_slots {
+            var key string = slot.procedure + " " + slot.location
+            if owners[key] == nil {
+                owners[key] = map[string]bool{}
+            }
+            owners[key][slot.name] = true
+            if len(owners[key]) == 2 {
+                shared[slot.procedure]++
+            }
+            // nothing takes the slot of 'kept' while 'g' can still
+            // run
+            if slot.procedure == "run" && slot.name == "kept" {
+                kept = slot.location
+            } else if slot.procedure == "run" && slot.location == kept {
+                t.Errorf("'%s' took the slot of 'kept' (%s)", slot.name, kept)
+            }
+        }
+        if share_slots && (shared["main"] == 0 || shared["run"] == 0) || !share_slots && len(shared) != 0 {
+            t.Errorf("share_slots: %t, but %v slot(s) were shared", share_slots, shared)
+        }
+    }
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// the extension of the files 'scg snapshot' records its output in,
+// next to each input
+const golden_extension = ".golden"
+
+// returns what a program compiles to, for 'scg snapshot'; its
+// diagnostics come first (as comments, so that the rest stays
+// assembly), followed by the code, if there were no errors
+func snapshot_output(path string, options BackendOptions) string {
+    var ret strings.Builder
+    data, err := os.ReadFile(path)
+    var ast interface{}
+    if err == nil {
+        ast, err = decode_ast(data)
+    }
+    if err != nil {
+        fmt.Fprintf(&ret, "# Error: %v\n", err)
+        return ret.String()
+    }
+    backend, diagnostics, ok := try_generate(ast, options)
+    for _, diagnostic := range diagnostics {
+        // a diagnostic can span several lines (see 'summarize')
+        fmt.Fprintf(&ret, "# %s\n", strings.ReplaceAll(diagnostic, "\n", "\n# "))
+    }
+    if ok {
+        ret.WriteString(backend.assemble() + "\n")
+    }
+    return ret.String()
+}
+
+// returns the inputs (JSON asts) of a snapshot directory, sorted
+func snapshot_inputs(directory string) ([]string, error) {
+    inputs, err := filepath.Glob(filepath.Join(directory, "*.json"))
+    sort.Strings(inputs)
+    if err == nil && len(inputs) == 0 {
+        err = fmt.Errorf("%s has no inputs (*.json)", directory)
+    }
+    return inputs, err
+}
+
+// scg snapshot [flags] directory
+// scg verify [flags] directory
+// snapshot records what every input in a directory compiles to
+// (see 'snapshot_output') in a golden file next to it; verify
+// compiles them again and prints how the output changed (see
+// 'diff_lines'), exiting with 1 if it did for any of them (or if
+// one has no golden file). both take the flags of the default
+// command that change the code (e.g. -O2), which verify needs to
+// be given the same way as snapshot was; the stack discipline is
+// always checked (see '__check_discipline')
+func snapshot(command string, args []string) {
+    var (
+        flags   *flag.FlagSet  = flag.NewFlagSet(command, flag.ExitOnError)
+        options BackendOptions = default_backend_options()
+        changed int
+    )
+    backend_flags(flags, &options)
+    // snapshots are tests, so generator bugs fail them
+    options.check_discipline = true
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        fmt.Fprintf(os.Stderr, "usage: scg %s [flags] directory\n", command)
+        os.Exit(2)
+    }
+    inputs, err := snapshot_inputs(flags.Arg(0))
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    for _, input := range inputs {
+        var (
+            output string = snapshot_output(input, options)
+            golden string = strings.TrimSuffix(input, ".json") + golden_extension
+        )
+        if command == "snapshot" {
+            if err := os.WriteFile(golden, []byte(output), 0o644); err != nil {
+                fmt.Fprintln(os.Stderr, err)
+                os.Exit(1)
+            }
+            continue
+        }
+        recorded, err := os.ReadFile(golden)
+        if err != nil {
+            fmt.Printf("%s: no golden output (run 'scg snapshot' first)\n", input)
+            changed++
+            continue
+        }
+        if string(recorded) == output {
+            continue
+        }
+        fmt.Printf("%s: the output changed\n", input)
+        for _, change := range diff_lines(strings.Split(string(recorded), "\n"), strings.Split(output, "\n")) {
+            fmt.Printf("    %s\n", change)
+        }
+        changed++
+    }
+    if command == "snapshot" {
+        fmt.Printf("recorded %d output(s)\n", len(inputs))
+        return
+    }
+    if changed != 0 {
+        fmt.Printf("%d of %d output(s) changed\n", changed, len(inputs))
+        os.Exit(1)
+    }
+    fmt.Printf("all %d output(s) match\n", len(inputs))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+    "encoding/json"
+    "sort"
+)
+
+// returns the source map of the generated code (see '-source-map'):
+// the node (see 'origin') each line of the assembly was generated
+// for, as JSON; e.g.:
+// {"version": 1, "assembly": "prog.s", "input": "prog.json",
+//  "nodes": [{"node": "Integer", "value": 5}, ...],
+//  "lines": [{"line": 6, "node": 0}, ...]}
+// each node is written once (like 'encode_node'), and lines refer
+// to it by its index; lines without a node (e.g. prologues and the
+// runtime library) are left out. the input has no positions of its
+// own, so the nodes are what tools match against it
+func (backend *MIPSBackend) source_map(assembly string, input string) ([]byte, error) {
+    var (
+        numbers  []int
+        ids      map[string]int = map[string]int{}
+        nodes    []json.RawMessage = []json.RawMessage{}
+        mapped   []map[string]int = []map[string]int{}
+    )
+    _, lines := backend.assemble_mapped()
+    for number := range lines {
+        numbers = append(numbers, number)
+    }
+    sort.Ints(numbers)
+    for _, number := range numbers {
+        var node interface{} = backend.origin(lines[number])
+        if node == nil {
+            continue
+        }
+        var encoded string = encode_node(node, "")
+        id, ok := ids[encoded]
+        if !ok {
+            id = len(nodes)
+            ids[encoded] = id
+            nodes = append(nodes, json.RawMessage(encoded))
+        }
+        mapped = append(mapped, map[string]int{"line": number, "node": id})
+    }
+    return json.Marshal(map[string]interface{}{
+        "version":  1,
+        "assembly": assembly,
+        "input":    input,
+        "nodes":    nodes,
+        "lines":    mapped,
+    })
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// the file 'assemble_split' puts everything but the functions in
+const split_driver string = "main.s"
+
+// returns the program as one file of assembly per function (named
+// after its label), and a driver file ('split_driver') with the
+// rest: the data sections, main, the runtime library and the
+// exception handler; converts:
+// <data>
+// main: <code for main>
+// f: <code for f>
+// =>
+// main.s: <data and main>, and f.s:
+// .text
+// .globl f
+// f:
+// <code for f>
+// every label another file uses is global (the driver starts with
+// a '.globl' for each of its data labels and procedures), so the
+// files can be assembled on their own and linked, or assembled
+// together (e.g. by MARS's "assemble all files in directory"); a
+// change to one function only changes its file. position-independent
+// code can't be split, since it loads the data labels as local ones
+func (backend *MIPSBackend) assemble_split() map[string]string {
+    if backend.options.pic {
+        panic("position-independent code can't be split into files, since it treats the data labels as local")
+    }
+    var (
+        ret       map[string]string = map[string]string{}
+        functions []Procedure       = backend.procedures
+        files     []string
+    )
+    for _, procedure := range functions {
+        var (
+            name   string = procedure.label + ".s"
+            header string = ".text\n"
+        )
+        if name == split_driver {
+            panic(fmt.Sprintf("the file of '%s' would be the driver, '%s'", procedure.label, split_driver))
+        }
+        if section := backend.procedure_sections[procedure.label]; section != "" {
+            header = backend.__section_header(section)
+        }
+        ret[name] = header + fmt.Sprintf("    .globl %s\n", procedure.label) +
+            render_instructions(procedure.instructions())
+        files = append(files, name)
+    }
+    // the driver is the program without the functions
+    backend.procedures = nil
+    defer func() {
+        backend.procedures = functions
+    }()
+    var globals []string = []string{"main"}
+    for _, section := range []string{backend.data_section, backend.rodata_section, backend.bss_section} {
+        for _, line := range strings.Split(section, "\n") {
+            if label, ok := data_label(line); ok {
+                globals = append(globals, label)
+            }
+        }
+    }
+    for _, procedure := range backend.text_procedures(false) {
+        globals = append(globals, procedure.label)
+    }
+    var driver string
+    if len(files) != 0 {
+        sort.Strings(files)
+        driver = fmt.Sprintf("# the functions are in %s\n", strings.Join(files, ", "))
+    }
+    for _, label := range globals {
+        driver += fmt.Sprintf("    .globl %s\n", label)
+    }
+    ret[split_driver] = driver + backend.assemble()
+    return ret
+}
+
+// writes the files of 'assemble_split' to a directory, creating it
+// if it doesn't exist; the files that didn't change are left alone,
+// so that build tools only assemble the changed ones again (files
+// of functions that are gone are left alone too)
+func write_split(directory string, files map[string]string) error {
+    if err := os.MkdirAll(directory, 0o755); err != nil {
+        return err
+    }
+    for name, code := range files {
+        var (
+            path string = filepath.Join(directory, name)
+            data []byte = []byte(code + "\n")
+        )
+        if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+            continue
+        }
+        if err := os.WriteFile(path, data, 0o644); err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// the registers holding the values of the expressions being
+// generated; every expression pushes the register its value
+// ends up in, and whatever uses the value pops it
+type ValueStack struct {
+    // the register of each value, or its stack slot (e.g.
+    // "-12($sp)") if '__spill' moved it out of the register
+    registers []string
+    // the values below it belong to the statements around the
+    // one being generated (see 'statement'), and aren't spilled
+    floor int
+}
+
+// pushes the register holding a value
+func (stack *ValueStack) push(register string) {
+    stack.registers = append(stack.registers, register)
+}
+
+// pops the register holding the last value pushed
+func (stack *ValueStack) pop() string {
+    return stack.pop_n(1)[0]
+}
+
+// pops the registers holding the last 'count' values
+// pushed (in the order they were pushed)
+func (stack *ValueStack) pop_n(count int) []string {
+    if count < 0 || count > len(stack.registers) {
+        panic(InternalError(fmt.Sprintf("popping %d value(s) off a stack of %d", count, len(stack.registers))))
+    }
+    var i int = len(stack.registers) - count
+    var registers []string = append([]string{}, stack.registers[i:]...)
+    stack.registers = stack.registers[:i]
+    return registers
+}
+
+// returns the register holding the last value pushed,
+// without popping it
+func (stack *ValueStack) peek() string {
+    if len(stack.registers) == 0 {
+        panic(InternalError("peeking at an empty stack"))
+    }
+    return stack.registers[len(stack.registers)-1]
+}
+
+// returns the number of values on the stack
+func (stack *ValueStack) depth() int {
+    return len(stack.registers)
+}
+
+// pops values until only 'depth' are left
+func (stack *ValueStack) truncate(depth int) {
+    stack.pop_n(len(stack.registers) - depth)
+}
+
+// returns the registers holding every value on the
+// stack, from the bottom up
+func (stack *ValueStack) live() []string {
+    return append([]string{}, stack.registers...)
+}
+
+// moves the 'i'th value (from the bottom) to 'location'
+func (stack *ValueStack) move(i int, location string) {
+    stack.registers[i] = location
+}
+
+// returns true if a value is in a stack slot (see '__spill')
+// rather than a register
+func spilled(location string) bool {
+    return !strings.HasPrefix(location, "$")
+}
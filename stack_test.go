@@ -0,0 +1,56 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func Test_value_stack(t *testing.T) {
+    var stack ValueStack
+    stack.push("$t0")
+    stack.push("$t1")
+    stack.push("$t2")
+    if top := stack.peek(); top != "$t2" || stack.depth() != 3 {
+        t.Fatalf("peeked %s at depth %d, expected $t2 at depth 3", top, stack.depth())
+    }
+    if registers := stack.pop_n(2); !reflect.DeepEqual(registers, []string{"$t1", "$t2"}) {
+        t.Errorf("popped %v, expected them in the order they were pushed", registers)
+    }
+    if register := stack.pop(); register != "$t0" || stack.depth() != 0 {
+        t.Errorf("popped %s, leaving %d value(s)", register, stack.depth())
+    }
+    stack.push("$t3")
+    stack.push("$t4")
+    var live []string = stack.live()
+    live[0] = "$t9"
+    if stack.peek() != "$t4" || stack.live()[0] != "$t3" {
+        t.Errorf("changing what 'live' returned changed the stack to %v", stack.live())
+    }
+    stack.truncate(1)
+    if !reflect.DeepEqual(stack.live(), []string{"$t3"}) {
+        t.Errorf("truncating to 1 left %v", stack.live())
+    }
+}
+
+// popping or peeking past the bottom of the stack is a bug in
+// the generator, not in the program (see 'InternalError')
+func Test_value_stack_underflow(t *testing.T) {
+    var stack ValueStack
+    stack.push("$t0")
+    var uses = map[string]func(){
+        "pop_n":    func() { stack.pop_n(2) },
+        "truncate": func() { stack.truncate(2) },
+    }
+    // truncating to more values than there are pops a negative count
+    for name, use := range uses {
+        if _, ok := recovered_from(use).(InternalError); !ok {
+            t.Errorf("'%s' past the bottom didn't panic with an 'InternalError'", name)
+        }
+    }
+    stack.pop()
+    for name, use := range map[string]func(){"pop": func() { stack.pop() }, "peek": func() { stack.peek() }} {
+        if _, ok := recovered_from(use).(InternalError); !ok {
+            t.Errorf("'%s' on an empty stack didn't panic with an 'InternalError'", name)
+        }
+    }
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+)
+
+// the data directive for each width of static
+var static_directives = map[uint]string{8: ".byte", 16: ".half", 32: ".word"}
+
+// the instructions that load (and extend) each type of static
+var static_loads = map[CastType]string{
+    {8, true}: "lb", {8, false}: "lbu", {16, true}: "lh", {16, false}: "lhu", {32, true}: "lw",
+}
+
+// the instruction that stores each width of static
+var static_stores = map[uint]string{8: "sb", 16: "sh", 32: "sw"}
+
+// returns the label of a static's data
+func (backend *MIPSBackend) __static_label(name string) string {
+    return mangle(backend.options.module, "__static_"+name)
+}
+
+// declares a static; emits:
+// __static_a: .half 5
+// in the data section, such that a is a static int16 (or uint16)
+// with the value 5; the directive aligns the value to its width,
+// and a value that doesn't fit is converted, as in a 'Cast':
+// __static_b: .byte 44           # 300 as uint8
+// statics without a value go in the bss (see '__emit_bss')
+func (backend *MIPSBackend) static_variable(node *Static) {
+    if _, ok := backend.statics[node.name]; ok {
+        panic(fmt.Sprintf("static '%s' is declared twice", node.name))
+    }
+    cast_type, ok := cast_types[node.kind]
+    if !ok {
+        panic(fmt.Sprintf("unknown type '%s' for static '%s'", node.kind, node.name))
+    }
+    var value int64
+    if node.value != "" {
+        var err error
+        if value, err = strconv.ParseInt(node.value, 0, 64); err != nil {
+            panic(fmt.Sprintf("static '%s' has invalid value '%s'", node.name, node.value))
+        }
+    }
+    backend.statics[node.name] = *node
+    var label string = backend.__static_label(node.name)
+    if node.value == "" {
+        backend.__emit_bss(label, cast_type.bits/8)
+    } else {
+        var (
+            converted int32    = convert(int32(value), node.kind)
+            item      DataItem = DataItem{fmt.Sprintf("%s: %s %d", label, static_directives[cast_type.bits], converted), ""}
+        )
+        if int64(converted) != value {
+            item.comment = fmt.Sprintf("%s as %s", node.value, node.kind)
+        }
+        backend.__emit_data(item)
+    }
+    // every procedure can use it
+    backend.data_owners[label] = ""
+}
+
+// emits:
+// la $t0, __static_a
+// lh $t0, 0($t0)
+// such that $t0 is 'register', and a is a static int16
+func (backend *MIPSBackend) __load_static(name string, register string) {
+    var cast_type CastType = cast_types[backend.statics[name].kind]
+    backend.__emit_address(register, backend.__static_label(name))
+    backend.__emit_main(static_loads[cast_type], register, fmt.Sprintf("0(%s)", register), "")
+}
+
+// emits:
+// la $t1, __static_a
+// sh $t0, 0($t1)
+// such that $t0 is 'register', and a is a static int16; the
+// store truncates the value to the static's width
+func (backend *MIPSBackend) __store_static(name string, register string) {
+    var (
+        cast_type        CastType = cast_types[backend.statics[name].kind]
+        address_register string   = backend.__temp_register()
+    )
+    backend.__emit_address(address_register, backend.__static_label(name))
+    backend.__emit_main(static_stores[cast_type.bits], register, fmt.Sprintf("0(%s)", address_register), "")
+    backend.__free(address_register)
+}
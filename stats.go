@@ -0,0 +1,144 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// statistics about the generated code
+type Stats struct {
+    // real instructions (pseudo-instructions count as what
+    // they expand to), by opcode
+    opcodes map[string]int
+    loads   int
+    stores  int
+    // the size of the data section
+    data_bytes int
+    // the cycles it takes to run every instruction once
+    cycles int
+    // the most temporaries live at once, by procedure
+    pressure map[string]int
+    // the branches taken on the likely paths through the code (see
+    // 'taken_branches'), and how many were before block layout
+    // (-1 if the blocks weren't reordered)
+    taken_branches      int
+    taken_before_layout int
+}
+
+// returns the number of temporaries live at once at most in a list
+// of instructions; a value is live from the instruction that defines
+// it (see 'defines') to its last use before the register gets a new
+// value, since registers are reused from one statement to the next
+func (backend *MIPSBackend) register_pressure(instructions []Instruction) int {
+    var (
+        temps  map[string]bool = map[string]bool{}
+        ranges [][2]int
+        // the index in 'ranges' of each register's current value
+        current map[string]int = map[string]int{}
+    )
+    for _, register := range backend.target.temp_registers {
+        temps[register] = true
+    }
+    for i, instruction := range instructions {
+        for _, arg := range instruction.args {
+            for _, register := range register_pattern.FindAllString(arg, -1) {
+                if !temps[register] {
+                    continue
+                }
+                if j, ok := current[register]; ok && !defines(instruction, register) {
+                    ranges[j][1] = i
+                    continue
+                }
+                current[register] = len(ranges)
+                ranges = append(ranges, [2]int{i, i})
+            }
+        }
+    }
+    var max int
+    for i := range instructions {
+        var live int
+        for _, span := range ranges {
+            if span[0] <= i && i <= span[1] {
+                live++
+            }
+        }
+        if live > max {
+            max = live
+        }
+    }
+    return max
+}
+
+// returns statistics about the generated code
+func (backend *MIPSBackend) stats() Stats {
+    var (
+        stats   Stats = Stats{map[string]int{}, 0, 0, 0, 0, map[string]int{}, 0, -1}
+        unknown       = func(string) uint32 { return 0 }
+    )
+    for _, procedure := range backend.text_procedures(true) {
+        var instructions []Instruction = procedure.instructions()
+        stats.pressure[procedure.label] = backend.register_pressure(instructions)
+        stats.taken_branches += taken_branches(split_blocks(instructions[1:]))
+        for _, instruction := range instructions {
+            if strings.HasSuffix(instruction.opcode, ":") {
+                continue
+            }
+            for _, real := range expand(instruction, unknown) {
+                if real.opcode == "sll" && real.args[0] == "$zero" {
+                    // a delay slot
+                    real.opcode = "nop"
+                }
+                stats.opcodes[real.opcode]++
+                stats.cycles += 1 + opcode_table[real.opcode].latency
+                switch opcode_table[real.opcode].memory {
+                case "load":
+                    stats.loads++
+                case "store":
+                    stats.stores++
+                }
+            }
+        }
+    }
+    if backend.options.optimize >= 2 {
+        stats.taken_before_layout = backend.taken_before_layout
+    }
+    stats.data_bytes = len(layout_data(backend.rodata_section+backend.data_section, 0, map[string]uint32{}, backend.byte_order()))
+    return stats
+}
+
+// returns the keys of a map of counts, sorted
+func sorted_keys(counts map[string]int) []string {
+    var keys []string
+    for key := range counts {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func (stats Stats) String() string {
+    var (
+        total int
+        ret   string
+    )
+    for _, opcode := range sorted_keys(stats.opcodes) {
+        total += stats.opcodes[opcode]
+    }
+    ret += fmt.Sprintf("instructions: %d (%d loads, %d stores)\n", total, stats.loads, stats.stores)
+    for _, opcode := range sorted_keys(stats.opcodes) {
+        ret += fmt.Sprintf("    %-8s %d\n", opcode, stats.opcodes[opcode])
+    }
+    ret += fmt.Sprintf("data: %d bytes\n", stats.data_bytes)
+    ret += fmt.Sprintf("estimated cycles (each instruction once): %d\n", stats.cycles)
+    ret += fmt.Sprintf("taken branches (on the likely paths): %d", stats.taken_branches)
+    if stats.taken_before_layout != -1 {
+        ret += fmt.Sprintf(" (%d before block layout)", stats.taken_before_layout)
+    }
+    ret += "\n"
+    ret += "register pressure:\n"
+    for _, label := range sorted_keys(stats.pressure) {
+        ret += fmt.Sprintf("    %-8s %d\n", label, stats.pressure[label])
+    }
+    return ret
+}
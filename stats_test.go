@@ -0,0 +1,53 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+// the statistics of small programs, counted by hand from their
+// code; pseudo-instructions count as what they expand to (e.g. 'la'
+// as 'lui' and 'ori', and 'j $31' as 'jr' and a delay slot 'nop'),
+// loads and stores are the opcodes 'opcode_table' marks, and each
+// cycle estimate adds the latencies of the loads and of 'mul'
+func Test_stats(t *testing.T) {
+    var cases = map[string]struct {
+        program  Program
+        expected Stats
+    }{
+        "assignments": {Program{[]interface{}{
+            Assignment{"a", Integer{"5"}},
+            Assignment{"b", ArithmeticOp{Ident{"a"}, "addu", Integer{"3"}}},
+        }}, Stats{
+            map[string]int{"addiu": 2, "addu": 1, "jr": 1, "lw": 1, "nop": 1, "sw": 2},
+            1, 2, 0, 8 + 1, map[string]int{"main": 1}, 0, -1,
+        }},
+        // bytes are loads and stores too, and the strings (with their
+        // NULs) are the data
+        "strings": {Program{[]interface{}{
+            Assignment{"s", String{"abcdefg"}},
+            Call{"memcpy", []interface{}{Ident{"s"}, String{"xyz"}, Integer{"2"}}},
+            Call{"Printf", []interface{}{String{"%s\\n"}, Ident{"s"}}},
+        }}, Stats{
+            map[string]int{"addiu": 2, "addu": 2, "jr": 1, "lbu": 2, "lui": 3, "lw": 2, "nop": 1,
+                "ori": 3, "sb": 2, "sw": 1, "syscall": 2},
+            4, 3, 8 + 4 + 2, 21 + 4, map[string]int{"main": 3}, 0, -1,
+        }},
+        // 'f' holds three temporaries at once for 'x*y + (x-y)'
+        "function": {Program{[]interface{}{
+            Function{"f", []string{"x", "y"}, []interface{}{
+                Return{ArithmeticOp{ArithmeticOp{Ident{"x"}, "mul", Ident{"y"}}, "addu", ArithmeticOp{Ident{"x"}, "subu", Ident{"y"}}}},
+            }, false},
+            Assignment{"r", Call{"f", []interface{}{Integer{"6"}, Integer{"7"}}}},
+        }}, Stats{
+            map[string]int{"addiu": 4, "addu": 6, "j": 1, "jal": 1, "jr": 2, "lw": 5, "mul": 1, "nop": 4, "subu": 1, "sw": 4},
+            5, 4, 0, 29 + 5 + 4, map[string]int{"main": 2, "f": 3}, 0, -1,
+        }},
+    }
+    for name, test := range cases {
+        var backend MIPSBackend = new_mips_backend(test.program)
+        if stats := backend.stats(); !reflect.DeepEqual(stats, test.expected) {
+            t.Errorf("%s: the statistics are\n%s\nexpected\n%s", name, stats, test.expected)
+        }
+    }
+}
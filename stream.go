@@ -0,0 +1,117 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+)
+
+// generates a program one top-level node at a time, so that the
+// whole ast never has to be in memory (e.g. for machine-generated
+// programs, see 'decode_stream'); the nodes go through the same
+// passes as in 'generate', except that nothing can look ahead:
+// - enums, statics, and functions have to come before their uses
+// - immutable variables aren't folded into their uses (see
+// 'bind_all'), and every variable keeps its own stack slot
+// - the first node with errors panics with them (see 'check')
+type Stream struct {
+    backend MIPSBackend
+    binder  Binder
+    enums   EnumFolder
+    // the number of nodes added so far
+    count int
+}
+
+// 'Stream' constructor
+func new_stream(options BackendOptions) *Stream {
+    var stream *Stream = &Stream{blank_mips_backend(options), Binder{}, EnumFolder{map[string]EnumMember{}}, 0}
+    stream.binder = new_binder(&stream.backend.diagnostics)
+    return stream
+}
+
+// generates the next top-level node of the program
+func (stream *Stream) add(node interface{}) {
+    check_cancelled(stream.backend.options.context)
+    var validator Validator
+    validator.visit(node, fmt.Sprintf("Program.nodes[%d]", stream.count))
+    stream.count++
+    for _, violation := range validator.violations {
+        stream.backend.diagnostics.error(nil, "%s", violation)
+    }
+    stream.backend.diagnostics.check()
+    if enum, ok := node.(Enum); ok {
+        stream.enums.declare(enum)
+        return
+    }
+    node = stream.enums.fold(node)
+    if static, ok := node.(Static); ok {
+        stream.binder.statics[static.name] = static.kind
+        if static.value != "" {
+            stream.binder.convert_static(static.name, Integer{static.value}, static)
+        }
+        stream.backend.static_variable(&static)
+    }
+    node = stream.binder.bind(node)
+    stream.backend.diagnostics.check()
+    stream.backend.statement(node)
+}
+
+// finishes the program once every node is added, returning its code
+func (stream *Stream) finish() string {
+    stream.binder.report_unused(stream.binder.scopes[0])
+    stream.backend.__finish_main()
+    return stream.backend.assemble()
+}
+
+// reads a program (see 'decode_ast') from JSON without reading
+// all of it at once, passing each of its top-level nodes to 'add'
+// as soon as it's decoded; the program has to be written as:
+// {"node": "Program", "nodes": [...]}
+// (in that order, which 'encode_ast' always uses)
+func decode_stream(reader io.Reader, stream *Stream) error {
+    var (
+        decoder     *json.Decoder = json.NewDecoder(reader)
+        ast_decoder AstDecoder    = AstDecoder{stream.backend.options.context}
+    )
+    decoder.UseNumber()
+    // reads the next token, which has to be 'expected'
+    var expect = func(expected interface{}, what string) error {
+        token, err := decoder.Token()
+        if err != nil {
+            return err
+        }
+        if token != expected {
+            return fmt.Errorf("expected %s, got %v", what, token)
+        }
+        return nil
+    }
+    for _, step := range []struct {
+        token interface{}
+        what  string
+    }{
+        {json.Delim('{'), "a Program"},
+        {"node", `"node" first`},
+        {"Program", "a Program"},
+        {"nodes", `"nodes" after "node"`},
+        {json.Delim('['), "an array of nodes"},
+    } {
+        if err := expect(step.token, step.what); err != nil {
+            return err
+        }
+    }
+    for i := 0; decoder.More(); i++ {
+        var value interface{}
+        if err := decoder.Decode(&value); err != nil {
+            return err
+        }
+        node, err := ast_decoder.decode(value, fmt.Sprintf("$.nodes[%d]", i))
+        if err != nil {
+            return err
+        }
+        stream.add(node)
+    }
+    if err := expect(json.Delim(']'), "the end of the nodes"); err != nil {
+        return err
+    }
+    return expect(json.Delim('}'), "the end of the Program")
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+)
+
+// the operator each instruction computes, for 'symbolic_trace'
+var symbolic_operators = map[string]string{
+    "add": "+", "addu": "+", "addi": "+", "addiu": "+",
+    "sub": "-", "subu": "-", "mul": "*", "div": "/", "divu": "/",
+    "and": "&", "andi": "&", "or": "|", "ori": "|", "xor": "^", "xori": "^",
+    "slt": "<", "sltu": "<", "slti": "<", "sltiu": "<",
+    "sll": "<<", "sllv": "<<", "srl": ">>", "srlv": ">>", "sra": ">>", "srav": ">>",
+}
+
+// the comparison each branch makes
+var symbolic_branches = map[string]string{
+    "beq": "==", "bne": "!=", "beql": "==", "bnel": "!=",
+    "blez": "<= 0", "bgtz": "> 0", "bltz": "< 0", "bgez": ">= 0",
+}
+
+// expressions longer than this are shown as where they're kept
+const max_symbolic_length = 60
+
+// the state of symbolic execution (see 'symbolic_trace') at one
+// point of a procedure
+type Symbolic struct {
+    // the expression each register ("$t0", "$lo") and stack slot
+    // (relative to $sp on entry, e.g. "-8($sp)") holds; anything
+    // missing holds whatever it did on entry
+    values map[string]string
+    // how far $sp has moved since the procedure was entered
+    sp int64
+    // the variables of the procedure that live in each slot
+    // (several, if they share it, see '__free_slots')
+    names map[string][]string
+}
+
+// returns the location a register is kept under, which is the
+// same for every name it has (e.g. "$v0" and "$2")
+func symbolic_location(operand string) string {
+    if number, ok := register_numbers[operand]; ok {
+        return fmt.Sprintf("$%d", number)
+    }
+    return operand
+}
+
+// returns the expression an operand holds
+func (state *Symbolic) value(operand string) string {
+    if symbolic_location(operand) == "$0" {
+        return "0"
+    }
+    if value, ok := state.values[symbolic_location(operand)]; ok {
+        return value
+    }
+    // an immediate, a label, or a register that still holds
+    // what it did on entry
+    return operand
+}
+
+// returns the name of the stack slot a memory operand refers to,
+// or "" if it isn't in the frame
+func (state *Symbolic) slot(operand string) string {
+    offset, base, ok := split_memory(operand)
+    if !ok || base != "$sp" {
+        return ""
+    }
+    value, ok := parse_immediate(offset)
+    if !ok {
+        return ""
+    }
+    return fmt.Sprintf("%d($sp)", value+state.sp)
+}
+
+// sets what a register (or slot) holds; long expressions are
+// replaced by the location itself, which is easier to follow
+func (state *Symbolic) set(location string, expression string) string {
+    if len(expression) > max_symbolic_length {
+        expression = location
+    }
+    state.values[symbolic_location(location)] = expression
+    return expression
+}
+
+// returns the operand of a binary expression, in parentheses
+// unless it's a single term
+func symbolic_operand(expression string) string {
+    if strings.Contains(expression, " ") {
+        return "(" + expression + ")"
+    }
+    return expression
+}
+
+// executes an instruction symbolically, returning what it did
+// (e.g. "$t0 = 321 - 123"), or "" if it has no visible effect
+func (backend *MIPSBackend) __symbolic_step(state *Symbolic, instruction Instruction) string {
+    var args []string = operands(instruction)
+    // the expression of an operand
+    var value = func(i int) string {
+        return state.value(args[i])
+    }
+    switch opcode := instruction.opcode; {
+    case strings.HasSuffix(opcode, ":"):
+        // a join point, where the values depend on the way there
+        state.values = map[string]string{}
+        return ""
+    case opcode == "li" || opcode == "la":
+        return fmt.Sprintf("%s = %s", args[0], state.set(args[0], args[1]))
+    case opcode == "move":
+        return fmt.Sprintf("%s = %s", args[0], state.set(args[0], value(1)))
+    case (opcode == "addiu" || opcode == "addu") && args[0] == "$sp" && args[1] == "$sp":
+        amount, _ := parse_immediate(args[2])
+        state.sp += amount
+        return fmt.Sprintf("$sp moves by %d", amount)
+    case symbolic_operators[opcode] != "" && len(args) == 3:
+        var operator, right string = symbolic_operators[opcode], value(2)
+        if immediate, ok := parse_immediate(right); ok && operator == "+" && immediate < 0 {
+            // e.g. the 'addi' of a subtraction (see 'immediate_ops')
+            operator, right = "-", fmt.Sprint(-immediate)
+        }
+        var expression string = fmt.Sprintf("%s %s %s", symbolic_operand(value(1)), operator, symbolic_operand(right))
+        return fmt.Sprintf("%s = %s", args[0], state.set(args[0], expression))
+    case opcode == "div" || opcode == "divu":
+        state.set("$lo", fmt.Sprintf("%s / %s", symbolic_operand(value(0)), symbolic_operand(value(1))))
+        state.set("$hi", fmt.Sprintf("%s %% %s", symbolic_operand(value(0)), symbolic_operand(value(1))))
+        return fmt.Sprintf("$lo = %s", state.value("$lo"))
+    case opcode == "mult" || opcode == "multu":
+        return fmt.Sprintf("$lo = %s", state.set("$lo", fmt.Sprintf("%s * %s", symbolic_operand(value(0)), symbolic_operand(value(1)))))
+    case opcode_table[opcode].reads_hi_lo:
+        var from string = "$" + strings.TrimPrefix(opcode, "mf")
+        return fmt.Sprintf("%s = %s", args[0], state.set(args[0], state.value(from)))
+    case opcode_table[opcode].memory == "load":
+        if slot := state.slot(args[1]); slot != "" {
+            return fmt.Sprintf("%s = %s", args[0], state.set(args[0], state.value(slot)))
+        }
+        offset, base, ok := split_memory(args[1])
+        if !ok {
+            return fmt.Sprintf("%s = *%s", args[0], state.set(args[0], args[1]))
+        }
+        return fmt.Sprintf("%s = %s", args[0], state.set(args[0],
+            fmt.Sprintf("*(%s + %s)", state.value(base), offset)))
+    case opcode_table[opcode].memory == "store":
+        var slot string = state.slot(args[1])
+        if slot == "" {
+            return fmt.Sprintf("*%s = %s", args[1], value(0))
+        }
+        var target string = slot
+        if names := state.names[slot]; len(names) != 0 {
+            target = fmt.Sprintf("%s (%s)", slot, strings.Join(names, "/"))
+        }
+        return fmt.Sprintf("%s = %s", target, state.set(slot, value(0)))
+    case opcode == "j" || opcode == "jr":
+        if symbolic_location(args[0]) == "$31" {
+            return fmt.Sprintf("return %s", state.value("$v0"))
+        }
+        return fmt.Sprintf("goto %s", args[0])
+    case symbolic_branches[opcode] != "":
+        var condition string = fmt.Sprintf("%s %s", value(0), symbolic_branches[opcode])
+        if len(args) == 3 {
+            condition = fmt.Sprintf("%s %s %s", value(0), symbolic_branches[opcode], value(1))
+        }
+        return fmt.Sprintf("if %s goto %s", condition, args[len(args)-1])
+    case opcode == "jal" || opcode == "jalr" || opcode == "bal":
+        var (
+            callee   string = args[len(args)-1]
+            function        = backend.functions[callee]
+            call     []string
+        )
+        for i := range function.params {
+            if i < len(backend.target.convention.arg_registers) {
+                call = append(call, state.value(backend.target.convention.arg_registers[i]))
+            }
+        }
+        // the callee can change every temporary
+        for location := range state.values {
+            if strings.HasPrefix(location, "$") {
+                delete(state.values, location)
+            }
+        }
+        return fmt.Sprintf("$v0 = %s", state.set("$v0", fmt.Sprintf("%s(%s)", callee, strings.Join(call, ", "))))
+    case opcode == "syscall":
+        return fmt.Sprintf("$v0 = %s", state.set("$v0", fmt.Sprintf("syscall(%s)", state.value("$v0"))))
+    case len(args) != 0 && strings.HasPrefix(args[0], "$") && !opcode_table[opcode].reads_first &&
+        !strings.HasPrefix(opcode, "."):
+        var inputs []string
+        for i := 1; i < len(args); i++ {
+            inputs = append(inputs, value(i))
+        }
+        return fmt.Sprintf("%s = %s", args[0], state.set(args[0], fmt.Sprintf("%s(%s)", opcode, strings.Join(inputs, ", "))))
+    }
+    return ""
+}
+
+// returns the generated code with what each instruction computes
+// next to it, executed symbolically (for teaching); converts:
+// li $t0,321
+// addi $t0,$t0,-123
+// sw $t0,-4($sp)
+// =>
+// li $t0,321                    # $t0 = 321
+// addi $t0,$t0,-123             # $t0 = 321 - 123
+// sw $t0,-4($sp)                # -4($sp) (foo) = 321 - 123
+// every procedure starts from its entry, and values are forgotten
+// at labels, where they depend on the way there
+func (backend *MIPSBackend) symbolic_trace() string {
+    var ret strings.Builder
+    for _, procedure := range backend.text_procedures(true) {
+        var state Symbolic = Symbolic{map[string]string{}, 0, map[string][]string{}}
+        for _, slot := range backend.stack_slots {
+            if slot.procedure == procedure.label {
+                state.names[slot.location] = append(state.names[slot.location], slot.name)
+            }
+        }
+        for _, instruction := range procedure.instructions() {
+            if strings.HasSuffix(instruction.opcode, ":") {
+                backend.__symbolic_step(&state, instruction)
+                fmt.Fprintf(&ret, "    %s\n", instruction.opcode)
+                continue
+            }
+            var effect string = backend.__symbolic_step(&state, instruction)
+            if effect == "" {
+                fmt.Fprintf(&ret, "        %s\n", render_instruction(instruction))
+                continue
+            }
+            fmt.Fprintf(&ret, "        %-30s # %s\n", render_instruction(instruction), effect)
+        }
+    }
+    return ret.String()
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+    "fmt"
+)
+
+// everything the backend needs to know about a target
+type TargetConfig struct {
+    // the size of a register (and of a stack slot) in bytes
+    word_size uint
+    // the temporary registers expressions are evaluated in,
+    // in the order they are handed out
+    temp_registers []string
+    // registers the generated code never uses to hold values
+    // (so e.g. exception handlers don't need to save them)
+    reserved_registers map[string]bool
+    // syscall numbers; MARS uses its own numbering while linux
+    // (for running under qemu-mips) uses the o32 numbers, which
+    // start at 4000
+    syscalls map[string]int
+    // pseudo-instructions the target's assembler expands; the
+    // backend expands the others itself (see 'arithmetic_op')
+    pseudo_ops map[string]bool
+    // optional features the target supports; code that needs
+    // one of these must check for it with '__require_capability'
+    capabilities map[string]bool
+    // the byte order of binary output, by the name GNU tools
+    // use for it ("EB" or "EL")
+    byte_order string
+    // true if the assembler mustn't use $at either
+    reserve_at bool
+    // how functions are called, unless the 'calling_convention'
+    // option picks another one
+    convention CallingConvention
+}
+
+// how functions pass their arguments and results, and which
+// registers they have to preserve
+type CallingConvention struct {
+    // the registers the first arguments are passed in; the rest
+    // are stored in the caller's argument area (see 'user_call')
+    arg_registers []string
+    // the registers results are returned in; an int takes the
+    // first one
+    return_registers []string
+    // the registers a function has to preserve for its caller
+    // (which no target keeps temporaries in, see '__callee_saves'),
+    // and the ones a call can overwrite, so the caller spills the
+    // values it still needs from them (see 'user_call')
+    callee_saved map[string]bool
+    caller_saved map[string]bool
+    // the alignment of $sp at calls the ABI asks for, in bytes;
+    // the 'stack_alignment' option enforces it
+    stack_alignment uint
+    // the smallest argument area a caller reserves
+    min_argument_area uint
+    // the size of each argument's slot in the argument area, and
+    // whether the register arguments get one too (as in O32), so
+    // that the callee can store them next to the rest; calls to
+    // variadic functions always give them one, for 'VarArg'
+    arg_slot_size  uint
+    register_homes bool
+    // the ABI GNU as and ld are told about (see 'gas_abis')
+    gas_abi string
+}
+
+// every supported calling convention, by name
+var calling_conventions = map[string]CallingConvention{
+    "o32": {
+        []string{"$a0", "$a1", "$a2", "$a3"},
+        []string{"$v0", "$v1"},
+        map[string]bool{
+            "$s0": true, "$s1": true, "$s2": true, "$s3": true,
+            "$s4": true, "$s5": true, "$s6": true, "$s7": true, "$s8": true,
+        },
+        map[string]bool{
+            "$t0": true, "$t1": true, "$t2": true, "$t3": true, "$t4": true,
+            "$t5": true, "$t6": true, "$t7": true, "$t8": true, "$t9": true,
+            "$a0": true, "$a1": true, "$a2": true, "$a3": true, "$v0": true, "$v1": true,
+        },
+        8,
+        16,
+        4,
+        true,
+        "32",
+    },
+    // ints still take 32 bits (and so do pointers), but every
+    // register is 64 bits wide, and so is each argument's slot
+    "n32": {
+        []string{"$a0", "$a1", "$a2", "$a3", "$8", "$9", "$10", "$11"},
+        []string{"$v0", "$v1"},
+        map[string]bool{
+            "$s0": true, "$s1": true, "$s2": true, "$s3": true,
+            "$s4": true, "$s5": true, "$s6": true, "$s7": true, "$s8": true,
+        },
+        map[string]bool{
+            "$12": true, "$13": true, "$14": true, "$15": true, "$24": true, "$25": true,
+            "$a0": true, "$a1": true, "$a2": true, "$a3": true,
+            "$8": true, "$9": true, "$10": true, "$11": true, "$v0": true, "$v1": true,
+        },
+        16,
+        0,
+        8,
+        false,
+        "n32",
+    },
+}
+
+// calling conventions that aren't supported yet, and why
+var unsupported_conventions = map[string]string{
+    // every pointer (and $sp and $ra) would need 64-bit loads,
+    // stores and arithmetic ('ld', 'sd', 'daddiu', 'dla'), stack
+    // slots would have to be 8 bytes wide (see 'word_size'), and
+    // linux puts the program above 4 GiB, which 'Machine' can't
+    // run; until then N32 (the same argument registers, with
+    // 32-bit pointers) is the 64-bit ABI there is
+    "n64": "pointers would take 64 bits, which the generated code never uses yet (try n32)",
+}
+
+// the registers neither target lets the generated code use
+var mips_reserved_registers = map[string]bool{
+    "$zero": true, "$0": true, "$at": true, "$k0": true, "$k1": true, "$gp": true, "$sp": true,
+}
+
+// registers with a fixed role in the generated code (the arguments
+// and results of syscalls and the runtime library, and the static
+// link), which users can't reserve any more than the registers of
+// the calling convention
+var fixed_registers = []string{"$zero", "$v0", "$v1", "$a0", "$a1", "$a2", "$a3", "$sp", "$ra"}
+
+// the fewest temporary registers that still let every
+// construct be generated (e.g. assigning the result of an
+// arithmetic operation to a captured variable)
+const min_temp_registers int = 3
+
+// every supported target, by name
+var targets = map[string]TargetConfig{
+    "mars": {
+        4,
+        []string{"$t0", "$t1", "$t2", "$t3", "$t4", "$t5", "$t6", "$t7", "$t8", "$t9"},
+        mips_reserved_registers,
+        map[string]int{
+            "print_int":    1,
+            "print_float":  2,
+            "print_double": 3,
+            "print_string": 4,
+            "sbrk":         9,
+            "print_char":   11,
+            "open":         13,
+            "read":         14,
+            "write":        15,
+            "close":        16,
+            "time":         30,
+            "random_int":   41,
+            "random_range": 42,
+        },
+        map[string]bool{"li": true, "la": true, "move": true, "div": true, "bal": true},
+        map[string]bool{"ll_sc": true, "movn": true},
+        // MARS is little-endian
+        "EL",
+        false,
+        calling_conventions["o32"],
+    },
+    "linux": {
+        4,
+        []string{"$t0", "$t1", "$t2", "$t3", "$t4", "$t5", "$t6", "$t7", "$t8", "$t9"},
+        mips_reserved_registers,
+        map[string]int{
+            "exit":  4001,
+            "read":  4003,
+            "write": 4004,
+            "open":  4005,
+            "close": 4006,
+        },
+        map[string]bool{"li": true, "la": true, "move": true, "div": true, "bal": true},
+        map[string]bool{"ll_sc": true, "movn": true, "pic": true, "branch_likely": true, "seb": true, "gas": true, "libc": true, "bss": true, "rdata": true, "sections": true},
+        // as 'qemu-mips' expects
+        "EB",
+        false,
+        calling_conventions["o32"],
+    },
+    "linux-n32": {
+        4,
+        // $8-$11 pass arguments, and GNU as names $12-$15 differently
+        // for N32 than for O32, so the temporaries are numbered
+        []string{"$12", "$13", "$14", "$15", "$24", "$25"},
+        mips_reserved_registers,
+        map[string]int{
+            "exit":  6058,
+            "read":  6000,
+            "write": 6001,
+            "open":  6002,
+            "close": 6003,
+        },
+        map[string]bool{"li": true, "la": true, "move": true, "div": true, "bal": true},
+        map[string]bool{"ll_sc": true, "movn": true, "branch_likely": true, "seb": true, "gas": true, "libc": true, "bss": true, "rdata": true, "sections": true},
+        // as 'qemu-mipsn32' expects
+        "EB",
+        false,
+        calling_conventions["n32"],
+    },
+    // no operating system (and so no syscalls): the program runs
+    // straight from reset, e.g. in an emulator that loads a flat
+    // binary (see 'bare_metal_scaffold')
+    "bare": {
+        4,
+        []string{"$t0", "$t1", "$t2", "$t3", "$t4", "$t5", "$t6", "$t7", "$t8", "$t9"},
+        mips_reserved_registers,
+        map[string]int{},
+        map[string]bool{"li": true, "la": true, "move": true, "div": true, "bal": true},
+        map[string]bool{"ll_sc": true, "movn": true, "bare_metal": true, "bss": true, "rdata": true, "sections": true},
+        "EB",
+        false,
+        calling_conventions["o32"],
+    },
+}
+
+// returns the target with the 'reserved_registers' option applied:
+// reserved temporaries are never handed out, and reserving $at
+// makes the output start with '.set noat'; panics for registers
+// the backend can't do without, or if too few temporaries remain
+func reserve_registers(target TargetConfig, options BackendOptions) TargetConfig {
+    var (
+        reserved map[uint32]bool = map[uint32]bool{}
+        names    map[string]bool = map[string]bool{}
+        fixed    []string        = append(append(append([]string{}, fixed_registers...),
+            target.convention.arg_registers...), target.convention.return_registers...)
+    )
+    if options.pic {
+        // '__emit_call' needs $t9, and $gp points to the GOT
+        fixed = append(fixed, "$t9", "$gp")
+    } else if options.libc {
+        // C functions are called through $t9 (see '__emit_c_call')
+        fixed = append(fixed, "$t9")
+    }
+    for _, register := range options.reserved_registers {
+        var number uint32 = register_number(register)
+        for _, name := range fixed {
+            if register_numbers[name] == number {
+                panic(fmt.Sprintf("'%s' can't be reserved; the generated code needs it", register))
+            }
+        }
+        reserved[number] = true
+        names[register] = true
+    }
+    var temps []string
+    for _, register := range target.temp_registers {
+        if !reserved[register_number(register)] {
+            temps = append(temps, register)
+        }
+    }
+    if len(temps) < min_temp_registers {
+        panic(fmt.Sprintf("reserving %v leaves %d temporary register(s), but at least %d are needed",
+            options.reserved_registers, len(temps), min_temp_registers))
+    }
+    for name := range target.reserved_registers {
+        names[name] = true
+    }
+    target.temp_registers, target.reserved_registers = temps, names
+    target.reserve_at = reserved[register_numbers["$at"]]
+    return target
+}
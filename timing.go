@@ -0,0 +1,68 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+// a phase of compilation and how long it took altogether (a
+// phase can run more than once, e.g. once per module)
+type Phase struct {
+    name    string
+    elapsed time.Duration
+}
+
+// how long each phase of a compilation took (see '-time-report')
+type TimeReport struct {
+    // in the order they first ran
+    phases []Phase
+}
+
+// runs a phase, adding the time it took to the report; a nil
+// report just runs it
+func (report *TimeReport) time(name string, phase func()) {
+    if report == nil {
+        phase()
+        return
+    }
+    var start time.Time = time.Now()
+    phase()
+    var elapsed time.Duration = time.Since(start)
+    for i := range report.phases {
+        if report.phases[i].name == name {
+            report.phases[i].elapsed += elapsed
+            return
+        }
+    }
+    report.phases = append(report.phases, Phase{name, elapsed})
+}
+
+// returns the report as a table; e.g.:
+// parse                   0.412ms   20.1%
+// analysis                0.398ms   19.4%
+// codegen                 1.241ms   60.5%
+// total                   2.051ms
+func (report *TimeReport) String() string {
+    var (
+        total time.Duration
+        text  strings.Builder
+    )
+    for _, phase := range report.phases {
+        total += phase.elapsed
+    }
+    for _, phase := range report.phases {
+        var percent float64
+        if total != 0 {
+            percent = 100 * float64(phase.elapsed) / float64(total)
+        }
+        fmt.Fprintf(&text, "%-22s %8.3fms %6.1f%%\n", phase.name, milliseconds(phase.elapsed), percent)
+    }
+    fmt.Fprintf(&text, "%-22s %8.3fms\n", "total", milliseconds(total))
+    return text.String()
+}
+
+// returns a duration in (fractional) milliseconds
+func milliseconds(duration time.Duration) float64 {
+    return float64(duration) / float64(time.Millisecond)
+}
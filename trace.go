@@ -0,0 +1,48 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "os"
+    "strings"
+)
+
+// returns the logger '-trace' uses; every codegen decision is
+// logged at the debug level, which slog drops by default
+func trace_logger() *slog.Logger {
+    return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+// logs a codegen decision (see 'BackendOptions.logger') along
+// with the procedure it's made for; logs e.g.:
+// level=DEBUG msg=emit procedure=main instruction="li $t0,5"
+func (backend *MIPSBackend) __trace(message string, args ...interface{}) {
+    if backend.options.logger == nil {
+        return
+    }
+    var procedure string = backend.current_function
+    if procedure == "" {
+        procedure = "main"
+    }
+    backend.options.logger.Debug(message, append([]interface{}{"procedure", procedure}, args...)...)
+}
+
+// describes a node for the trace; converts:
+// Ident{"a"}
+// =>
+// Ident{name:a}
+// lists of statements (e.g. the bodies of functions) are left
+// out, since their nodes are visited on their own
+func describe_node(__node interface{}) string {
+    switch node := __node.(type) {
+    case Program:
+        return fmt.Sprintf("Program{%d node(s)}", len(node.nodes))
+    case Function:
+        return fmt.Sprintf("Function{name:%s params:%v}", node.name, node.params)
+    case If:
+        return "If"
+    case ExceptionHandler:
+        return "ExceptionHandler"
+    }
+    return strings.TrimPrefix(fmt.Sprintf("%T%+v", __node, __node), "main.")
+}
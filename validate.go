@@ -0,0 +1,199 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// a structural invariant an ast breaks, along with the path to
+// the node that breaks it (e.g. Program.nodes[0].value.left)
+type Violation struct {
+    path    string
+    message string
+}
+
+func (violation Violation) String() string {
+    return fmt.Sprintf("%s: %s", violation.path, violation.message)
+}
+
+// returns the name of a node's type (e.g. "Ident")
+func node_type(node interface{}) string {
+    return strings.TrimPrefix(fmt.Sprintf("%T", node), "main.")
+}
+
+// the state of validation
+type Validator struct {
+    violations []Violation
+}
+
+// records a violation at 'path'
+func (validator *Validator) report(path string, format string, args ...interface{}) {
+    validator.violations = append(validator.violations, Violation{path, fmt.Sprintf(format, args...)})
+}
+
+// checks that a name (of a variable, function, etc.) isn't empty
+func (validator *Validator) name(name string, path string) {
+    if name == "" {
+        validator.report(path, "name is empty")
+    }
+}
+
+// checks that an integer literal parses, and fits in a
+// register (signed or not)
+func (validator *Validator) integer(value string, path string) {
+    parsed, err := strconv.ParseInt(value, 0, 64)
+    if err != nil {
+        validator.report(path, "integer literal '%s' doesn't parse", value)
+    } else if parsed < math.MinInt32 || parsed > math.MaxUint32 {
+        validator.report(path, "integer literal '%s' doesn't fit in 32 bits", value)
+    }
+}
+
+// checks a node and its children; 'path' is where the node is
+func (validator *Validator) visit(__node interface{}, path string) {
+    switch node := __node.(type) {
+    case nil:
+        validator.report(path, "node is nil")
+    case Program:
+        validator.visit_all(node.nodes, path+".nodes")
+    case Ident:
+        validator.name(node.name, path+".name")
+    case Integer:
+        validator.integer(node.value, path+".value")
+    case String:
+    case Float:
+        value, err := strconv.ParseFloat(node.value, 8*int(float_directives[float_type(node)].size))
+        if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+            validator.report(path+".value", "floating-point literal '%s' doesn't parse, or doesn't fit in a %s",
+                node.value, float_type(node))
+        }
+    case StringArray:
+        if len(node.values) == 0 {
+            validator.report(path+".values", "arrays need at least one string")
+        }
+    case ArithmeticOp:
+        validator.visit(node.left, path+".left")
+        if _, ok := interpreted_ops[node.op]; !ok {
+            validator.report(path+".op", "unsupported operation '%s'", node.op)
+        }
+        validator.visit(node.right, path+".right")
+    case Assignment:
+        validator.name(node.name, path+".name")
+        validator.visit(node.value, path+".value")
+    case Let:
+        validator.name(node.name, path+".name")
+        validator.visit(node.value, path+".value")
+    case Var:
+        validator.name(node.name, path+".name")
+        validator.visit(node.value, path+".value")
+    case ExprStmt:
+        validator.visit(node.value, path+".value")
+    case Call:
+        validator.name(node.name, path+".name")
+        validator.visit_all(node.args, path+".args")
+    case Function:
+        validator.name(node.name, path+".name")
+        for i, param := range node.params {
+            validator.name(param, fmt.Sprintf("%s.params[%d]", path, i))
+        }
+        validator.visit_all(node.body, path+".body")
+    case Return:
+        // functions that don't return anything have nil values
+        if node.value != nil {
+            validator.visit(node.value, path+".value")
+        }
+    case If:
+        validator.visit(node.cond, path+".cond")
+        validator.visit_all(node.then, path+".then")
+        validator.visit_all(node.otherwise, path+".otherwise")
+    case Hint:
+        validator.visit(node.cond, path+".cond")
+    case VarArg:
+        validator.visit(node.index, path+".index")
+    case Cast:
+        validator.visit(node.value, path+".value")
+        if _, ok := cast_types[node.to]; !ok && node.to != "float" {
+            validator.report(path+".to", "unknown type '%s'", node.to)
+        }
+    case Index:
+        validator.visit(node.value, path+".value")
+        validator.visit(node.index, path+".index")
+    case Slice:
+        validator.visit(node.value, path+".value")
+        validator.visit(node.low, path+".low")
+        validator.visit(node.high, path+".high")
+    case Interp:
+        for i, part := range node.parts {
+            var part_path string = fmt.Sprintf("%s.parts[%d]", path, i)
+            switch part.(type) {
+            case String, Ident:
+                validator.visit(part, part_path)
+            default:
+                validator.report(part_path, "parts must be strings or identifiers, not %s", node_type(part))
+            }
+        }
+    case Static:
+        validator.name(node.name, path+".name")
+        if _, ok := cast_types[node.kind]; !ok {
+            validator.report(path+".kind", "unknown type '%s'", node.kind)
+        }
+        if node.value != "" {
+            validator.integer(node.value, path+".value")
+        }
+    case ExceptionHandler:
+        validator.visit_all(node.nodes, path+".nodes")
+    case Section:
+        if !valid_section.MatchString(node.name) {
+            validator.report(path+".name", "'%s' isn't the name of a section", node.name)
+        }
+        if node.address != "" {
+            validator.integer(node.address, path+".address")
+        }
+        for i, function := range node.functions {
+            validator.name(function, fmt.Sprintf("%s.functions[%d]", path, i))
+        }
+    case Raw:
+        for i, line := range node.lines {
+            if problem := raw_line_problem(node.placement, line); problem != "" {
+                validator.report(fmt.Sprintf("%s.lines[%d]", path, i), "%s", problem)
+            }
+        }
+    case Enum:
+        validator.name(node.name, path+".name")
+        for i, member := range node.members {
+            validator.name(member, fmt.Sprintf("%s.members[%d]", path, i))
+        }
+        for i, value := range node.values {
+            if value != "" {
+                validator.integer(value, fmt.Sprintf("%s.values[%d]", path, i))
+            }
+        }
+    default:
+        validator.report(path, "unknown node type %s", node_type(__node))
+    }
+}
+
+// checks every node of a list
+func (validator *Validator) visit_all(nodes []interface{}, path string) {
+    for i, node := range nodes {
+        validator.visit(node, fmt.Sprintf("%s[%d]", path, i))
+    }
+}
+
+// returns every violation of the invariants codegen relies on:
+// children that aren't nil, supported operations, integers that
+// parse (and fit), known types, and names that aren't empty;
+// converts:
+// Program{[]interface{}{Assignment{"a", ArithmeticOp{nil, "pow", Integer{"x"}}}}}
+// =>
+// Program.nodes[0].value.left: node is nil
+// Program.nodes[0].value.op: unsupported operation 'pow'
+// Program.nodes[0].value.right.value: integer literal 'x' doesn't parse
+// (see 'lower', which reports them as errors)
+func validate(ast interface{}) []Violation {
+    var validator Validator
+    validator.visit(ast, node_type(ast))
+    return validator.violations
+}
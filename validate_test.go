@@ -0,0 +1,101 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+// each invariant, with the path to the node that breaks it
+func Test_validate(t *testing.T) {
+    var cases = []struct {
+        ast      interface{}
+        expected []string
+    }{
+        {Program{[]interface{}{Assignment{"a", ArithmeticOp{nil, "pow", Integer{"x"}}}}}, []string{
+            "Program.nodes[0].value.left: node is nil",
+            "Program.nodes[0].value.op: unsupported operation 'pow'",
+            "Program.nodes[0].value.right.value: integer literal 'x' doesn't parse",
+        }},
+        {Program{[]interface{}{
+            Assignment{"a", Integer{"0xffffffff"}},
+            Assignment{"b", Integer{"-2147483648"}},
+            Assignment{"c", Integer{"4294967296"}},
+            Assignment{"d", Integer{"-2147483649"}},
+        }}, []string{
+            "Program.nodes[2].value.value: integer literal '4294967296' doesn't fit in 32 bits",
+            "Program.nodes[3].value.value: integer literal '-2147483649' doesn't fit in 32 bits",
+        }},
+        {Program{[]interface{}{
+            Assignment{"", Ident{""}},
+            Function{"f", []string{"x", ""}, []interface{}{Return{nil}, Return{Ident{"x"}}}, false},
+            ExprStmt{Call{"", []interface{}{nil}}},
+        }}, []string{
+            "Program.nodes[0].name: name is empty",
+            "Program.nodes[0].value.name: name is empty",
+            "Program.nodes[1].params[1]: name is empty",
+            "Program.nodes[2].value.name: name is empty",
+            "Program.nodes[2].value.args[0]: node is nil",
+        }},
+        {Program{[]interface{}{
+            If{Hint{nil, true}, []interface{}{Let{"x", nil}}, []interface{}{Var{"y", Cast{Integer{"1"}, "int24"}}}},
+        }}, []string{
+            "Program.nodes[0].cond.cond: node is nil",
+            "Program.nodes[0].then[0].value: node is nil",
+            "Program.nodes[0].otherwise[0].value.to: unknown type 'int24'",
+        }},
+        {Program{[]interface{}{
+            Assignment{"f", Float{"1e39", false}},
+            Assignment{"d", Float{"1e39", true}},
+            Assignment{"s", StringArray{[]string{}}},
+            Assignment{"i", Index{Ident{"s"}, nil}},
+            ExprStmt{Interp{[]interface{}{String{"x = "}, Integer{"1"}}}},
+        }}, []string{
+            "Program.nodes[0].value.value: floating-point literal '1e39' doesn't parse, or doesn't fit in a float",
+            "Program.nodes[2].value.values: arrays need at least one string",
+            "Program.nodes[3].value.index: node is nil",
+            "Program.nodes[4].value.parts[1]: parts must be strings or identifiers, not Integer",
+        }},
+        {Program{[]interface{}{
+            Static{"s", "int", ""},
+            Static{"t", "word", "1"},
+            Enum{"Colour", []string{"red", ""}, []string{"", "two"}},
+            Section{"fast code", "0x1000", []string{""}},
+            ExceptionHandler{[]interface{}{nil}},
+        }}, []string{
+            "Program.nodes[1].kind: unknown type 'word'",
+            "Program.nodes[2].members[1]: name is empty",
+            "Program.nodes[2].values[1]: integer literal 'two' doesn't parse",
+            "Program.nodes[3].name: 'fast code' isn't the name of a section",
+            "Program.nodes[3].functions[0]: name is empty",
+            "Program.nodes[4].nodes[0]: node is nil",
+        }},
+        {Program{[]interface{}{Raw{"middle", []string{"nop"}}, 5}}, []string{
+            "Program.nodes[0].lines[0]: unknown placement 'middle' (expected data, main or end)",
+            "Program.nodes[1]: unknown node type int",
+        }},
+        // the path starts at whatever node is validated
+        {ArithmeticOp{Integer{"1"}, "addu", nil}, []string{"ArithmeticOp.right: node is nil"}},
+    }
+    for _, test := range cases {
+        var violations []string
+        for _, violation := range validate(test.ast) {
+            violations = append(violations, violation.String())
+        }
+        if !reflect.DeepEqual(violations, test.expected) {
+            t.Errorf("%s\nhas the violations %q, expected %q", encode_ast(test.ast), violations, test.expected)
+        }
+    }
+    var valid Program = Program{[]interface{}{
+        Function{"f", []string{"x"}, []interface{}{Return{ArithmeticOp{Ident{"x"}, "mul", Integer{"-3"}}}}, false},
+        If{Hint{Ident{"a"}, false}, []interface{}{Assignment{"a", Call{"f", []interface{}{Integer{"2"}}}}}, nil},
+        Call{"Printf", []interface{}{String{"%d\\n"}, Ident{"a"}}},
+    }}
+    if violations := validate(valid); len(violations) != 0 {
+        t.Errorf("a valid program has the violations %v", violations)
+    }
+    // 'lower' reports them as errors, before anything else runs
+    _, diagnostics, ok := try_generate(cases[0].ast, default_backend_options())
+    if ok || len(diagnostics) != 3 || diagnostics[1] != "Error: "+cases[0].expected[1] {
+        t.Errorf("generating it reported %q (ok: %v)", diagnostics, ok)
+    }
+}
@@ -0,0 +1,78 @@
+//go:build js && wasm
+
+package main
+
+import (
+    "context"
+    "fmt"
+    "syscall/js"
+)
+
+func init() {
+    js_main = serve_js
+}
+
+// returns an option of 'scgCompile' as 'compile_options' expects
+// it; booleans are "1" or "0", and missing options are ""
+func js_option(options js.Value, name string) string {
+    if options.Type() != js.TypeObject {
+        return ""
+    }
+    var value js.Value = options.Get(name)
+    switch value.Type() {
+    case js.TypeString:
+        return value.String()
+    case js.TypeNumber:
+        return fmt.Sprint(value.Int())
+    case js.TypeBoolean:
+        if value.Bool() {
+            return "1"
+        }
+        return "0"
+    }
+    return ""
+}
+
+// scgCompile(source, options)
+// compiles a JSON ast (see 'decode_ast') for a page hosting the
+// generator (e.g. a playground), with the options of 'serve'
+// (e.g. {target: "linux", O: 2, Werror: true}); returns:
+// {assembly: "...", diagnostics: ["Warning: ..."], ok: true}
+func js_compile(this js.Value, args []js.Value) interface{} {
+    var source, options js.Value = js.Undefined(), js.Undefined()
+    if len(args) > 0 {
+        source = args[0]
+    }
+    if len(args) > 1 {
+        options = args[1]
+    }
+    var result = func(assembly string, diagnostics []string) interface{} {
+        var items []interface{} = []interface{}{}
+        for _, diagnostic := range diagnostics {
+            items = append(items, diagnostic)
+        }
+        return map[string]interface{}{"assembly": assembly, "diagnostics": items, "ok": assembly != ""}
+    }
+    if source.Type() != js.TypeString {
+        return result("", []string{"Error: the source has to be a string"})
+    }
+    backend_options, err := compile_options(func(name string) string { return js_option(options, name) })
+    if err != nil {
+        return result("", []string{fmt.Sprintf("Error: %v", err)})
+    }
+    var (
+        artifact    Artifact = new_compiler(backend_options).compile(context.Background(), []byte(source.String()))
+        diagnostics []string
+    )
+    for _, diagnostic := range artifact.diagnostics {
+        diagnostics = append(diagnostics, diagnostic.String())
+    }
+    return result(artifact.assembly, diagnostics)
+}
+
+// makes 'scgCompile' (see 'js_compile') a global of the page,
+// and keeps the program running so that it can be called
+func serve_js() {
+    js.Global().Set("scgCompile", js.FuncOf(js_compile))
+    select {}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "time"
+)
+
+// how often 'watch' checks its input for changes
+const watch_interval = 500 * time.Millisecond
+
+// the state of watching an input (see 'watch')
+type Watcher struct {
+    input   string
+    options BackendOptions
+    // how long each regeneration may take (0 for no limit); every
+    // one gets a deadline of its own
+    timeout time.Duration
+    write   func(assembly string)
+    // where the changes go, and where problems go
+    stdout, stderr io.Writer
+    modified       time.Time
+    problem        string
+    previous       []string
+}
+
+// reports a problem once, rather than every time the file is checked
+func (watcher *Watcher) report(message string) {
+    if message != watcher.problem {
+        fmt.Fprintln(watcher.stderr, message)
+    }
+    watcher.problem = message
+}
+
+// regenerates the program if its file changed since the last check
+func (watcher *Watcher) check() {
+    info, err := os.Stat(watcher.input)
+    if err != nil {
+        watcher.report(err.Error())
+        return
+    }
+    if info.ModTime().Equal(watcher.modified) {
+        return
+    }
+    watcher.modified, watcher.problem = info.ModTime(), ""
+    data, err := os.ReadFile(watcher.input)
+    if err != nil {
+        watcher.report(err.Error())
+        return
+    }
+    var options BackendOptions = watcher.options
+    if watcher.timeout != 0 {
+        var cancel context.CancelFunc
+        options.context, cancel = context.WithTimeout(options.context, watcher.timeout)
+        defer cancel()
+    }
+    ast, err := decode_ast_with(options.context, data)
+    if err != nil {
+        watcher.report(fmt.Sprintf("%s: %v", watcher.input, err))
+        return
+    }
+    backend, diagnostics, ok := try_generate(ast, options)
+    fmt.Fprintf(watcher.stdout, "== %s (%s)\n", watcher.input, watcher.modified.Format(time.TimeOnly))
+    for _, diagnostic := range diagnostics {
+        fmt.Fprintln(watcher.stdout, diagnostic)
+    }
+    if !ok {
+        return
+    }
+    var (
+        assembly string   = backend.assemble() + "\n"
+        lines    []string = strings.Split(strings.TrimRight(assembly, "\n"), "\n")
+    )
+    for _, change := range diff_lines(watcher.previous, lines) {
+        fmt.Fprintln(watcher.stdout, change)
+    }
+    watcher.previous = lines
+    watcher.write(assembly)
+}
+
+// scg build -watch ast.json
+// regenerates the program whenever its file changes, printing how
+// the assembly changed (see 'diff_lines'), and handing the new
+// assembly to 'write' (e.g. to update the -o file); a program with
+// errors is reported, and the last one that compiled is kept. runs
+// until it's interrupted
+func watch(input string, options BackendOptions, timeout time.Duration, write func(assembly string)) {
+    var watcher Watcher = Watcher{input, options, timeout, write, os.Stdout, os.Stderr, time.Time{}, "", nil}
+    for ; ; time.Sleep(watch_interval) {
+        watcher.check()
+    }
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// every regeneration gets its own -timeout, so that rebuilds still
+// work once the first one's deadline has passed
+func Test_watch_timeout(t *testing.T) {
+    var (
+        input    string = filepath.Join(t.TempDir(), "prog.json")
+        written  []string
+        stdout   bytes.Buffer
+        stderr   bytes.Buffer
+        timeout  time.Duration = 50 * time.Millisecond
+        modified time.Time     = time.Now()
+    )
+    var watcher Watcher = Watcher{input, default_backend_options(), timeout,
+        func(assembly string) { written = append(written, assembly) }, &stdout, &stderr, time.Time{}, "", nil}
+    for i, value := range []string{"1", "2", "3"} {
+        var program Program = Program{[]interface{}{Call{"Printf", []interface{}{String{"%d\\n"}, Integer{value}}}}}
+        if err := os.WriteFile(input, []byte(encode_ast(program)), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        // the file system may not tell writes this close apart
+        modified = modified.Add(time.Second)
+        if err := os.Chtimes(input, modified, modified); err != nil {
+            t.Fatal(err)
+        }
+        watcher.check()
+        if len(written) != i+1 || !strings.Contains(written[i], "li $t0,"+value) {
+            t.Fatalf("regeneration %d wrote %d program(s):\n%s%s", i+1, len(written), stdout.String(), stderr.String())
+        }
+        time.Sleep(2 * timeout)
+    }
+    if strings.Contains(stdout.String(), "compilation stopped") || stderr.Len() != 0 {
+        t.Errorf("watching printed:\n%s%s", stdout.String(), stderr.String())
+    }
+    // nothing changed, so nothing is regenerated
+    watcher.check()
+    if len(written) != 3 {
+        t.Errorf("an unchanged file was regenerated")
+    }
+}